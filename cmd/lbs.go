@@ -3,35 +3,170 @@ package main
 import (
 	"fmt"
 	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
 
 	"github.com/ledgerhq/bitcoin-lib-grpc/config"
 
 	controllers "github.com/ledgerhq/bitcoin-lib-grpc/grpc"
 	"github.com/ledgerhq/bitcoin-lib-grpc/log"
 	pb "github.com/ledgerhq/bitcoin-lib-grpc/pb/bitcoin"
+	"github.com/spf13/viper"
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/keepalive"
 	"google.golang.org/grpc/reflection"
 )
 
-func serve(addr string) {
+// newServer returns a gRPC server with the coin and health services
+// registered, configured with the given server options. Unary and
+// streaming RPCs are recorded in metrics, and logged with the application
+// logger. Panics in handlers are recovered first, so that they are recorded
+// as Internal errors.
+//
+// The server reflection service, which exposes the full schema of the
+// services, is only registered if enableReflection is set.
+func newServer(
+	limits controllers.Limits,
+	metrics *controllers.Metrics,
+	enableReflection bool,
+	opts ...grpc.ServerOption,
+) *grpc.Server {
+	opts = append(opts, grpc.ChainUnaryInterceptor(
+		metrics.UnaryInterceptor(),
+		controllers.LoggingInterceptor(log.WithFields),
+		controllers.RecoveryInterceptor(),
+	), grpc.ChainStreamInterceptor(
+		metrics.StreamInterceptor(),
+		controllers.LoggingStreamInterceptor(log.WithFields),
+		controllers.RecoveryStreamInterceptor(),
+	))
+
+	s := grpc.NewServer(opts...)
+	bitcoinController := controllers.NewBitcoinControllerWithLimits(limits)
+	healthController := controllers.NewHealthChecker()
+
+	pb.RegisterCoinServiceServer(s, bitcoinController)
+	grpc_health_v1.RegisterHealthServer(s, healthController)
+
+	if enableReflection {
+		reflection.Register(s)
+	}
+
+	return s
+}
+
+// serveMetrics serves the metrics on the /metrics endpoint of an HTTP
+// server.
+func serveMetrics(addr string, metrics *controllers.Metrics) {
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", metrics)
+
+	if err := http.ListenAndServe(addr, mux); err != nil {
+		log.Fatalf("Failed to serve metrics: %v", err)
+	}
+}
+
+// gracefulStop stops the server from accepting new connections and RPCs,
+// and waits for the in-flight RPCs to complete. If they are still pending
+// after the timeout, the remaining connections are closed with Stop.
+func gracefulStop(s *grpc.Server, timeout time.Duration) {
+	stopped := make(chan struct{})
+
+	go func() {
+		s.GracefulStop()
+		close(stopped)
+	}()
+
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+
+	select {
+	case <-stopped:
+	case <-timer.C:
+		log.Warnf("Graceful shutdown timed out after %s, closing remaining connections", timeout)
+		s.Stop()
+	}
+}
+
+// serve serves the gRPC server on addr, and the metrics on metricsAddr,
+// until SIGINT or SIGTERM is received. The server is then stopped
+// gracefully, waiting up to shutdownTimeout for the in-flight RPCs.
+func serve(
+	addr string,
+	metricsAddr string,
+	limits controllers.Limits,
+	enableReflection bool,
+	shutdownTimeout time.Duration,
+	opts ...grpc.ServerOption,
+) {
 	conn, err := net.Listen("tcp", addr)
 	if err != nil {
 		log.Fatalf("Cannot listen to address %s", addr)
 	}
 
-	s := grpc.NewServer()
-	bitcoinController := controllers.NewBitcoinController()
-	healthController := controllers.NewHealthChecker()
+	metrics := controllers.NewMetrics()
+	go serveMetrics(metricsAddr, metrics)
 
-	pb.RegisterCoinServiceServer(s, bitcoinController)
-	grpc_health_v1.RegisterHealthServer(s, healthController)
+	s := newServer(limits, metrics, enableReflection, opts...)
+
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGINT, syscall.SIGTERM)
 
-	reflection.Register(s)
+	stopped := make(chan struct{})
+
+	go func() {
+		sig := <-signals
+		log.Infof("Received %s, shutting down gracefully", sig)
+
+		gracefulStop(s, shutdownTimeout)
+		close(stopped)
+	}()
 
 	if err := s.Serve(conn); err != nil {
 		log.Fatalf("Failed to serve: %v", err)
 	}
+
+	// Serve returns as soon as the listener is closed, while the in-flight
+	// RPCs may still be running.
+	<-stopped
+
+	log.Info("Server stopped")
+}
+
+// loadLimits returns the default limits of the controllers, overridden by
+// the ones set in the configuration. An explicit 0 disables a limit.
+func loadLimits(configProvider *viper.Viper) controllers.Limits {
+	limits := controllers.DefaultLimits
+
+	if configProvider.IsSet("max_derivation_depth") {
+		limits.MaxDerivationDepth = configProvider.GetInt("max_derivation_depth")
+	}
+
+	if configProvider.IsSet("max_inputs") {
+		limits.MaxInputs = configProvider.GetInt("max_inputs")
+	}
+
+	if configProvider.IsSet("max_outputs") {
+		limits.MaxOutputs = configProvider.GetInt("max_outputs")
+	}
+
+	if configProvider.IsSet("max_fee_sat_per_kb") {
+		limits.MaxFeeSatPerKb = configProvider.GetInt64("max_fee_sat_per_kb")
+	}
+
+	if configProvider.IsSet("max_batch_size") {
+		limits.MaxBatchSize = configProvider.GetInt("max_batch_size")
+	}
+
+	if configProvider.IsSet("max_address_count") {
+		limits.MaxAddressCount = configProvider.GetInt("max_address_count")
+	}
+
+	return limits
 }
 
 func main() {
@@ -49,6 +184,26 @@ func main() {
 	}
 
 	addr := fmt.Sprintf("%s:%d", host, port)
+	metricsAddr := fmt.Sprintf("%s:%d", host, configProvider.GetInt32("metrics_port"))
+
+	limits := loadLimits(configProvider)
+
+	serverOptions := []grpc.ServerOption{
+		grpc.MaxRecvMsgSize(configProvider.GetInt("max_recv_msg_size")),
+		grpc.MaxSendMsgSize(configProvider.GetInt("max_send_msg_size")),
+		grpc.KeepaliveParams(keepalive.ServerParameters{
+			MaxConnectionIdle: configProvider.GetDuration("keepalive_max_connection_idle"),
+			Time:              configProvider.GetDuration("keepalive_time"),
+			Timeout:           configProvider.GetDuration("keepalive_timeout"),
+		}),
+		grpc.KeepaliveEnforcementPolicy(keepalive.EnforcementPolicy{
+			MinTime:             configProvider.GetDuration("keepalive_min_time"),
+			PermitWithoutStream: configProvider.GetBool("keepalive_permit_without_stream"),
+		}),
+	}
+
+	enableReflection := configProvider.GetBool("enable_reflection")
+	shutdownTimeout := configProvider.GetDuration("shutdown_timeout")
 
-	serve(addr)
+	serve(addr, metricsAddr, limits, enableReflection, shutdownTimeout, serverOptions...)
 }
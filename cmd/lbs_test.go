@@ -0,0 +1,330 @@
+package main
+
+import (
+	"context"
+	"net"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ledgerhq/bitcoin-lib-grpc/config"
+	controllers "github.com/ledgerhq/bitcoin-lib-grpc/grpc"
+	pb "github.com/ledgerhq/bitcoin-lib-grpc/pb/bitcoin"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/connectivity"
+	"google.golang.org/grpc/keepalive"
+	rpb "google.golang.org/grpc/reflection/grpc_reflection_v1alpha"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+)
+
+// dialServer serves s on an in-memory listener, and returns a client
+// connected to it, accepting messages of up to maxMsgSize bytes.
+func dialServer(t *testing.T, s *grpc.Server, maxMsgSize int) pb.CoinServiceClient {
+	return pb.NewCoinServiceClient(dialConn(t, s, maxMsgSize))
+}
+
+// dialConn serves s on an in-memory listener, and returns a connection to
+// it, accepting messages of up to maxMsgSize bytes.
+func dialConn(t *testing.T, s *grpc.Server, maxMsgSize int) *grpc.ClientConn {
+	return dialListener(t, serveListener(t, s), maxMsgSize)
+}
+
+// serveListener serves s on an in-memory listener, and returns the
+// listener.
+func serveListener(t *testing.T, s *grpc.Server) *bufconn.Listener {
+	listener := bufconn.Listen(1024 * 1024)
+
+	go func() {
+		_ = s.Serve(listener)
+	}()
+
+	t.Cleanup(s.Stop)
+
+	return listener
+}
+
+// dialListener returns a connection to an in-memory listener, accepting
+// messages of up to maxMsgSize bytes.
+func dialListener(t *testing.T, listener *bufconn.Listener, maxMsgSize int) *grpc.ClientConn {
+	conn, err := grpc.Dial("bufnet",
+		grpc.WithContextDialer(func(context.Context, string) (net.Conn, error) {
+			return listener.Dial()
+		}),
+		grpc.WithInsecure(),
+		grpc.WithDefaultCallOptions(
+			grpc.MaxCallRecvMsgSize(maxMsgSize),
+			grpc.MaxCallSendMsgSize(maxMsgSize),
+		),
+	)
+	if err != nil {
+		t.Fatalf("failed to dial bufnet: %v", err)
+	}
+
+	t.Cleanup(func() { _ = conn.Close() })
+
+	return conn
+}
+
+func TestNewServer_MaxRecvMsgSize(t *testing.T) {
+	const maxMsgSize = 16 * 1024 * 1024
+
+	// A request above the default receive limit of 4MB.
+	request := &pb.ValidateAddressRequest{
+		Address: strings.Repeat("1", 5*1024*1024),
+		ChainParams: &pb.ChainParams{
+			Network: &pb.ChainParams_BitcoinNetwork{
+				BitcoinNetwork: pb.BitcoinNetwork_BITCOIN_NETWORK_MAINNET,
+			},
+		},
+	}
+
+	client := dialServer(t, newServer(controllers.DefaultLimits, controllers.NewMetrics(), true), maxMsgSize)
+
+	_, err := client.ValidateAddress(context.Background(), request)
+	if status.Code(err) != codes.ResourceExhausted {
+		t.Fatalf("ValidateAddress() got error '%v' with default limit, want code %s",
+			err, codes.ResourceExhausted)
+	}
+
+	client = dialServer(t, newServer(controllers.DefaultLimits, controllers.NewMetrics(), true,
+		grpc.MaxRecvMsgSize(maxMsgSize)), maxMsgSize)
+
+	response, err := client.ValidateAddress(context.Background(), request)
+	if err != nil {
+		t.Fatalf("ValidateAddress() got error '%v' with overridden limit", err)
+	}
+
+	if response.IsValid {
+		t.Fatalf("ValidateAddress() got valid address, want invalid")
+	}
+}
+
+func TestNewServer_EnableReflection(t *testing.T) {
+	tests := []struct {
+		name             string
+		enableReflection bool
+		wantCode         codes.Code
+	}{
+		{
+			name:             "enabled",
+			enableReflection: true,
+			wantCode:         codes.OK,
+		},
+		{
+			name:             "disabled",
+			enableReflection: false,
+			wantCode:         codes.Unimplemented,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newServer(controllers.DefaultLimits, controllers.NewMetrics(), tt.enableReflection)
+			client := rpb.NewServerReflectionClient(dialConn(t, s, 4*1024*1024))
+
+			stream, err := client.ServerReflectionInfo(context.Background())
+			if err != nil {
+				t.Fatalf("ServerReflectionInfo() got error '%v'", err)
+			}
+
+			err = stream.Send(&rpb.ServerReflectionRequest{
+				MessageRequest: &rpb.ServerReflectionRequest_ListServices{},
+			})
+			if err != nil {
+				t.Fatalf("Send() got error '%v'", err)
+			}
+
+			response, err := stream.Recv()
+			if status.Code(err) != tt.wantCode {
+				t.Fatalf("Recv() got error '%v', want code %s", err, tt.wantCode)
+			}
+
+			if tt.wantCode != codes.OK {
+				return
+			}
+
+			services := make(map[string]bool)
+			for _, service := range response.GetListServicesResponse().GetService() {
+				services[service.Name] = true
+			}
+
+			if !services["pb.bitcoin.CoinService"] {
+				t.Fatalf("ListServices() got %v, want pb.bitcoin.CoinService", services)
+			}
+		})
+	}
+}
+
+// blockingInterceptor returns a unary server interceptor that closes
+// started when an RPC is received, and waits for release to be closed
+// before handling it.
+func blockingInterceptor(started, release chan struct{}) grpc.ServerOption {
+	return grpc.ChainUnaryInterceptor(func(
+		ctx context.Context,
+		req interface{},
+		info *grpc.UnaryServerInfo,
+		handler grpc.UnaryHandler,
+	) (interface{}, error) {
+		close(started)
+		<-release
+
+		return handler(ctx, req)
+	})
+}
+
+var shutdownRequest = &pb.ValidateAddressRequest{
+	Address: "bc1qhm6697d9d2224vfyt8mj4kw03ncec7a7fdafvt",
+	ChainParams: &pb.ChainParams{
+		Network: &pb.ChainParams_BitcoinNetwork{
+			BitcoinNetwork: pb.BitcoinNetwork_BITCOIN_NETWORK_MAINNET,
+		},
+	},
+}
+
+func TestGracefulStop(t *testing.T) {
+	const maxMsgSize = 4 * 1024 * 1024
+
+	started := make(chan struct{})
+	release := make(chan struct{})
+
+	s := newServer(controllers.DefaultLimits, controllers.NewMetrics(), true,
+		blockingInterceptor(started, release))
+	listener := serveListener(t, s)
+	client := pb.NewCoinServiceClient(dialListener(t, listener, maxMsgSize))
+
+	errs := make(chan error, 1)
+
+	go func() {
+		_, err := client.ValidateAddress(context.Background(), shutdownRequest)
+		errs <- err
+	}()
+
+	<-started
+
+	stopped := make(chan struct{})
+
+	go func() {
+		gracefulStop(s, time.Minute)
+		close(stopped)
+	}()
+
+	// The listener is closed as soon as the graceful shutdown starts.
+	deadline := time.Now().Add(5 * time.Second)
+
+	for {
+		conn, err := listener.Dial()
+		if err != nil {
+			break
+		}
+
+		_ = conn.Close()
+
+		if time.Now().After(deadline) {
+			t.Fatalf("listener still accepts connections during graceful shutdown")
+		}
+
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	newClient := pb.NewCoinServiceClient(dialListener(t, listener, maxMsgSize))
+
+	_, err := newClient.ValidateAddress(context.Background(), shutdownRequest)
+	if status.Code(err) != codes.Unavailable {
+		t.Fatalf("ValidateAddress() on new connection got error '%v', want code %s",
+			err, codes.Unavailable)
+	}
+
+	select {
+	case <-stopped:
+		t.Fatalf("gracefulStop() returned before the in-flight RPC completed")
+	default:
+	}
+
+	close(release)
+
+	if err := <-errs; err != nil {
+		t.Fatalf("ValidateAddress() in flight got error '%v'", err)
+	}
+
+	<-stopped
+}
+
+func TestNewServer_KeepaliveMaxConnectionIdle(t *testing.T) {
+	s := newServer(controllers.DefaultLimits, controllers.NewMetrics(), true,
+		grpc.KeepaliveParams(keepalive.ServerParameters{
+			MaxConnectionIdle: 100 * time.Millisecond,
+		}))
+	conn := dialConn(t, s, 4*1024*1024)
+
+	_, err := pb.NewCoinServiceClient(conn).ValidateAddress(context.Background(), shutdownRequest)
+	if err != nil {
+		t.Fatalf("ValidateAddress() got error '%v'", err)
+	}
+
+	if state := conn.GetState(); state != connectivity.Ready {
+		t.Fatalf("connection got state %s after RPC, want %s", state, connectivity.Ready)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	// The server closes the idle connection, which leaves the Ready state.
+	if !conn.WaitForStateChange(ctx, connectivity.Ready) {
+		t.Fatalf("idle connection still %s after %s", connectivity.Ready, 5*time.Second)
+	}
+}
+
+func TestLoadLimits(t *testing.T) {
+	tests := []struct {
+		name string
+		env  map[string]string
+		want controllers.Limits
+	}{
+		{
+			name: "defaults",
+			want: controllers.DefaultLimits,
+		},
+		{
+			name: "overridden limits",
+			env: map[string]string{
+				"BITCOIN_MAX_INPUTS":        "10",
+				"BITCOIN_MAX_ADDRESS_COUNT": "20",
+			},
+			want: func() controllers.Limits {
+				limits := controllers.DefaultLimits
+				limits.MaxInputs = 10
+				limits.MaxAddressCount = 20
+				return limits
+			}(),
+		},
+		{
+			name: "disabled limits",
+			env: map[string]string{
+				"BITCOIN_MAX_DERIVATION_DEPTH": "0",
+				"BITCOIN_MAX_INPUTS":           "0",
+				"BITCOIN_MAX_OUTPUTS":          "0",
+				"BITCOIN_MAX_FEE_SAT_PER_KB":   "0",
+				"BITCOIN_MAX_BATCH_SIZE":       "0",
+				"BITCOIN_MAX_ADDRESS_COUNT":    "0",
+			},
+			want: controllers.Limits{},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for key, value := range tt.env {
+				os.Setenv(key, value)
+				defer os.Unsetenv(key)
+			}
+
+			got := loadLimits(config.LoadProvider("bitcoin"))
+			if got != tt.want {
+				t.Fatalf("loadLimits() got %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
@@ -1,6 +1,9 @@
 package config
 
 import (
+	"math"
+	"time"
+
 	"github.com/spf13/viper"
 )
 
@@ -19,5 +22,34 @@ func readViperConfig(appName string) *viper.Viper {
 	v.SetDefault("json_logs", false)
 	v.SetDefault("loglevel", "debug")
 
+	// gRPC message size limits, in bytes. The defaults are the ones of gRPC.
+	v.SetDefault("max_recv_msg_size", 4*1024*1024)
+	v.SetDefault("max_send_msg_size", math.MaxInt32)
+
+	// Port of the HTTP server of the /metrics endpoint.
+	v.SetDefault("metrics_port", 9090)
+
+	// Register the gRPC server reflection service, which exposes the full
+	// schema of the services. It can be disabled in hardened deployments.
+	v.SetDefault("enable_reflection", true)
+
+	// Maximum time to wait for in-flight RPCs on SIGINT or SIGTERM, before
+	// the remaining connections are closed.
+	v.SetDefault("shutdown_timeout", 30*time.Second)
+
+	// Keepalive of the gRPC connections. Idle connections are closed after
+	// keepalive_max_connection_idle, 0 disabling it. The server pings the
+	// clients after keepalive_time without activity, and closes the
+	// connection if the ping is not acknowledged within keepalive_timeout.
+	v.SetDefault("keepalive_max_connection_idle", time.Duration(0))
+	v.SetDefault("keepalive_time", 2*time.Hour)
+	v.SetDefault("keepalive_timeout", 20*time.Second)
+
+	// Keepalive enforcement policy: clients pinging more often than
+	// keepalive_min_time, or without active RPCs unless
+	// keepalive_permit_without_stream is set, are disconnected.
+	v.SetDefault("keepalive_min_time", 5*time.Minute)
+	v.SetDefault("keepalive_permit_without_stream", false)
+
 	return v
 }
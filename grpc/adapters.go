@@ -4,7 +4,7 @@ import (
 	"encoding/hex"
 	"strconv"
 
-	"github.com/btcsuite/btcutil"
+	"github.com/btcsuite/btcd/btcutil"
 	pb "github.com/ledgerhq/bitcoin-lib-grpc/pb/bitcoin"
 	"github.com/ledgerhq/bitcoin-lib-grpc/pkg/chaincfg"
 	"github.com/ledgerhq/bitcoin-lib-grpc/pkg/core"
@@ -19,11 +19,24 @@ func ChainParams(chainParams *pb.ChainParams) (chaincfg.ChainParams, error) {
 		return chaincfg.BitcoinTestNet3Params, nil
 	case pb.BitcoinNetwork_BITCOIN_NETWORK_REGTEST:
 		return chaincfg.BitcoinRegressionNetParams, nil
+	case pb.BitcoinNetwork_BITCOIN_NETWORK_TESTNET4:
+		return chaincfg.BitcoinTestNet4Params, nil
+	}
+
+	switch network := chainParams.GetBitcoinCashNetwork(); network {
+	case pb.BitcoinCashNetwork_BITCOIN_CASH_NETWORK_MAINNET:
+		return chaincfg.BitcoinCashMainNetParams, nil
+	case pb.BitcoinCashNetwork_BITCOIN_CASH_NETWORK_TESTNET3:
+		return chaincfg.BitcoinCashTestNet3Params, nil
 	}
 
 	switch network := chainParams.GetLitecoinNetwork(); network {
 	case pb.LitecoinNetwork_LITECOIN_NETWORK_MAINNET:
 		return chaincfg.LitecoinMainNetParams, nil
+	case pb.LitecoinNetwork_LITECOIN_NETWORK_TESTNET4:
+		return chaincfg.LitecoinTestNet4Params, nil
+	case pb.LitecoinNetwork_LITECOIN_NETWORK_REGTEST:
+		return chaincfg.LitecoinRegTestParams, nil
 	default:
 		return nil, errors.Wrapf(ErrUnknownNetwork,
 			"failed to decode chain params from network %s", network.String())
@@ -38,6 +51,8 @@ func BitcoinAddressEncoding(encoding pb.AddressEncoding) (core.AddressEncoding,
 		return core.WrappedSegwit, nil
 	case pb.AddressEncoding_ADDRESS_ENCODING_P2WPKH:
 		return core.NativeSegwit, nil
+	case pb.AddressEncoding_ADDRESS_ENCODING_P2TR:
+		return core.Taproot, nil
 	case pb.AddressEncoding_ADDRESS_ENCODING_UNSPECIFIED:
 		return -1, errors.Wrapf(core.ErrUnknownAddressType,
 			"invalid address encoding %s", encoding)
@@ -47,19 +62,105 @@ func BitcoinAddressEncoding(encoding pb.AddressEncoding) (core.AddressEncoding,
 	}
 }
 
-// Tx is an adapter function to build a *core.Tx object from a gRPC message.
-// It also converts raw gRPC values to a format that is acceptable to btcd.
-func Tx(txProto *pb.CreateTransactionRequest) (*core.Tx, error) {
+// AddressEncodingProto is an adapter function to convert a
+// core.AddressEncoding to a gRPC AddressEncoding enum.
+func AddressEncodingProto(encoding core.AddressEncoding) pb.AddressEncoding {
+	switch encoding {
+	case core.Legacy:
+		return pb.AddressEncoding_ADDRESS_ENCODING_P2PKH
+	case core.WrappedSegwit:
+		return pb.AddressEncoding_ADDRESS_ENCODING_P2SH_P2WPKH
+	case core.NativeSegwit:
+		return pb.AddressEncoding_ADDRESS_ENCODING_P2WPKH
+	case core.Taproot:
+		return pb.AddressEncoding_ADDRESS_ENCODING_P2TR
+	default:
+		return pb.AddressEncoding_ADDRESS_ENCODING_UNSPECIFIED
+	}
+}
+
+// AddressTypeProto is an adapter function to convert a core.AddressType to
+// a gRPC AddressType enum.
+func AddressTypeProto(addrType core.AddressType) pb.AddressType {
+	switch addrType {
+	case core.AddressTypeP2PKH:
+		return pb.AddressType_ADDRESS_TYPE_P2PKH
+	case core.AddressTypeP2SH:
+		return pb.AddressType_ADDRESS_TYPE_P2SH
+	case core.AddressTypeP2WPKH:
+		return pb.AddressType_ADDRESS_TYPE_P2WPKH
+	case core.AddressTypeP2WSH:
+		return pb.AddressType_ADDRESS_TYPE_P2WSH
+	case core.AddressTypeP2TR:
+		return pb.AddressType_ADDRESS_TYPE_P2TR
+	default:
+		return pb.AddressType_ADDRESS_TYPE_UNSPECIFIED
+	}
+}
+
+// CashAddrType is an adapter function to convert a gRPC CashAddrType enum
+// to core.CashAddrType.
+func CashAddrType(addrType pb.CashAddrType) (core.CashAddrType, error) {
+	switch addrType {
+	case pb.CashAddrType_CASH_ADDR_TYPE_P2PKH:
+		return core.CashAddrP2PKH, nil
+	case pb.CashAddrType_CASH_ADDR_TYPE_P2SH:
+		return core.CashAddrP2SH, nil
+	default:
+		return 0, errors.Wrapf(core.ErrUnknownAddressType,
+			"invalid CashAddr type %s", addrType)
+	}
+}
+
+// TxOrdering is an adapter function to convert a gRPC TxOrdering enum to
+// core.Ordering.
+func TxOrdering(ordering pb.TxOrdering) (core.Ordering, error) {
+	switch ordering {
+	case pb.TxOrdering_TX_ORDERING_AS_PROVIDED:
+		return core.AsProvided, nil
+	case pb.TxOrdering_TX_ORDERING_BIP69:
+		return core.Bip69, nil
+	default:
+		return 0, errors.Wrapf(core.ErrUnknownOrdering, "invalid ordering %s", ordering)
+	}
+}
+
+// DustChangePolicy is an adapter function to convert a gRPC DustChangePolicy
+// enum to core.DustChangePolicy.
+func DustChangePolicy(policy pb.DustChangePolicy) (core.DustChangePolicy, error) {
+	switch policy {
+	case pb.DustChangePolicy_DUST_CHANGE_POLICY_TO_FEE:
+		return core.ToFee, nil
+	case pb.DustChangePolicy_DUST_CHANGE_POLICY_TO_FIRST_OUTPUT:
+		return core.ToFirstOutput, nil
+	default:
+		return 0, errors.Wrapf(core.ErrInvalidDustChangePolicy,
+			"invalid dust change policy %s", policy)
+	}
+}
+
+// Inputs is an adapter function to build core.Input objects from gRPC
+// messages.
+func Inputs(inputsProto []*pb.Input) []core.Input {
 	var inputs []core.Input
-	for _, inputProto := range txProto.Inputs {
+	for _, inputProto := range inputsProto {
 		inputs = append(inputs, core.Input{
 			OutputHash:  inputProto.OutputHash,
 			OutputIndex: uint32(inputProto.OutputIndex),
 			Script:      inputProto.Script,
 			Value:       inputProto.Value,
+			Sequence:    inputProto.Sequence,
 		})
 	}
 
+	return inputs
+}
+
+// Tx is an adapter function to build a *core.Tx object from a gRPC message.
+// It also converts raw gRPC values to a format that is acceptable to btcd.
+func Tx(txProto *pb.CreateTransactionRequest) (*core.Tx, error) {
+	inputs := Inputs(txProto.Inputs)
+
 	var outputs []core.Output
 	for _, outputProto := range txProto.Outputs {
 		value, err := strconv.ParseInt(outputProto.Value, 10, 64)
@@ -71,15 +172,57 @@ func Tx(txProto *pb.CreateTransactionRequest) (*core.Tx, error) {
 		outputs = append(outputs, core.Output{
 			Address: outputProto.Address,
 			Value:   value,
+			Script:  outputProto.Script,
 		})
 	}
 
+	var splitChange []core.ChangeSplit
+	for _, splitProto := range txProto.SplitChange {
+		splitChange = append(splitChange, core.ChangeSplit{
+			Address: splitProto.Address,
+			Ratio:   splitProto.Ratio,
+		})
+	}
+
+	ordering, err := TxOrdering(txProto.Ordering)
+	if err != nil {
+		return nil, err
+	}
+
+	dustChangePolicy, err := DustChangePolicy(txProto.DustChangePolicy)
+	if err != nil {
+		return nil, err
+	}
+
+	// The change encoding is only relevant for a derived change address.
+	var changeEncoding core.AddressEncoding
+	if len(txProto.ChangeDerivation) > 0 {
+		changeEncoding, err = BitcoinAddressEncoding(txProto.ChangeEncoding)
+		if err != nil {
+			return nil, err
+		}
+	}
+
 	return &core.Tx{
-		Inputs:        inputs,
-		Outputs:       outputs,
-		ChangeAddress: txProto.ChangeAddress,
-		FeeSatPerKb:   txProto.FeeSatPerKb,
-		LockTime:      txProto.LockTime,
+		Inputs:              inputs,
+		Outputs:             outputs,
+		ChangeAddress:       txProto.ChangeAddress,
+		FeeSatPerKb:         txProto.FeeSatPerKb,
+		LockTime:            txProto.LockTime,
+		DustLimit:           txProto.DustLimit,
+		MinRelayFeeSatPerKb: txProto.MinRelayFeeSatPerKb,
+		SendMax:             txProto.SendMax,
+		AbsoluteFee:         txProto.AbsoluteFee,
+		ChangeAccountKey:    txProto.ChangeAccountKey,
+		ChangeDerivation:    txProto.ChangeDerivation,
+		ChangeEncoding:      changeEncoding,
+		StrictLockTime:      txProto.StrictLockTime,
+		SplitChange:         splitChange,
+		Ordering:            ordering,
+		MaxOutputValue:      txProto.MaxOutputValue,
+		DustChangePolicy:    dustChangePolicy,
+		SizePaddingVbytes:   int(txProto.SizePaddingVbytes),
+		AllowNonStandard:    txProto.AllowNonStandard,
 	}, nil
 }
 
@@ -106,13 +249,91 @@ func Utxo(proto *pb.Utxo) (*core.Utxo, error) {
 			"invalid utxo script hex: %s", proto.ScriptHex)
 	}
 
+	previousTx, err := hex.DecodeString(proto.PreviousTxHex)
+	if err != nil {
+		return nil, errors.Wrapf(err,
+			"invalid utxo previous tx hex: %s", proto.PreviousTxHex)
+	}
+
+	redeemScript, err := hex.DecodeString(proto.RedeemScriptHex)
+	if err != nil {
+		return nil, errors.Wrapf(err,
+			"invalid utxo redeem script hex: %s", proto.RedeemScriptHex)
+	}
+
+	tapLeafScript, err := hex.DecodeString(proto.TapLeafScriptHex)
+	if err != nil {
+		return nil, errors.Wrapf(err,
+			"invalid utxo tap leaf script hex: %s", proto.TapLeafScriptHex)
+	}
+
 	return &core.Utxo{
-		Script:     script,
-		Value:      value,
-		Derivation: proto.Derivation,
+		Script:        script,
+		Value:         value,
+		Derivation:    proto.Derivation,
+		PreviousTx:    previousTx,
+		RedeemScript:  redeemScript,
+		TapLeafScript: tapLeafScript,
 	}, nil
 }
 
+// HardwareSigningInputProto is an adapter function to build a gRPC message
+// from a core.HardwareSigningInput object.
+func HardwareSigningInputProto(input core.HardwareSigningInput) *pb.HardwareSigningInput {
+	return &pb.HardwareSigningInput{
+		Derivation:      input.Derivation,
+		Value:           strconv.FormatInt(input.Value, 10),
+		ScriptHex:       hex.EncodeToString(input.Script),
+		Address:         input.Address,
+		AddressEncoding: AddressEncodingProto(input.AddrEncoding),
+		SighashType:     uint32(input.SigHashType),
+		Sighash:         input.SigHash,
+	}
+}
+
+// DecodedTxProto is an adapter function to build a gRPC message from a
+// *core.DecodedTx object.
+func DecodedTxProto(decodedTx *core.DecodedTx) *pb.DecodeTransactionResponse {
+	inputs := make([]*pb.DecodedTxInput, len(decodedTx.Inputs))
+	for idx, input := range decodedTx.Inputs {
+		inputs[idx] = &pb.DecodedTxInput{
+			OutputHash:  input.OutputHash,
+			OutputIndex: input.OutputIndex,
+			Sequence:    input.Sequence,
+			Script:      input.Script,
+			Value:       input.Value,
+		}
+	}
+
+	outputs := make([]*pb.DecodedTxOutput, len(decodedTx.Outputs))
+	for idx, output := range decodedTx.Outputs {
+		outputs[idx] = &pb.DecodedTxOutput{
+			Value:     output.Value,
+			ScriptHex: hex.EncodeToString(output.Script),
+			Addresses: output.Addresses,
+		}
+	}
+
+	return &pb.DecodeTransactionResponse{
+		Version:     decodedTx.Version,
+		LockTime:    decodedTx.LockTime,
+		Inputs:      inputs,
+		Outputs:     outputs,
+		TotalOutput: decodedTx.TotalOutput,
+		HasFee:      decodedTx.HasFee,
+		TotalInput:  decodedTx.TotalInput,
+		Fee:         decodedTx.Fee,
+	}
+}
+
+// ScalarKey is an adapter function to build a core.ScalarKey object from a gRPC message.
+func ScalarKey(proto *pb.ScalarKey) core.ScalarKey {
+	return core.ScalarKey{
+		PrivateKey: proto.PrivateKey,
+		PublicKey:  proto.PublicKey,
+	}
+}
+
 // SignatureMetadata is an adapter function to build a *bitcoin.SignatureMetadata object from a gRPC message.
 func SignatureMetadata(proto *pb.SignatureMetadata, chainParams chaincfg.ChainParams) (*core.SignatureMetadata, error) {
 	addrEncoding, err := BitcoinAddressEncoding(proto.AddrEncoding)
@@ -133,9 +354,20 @@ func SignatureMetadata(proto *pb.SignatureMetadata, chainParams chaincfg.ChainPa
 			"failed to parse pub key from signature")
 	}
 
+	utxoScript, err := hex.DecodeString(proto.UtxoScriptHex)
+	if err != nil {
+		return nil, errors.Wrapf(err,
+			"invalid utxo script hex: %s", proto.UtxoScriptHex)
+	}
+
 	return &core.SignatureMetadata{
-		DerSig:       proto.DerSignature,
-		PubKey:       addressPubKey.PubKey(),
-		AddrEncoding: addrEncoding,
+		DerSig:             proto.DerSignature,
+		PubKey:             addressPubKey.PubKey(),
+		AddrEncoding:       addrEncoding,
+		UtxoScript:         utxoScript,
+		UncompressedPubKey: addressPubKey.Format() == btcutil.PKFUncompressed,
+		TapLeafScript:      proto.TapLeafScript,
+		ControlBlock:       proto.ControlBlock,
+		NormalizeLowS:      proto.NormalizeLowS,
 	}, nil
 }
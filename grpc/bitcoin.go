@@ -5,29 +5,53 @@ import (
 
 	pb "github.com/ledgerhq/bitcoin-lib-grpc/pb/bitcoin"
 	"github.com/ledgerhq/bitcoin-lib-grpc/pkg/core"
+	"github.com/ledgerhq/bitcoin-lib-grpc/version"
+	"github.com/pkg/errors"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
 	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/status"
 )
 
 type controller struct {
-	svc core.Service
+	svc    core.Service
+	limits Limits
 }
 
+// NewBitcoinController returns a controller enforcing DefaultLimits.
 func NewBitcoinController() *controller {
+	return NewBitcoinControllerWithLimits(DefaultLimits)
+}
+
+// NewBitcoinControllerWithLimits returns a controller rejecting requests
+// exceeding the given limits with InvalidArgument.
+func NewBitcoinControllerWithLimits(limits Limits) *controller {
 	return &controller{
-		svc: core.Service{},
+		svc:    core.Service{},
+		limits: limits,
 	}
 }
 
+// GetVersion returns the version of the server, along with the commit hash
+// and the build date injected at build time, if any.
+func (c *controller) GetVersion(
+	ctx context.Context, request *pb.GetVersionRequest,
+) (*pb.GetVersionResponse, error) {
+	return &pb.GetVersionResponse{
+		Version:    version.Version,
+		CommitHash: version.GitCommit,
+		BuildDate:  version.BuildDate,
+	}, nil
+}
+
 func (c *controller) ValidateAddress(
 	ctx context.Context, request *pb.ValidateAddressRequest,
 ) (*pb.ValidateAddressResponse, error) {
 	chainParams, err := ChainParams(request.ChainParams)
 	if err != nil {
-		return nil, status.Errorf(codes.InvalidArgument, err.Error())
+		return nil, errorStatus(codes.InvalidArgument, err)
 	}
 
-	addr, err := c.svc.ValidateAddress(request.Address, chainParams)
+	addr, addrType, err := c.svc.ValidateAddress(request.Address, chainParams)
 	if err != nil {
 		return &pb.ValidateAddressResponse{
 			Address:       request.Address,
@@ -37,8 +61,58 @@ func (c *controller) ValidateAddress(
 	}
 
 	return &pb.ValidateAddressResponse{
-		Address: addr,
-		IsValid: true,
+		Address:     addr,
+		IsValid:     true,
+		AddressType: AddressTypeProto(addrType),
+	}, nil
+}
+
+func (c *controller) ValidateAddresses(
+	ctx context.Context, request *pb.ValidateAddressesRequest,
+) (*pb.ValidateAddressesResponse, error) {
+	chainParams, err := ChainParams(request.ChainParams)
+	if err != nil {
+		return nil, errorStatus(codes.InvalidArgument, err)
+	}
+
+	validations := c.svc.ValidateAddresses(request.Addresses, chainParams)
+
+	results := make([]*pb.ValidateAddressResponse, len(validations))
+	for idx, validation := range validations {
+		results[idx] = &pb.ValidateAddressResponse{
+			Address:       validation.Address,
+			IsValid:       validation.IsValid,
+			InvalidReason: validation.InvalidReason,
+			AddressType:   AddressTypeProto(validation.AddressType),
+		}
+	}
+
+	return &pb.ValidateAddressesResponse{
+		Results: results,
+	}, nil
+}
+
+func (c *controller) ConvertExtendedKeyVersion(
+	ctx context.Context, request *pb.ConvertExtendedKeyVersionRequest,
+) (*pb.ConvertExtendedKeyVersionResponse, error) {
+	chainParams, err := ChainParams(request.ChainParams)
+	if err != nil {
+		return nil, errorStatus(codes.InvalidArgument, err)
+	}
+
+	encoding, err := BitcoinAddressEncoding(request.Encoding)
+	if err != nil {
+		return nil, errorStatus(codes.InvalidArgument, err)
+	}
+
+	extendedKey, err := c.svc.ConvertExtendedKeyVersion(
+		request.ExtendedKey, encoding, chainParams)
+	if err != nil {
+		return nil, errorStatus(codes.InvalidArgument, err)
+	}
+
+	return &pb.ConvertExtendedKeyVersionResponse{
+		ExtendedKey: extendedKey,
 	}, nil
 }
 
@@ -47,17 +121,18 @@ func (c *controller) EncodeAddress(
 ) (*pb.EncodeAddressResponse, error) {
 	chainParams, err := ChainParams(request.ChainParams)
 	if err != nil {
-		return nil, status.Errorf(codes.InvalidArgument, err.Error())
+		return nil, errorStatus(codes.InvalidArgument, err)
 	}
 
 	encoding, err := BitcoinAddressEncoding(request.Encoding)
 	if err != nil {
-		return nil, status.Errorf(codes.InvalidArgument, err.Error())
+		return nil, errorStatus(codes.InvalidArgument, err)
 	}
 
-	address, err := c.svc.EncodeAddress(request.PublicKey, encoding, chainParams)
+	address, err := c.svc.EncodeAddress(
+		request.PublicKey, encoding, !request.Uncompressed, chainParams)
 	if err != nil {
-		return nil, status.Errorf(codes.InvalidArgument, err.Error())
+		return nil, errorStatus(codes.InvalidArgument, err)
 	}
 
 	return &pb.EncodeAddressResponse{
@@ -68,9 +143,13 @@ func (c *controller) EncodeAddress(
 func (c *controller) DeriveExtendedKey(
 	ctx context.Context, request *pb.DeriveExtendedKeyRequest,
 ) (*pb.DeriveExtendedKeyResponse, error) {
-	response, err := c.svc.DeriveExtendedKey(request.ExtendedKey, request.Derivation)
+	if err := c.limits.checkDerivation(request.Derivation); err != nil {
+		return nil, errorStatus(codes.InvalidArgument, err)
+	}
+
+	response, err := c.svc.DeriveExtendedKey(ctx, request.ExtendedKey, request.Derivation)
 	if err != nil {
-		return nil, status.Errorf(codes.InvalidArgument, err.Error())
+		return nil, derivationError(ctx, err)
 	}
 
 	return &pb.DeriveExtendedKeyResponse{
@@ -80,18 +159,297 @@ func (c *controller) DeriveExtendedKey(
 	}, nil
 }
 
+func (c *controller) DeriveKeyWithAddresses(
+	ctx context.Context, request *pb.DeriveKeyWithAddressesRequest,
+) (*pb.DeriveKeyWithAddressesResponse, error) {
+	if err := c.limits.checkDerivation(request.Derivation); err != nil {
+		return nil, errorStatus(codes.InvalidArgument, err)
+	}
+
+	chainParams, err := ChainParams(request.ChainParams)
+	if err != nil {
+		return nil, errorStatus(codes.InvalidArgument, err)
+	}
+
+	response, err := c.svc.DeriveKeyWithAddresses(
+		ctx, request.ExtendedKey, request.Derivation, chainParams)
+	if err != nil {
+		return nil, derivationError(ctx, err)
+	}
+
+	return &pb.DeriveKeyWithAddressesResponse{
+		PublicKey:            response.PublicKey,
+		Hash160:              response.Hash160,
+		LegacyAddress:        response.LegacyAddress,
+		WrappedSegwitAddress: response.WrappedSegwitAddress,
+		NativeSegwitAddress:  response.NativeSegwitAddress,
+	}, nil
+}
+
+func (c *controller) DerivePrivateKey(
+	ctx context.Context, request *pb.DerivePrivateKeyRequest,
+) (*pb.DerivePrivateKeyResponse, error) {
+	if err := c.limits.checkDerivation(request.Derivation); err != nil {
+		return nil, errorStatus(codes.InvalidArgument, err)
+	}
+
+	response, err := c.svc.DerivePrivateKey(request.ExtendedKey, request.Derivation)
+	if err != nil {
+		return nil, errorStatus(codes.InvalidArgument, err)
+	}
+
+	return &pb.DerivePrivateKeyResponse{
+		ExtendedKey: response.ExtendedKey,
+		PrivateKey:  response.PrivateKey,
+		PublicKey:   response.PublicKey,
+		ChainCode:   response.ChainCode,
+	}, nil
+}
+
+func (c *controller) EncodeTaprootScriptAddress(
+	ctx context.Context, request *pb.EncodeTaprootScriptAddressRequest,
+) (*pb.EncodeTaprootScriptAddressResponse, error) {
+	chainParams, err := ChainParams(request.ChainParams)
+	if err != nil {
+		return nil, errorStatus(codes.InvalidArgument, err)
+	}
+
+	address, err := c.svc.EncodeTaprootScriptAddress(
+		request.InternalKey, request.TapLeaves, chainParams)
+	if err != nil {
+		return nil, errorStatus(codes.InvalidArgument, err)
+	}
+
+	return &pb.EncodeTaprootScriptAddressResponse{
+		Address:       address.Address,
+		OutputKey:     address.OutputKey,
+		MerkleRoot:    address.MerkleRoot,
+		ControlBlocks: address.ControlBlocks,
+	}, nil
+}
+
+func (c *controller) EncodeCashAddr(
+	ctx context.Context, request *pb.EncodeCashAddrRequest,
+) (*pb.EncodeCashAddrResponse, error) {
+	chainParams, err := ChainParams(request.ChainParams)
+	if err != nil {
+		return nil, errorStatus(codes.InvalidArgument, err)
+	}
+
+	addrType, err := CashAddrType(request.Type)
+	if err != nil {
+		return nil, errorStatus(codes.InvalidArgument, err)
+	}
+
+	address, err := c.svc.EncodeCashAddr(request.PublicKey, addrType, chainParams)
+	if err != nil {
+		return nil, errorStatus(codes.InvalidArgument, err)
+	}
+
+	return &pb.EncodeCashAddrResponse{
+		Address: address,
+	}, nil
+}
+
+func (c *controller) LegacyToCashAddr(
+	ctx context.Context, request *pb.LegacyToCashAddrRequest,
+) (*pb.LegacyToCashAddrResponse, error) {
+	chainParams, err := ChainParams(request.ChainParams)
+	if err != nil {
+		return nil, errorStatus(codes.InvalidArgument, err)
+	}
+
+	address, err := c.svc.LegacyToCashAddr(request.Address, chainParams)
+	if err != nil {
+		return nil, addressErrorStatus(err)
+	}
+
+	return &pb.LegacyToCashAddrResponse{
+		Address: address,
+	}, nil
+}
+
+func (c *controller) CashAddrToLegacy(
+	ctx context.Context, request *pb.CashAddrToLegacyRequest,
+) (*pb.CashAddrToLegacyResponse, error) {
+	chainParams, err := ChainParams(request.ChainParams)
+	if err != nil {
+		return nil, errorStatus(codes.InvalidArgument, err)
+	}
+
+	address, err := c.svc.CashAddrToLegacy(request.Address, chainParams)
+	if err != nil {
+		return nil, addressErrorStatus(err)
+	}
+
+	return &pb.CashAddrToLegacyResponse{
+		Address: address,
+	}, nil
+}
+
+func (c *controller) ConvertBchAddress(
+	ctx context.Context, request *pb.ConvertBchAddressRequest,
+) (*pb.ConvertBchAddressResponse, error) {
+	chainParams, err := ChainParams(request.ChainParams)
+	if err != nil {
+		return nil, errorStatus(codes.InvalidArgument, err)
+	}
+
+	address, err := c.svc.ConvertBchAddress(request.Address, request.ToCashAddr, chainParams)
+	if err != nil {
+		return nil, addressErrorStatus(err)
+	}
+
+	return &pb.ConvertBchAddressResponse{
+		Address: address,
+	}, nil
+}
+
+func (c *controller) DeriveAddresses(
+	ctx context.Context, request *pb.DeriveAddressesRequest,
+) (*pb.DeriveAddressesResponse, error) {
+	chainParams, err := ChainParams(request.ChainParams)
+	if err != nil {
+		return nil, errorStatus(codes.InvalidArgument, err)
+	}
+
+	encoding, err := BitcoinAddressEncoding(request.Encoding)
+	if err != nil {
+		return nil, errorStatus(codes.InvalidArgument, err)
+	}
+
+	if err := c.limits.checkAddressCount(request.Count); err != nil {
+		return nil, errorStatus(codes.InvalidArgument, err)
+	}
+
+	addresses, err := c.svc.DeriveAddresses(ctx, request.AccountKey, encoding,
+		request.Change, request.StartIndex, request.Count, chainParams)
+	if err != nil {
+		return nil, derivationError(ctx, err)
+	}
+
+	return deriveAddressesResponse(addresses), nil
+}
+
+func (c *controller) DeriveChangeAddresses(
+	ctx context.Context, request *pb.DeriveChangeAddressesRequest,
+) (*pb.DeriveAddressesResponse, error) {
+	chainParams, err := ChainParams(request.ChainParams)
+	if err != nil {
+		return nil, errorStatus(codes.InvalidArgument, err)
+	}
+
+	encoding, err := BitcoinAddressEncoding(request.Encoding)
+	if err != nil {
+		return nil, errorStatus(codes.InvalidArgument, err)
+	}
+
+	if err := c.limits.checkAddressCount(request.Count); err != nil {
+		return nil, errorStatus(codes.InvalidArgument, err)
+	}
+
+	addresses, err := c.svc.DeriveChangeAddresses(ctx, request.AccountKey, encoding,
+		request.StartIndex, request.Count, chainParams)
+	if err != nil {
+		return nil, derivationError(ctx, err)
+	}
+
+	return deriveAddressesResponse(addresses), nil
+}
+
+func deriveAddressesResponse(addresses []core.AddressInfo) *pb.DeriveAddressesResponse {
+	response := &pb.DeriveAddressesResponse{
+		Addresses: make([]*pb.AddressInfo, len(addresses)),
+	}
+
+	for idx, address := range addresses {
+		response.Addresses[idx] = &pb.AddressInfo{
+			Index:     address.Index,
+			Address:   address.Address,
+			PublicKey: address.PublicKey,
+		}
+	}
+
+	return response
+}
+
+func (c *controller) DeriveAddressesStream(
+	request *pb.DeriveAddressesRequest, stream pb.CoinService_DeriveAddressesStreamServer,
+) error {
+	chainParams, err := ChainParams(request.ChainParams)
+	if err != nil {
+		return errorStatus(codes.InvalidArgument, err)
+	}
+
+	encoding, err := BitcoinAddressEncoding(request.Encoding)
+	if err != nil {
+		return errorStatus(codes.InvalidArgument, err)
+	}
+
+	ctx := stream.Context()
+
+	// streamErr holds the error that interrupted the stream, if any, to
+	// distinguish it from derivation errors.
+	var streamErr error
+
+	// The derivation stops as soon as the client is gone.
+	err = c.svc.DeriveAddressesFunc(ctx, request.AccountKey, encoding,
+		request.Change, request.StartIndex, request.Count, chainParams,
+		func(address core.AddressInfo) error {
+			streamErr = stream.Send(&pb.AddressInfo{
+				Index:     address.Index,
+				Address:   address.Address,
+				PublicKey: address.PublicKey,
+			})
+			return streamErr
+		})
+
+	if streamErr != nil {
+		return streamErr
+	}
+
+	if err != nil {
+		return derivationError(ctx, err)
+	}
+
+	return nil
+}
+
+// derivationError converts the error of a derivation to a gRPC status. A
+// derivation interrupted by the context of the request maps to the status
+// of the context error, e.g. DeadlineExceeded, and any other error maps to
+// InvalidArgument.
+func derivationError(ctx context.Context, err error) error {
+	if ctxErr := ctx.Err(); ctxErr != nil && errors.Cause(err) == ctxErr {
+		return status.FromContextError(ctxErr).Err()
+	}
+
+	return errorStatus(codes.InvalidArgument, err)
+}
+
 func (c *controller) GetAccountExtendedKey(
 	ctx context.Context, request *pb.GetAccountExtendedKeyRequest,
 ) (*pb.GetAccountExtendedKeyResponse, error) {
 	chainParams, err := ChainParams(request.ChainParams)
 	if err != nil {
-		return nil, status.Errorf(codes.InvalidArgument, err.Error())
+		return nil, errorStatus(codes.InvalidArgument, err)
+	}
+
+	// The version bytes of the chain params are used by default, for
+	// backward compatibility.
+	encoding := core.Legacy
+	if request.Encoding != pb.AddressEncoding_ADDRESS_ENCODING_UNSPECIFIED {
+		encoding, err = BitcoinAddressEncoding(request.Encoding)
+		if err != nil {
+			return nil, errorStatus(codes.InvalidArgument, err)
+		}
 	}
 
 	key, err := c.svc.GetAccountExtendedKey(
-		request.PublicKey, request.ChainCode, request.AccountIndex, chainParams)
+		request.PublicKey, request.ChainCode, request.AccountIndex,
+		request.ParentPublicKey, encoding, chainParams)
 	if err != nil {
-		return nil, status.Errorf(codes.InvalidArgument, err.Error())
+		return nil, errorStatus(codes.InvalidArgument, err)
 	}
 
 	return &pb.GetAccountExtendedKeyResponse{
@@ -103,51 +461,136 @@ func (c *controller) CreateTransaction(
 	ctx context.Context, txRequest *pb.CreateTransactionRequest,
 ) (*pb.RawTransactionResponse, error) {
 
+	if err := c.limits.checkInputs(len(txRequest.Inputs)); err != nil {
+		return nil, errorStatus(codes.InvalidArgument, err)
+	}
+
+	// Split change outputs are outputs of the transaction too.
+	if err := c.limits.checkOutputs(len(txRequest.Outputs) + len(txRequest.SplitChange)); err != nil {
+		return nil, errorStatus(codes.InvalidArgument, err)
+	}
+
+	if err := c.limits.checkDerivation(txRequest.ChangeDerivation); err != nil {
+		return nil, errorStatus(codes.InvalidArgument, err)
+	}
+
 	chainParams, err := ChainParams(txRequest.ChainParams)
 	if err != nil {
-		return nil, status.Errorf(codes.InvalidArgument, err.Error())
+		return nil, errorStatus(codes.InvalidArgument, err)
 	}
 
 	tx, err := Tx(txRequest)
 	if err != nil {
-		return nil, status.Errorf(codes.InvalidArgument, err.Error())
+		return nil, errorStatus(codes.InvalidArgument, err)
+	}
+
+	if !txRequest.AllowHighFeeRate {
+		tx.MaxFeeSatPerKb = c.limits.MaxFeeSatPerKb
 	}
 
 	rawTxWithExtra, err := c.svc.CreateTransaction(tx, chainParams)
-	if err != nil {
-		return nil, status.Errorf(codes.Internal, err.Error())
+
+	// Insufficient funds are reported in the response, for backward
+	// compatibility.
+	var insufficientFunds *core.ErrInsufficientFunds
+	if errors.As(err, &insufficientFunds) {
+		return &pb.RawTransactionResponse{
+			NotEnoughUtxo: &pb.NotEnoughUtxo{
+				MissingAmount: insufficientFunds.MissingAmount,
+			},
+		}, nil
 	}
 
-	var notEnoughUtxo *pb.NotEnoughUtxo
-	if rawTxWithExtra.RawTx.NotEnoughUtxo != nil {
-		notEnoughUtxo = &pb.NotEnoughUtxo{MissingAmount: rawTxWithExtra.RawTx.NotEnoughUtxo.MissingAmount}
+	if err != nil {
+		return nil, errorStatus(codes.Internal, err)
 	}
 
 	response := pb.RawTransactionResponse{
-		Hex:           rawTxWithExtra.RawTx.Hex,
-		Hash:          rawTxWithExtra.RawTx.Hash,
-		WitnessHash:   rawTxWithExtra.RawTx.WitnessHash,
-		ChangeAmount:  rawTxWithExtra.Change,
-		TotalFees:     rawTxWithExtra.TotalFees,
-		NotEnoughUtxo: notEnoughUtxo,
+		Hex:          rawTxWithExtra.RawTx.Hex,
+		Hash:         rawTxWithExtra.RawTx.Hash,
+		WitnessHash:  rawTxWithExtra.RawTx.WitnessHash,
+		StrippedHex:  rawTxWithExtra.RawTx.StrippedHex,
+		ChangeAmount: rawTxWithExtra.Change,
+		TotalFees:    rawTxWithExtra.TotalFees,
+
+		FeeRateSatPerVbyte: rawTxWithExtra.FeeRateSatPerVByte,
+		FeeRateSatPerKb:    rawTxWithExtra.FeeRateSatPerKb,
+		ChangeDropped:      rawTxWithExtra.ChangeDropped,
+		LockTimeUnenforced: rawTxWithExtra.LockTimeUnenforced,
 	}
 
 	return &response, nil
 }
 
+func (c *controller) CreateTransactions(
+	ctx context.Context, request *pb.CreateTransactionsRequest,
+) (*pb.CreateTransactionsResponse, error) {
+	if err := c.limits.checkBatchSize(len(request.Transactions)); err != nil {
+		return nil, errorStatus(codes.InvalidArgument, err)
+	}
+
+	results := make([]*pb.CreateTransactionResult, 0, len(request.Transactions))
+
+	for _, txRequest := range request.Transactions {
+		if err := ctx.Err(); err != nil {
+			return nil, status.FromContextError(err).Err()
+		}
+
+		// Each transaction is checked and created like by CreateTransaction,
+		// so that its errors are those of a single request.
+		transaction, err := c.CreateTransaction(ctx, txRequest)
+		if err != nil {
+			results = append(results, createTransactionErrorResult(err))
+			continue
+		}
+
+		results = append(results, &pb.CreateTransactionResult{Transaction: transaction})
+	}
+
+	return &pb.CreateTransactionsResponse{Results: results}, nil
+}
+
+// createTransactionErrorResult returns the result of a transaction of a
+// batch, from the status error returned by CreateTransaction.
+func createTransactionErrorResult(err error) *pb.CreateTransactionResult {
+	st := status.Convert(err)
+
+	result := &pb.CreateTransactionResult{
+		ErrorCode:    int32(st.Code()),
+		ErrorMessage: st.Message(),
+	}
+
+	for _, detail := range st.Details() {
+		if info, ok := detail.(*errdetails.ErrorInfo); ok {
+			result.ErrorReason = info.Reason
+		}
+	}
+
+	return result
+}
+
 func (c *controller) GetKeypair(
 	ctx context.Context, request *pb.GetKeypairRequest,
 ) (*pb.GetKeypairResponse, error) {
 
+	if err := c.limits.checkDerivation(request.Derivation); err != nil {
+		return nil, errorStatus(codes.InvalidArgument, err)
+	}
+
 	chainParams, err := ChainParams(request.ChainParams)
 	if err != nil {
-		return nil, status.Errorf(codes.InvalidArgument, err.Error())
+		return nil, errorStatus(codes.InvalidArgument, err)
 	}
 
-	keypair, err := c.svc.GetKeypair(request.Seed, chainParams, request.Derivation)
+	keypair, err := c.svc.GetKeypair(
+		ctx, request.Seed, chainParams, request.Derivation, request.XpubOnly)
+
+	if ctxErr := ctx.Err(); ctxErr != nil && errors.Cause(err) == ctxErr {
+		return nil, status.FromContextError(ctxErr).Err()
+	}
 
 	if err != nil {
-		return nil, status.Errorf(codes.Internal, err.Error())
+		return nil, errorStatus(codes.Internal, err)
 	}
 
 	response := pb.GetKeypairResponse{ExtendedPublicKey: keypair.ExtendedPublicKey, PrivateKey: keypair.PrivateKey}
@@ -155,70 +598,686 @@ func (c *controller) GetKeypair(
 	return &response, nil
 }
 
-func (c *controller) GenerateDerSignatures(
-	ctx context.Context, request *pb.GenerateDerSignaturesRequest,
-) (*pb.GenerateDerSignaturesResponse, error) {
-
-	rawTx := RawTx(request.RawTx)
+func (c *controller) KeypairFromMnemonic(
+	ctx context.Context, request *pb.KeypairFromMnemonicRequest,
+) (*pb.GetKeypairResponse, error) {
 
-	utxos := make([]core.Utxo, len(request.Utxos))
-	for idx, utxoProto := range request.Utxos {
-		utxo, err := Utxo(utxoProto)
-		if err != nil {
-			return nil, status.Errorf(codes.Internal, err.Error())
-		}
-		utxos[idx] = *utxo
+	if err := c.limits.checkDerivation(request.Derivation); err != nil {
+		return nil, errorStatus(codes.InvalidArgument, err)
 	}
 
-	msgTx, err := c.svc.DeserializeMsgTx(rawTx)
+	chainParams, err := ChainParams(request.ChainParams)
 	if err != nil {
-		return nil, err
+		return nil, errorStatus(codes.InvalidArgument, err)
 	}
 
-	derSignatures, err := c.svc.GenerateDerSignatures(msgTx, utxos, request.PrivateKey)
+	keypair, err := c.svc.KeypairFromMnemonic(
+		request.Mnemonic, request.Passphrase, chainParams, request.Derivation)
+
 	if err != nil {
-		return nil, status.Errorf(codes.Internal, err.Error())
+		return nil, errorStatus(codes.Internal, err)
 	}
 
-	return &pb.GenerateDerSignaturesResponse{DerSignatures: derSignatures}, nil
+	response := pb.GetKeypairResponse{ExtendedPublicKey: keypair.ExtendedPublicKey, PrivateKey: keypair.PrivateKey}
+
+	return &response, nil
 }
 
-func (c *controller) SignTransaction(
-	ctx context.Context, request *pb.SignTransactionRequest,
-) (*pb.RawTransactionResponse, error) {
+func (c *controller) GenerateMnemonic(
+	ctx context.Context, request *pb.GenerateMnemonicRequest,
+) (*pb.GenerateMnemonicResponse, error) {
+	mnemonic, err := c.svc.GenerateMnemonic(int(request.EntropyBits))
 
-	chainParams, err := ChainParams(request.ChainParams)
 	if err != nil {
-		return nil, status.Errorf(codes.Internal, err.Error())
+		return nil, errorStatus(codes.Internal, err)
 	}
 
-	rawTx := RawTx(request.RawTx)
-
-	signatures := make([]core.SignatureMetadata, len(request.Signatures))
+	return &pb.GenerateMnemonicResponse{Mnemonic: mnemonic}, nil
+}
 
-	for idx, signature := range request.Signatures {
-		sigMetadata, err := SignatureMetadata(signature, chainParams)
-		if err != nil {
-			return nil, status.Errorf(codes.Internal, err.Error())
-		}
-		signatures[idx] = *sigMetadata
+func (c *controller) SignMessage(
+	ctx context.Context, request *pb.SignMessageRequest,
+) (*pb.SignMessageResponse, error) {
+	encoding, err := BitcoinAddressEncoding(request.Encoding)
+	if err != nil {
+		return nil, errorStatus(codes.InvalidArgument, err)
 	}
 
-	msgTx, err := c.svc.DeserializeMsgTx(rawTx)
+	signature, err := c.svc.SignMessage(
+		request.PrivateKey, request.Message, encoding, request.Compressed)
 	if err != nil {
-		return nil, status.Errorf(codes.Internal, err.Error())
+		return nil, errorStatus(codes.InvalidArgument, err)
 	}
 
-	signedRawTx, err := c.svc.SignTransaction(msgTx, chainParams, signatures)
+	return &pb.SignMessageResponse{Signature: signature}, nil
+}
+
+func (c *controller) VerifyMessage(
+	ctx context.Context, request *pb.VerifyMessageRequest,
+) (*pb.VerifyMessageResponse, error) {
+	chainParams, err := ChainParams(request.ChainParams)
 	if err != nil {
-		return nil, status.Errorf(codes.Internal, err.Error())
+		return nil, errorStatus(codes.InvalidArgument, err)
 	}
 
-	response := pb.RawTransactionResponse{
-		Hex:         signedRawTx.Hex,
-		Hash:        signedRawTx.Hash,
-		WitnessHash: signedRawTx.WitnessHash,
+	valid, err := c.svc.VerifyMessage(
+		request.Address, request.Message, request.Signature, chainParams)
+	if err != nil {
+		return nil, errorStatus(codes.InvalidArgument, err)
+	}
+
+	return &pb.VerifyMessageResponse{Valid: valid}, nil
+}
+
+func (c *controller) RecoverPublicKey(
+	ctx context.Context, request *pb.RecoverPublicKeyRequest,
+) (*pb.RecoverPublicKeyResponse, error) {
+	publicKey, err := c.svc.RecoverPublicKey(request.MessageHash, request.Signature)
+	if err != nil {
+		return nil, errorStatus(codes.InvalidArgument, err)
+	}
+
+	return &pb.RecoverPublicKeyResponse{PublicKey: publicKey}, nil
+}
+
+func (c *controller) AccountDescriptor(
+	ctx context.Context, request *pb.AccountDescriptorRequest,
+) (*pb.AccountDescriptorResponse, error) {
+	encoding, err := BitcoinAddressEncoding(request.Encoding)
+	if err != nil {
+		return nil, errorStatus(codes.InvalidArgument, err)
+	}
+
+	var fingerprint [4]byte
+	if len(request.Fingerprint) != len(fingerprint) {
+		return nil, status.Errorf(codes.InvalidArgument,
+			"fingerprint has invalid length %d, expected %d",
+			len(request.Fingerprint), len(fingerprint))
+	}
+	copy(fingerprint[:], request.Fingerprint)
+
+	receive, change, err := c.svc.AccountDescriptor(
+		request.AccountKey, encoding, fingerprint,
+		request.Purpose, request.CoinType, request.Account)
+	if err != nil {
+		return nil, errorStatus(codes.InvalidArgument, err)
+	}
+
+	return &pb.AccountDescriptorResponse{
+		ReceiveDescriptor: receive,
+		ChangeDescriptor:  change,
+	}, nil
+}
+
+func (c *controller) DeriveFromDescriptor(
+	ctx context.Context, request *pb.DeriveFromDescriptorRequest,
+) (*pb.DeriveFromDescriptorResponse, error) {
+	chainParams, err := ChainParams(request.ChainParams)
+	if err != nil {
+		return nil, errorStatus(codes.InvalidArgument, err)
+	}
+
+	address, err := c.svc.DeriveFromDescriptor(request.Descriptor_, request.Index, chainParams)
+	if err != nil {
+		return nil, errorStatus(codes.InvalidArgument, err)
+	}
+
+	return &pb.DeriveFromDescriptorResponse{Address: address}, nil
+}
+
+func (c *controller) EncodeMultisigAddress(
+	ctx context.Context, request *pb.EncodeMultisigAddressRequest,
+) (*pb.EncodeMultisigAddressResponse, error) {
+	chainParams, err := ChainParams(request.ChainParams)
+	if err != nil {
+		return nil, errorStatus(codes.InvalidArgument, err)
+	}
+
+	encoding, err := BitcoinAddressEncoding(request.Encoding)
+	if err != nil {
+		return nil, errorStatus(codes.InvalidArgument, err)
+	}
+
+	address, err := c.svc.EncodeMultisigAddress(
+		request.PublicKeys, int(request.Threshold), encoding, chainParams)
+	if err != nil {
+		return nil, errorStatus(codes.InvalidArgument, err)
+	}
+
+	return &pb.EncodeMultisigAddressResponse{Address: address}, nil
+}
+
+func (c *controller) EncodeScriptAddress(
+	ctx context.Context, request *pb.EncodeScriptAddressRequest,
+) (*pb.EncodeAddressResponse, error) {
+	chainParams, err := ChainParams(request.ChainParams)
+	if err != nil {
+		return nil, errorStatus(codes.InvalidArgument, err)
+	}
+
+	var address string
+	if request.Witness {
+		address, err = c.svc.EncodeWitnessScriptAddress(request.RedeemScript, chainParams)
+	} else {
+		address, err = c.svc.EncodeScriptAddress(request.RedeemScript, chainParams)
+	}
+
+	if err != nil {
+		return nil, errorStatus(codes.InvalidArgument, err)
+	}
+
+	return &pb.EncodeAddressResponse{Address: address}, nil
+}
+
+func (c *controller) AddressToScript(
+	ctx context.Context, request *pb.AddressToScriptRequest,
+) (*pb.AddressToScriptResponse, error) {
+	chainParams, err := ChainParams(request.ChainParams)
+	if err != nil {
+		return nil, errorStatus(codes.InvalidArgument, err)
+	}
+
+	script, err := c.svc.AddressToScript(request.Address, chainParams)
+	if err != nil {
+		return nil, addressErrorStatus(err)
+	}
+
+	return &pb.AddressToScriptResponse{Script: script}, nil
+}
+
+func (c *controller) ScriptToAddress(
+	ctx context.Context, request *pb.ScriptToAddressRequest,
+) (*pb.ScriptToAddressResponse, error) {
+	chainParams, err := ChainParams(request.ChainParams)
+	if err != nil {
+		return nil, errorStatus(codes.InvalidArgument, err)
+	}
+
+	address, err := c.svc.ScriptToAddress(request.Script, chainParams)
+	if err != nil {
+		return nil, errorStatus(codes.InvalidArgument, err)
+	}
+
+	return &pb.ScriptToAddressResponse{Address: address}, nil
+}
+
+func (c *controller) GetAccountXpubFromSeed(
+	ctx context.Context, request *pb.GetAccountXpubFromSeedRequest,
+) (*pb.GetAccountExtendedKeyResponse, error) {
+	chainParams, err := ChainParams(request.ChainParams)
+	if err != nil {
+		return nil, errorStatus(codes.InvalidArgument, err)
+	}
+
+	encoding, err := BitcoinAddressEncoding(request.Encoding)
+	if err != nil {
+		return nil, errorStatus(codes.InvalidArgument, err)
+	}
+
+	key, err := c.svc.GetAccountXpubFromSeed(
+		request.Seed, request.Purpose, request.CoinType, request.Account,
+		chainParams, encoding)
+	if err != nil {
+		return nil, errorStatus(codes.InvalidArgument, err)
+	}
+
+	return &pb.GetAccountExtendedKeyResponse{
+		ExtendedKey: key,
+	}, nil
+}
+
+func (c *controller) ComputeCpfpFee(
+	ctx context.Context, request *pb.ComputeCpfpFeeRequest,
+) (*pb.ComputeCpfpFeeResponse, error) {
+	childFee, err := c.svc.ComputeCpfpFee(
+		request.ParentHex, request.ParentFee, int(request.ParentVsize),
+		int(request.ChildVsize), request.TargetFeeSatPerKb)
+	if err != nil {
+		return nil, errorStatus(codes.InvalidArgument, err)
+	}
+
+	return &pb.ComputeCpfpFeeResponse{ChildFee: childFee}, nil
+}
+
+func (c *controller) GenerateDerSignatures(
+	ctx context.Context, request *pb.GenerateDerSignaturesRequest,
+) (*pb.GenerateDerSignaturesResponse, error) {
+
+	if err := c.limits.checkInputs(len(request.Utxos)); err != nil {
+		return nil, errorStatus(codes.InvalidArgument, err)
+	}
+
+	rawTx := RawTx(request.RawTx)
+
+	utxos := make([]core.Utxo, len(request.Utxos))
+	for idx, utxoProto := range request.Utxos {
+		utxo, err := Utxo(utxoProto)
+		if err != nil {
+			return nil, errorStatus(codes.Internal, err)
+		}
+		utxos[idx] = *utxo
+	}
+
+	msgTx, err := c.svc.DeserializeMsgTx(rawTx)
+	if err != nil {
+		return nil, errorStatus(codes.InvalidArgument, err)
+	}
+
+	derSignatures, err := c.svc.GenerateDerSignatures(msgTx, utxos, request.PrivateKey, request.GrindLowR)
+
+	if err != nil {
+		return nil, errorStatus(codes.Internal, err)
+	}
+
+	return &pb.GenerateDerSignaturesResponse{DerSignatures: derSignatures}, nil
+}
+
+func (c *controller) GenerateDerSignaturesFromScalars(
+	ctx context.Context, request *pb.GenerateDerSignaturesFromScalarsRequest,
+) (*pb.GenerateDerSignaturesResponse, error) {
+
+	if err := c.limits.checkInputs(len(request.Utxos)); err != nil {
+		return nil, errorStatus(codes.InvalidArgument, err)
+	}
+
+	rawTx := RawTx(request.RawTx)
+
+	utxos := make([]core.Utxo, len(request.Utxos))
+	for idx, utxoProto := range request.Utxos {
+		utxo, err := Utxo(utxoProto)
+		if err != nil {
+			return nil, errorStatus(codes.InvalidArgument, err)
+		}
+		utxos[idx] = *utxo
+	}
+
+	keys := make([]core.ScalarKey, len(request.Keys))
+	for idx, keyProto := range request.Keys {
+		keys[idx] = ScalarKey(keyProto)
+	}
+
+	msgTx, err := c.svc.DeserializeMsgTx(rawTx)
+	if err != nil {
+		return nil, errorStatus(codes.InvalidArgument, err)
+	}
+
+	derSignatures, err := c.svc.GenerateDerSignaturesFromScalars(msgTx, utxos, keys)
+	if err != nil {
+		return nil, errorStatus(codes.InvalidArgument, err)
+	}
+
+	return &pb.GenerateDerSignaturesResponse{DerSignatures: derSignatures}, nil
+}
+
+func (c *controller) SignTransaction(
+	ctx context.Context, request *pb.SignTransactionRequest,
+) (*pb.RawTransactionResponse, error) {
+
+	chainParams, err := ChainParams(request.ChainParams)
+	if err != nil {
+		return nil, errorStatus(codes.Internal, err)
+	}
+
+	rawTx := RawTx(request.RawTx)
+
+	signatures := make([]core.SignatureMetadata, len(request.Signatures))
+
+	for idx, signature := range request.Signatures {
+		sigMetadata, err := SignatureMetadata(signature, chainParams)
+		if err != nil {
+			return nil, errorStatus(codes.Internal, err)
+		}
+		signatures[idx] = *sigMetadata
+	}
+
+	msgTx, err := c.svc.DeserializeMsgTx(rawTx)
+	if err != nil {
+		return nil, errorStatus(codes.InvalidArgument, err)
+	}
+
+	signedRawTx, err := c.svc.SignTransaction(msgTx, chainParams, signatures)
+	if err != nil {
+		return nil, errorStatus(codes.Internal, err)
+	}
+
+	response := pb.RawTransactionResponse{
+		Hex:         signedRawTx.Hex,
+		Hash:        signedRawTx.Hash,
+		WitnessHash: signedRawTx.WitnessHash,
+		StrippedHex: signedRawTx.StrippedHex,
 	}
 
 	return &response, nil
 }
+
+func (c *controller) ReplaceOutputAddress(
+	ctx context.Context, request *pb.ReplaceOutputAddressRequest,
+) (*pb.RawTransactionResponse, error) {
+	chainParams, err := ChainParams(request.ChainParams)
+	if err != nil {
+		return nil, errorStatus(codes.InvalidArgument, err)
+	}
+
+	rawTx, err := c.svc.ReplaceOutputAddress(
+		request.Hex, request.OutputIndex, request.Address, chainParams)
+	if err != nil {
+		return nil, errorStatus(codes.InvalidArgument, err)
+	}
+
+	return &pb.RawTransactionResponse{
+		Hex:         rawTx.Hex,
+		Hash:        rawTx.Hash,
+		WitnessHash: rawTx.WitnessHash,
+		StrippedHex: rawTx.StrippedHex,
+	}, nil
+}
+
+func (c *controller) EstimateTxSize(
+	ctx context.Context, request *pb.EstimateTxSizeRequest,
+) (*pb.EstimateTxSizeResponse, error) {
+	if err := c.limits.checkInputs(len(request.UtxoScripts)); err != nil {
+		return nil, errorStatus(codes.InvalidArgument, err)
+	}
+
+	if err := c.limits.checkOutputs(len(request.OutputScripts)); err != nil {
+		return nil, errorStatus(codes.InvalidArgument, err)
+	}
+
+	size := c.svc.EstimateTxSize(request.UtxoScripts, request.OutputScripts)
+
+	return &pb.EstimateTxSizeResponse{
+		Size:        int64(size.Size),
+		Weight:      int64(size.Weight),
+		VirtualSize: int64(size.VirtualSize),
+	}, nil
+}
+
+func (c *controller) AddressesFromPublicKey(
+	ctx context.Context, request *pb.AddressesFromPublicKeyRequest,
+) (*pb.AddressesFromPublicKeyResponse, error) {
+	chainParams, err := ChainParams(request.ChainParams)
+	if err != nil {
+		return nil, errorStatus(codes.InvalidArgument, err)
+	}
+
+	addresses, err := c.svc.AddressesFromPublicKey(request.PublicKey, chainParams)
+	if err != nil {
+		return nil, errorStatus(codes.InvalidArgument, err)
+	}
+
+	return &pb.AddressesFromPublicKeyResponse{
+		LegacyAddress:        addresses.Legacy,
+		WrappedSegwitAddress: addresses.WrappedSegwit,
+		NativeSegwitAddress:  addresses.NativeSegwit,
+		TaprootAddress:       addresses.Taproot,
+	}, nil
+}
+
+func (c *controller) GetMasterFingerprint(
+	ctx context.Context, request *pb.GetMasterFingerprintRequest,
+) (*pb.MasterFingerprintResponse, error) {
+	chainParams, err := ChainParams(request.ChainParams)
+	if err != nil {
+		return nil, errorStatus(codes.InvalidArgument, err)
+	}
+
+	fingerprint, err := c.svc.MasterFingerprint(request.Seed, chainParams)
+	if err != nil {
+		return nil, errorStatus(codes.InvalidArgument, err)
+	}
+
+	return &pb.MasterFingerprintResponse{Fingerprint: fingerprint[:]}, nil
+}
+
+func (c *controller) MasterFingerprintFromMnemonic(
+	ctx context.Context, request *pb.MasterFingerprintFromMnemonicRequest,
+) (*pb.MasterFingerprintResponse, error) {
+	chainParams, err := ChainParams(request.ChainParams)
+	if err != nil {
+		return nil, errorStatus(codes.InvalidArgument, err)
+	}
+
+	fingerprint, err := c.svc.MasterFingerprintFromMnemonic(
+		request.Mnemonic, request.Passphrase, chainParams)
+
+	if err != nil {
+		return nil, errorStatus(codes.Internal, err)
+	}
+
+	return &pb.MasterFingerprintResponse{Fingerprint: fingerprint[:]}, nil
+}
+
+func (c *controller) CreateCltvScript(
+	ctx context.Context, request *pb.CreateCltvScriptRequest,
+) (*pb.CreateCltvScriptResponse, error) {
+	script, err := c.svc.CreateCltvScript(request.PublicKey, request.Locktime)
+	if err != nil {
+		return nil, errorStatus(codes.InvalidArgument, err)
+	}
+
+	return &pb.CreateCltvScriptResponse{Script: script}, nil
+}
+
+func (c *controller) Bip85DeriveMnemonic(
+	ctx context.Context, request *pb.Bip85DeriveMnemonicRequest,
+) (*pb.Bip85DeriveMnemonicResponse, error) {
+	mnemonic, err := c.svc.Bip85DeriveMnemonic(
+		request.MasterXprv, request.Language, request.Words, request.Index)
+	if err != nil {
+		return nil, errorStatus(codes.InvalidArgument, err)
+	}
+
+	return &pb.Bip85DeriveMnemonicResponse{Mnemonic: mnemonic}, nil
+}
+
+func (c *controller) InspectExtendedKey(
+	ctx context.Context, request *pb.InspectExtendedKeyRequest,
+) (*pb.InspectExtendedKeyResponse, error) {
+	info, err := c.svc.InspectExtendedKey(request.ExtendedKey)
+	if err != nil {
+		return nil, errorStatus(codes.InvalidArgument, err)
+	}
+
+	return &pb.InspectExtendedKeyResponse{
+		Depth:             uint32(info.Depth),
+		ChildNumber:       info.ChildNumber,
+		ParentFingerprint: info.ParentFingerprint[:],
+		IsPrivate:         info.IsPrivate,
+		Encoding:          AddressEncodingProto(info.Encoding),
+		Network:           info.ChainParams.Name,
+	}, nil
+}
+
+func (c *controller) DecodeRawTransaction(
+	ctx context.Context, request *pb.DecodeRawTransactionRequest,
+) (*pb.DecodeRawTransactionResponse, error) {
+	decodedRawTx, err := c.svc.DecodeRawTransaction(request.Hex)
+	if err != nil {
+		return nil, errorStatus(codes.InvalidArgument, err)
+	}
+
+	return &pb.DecodeRawTransactionResponse{
+		Hash:             decodedRawTx.Hash,
+		WitnessHash:      decodedRawTx.WitnessHash,
+		SegwitSerialized: decodedRawTx.SegwitSerialized,
+	}, nil
+}
+
+func (c *controller) TxidFromHex(
+	ctx context.Context, request *pb.TxidFromHexRequest,
+) (*pb.TxidFromHexResponse, error) {
+	txid, wtxid, err := c.svc.TxidFromHex(request.Hex)
+	if err != nil {
+		return nil, errorStatus(codes.InvalidArgument, err)
+	}
+
+	return &pb.TxidFromHexResponse{Txid: txid, Wtxid: wtxid}, nil
+}
+
+func (c *controller) DecodeTransaction(
+	ctx context.Context, request *pb.DecodeTransactionRequest,
+) (*pb.DecodeTransactionResponse, error) {
+	chainParams, err := ChainParams(request.ChainParams)
+	if err != nil {
+		return nil, errorStatus(codes.InvalidArgument, err)
+	}
+
+	if err := c.limits.checkInputs(len(request.Prevouts)); err != nil {
+		return nil, errorStatus(codes.InvalidArgument, err)
+	}
+
+	decodedTx, err := c.svc.DecodeTransaction(request.Hex, Inputs(request.Prevouts), chainParams)
+	if err != nil {
+		return nil, errorStatus(codes.InvalidArgument, err)
+	}
+
+	return DecodedTxProto(decodedTx), nil
+}
+
+func (c *controller) SignAndVerifyTransaction(
+	ctx context.Context, request *pb.SignAndVerifyTransactionRequest,
+) (*pb.SignAndVerifyTransactionResponse, error) {
+
+	if err := c.limits.checkInputs(len(request.Utxos)); err != nil {
+		return nil, errorStatus(codes.InvalidArgument, err)
+	}
+
+	chainParams, err := ChainParams(request.ChainParams)
+	if err != nil {
+		return nil, errorStatus(codes.InvalidArgument, err)
+	}
+
+	rawTx := RawTx(request.RawTx)
+
+	utxos := make([]core.Utxo, len(request.Utxos))
+	for idx, utxoProto := range request.Utxos {
+		utxo, err := Utxo(utxoProto)
+		if err != nil {
+			return nil, errorStatus(codes.InvalidArgument, err)
+		}
+		utxos[idx] = *utxo
+	}
+
+	signatures := make([]core.SignatureMetadata, len(request.Signatures))
+	for idx, signature := range request.Signatures {
+		sigMetadata, err := SignatureMetadata(signature, chainParams)
+		if err != nil {
+			return nil, errorStatus(codes.InvalidArgument, err)
+		}
+		signatures[idx] = *sigMetadata
+	}
+
+	msgTx, err := c.svc.DeserializeMsgTx(rawTx)
+	if err != nil {
+		return nil, errorStatus(codes.InvalidArgument, err)
+	}
+
+	signedRawTx, err := c.svc.SignAndVerifyTransaction(
+		msgTx, utxos, request.PrivateKey, signatures, chainParams)
+	if verificationErr, ok := errors.Cause(err).(*core.VerificationError); ok {
+		failures := make([]*pb.InputVerificationFailure, len(verificationErr.Failures))
+		for idx, failure := range verificationErr.Failures {
+			failures[idx] = &pb.InputVerificationFailure{
+				InputIndex: uint32(failure.InputIndex),
+				Reason:     failure.Reason,
+			}
+		}
+
+		return &pb.SignAndVerifyTransactionResponse{Failures: failures}, nil
+	}
+
+	if err != nil {
+		return nil, errorStatus(codes.Internal, err)
+	}
+
+	return &pb.SignAndVerifyTransactionResponse{
+		SignedRawTx: &pb.RawTransactionResponse{
+			Hex:         signedRawTx.Hex,
+			Hash:        signedRawTx.Hash,
+			WitnessHash: signedRawTx.WitnessHash,
+			StrippedHex: signedRawTx.StrippedHex,
+		},
+	}, nil
+}
+
+func (c *controller) PrepareForHardwareSigning(
+	ctx context.Context, request *pb.PrepareForHardwareSigningRequest,
+) (*pb.PrepareForHardwareSigningResponse, error) {
+
+	if err := c.limits.checkInputs(len(request.Utxos)); err != nil {
+		return nil, errorStatus(codes.InvalidArgument, err)
+	}
+
+	chainParams, err := ChainParams(request.ChainParams)
+	if err != nil {
+		return nil, errorStatus(codes.InvalidArgument, err)
+	}
+
+	rawTx := RawTx(request.RawTx)
+
+	utxos := make([]core.Utxo, len(request.Utxos))
+	for idx, utxoProto := range request.Utxos {
+		utxo, err := Utxo(utxoProto)
+		if err != nil {
+			return nil, errorStatus(codes.InvalidArgument, err)
+		}
+		utxos[idx] = *utxo
+	}
+
+	msgTx, err := c.svc.DeserializeMsgTx(rawTx)
+	if err != nil {
+		return nil, errorStatus(codes.InvalidArgument, err)
+	}
+
+	inputs, err := c.svc.PrepareForHardwareSigning(msgTx, utxos, chainParams)
+	if err != nil {
+		return nil, errorStatus(codes.InvalidArgument, err)
+	}
+
+	inputsProto := make([]*pb.HardwareSigningInput, len(inputs))
+	for idx, input := range inputs {
+		inputsProto[idx] = HardwareSigningInputProto(input)
+	}
+
+	return &pb.PrepareForHardwareSigningResponse{Inputs: inputsProto}, nil
+}
+
+func (c *controller) ImportWif(
+	ctx context.Context, request *pb.ImportWifRequest,
+) (*pb.ImportWifResponse, error) {
+	chainParams, err := ChainParams(request.ChainParams)
+	if err != nil {
+		return nil, errorStatus(codes.InvalidArgument, err)
+	}
+
+	key, err := c.svc.ImportWIF(request.Wif, chainParams)
+	if err != nil {
+		return nil, errorStatus(codes.InvalidArgument, err)
+	}
+
+	return &pb.ImportWifResponse{
+		PrivateKey:          key.PrivateKey,
+		PublicKey:           key.PublicKey,
+		Compressed:          key.Compressed,
+		LegacyAddress:       key.LegacyAddress,
+		NativeSegwitAddress: key.NativeSegwitAddress,
+	}, nil
+}
+
+func (c *controller) ExportWif(
+	ctx context.Context, request *pb.ExportWifRequest,
+) (*pb.ExportWifResponse, error) {
+	chainParams, err := ChainParams(request.ChainParams)
+	if err != nil {
+		return nil, errorStatus(codes.InvalidArgument, err)
+	}
+
+	wif, err := c.svc.ExportWIF(request.PrivateKey, request.Compressed, chainParams)
+	if err != nil {
+		return nil, errorStatus(codes.InvalidArgument, err)
+	}
+
+	return &pb.ExportWifResponse{
+		Wif: wif,
+	}, nil
+}
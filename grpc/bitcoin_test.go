@@ -0,0 +1,222 @@
+package grpc
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	pb "github.com/ledgerhq/bitcoin-lib-grpc/pb/bitcoin"
+	"github.com/ledgerhq/bitcoin-lib-grpc/version"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+)
+
+// newTestClient serves a bitcoin controller on an in-memory connection, and
+// returns a client connected to it.
+//
+// The server wraps stream handlers with interceptor, if not nil.
+func newTestClient(
+	t *testing.T, interceptor grpc.StreamServerInterceptor,
+) (pb.CoinServiceClient, func()) {
+	listener := bufconn.Listen(1024 * 1024)
+
+	var opts []grpc.ServerOption
+	if interceptor != nil {
+		opts = append(opts, grpc.StreamInterceptor(interceptor))
+	}
+
+	server := grpc.NewServer(opts...)
+	pb.RegisterCoinServiceServer(server, NewBitcoinController())
+
+	go func() {
+		_ = server.Serve(listener)
+	}()
+
+	conn, err := grpc.Dial("bufnet",
+		grpc.WithContextDialer(func(context.Context, string) (net.Conn, error) {
+			return listener.Dial()
+		}),
+		grpc.WithInsecure(),
+	)
+	if err != nil {
+		t.Fatalf("failed to dial bufnet: %v", err)
+	}
+
+	return pb.NewCoinServiceClient(conn), func() {
+		conn.Close()
+		server.Stop()
+	}
+}
+
+func TestDeriveAddressesStream_Cancel(t *testing.T) {
+	handlerDone := make(chan error, 1)
+
+	client, closeClient := newTestClient(t, func(
+		srv interface{}, ss grpc.ServerStream,
+		info *grpc.StreamServerInfo, handler grpc.StreamHandler,
+	) error {
+		err := handler(srv, ss)
+		handlerDone <- err
+		return err
+	})
+	defer closeClient()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	stream, err := client.DeriveAddressesStream(ctx, &pb.DeriveAddressesRequest{
+		// BIP0084: Test Vectors (account 0, m/84'/0'/0')
+		AccountKey: "zpub6rFR7y4Q2AijBEqTUquhVz398htDFrtymD9xYYfG1m4wAcvPhXNfE3EfH1r1ADqtfSdVCToUG868RvUUkgDKf31mGDtKsAYz2oz2AGutZYs",
+		Encoding:   pb.AddressEncoding_ADDRESS_ENCODING_P2WPKH,
+		Count:      100000,
+		ChainParams: &pb.ChainParams{
+			Network: &pb.ChainParams_BitcoinNetwork{
+				BitcoinNetwork: pb.BitcoinNetwork_BITCOIN_NETWORK_MAINNET,
+			},
+		},
+	})
+	if err != nil {
+		t.Fatalf("DeriveAddressesStream() got error '%v'", err)
+	}
+
+	for i := uint32(0); i < 10; i++ {
+		address, err := stream.Recv()
+		if err != nil {
+			t.Fatalf("Recv() got error '%v'", err)
+		}
+
+		if address.Index != i {
+			t.Fatalf("Recv() got index %d, want %d", address.Index, i)
+		}
+	}
+
+	cancel()
+
+	// Deriving the 100000 requested addresses takes several seconds, so the
+	// handler must return well before, if it stops on cancellation.
+	select {
+	case err := <-handlerDone:
+		if err == nil {
+			t.Fatal("DeriveAddressesStream() handler completed without error")
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("DeriveAddressesStream() handler did not stop after cancellation")
+	}
+}
+
+func TestDeriveAddresses_DeadlineExceeded(t *testing.T) {
+	ctx, cancel := context.WithDeadline(context.Background(), time.Now().Add(-time.Second))
+	defer cancel()
+
+	// The controller is called directly, since the client would not send a
+	// request whose deadline is already exceeded. The address count is not
+	// bounded, so that the derivation is interrupted by the deadline.
+	_, err := NewBitcoinControllerWithLimits(Limits{}).DeriveAddresses(ctx, &pb.DeriveAddressesRequest{
+		// BIP0084: Test Vectors (account 0, m/84'/0'/0')
+		AccountKey: "zpub6rFR7y4Q2AijBEqTUquhVz398htDFrtymD9xYYfG1m4wAcvPhXNfE3EfH1r1ADqtfSdVCToUG868RvUUkgDKf31mGDtKsAYz2oz2AGutZYs",
+		Encoding:   pb.AddressEncoding_ADDRESS_ENCODING_P2WPKH,
+		Count:      1000000,
+		ChainParams: &pb.ChainParams{
+			Network: &pb.ChainParams_BitcoinNetwork{
+				BitcoinNetwork: pb.BitcoinNetwork_BITCOIN_NETWORK_MAINNET,
+			},
+		},
+	})
+	if status.Code(err) != codes.DeadlineExceeded {
+		t.Fatalf("DeriveAddresses() got error '%v', want code %v", err, codes.DeadlineExceeded)
+	}
+}
+
+func TestCreateTransactions(t *testing.T) {
+	txRequest := func(inputValue int64, outputAddress string, network pb.BitcoinNetwork) *pb.CreateTransactionRequest {
+		return &pb.CreateTransactionRequest{
+			Inputs: []*pb.Input{
+				{
+					OutputHash:  "2f5dae23c2e18588c86cfc4e154f3b68bd8eb4265fe0b4b1341ad5aa40422f66",
+					OutputIndex: 0,
+					Value:       inputValue,
+				},
+			},
+			Outputs: []*pb.Output{
+				{Address: outputAddress, Value: "100000"},
+			},
+			ChangeAddress: outputAddress,
+			FeeSatPerKb:   1000,
+			ChainParams: &pb.ChainParams{
+				Network: &pb.ChainParams_BitcoinNetwork{BitcoinNetwork: network},
+			},
+		}
+	}
+
+	// The transactions are independent, and each has its own network.
+	request := &pb.CreateTransactionsRequest{
+		Transactions: []*pb.CreateTransactionRequest{
+			txRequest(1000000, "1MZbRqZGpiSWGRLg8DUdVrDKHwNe1oesUZ", pb.BitcoinNetwork_BITCOIN_NETWORK_MAINNET),
+			txRequest(100000, "1MZbRqZGpiSWGRLg8DUdVrDKHwNe1oesUZ", pb.BitcoinNetwork_BITCOIN_NETWORK_MAINNET),
+			txRequest(1000000, "tb1qw508d6qejxtdg4y5r3zarvary0c5xw7kxpjzsx", pb.BitcoinNetwork_BITCOIN_NETWORK_MAINNET),
+			txRequest(1000000, "tb1qw508d6qejxtdg4y5r3zarvary0c5xw7kxpjzsx", pb.BitcoinNetwork_BITCOIN_NETWORK_TESTNET3),
+		},
+	}
+
+	c := NewBitcoinController()
+
+	got, err := c.CreateTransactions(context.Background(), request)
+	if err != nil {
+		t.Fatalf("CreateTransactions() got error '%v'", err)
+	}
+
+	if len(got.Results) != len(request.Transactions) {
+		t.Fatalf("CreateTransactions() got %d results, want %d",
+			len(got.Results), len(request.Transactions))
+	}
+
+	// The results are those of independent calls to CreateTransaction.
+	for _, idx := range []int{0, 3} {
+		want, err := c.CreateTransaction(context.Background(), request.Transactions[idx])
+		if err != nil {
+			t.Fatalf("CreateTransaction() got error '%v' for tx %d", err, idx)
+		}
+
+		if result := got.Results[idx]; result.ErrorCode != 0 ||
+			result.Transaction.GetTotalFees() != want.TotalFees ||
+			result.Transaction.GetChangeAmount() != want.ChangeAmount {
+			t.Fatalf("CreateTransactions() got %v for tx %d, want fees %d and change %d",
+				result, idx, want.TotalFees, want.ChangeAmount)
+		}
+	}
+
+	if result := got.Results[1]; result.Transaction.GetNotEnoughUtxo() == nil {
+		t.Fatalf("CreateTransactions() got %v for tx 1, want insufficient funds", result)
+	}
+
+	if result := got.Results[2]; result.ErrorCode != int32(codes.InvalidArgument) ||
+		result.ErrorReason != ReasonNetworkMismatch {
+		t.Fatalf("CreateTransactions() got %v for tx 2, want code %v and reason %s",
+			result, codes.InvalidArgument, ReasonNetworkMismatch)
+	}
+}
+
+func TestGetVersion(t *testing.T) {
+	client, closeClient := newTestClient(t, nil)
+	defer closeClient()
+
+	version.GitCommit = "abc1234"
+	version.BuildDate = "2021-01-01T00:00:00Z"
+	defer func() {
+		version.GitCommit = ""
+		version.BuildDate = ""
+	}()
+
+	got, err := client.GetVersion(context.Background(), &pb.GetVersionRequest{})
+	if err != nil {
+		t.Fatalf("GetVersion() got error '%v'", err)
+	}
+
+	if got.Version != version.Version || got.CommitHash != "abc1234" ||
+		got.BuildDate != "2021-01-01T00:00:00Z" {
+		t.Fatalf("GetVersion() got %v", got)
+	}
+}
@@ -1,7 +1,177 @@
 package grpc
 
-import "errors"
+import (
+	"errors"
+	"strconv"
+
+	"github.com/ledgerhq/bitcoin-lib-grpc/pkg/core"
+	pkgerrors "github.com/pkg/errors"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
 
 // ErrUnknownNetwork is returned when a string representing an unknown network
 // is found.
 var ErrUnknownNetwork = errors.New("invalid network")
+
+// ErrorDomain is the domain of the ErrorInfo details attached to the errors
+// returned by the controllers.
+const ErrorDomain = "github.com/ledgerhq/bitcoin-lib-grpc"
+
+// Reasons of the ErrorInfo details attached to the errors returned by the
+// controllers, for machine-readable handling of the known error causes.
+const (
+	ReasonInsufficientFunds        = "INSUFFICIENT_FUNDS"
+	ReasonInvalidAddress           = "INVALID_ADDRESS"
+	ReasonDeriveHardenedFromPublic = "DERIVE_HARDENED_FROM_PUBLIC"
+	ReasonNotPrivateExtendedKey    = "NOT_PRIVATE_EXTENDED_KEY"
+	ReasonUnknownNetwork           = "UNKNOWN_NETWORK"
+	ReasonNetworkMismatch          = "NETWORK_MISMATCH"
+	ReasonInvalidPrivateKey        = "INVALID_PRIVATE_KEY"
+	ReasonPublicKeyMismatch        = "PUBLIC_KEY_MISMATCH"
+	ReasonNonCanonicalSignature    = "NON_CANONICAL_SIGNATURE"
+	ReasonInvalidMnemonic          = "INVALID_MNEMONIC"
+	ReasonNoOutputs                = "NO_OUTPUTS"
+	ReasonDustOutput               = "DUST_OUTPUT"
+	ReasonOutputValueTooHigh       = "OUTPUT_VALUE_TOO_HIGH"
+	ReasonUnenforcedLockTime       = "UNENFORCED_LOCK_TIME"
+	ReasonFeeRateTooHigh           = "FEE_RATE_TOO_HIGH"
+	ReasonFeeRateTooLow            = "FEE_RATE_TOO_LOW"
+	ReasonNonStandardScript        = "NON_STANDARD_SCRIPT"
+	ReasonInvalidSendMax           = "INVALID_SEND_MAX"
+	ReasonInvalidFee               = "INVALID_FEE"
+	ReasonInvalidChange            = "INVALID_CHANGE"
+	ReasonInvalidChangeRatio       = "INVALID_CHANGE_RATIO"
+	ReasonUnknownOrdering          = "UNKNOWN_ORDERING"
+	ReasonInvalidDustChangePolicy  = "INVALID_DUST_CHANGE_POLICY"
+	ReasonInvalidSizePadding       = "INVALID_SIZE_PADDING"
+	ReasonLengthMismatch           = "LENGTH_MISMATCH"
+	ReasonUncompressedPublicKey    = "UNCOMPRESSED_PUBLIC_KEY"
+	ReasonInvalidControlBlock      = "INVALID_CONTROL_BLOCK"
+	ReasonAddressEncodingMismatch  = "ADDRESS_ENCODING_MISMATCH"
+	ReasonInvalidDescriptor        = "INVALID_DESCRIPTOR"
+	ReasonInvalidSeedLength        = "INVALID_SEED_LENGTH"
+	ReasonInvalidBip85Parameters   = "INVALID_BIP85_PARAMETERS"
+	ReasonInvalidRedeemScript      = "INVALID_REDEEM_SCRIPT"
+	ReasonPreviousTxMismatch       = "PREVIOUS_TX_MISMATCH"
+	ReasonUnknownHDKeyVersion      = "UNKNOWN_HD_KEY_VERSION"
+	ReasonInvalidEntropySize       = "INVALID_ENTROPY_SIZE"
+	ReasonInvalidMessageSignature  = "INVALID_MESSAGE_SIGNATURE"
+)
+
+// knownError is the status code, and the reason of the ErrorInfo detail, of
+// a known error cause.
+type knownError struct {
+	code   codes.Code
+	reason string
+}
+
+// knownErrors maps the known error causes to their status code and reason.
+// All of them are caused by the arguments of a request.
+var knownErrors = map[error]knownError{
+	core.ErrUnknownAddressType:      {codes.InvalidArgument, ReasonInvalidAddress},
+	core.ErrBech32Variant:           {codes.InvalidArgument, ReasonInvalidAddress},
+	core.ErrInvalidCashAddr:         {codes.InvalidArgument, ReasonInvalidAddress},
+	core.ErrMwebAddress:             {codes.InvalidArgument, ReasonInvalidAddress},
+	core.ErrDeriveHardFromPublic:    {codes.InvalidArgument, ReasonDeriveHardenedFromPublic},
+	core.ErrNotPrivateExtendedKey:   {codes.InvalidArgument, ReasonNotPrivateExtendedKey},
+	ErrUnknownNetwork:               {codes.InvalidArgument, ReasonUnknownNetwork},
+	core.ErrNetworkMismatch:         {codes.InvalidArgument, ReasonNetworkMismatch},
+	core.ErrInvalidPrivateKey:       {codes.InvalidArgument, ReasonInvalidPrivateKey},
+	core.ErrPublicKeyMismatch:       {codes.InvalidArgument, ReasonPublicKeyMismatch},
+	core.ErrNonCanonicalSignature:   {codes.InvalidArgument, ReasonNonCanonicalSignature},
+	core.ErrInvalidMnemonic:         {codes.InvalidArgument, ReasonInvalidMnemonic},
+	core.ErrNoOutputs:               {codes.InvalidArgument, ReasonNoOutputs},
+	core.ErrDustOutput:              {codes.InvalidArgument, ReasonDustOutput},
+	core.ErrOutputValueTooHigh:      {codes.InvalidArgument, ReasonOutputValueTooHigh},
+	core.ErrUnenforcedLockTime:      {codes.InvalidArgument, ReasonUnenforcedLockTime},
+	core.ErrFeeRateTooHigh:          {codes.InvalidArgument, ReasonFeeRateTooHigh},
+	core.ErrFeeRateTooLow:           {codes.InvalidArgument, ReasonFeeRateTooLow},
+	core.ErrNonStandardScript:       {codes.InvalidArgument, ReasonNonStandardScript},
+	core.ErrInvalidSendMax:          {codes.InvalidArgument, ReasonInvalidSendMax},
+	core.ErrInvalidFee:              {codes.InvalidArgument, ReasonInvalidFee},
+	core.ErrInvalidChange:           {codes.InvalidArgument, ReasonInvalidChange},
+	core.ErrInvalidChangeRatio:      {codes.InvalidArgument, ReasonInvalidChangeRatio},
+	core.ErrUnknownOrdering:         {codes.InvalidArgument, ReasonUnknownOrdering},
+	core.ErrInvalidDustChangePolicy: {codes.InvalidArgument, ReasonInvalidDustChangePolicy},
+	core.ErrInvalidSizePadding:      {codes.InvalidArgument, ReasonInvalidSizePadding},
+	core.ErrLengthMismatch:          {codes.InvalidArgument, ReasonLengthMismatch},
+	core.ErrUncompressedPublicKey:   {codes.InvalidArgument, ReasonUncompressedPublicKey},
+	core.ErrInvalidControlBlock:     {codes.InvalidArgument, ReasonInvalidControlBlock},
+	core.ErrAddressEncodingMismatch: {codes.InvalidArgument, ReasonAddressEncodingMismatch},
+	core.ErrInvalidDescriptor:       {codes.InvalidArgument, ReasonInvalidDescriptor},
+	core.ErrInvalidSeedLength:       {codes.InvalidArgument, ReasonInvalidSeedLength},
+	core.ErrInvalidBip85Parameters:  {codes.InvalidArgument, ReasonInvalidBip85Parameters},
+	core.ErrInvalidRedeemScript:     {codes.InvalidArgument, ReasonInvalidRedeemScript},
+	core.ErrPreviousTxMismatch:      {codes.InvalidArgument, ReasonPreviousTxMismatch},
+	core.ErrUnknownHDKeyVersion:     {codes.InvalidArgument, ReasonUnknownHDKeyVersion},
+	core.ErrInvalidEntropySize:      {codes.InvalidArgument, ReasonInvalidEntropySize},
+	core.ErrInvalidMessageSignature: {codes.InvalidArgument, ReasonInvalidMessageSignature},
+}
+
+// errorInfo returns the ErrorInfo detail of an error with a known cause, or
+// nil otherwise.
+func errorInfo(err error) *errdetails.ErrorInfo {
+	var insufficientFunds *core.ErrInsufficientFunds
+	if errors.As(err, &insufficientFunds) {
+		return &errdetails.ErrorInfo{
+			Reason: ReasonInsufficientFunds,
+			Domain: ErrorDomain,
+			Metadata: map[string]string{
+				"missing_amount": strconv.FormatInt(insufficientFunds.MissingAmount, 10),
+			},
+		}
+	}
+
+	if known, ok := knownErrors[pkgerrors.Cause(err)]; ok {
+		return &errdetails.ErrorInfo{Reason: known.reason, Domain: ErrorDomain}
+	}
+
+	return nil
+}
+
+// errorStatus converts an error to a gRPC status error with the message of
+// the error. If the cause of the error is known, the status has the code of
+// the cause, and an ErrorInfo detail is attached; otherwise, it has the given
+// code. Addresses that cannot be decoded always map to InvalidArgument.
+func errorStatus(code codes.Code, err error) error {
+	var invalidAddress *core.ErrInvalidAddress
+	if errors.As(err, &invalidAddress) {
+		return addressErrorStatus(err)
+	}
+
+	if known, ok := knownErrors[pkgerrors.Cause(err)]; ok {
+		code = known.code
+	}
+
+	return withErrorInfo(status.New(code, err.Error()), errorInfo(err))
+}
+
+// addressErrorStatus converts an error decoding an address to an
+// InvalidArgument status error. An ErrorInfo detail is always attached, with
+// ReasonInvalidAddress unless a more specific cause is known, since address
+// decoding errors of btcutil have no sentinel.
+func addressErrorStatus(err error) error {
+	info := errorInfo(err)
+	if info == nil {
+		info = &errdetails.ErrorInfo{Reason: ReasonInvalidAddress, Domain: ErrorDomain}
+	}
+
+	return withErrorInfo(status.New(codes.InvalidArgument, err.Error()), info)
+}
+
+// withErrorInfo returns the error of a status, with the ErrorInfo detail
+// attached if not nil.
+func withErrorInfo(st *status.Status, info *errdetails.ErrorInfo) error {
+	if info == nil {
+		return st.Err()
+	}
+
+	detailed, err := st.WithDetails(info)
+	if err != nil {
+		return st.Err()
+	}
+
+	return detailed.Err()
+}
@@ -0,0 +1,483 @@
+package grpc
+
+import (
+	"context"
+	"testing"
+
+	pb "github.com/ledgerhq/bitcoin-lib-grpc/pb/bitcoin"
+	"github.com/ledgerhq/bitcoin-lib-grpc/pkg/core"
+	"github.com/pkg/errors"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// statusErrorInfo returns the ErrorInfo detail of a status error, or nil.
+func statusErrorInfo(err error) *errdetails.ErrorInfo {
+	for _, detail := range status.Convert(err).Details() {
+		if info, ok := detail.(*errdetails.ErrorInfo); ok {
+			return info
+		}
+	}
+
+	return nil
+}
+
+func TestErrorDetails(t *testing.T) {
+	client, closeClient := newTestClient(t, nil)
+	defer closeClient()
+
+	mainnet := &pb.ChainParams{
+		Network: &pb.ChainParams_BitcoinNetwork{
+			BitcoinNetwork: pb.BitcoinNetwork_BITCOIN_NETWORK_MAINNET,
+		},
+	}
+
+	// BIP0032: Test Vector 1 (chain m)
+	const (
+		xprv = "xprv9s21ZrQH143K3QTDL4LXw2F7HEK3wJUD2nW2nRk4stbPy6cq3jPPqjiChkVvvNKmPGJxWUtg6LnF5kejMRNNU3TGtRBeJgk33yuGBxrMPHi"
+		xpub = "xpub661MyMwAqRbcFtXgS5sYJABqqG9YLmC4Q1Rdap9gSE8NqtwybGhePY2gZ29ESFjqJoCu1Rupje8YtGqsefD265TMg7usUDFdp6W1EGMcet8"
+		tprv = "tprv8ZgxMBicQKsPeDgjzdC36fs6bMjGApWDNLR9erAXMs5skhMv36j9MV5ecvfavji5khqjWaWSFhN3YcCUUdiKH6isR4Pwy3U5y5egddBr16m"
+	)
+
+	// Unsigned transaction spending a single P2WPKH output of the master
+	// key of the test vector.
+	const unsignedTxHex = "0100000001" +
+		"662f4240aad51a34b1b4e05f26b48ebd683b4f154efc6cc88885e1c223ae5d2f" +
+		"0000000000ffffffff0000000000"
+
+	utxos := []*pb.Utxo{
+		{ScriptHex: "00143442193e1bb70916e914552172cd4e2dbc9df811", Value: "100000"},
+	}
+
+	signatures := []*pb.SignatureMetadata{
+		{
+			PublicKey:    "0339a36013301597daef41fbe593a02cc513d0b55527ec2df1050e2e8ff49c85c2",
+			AddrEncoding: pb.AddressEncoding_ADDRESS_ENCODING_P2WPKH,
+		},
+	}
+
+	tests := []struct {
+		name       string
+		call       func() error
+		wantCode   codes.Code
+		wantReason string
+	}{
+		{
+			name: "invalid address",
+			call: func() error {
+				_, err := client.AddressToScript(context.Background(), &pb.AddressToScriptRequest{
+					Address:     "bc1qhm6697d9d2224vfyt8mj4kw03ncec7a7fdafvu",
+					ChainParams: mainnet,
+				})
+				return err
+			},
+			wantCode:   codes.InvalidArgument,
+			wantReason: ReasonInvalidAddress,
+		},
+		{
+			name: "hardened derivation from public key",
+			call: func() error {
+				_, err := client.DeriveExtendedKey(context.Background(), &pb.DeriveExtendedKeyRequest{
+					// BIP0032: Test Vector 1 (chain m)
+					ExtendedKey: "xpub661MyMwAqRbcFtXgS5sYJABqqG9YLmC4Q1Rdap9gSE8NqtwybGhePY2gZ29ESFjqJoCu1Rupje8YtGqsefD265TMg7usUDFdp6W1EGMcet8",
+					Derivation:  []uint32{0x80000000},
+				})
+				return err
+			},
+			wantCode:   codes.InvalidArgument,
+			wantReason: ReasonDeriveHardenedFromPublic,
+		},
+		{
+			name: "dust output",
+			call: func() error {
+				_, err := client.CreateTransaction(context.Background(), &pb.CreateTransactionRequest{
+					Inputs: []*pb.Input{
+						{
+							OutputHash:  "2f5dae23c2e18588c86cfc4e154f3b68bd8eb4265fe0b4b1341ad5aa40422f66",
+							OutputIndex: 0,
+							Value:       100000,
+						},
+					},
+					Outputs: []*pb.Output{
+						{Address: "1MZbRqZGpiSWGRLg8DUdVrDKHwNe1oesUZ", Value: "100"},
+					},
+					ChangeAddress: "1GgX4cGLiqF9p4Sd1XcPQhEAAhNDA4wLYS",
+					FeeSatPerKb:   1000,
+					ChainParams:   mainnet,
+				})
+				return err
+			},
+			wantCode:   codes.InvalidArgument,
+			wantReason: ReasonDustOutput,
+		},
+		{
+			name: "mistyped output address",
+			call: func() error {
+				_, err := client.CreateTransaction(context.Background(), &pb.CreateTransactionRequest{
+					Inputs: []*pb.Input{
+						{
+							OutputHash:  "2f5dae23c2e18588c86cfc4e154f3b68bd8eb4265fe0b4b1341ad5aa40422f66",
+							OutputIndex: 0,
+							Value:       100000,
+						},
+					},
+					Outputs: []*pb.Output{
+						// The last character of 1MZbRqZGpiSWGRLg8DUdVrDKHwNe1oesUZ
+						// is mistyped.
+						{Address: "1MZbRqZGpiSWGRLg8DUdVrDKHwNe1oesUY", Value: "10000"},
+					},
+					ChangeAddress: "1GgX4cGLiqF9p4Sd1XcPQhEAAhNDA4wLYS",
+					FeeSatPerKb:   1000,
+					ChainParams:   mainnet,
+				})
+				return err
+			},
+			wantCode:   codes.InvalidArgument,
+			wantReason: ReasonInvalidAddress,
+		},
+		{
+			name: "output address with the wrong bech32 variant",
+			call: func() error {
+				_, err := client.CreateTransaction(context.Background(), &pb.CreateTransactionRequest{
+					Inputs: []*pb.Input{
+						{
+							OutputHash:  "2f5dae23c2e18588c86cfc4e154f3b68bd8eb4265fe0b4b1341ad5aa40422f66",
+							OutputIndex: 0,
+							Value:       100000,
+						},
+					},
+					Outputs: []*pb.Output{
+						// BIP0350: witness v0 address encoded with bech32m.
+						{Address: "bc1qw508d6qejxtdg4y5r3zarvary0c5xw7kemeawh", Value: "10000"},
+					},
+					ChangeAddress: "1GgX4cGLiqF9p4Sd1XcPQhEAAhNDA4wLYS",
+					FeeSatPerKb:   1000,
+					ChainParams:   mainnet,
+				})
+				return err
+			},
+			wantCode:   codes.InvalidArgument,
+			wantReason: ReasonInvalidAddress,
+		},
+		{
+			name: "send max with several outputs",
+			call: func() error {
+				_, err := client.CreateTransaction(context.Background(), &pb.CreateTransactionRequest{
+					Inputs: []*pb.Input{
+						{
+							OutputHash:  "2f5dae23c2e18588c86cfc4e154f3b68bd8eb4265fe0b4b1341ad5aa40422f66",
+							OutputIndex: 0,
+							Value:       100000,
+						},
+					},
+					Outputs: []*pb.Output{
+						{Address: "1MZbRqZGpiSWGRLg8DUdVrDKHwNe1oesUZ", Value: "10000"},
+						{Address: "1GgX4cGLiqF9p4Sd1XcPQhEAAhNDA4wLYS", Value: "10000"},
+					},
+					SendMax:     true,
+					FeeSatPerKb: 1000,
+					ChainParams: mainnet,
+				})
+				return err
+			},
+			wantCode:   codes.InvalidArgument,
+			wantReason: ReasonInvalidSendMax,
+		},
+		{
+			name: "both fee rate and absolute fee",
+			call: func() error {
+				_, err := client.CreateTransaction(context.Background(), &pb.CreateTransactionRequest{
+					Inputs: []*pb.Input{
+						{
+							OutputHash:  "2f5dae23c2e18588c86cfc4e154f3b68bd8eb4265fe0b4b1341ad5aa40422f66",
+							OutputIndex: 0,
+							Value:       100000,
+						},
+					},
+					Outputs: []*pb.Output{
+						{Address: "1MZbRqZGpiSWGRLg8DUdVrDKHwNe1oesUZ", Value: "10000"},
+					},
+					ChangeAddress: "1GgX4cGLiqF9p4Sd1XcPQhEAAhNDA4wLYS",
+					FeeSatPerKb:   1000,
+					AbsoluteFee:   1000,
+					ChainParams:   mainnet,
+				})
+				return err
+			},
+			wantCode:   codes.InvalidArgument,
+			wantReason: ReasonInvalidFee,
+		},
+		{
+			name: "fee rate below minimum relay fee",
+			call: func() error {
+				_, err := client.CreateTransaction(context.Background(), &pb.CreateTransactionRequest{
+					Inputs: []*pb.Input{
+						{
+							OutputHash:  "2f5dae23c2e18588c86cfc4e154f3b68bd8eb4265fe0b4b1341ad5aa40422f66",
+							OutputIndex: 0,
+							Value:       100000,
+						},
+					},
+					Outputs: []*pb.Output{
+						{Address: "1MZbRqZGpiSWGRLg8DUdVrDKHwNe1oesUZ", Value: "10000"},
+					},
+					ChangeAddress: "1GgX4cGLiqF9p4Sd1XcPQhEAAhNDA4wLYS",
+					FeeSatPerKb:   500,
+					ChainParams:   mainnet,
+				})
+				return err
+			},
+			wantCode:   codes.InvalidArgument,
+			wantReason: ReasonFeeRateTooLow,
+		},
+		{
+			name: "both change address and change derivation",
+			call: func() error {
+				_, err := client.CreateTransaction(context.Background(), &pb.CreateTransactionRequest{
+					Inputs: []*pb.Input{
+						{
+							OutputHash:  "2f5dae23c2e18588c86cfc4e154f3b68bd8eb4265fe0b4b1341ad5aa40422f66",
+							OutputIndex: 0,
+							Value:       100000,
+						},
+					},
+					Outputs: []*pb.Output{
+						{Address: "1MZbRqZGpiSWGRLg8DUdVrDKHwNe1oesUZ", Value: "10000"},
+					},
+					ChangeAddress:    "1GgX4cGLiqF9p4Sd1XcPQhEAAhNDA4wLYS",
+					ChangeDerivation: []uint32{1, 0},
+					ChangeEncoding:   pb.AddressEncoding_ADDRESS_ENCODING_P2WPKH,
+					FeeSatPerKb:      1000,
+					ChainParams:      mainnet,
+				})
+				return err
+			},
+			wantCode:   codes.InvalidArgument,
+			wantReason: ReasonInvalidChange,
+		},
+		{
+			name: "change split ratios not summing to 1",
+			call: func() error {
+				_, err := client.CreateTransaction(context.Background(), &pb.CreateTransactionRequest{
+					Inputs: []*pb.Input{
+						{
+							OutputHash:  "2f5dae23c2e18588c86cfc4e154f3b68bd8eb4265fe0b4b1341ad5aa40422f66",
+							OutputIndex: 0,
+							Value:       100000,
+						},
+					},
+					Outputs: []*pb.Output{
+						{Address: "1MZbRqZGpiSWGRLg8DUdVrDKHwNe1oesUZ", Value: "10000"},
+					},
+					SplitChange: []*pb.ChangeSplit{
+						{Address: "1GgX4cGLiqF9p4Sd1XcPQhEAAhNDA4wLYS", Ratio: 0.5},
+						{Address: "1BvBMSEYstWetqTFn5Au4m4GFg7xJaNVN2", Ratio: 0.4},
+					},
+					FeeSatPerKb: 1000,
+					ChainParams: mainnet,
+				})
+				return err
+			},
+			wantCode:   codes.InvalidArgument,
+			wantReason: ReasonInvalidChangeRatio,
+		},
+		{
+			name: "unknown ordering",
+			call: func() error {
+				_, err := client.CreateTransaction(context.Background(), &pb.CreateTransactionRequest{
+					Inputs: []*pb.Input{
+						{
+							OutputHash:  "2f5dae23c2e18588c86cfc4e154f3b68bd8eb4265fe0b4b1341ad5aa40422f66",
+							OutputIndex: 0,
+							Value:       100000,
+						},
+					},
+					Outputs: []*pb.Output{
+						{Address: "1MZbRqZGpiSWGRLg8DUdVrDKHwNe1oesUZ", Value: "10000"},
+					},
+					ChangeAddress: "1GgX4cGLiqF9p4Sd1XcPQhEAAhNDA4wLYS",
+					FeeSatPerKb:   1000,
+					Ordering:      pb.TxOrdering(42),
+					ChainParams:   mainnet,
+				})
+				return err
+			},
+			wantCode:   codes.InvalidArgument,
+			wantReason: ReasonUnknownOrdering,
+		},
+		{
+			name: "unknown dust change policy",
+			call: func() error {
+				_, err := client.CreateTransaction(context.Background(), &pb.CreateTransactionRequest{
+					Inputs: []*pb.Input{
+						{
+							OutputHash:  "2f5dae23c2e18588c86cfc4e154f3b68bd8eb4265fe0b4b1341ad5aa40422f66",
+							OutputIndex: 0,
+							Value:       100000,
+						},
+					},
+					Outputs: []*pb.Output{
+						{Address: "1MZbRqZGpiSWGRLg8DUdVrDKHwNe1oesUZ", Value: "10000"},
+					},
+					ChangeAddress:    "1GgX4cGLiqF9p4Sd1XcPQhEAAhNDA4wLYS",
+					FeeSatPerKb:      1000,
+					DustChangePolicy: pb.DustChangePolicy(42),
+					ChainParams:      mainnet,
+				})
+				return err
+			},
+			wantCode:   codes.InvalidArgument,
+			wantReason: ReasonInvalidDustChangePolicy,
+		},
+		{
+			name: "size padding out of range",
+			call: func() error {
+				_, err := client.CreateTransaction(context.Background(), &pb.CreateTransactionRequest{
+					Inputs: []*pb.Input{
+						{
+							OutputHash:  "2f5dae23c2e18588c86cfc4e154f3b68bd8eb4265fe0b4b1341ad5aa40422f66",
+							OutputIndex: 0,
+							Value:       100000,
+						},
+					},
+					Outputs: []*pb.Output{
+						{Address: "1MZbRqZGpiSWGRLg8DUdVrDKHwNe1oesUZ", Value: "10000"},
+					},
+					ChangeAddress:     "1GgX4cGLiqF9p4Sd1XcPQhEAAhNDA4wLYS",
+					FeeSatPerKb:       1000,
+					SizePaddingVbytes: 1001,
+					ChainParams:       mainnet,
+				})
+				return err
+			},
+			wantCode:   codes.InvalidArgument,
+			wantReason: ReasonInvalidSizePadding,
+		},
+		{
+			name: "seed too short",
+			call: func() error {
+				_, err := client.GetKeypair(context.Background(), &pb.GetKeypairRequest{
+					Seed:        "too short",
+					ChainParams: mainnet,
+				})
+				return err
+			},
+			wantCode:   codes.InvalidArgument,
+			wantReason: ReasonInvalidSeedLength,
+		},
+		{
+			name: "invalid entropy size",
+			call: func() error {
+				_, err := client.GenerateMnemonic(context.Background(), &pb.GenerateMnemonicRequest{
+					EntropyBits: 100,
+				})
+				return err
+			},
+			wantCode:   codes.InvalidArgument,
+			wantReason: ReasonInvalidEntropySize,
+		},
+		{
+			name: "sign and verify with an extended public key",
+			call: func() error {
+				_, err := client.SignAndVerifyTransaction(context.Background(), &pb.SignAndVerifyTransactionRequest{
+					RawTx:       &pb.RawTransactionResponse{Hex: unsignedTxHex},
+					Utxos:       utxos,
+					PrivateKey:  xpub,
+					Signatures:  signatures,
+					ChainParams: mainnet,
+				})
+				return err
+			},
+			wantCode:   codes.InvalidArgument,
+			wantReason: ReasonNotPrivateExtendedKey,
+		},
+		{
+			name: "sign and verify with an extended private key of another network",
+			call: func() error {
+				_, err := client.SignAndVerifyTransaction(context.Background(), &pb.SignAndVerifyTransactionRequest{
+					RawTx:       &pb.RawTransactionResponse{Hex: unsignedTxHex},
+					Utxos:       utxos,
+					PrivateKey:  tprv,
+					Signatures:  signatures,
+					ChainParams: mainnet,
+				})
+				return err
+			},
+			wantCode:   codes.InvalidArgument,
+			wantReason: ReasonNetworkMismatch,
+		},
+		{
+			name: "sign and verify with missing utxos",
+			call: func() error {
+				_, err := client.SignAndVerifyTransaction(context.Background(), &pb.SignAndVerifyTransactionRequest{
+					RawTx:       &pb.RawTransactionResponse{Hex: unsignedTxHex},
+					Utxos:       nil,
+					PrivateKey:  xprv,
+					Signatures:  signatures,
+					ChainParams: mainnet,
+				})
+				return err
+			},
+			wantCode:   codes.InvalidArgument,
+			wantReason: ReasonLengthMismatch,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.call()
+			if status.Code(err) != tt.wantCode {
+				t.Fatalf("got error '%v', want code %v", err, tt.wantCode)
+			}
+
+			info := statusErrorInfo(err)
+			if info == nil {
+				t.Fatalf("got error '%v' without ErrorInfo detail", err)
+			}
+
+			if info.Reason != tt.wantReason || info.Domain != ErrorDomain {
+				t.Fatalf("got ErrorInfo reason %s, domain %s, want %s, %s",
+					info.Reason, info.Domain, tt.wantReason, ErrorDomain)
+			}
+		})
+	}
+}
+
+func TestErrorStatus(t *testing.T) {
+	err := errorStatus(codes.InvalidArgument,
+		errors.Wrap(&core.ErrInsufficientFunds{MissingAmount: 42}, "failed to select utxos"))
+
+	info := statusErrorInfo(err)
+	if info == nil || info.Reason != ReasonInsufficientFunds ||
+		info.Metadata["missing_amount"] != "42" {
+		t.Fatalf("errorStatus() got ErrorInfo %v, want reason %s with missing amount 42",
+			info, ReasonInsufficientFunds)
+	}
+
+	// Errors of known cause have the code of their cause, whatever the given
+	// code.
+	for cause, known := range knownErrors {
+		err := errorStatus(codes.Internal, errors.Wrap(cause, "failed"))
+		if status.Code(err) != known.code {
+			t.Fatalf("errorStatus() of '%v' got code %v, want %v",
+				cause, status.Code(err), known.code)
+		}
+
+		if info := statusErrorInfo(err); info == nil || info.Reason != known.reason {
+			t.Fatalf("errorStatus() of '%v' got ErrorInfo %v, want reason %s",
+				cause, info, known.reason)
+		}
+	}
+
+	// Errors of unknown cause have no detail.
+	err = errorStatus(codes.Internal, errors.New("unexpected error"))
+	if info := statusErrorInfo(err); info != nil {
+		t.Fatalf("errorStatus() got ErrorInfo %v, want none", info)
+	}
+
+	if status.Convert(err).Message() != "unexpected error" {
+		t.Fatalf("errorStatus() got message %s, want 'unexpected error'",
+			status.Convert(err).Message())
+	}
+}
@@ -4,26 +4,111 @@ import (
 	"context"
 
 	"github.com/ledgerhq/bitcoin-lib-grpc/log"
-
+	"github.com/ledgerhq/bitcoin-lib-grpc/pkg/chaincfg"
+	"github.com/ledgerhq/bitcoin-lib-grpc/pkg/core"
+	"github.com/pkg/errors"
+	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/status"
 )
 
-type HealthChecker struct{}
+// ReadinessService is the service name to query in health check requests
+// to check readiness. An empty service name checks liveness.
+const ReadinessService = "readiness"
+
+// Self-test vector of the readiness check, from BIP0032 Test Vector 1: the
+// xpub of chain m/0H, its child at index 1, and the P2WPKH address of the
+// child.
+const (
+	selfTestParentKey = "xpub68Gmy5EdvgibQVfPdqkBBCHxA5htiqg55crXYuXoQRKfDBFA1WEjWgP6LHhwBZeNK1VTsfTFUHCdrfp1bgwQ9xv5ski8PX9rL2dZXvgGDnw"
+	selfTestChildKey  = "xpub6ASuArnXKPbfEwhqN6e3mwBcDTgzisQN1wXN9BJcM47sSikHjJf3UFHKkNAWbWMiGj7Wf5uMash7SyYq527Hqck2AxYysAA7xmALppuCkwQ"
+	selfTestAddress   = "bc1qhm6697d9d2224vfyt8mj4kw03ncec7a7fdafvt"
+)
+
+type HealthChecker struct {
+	svc *core.Service
+}
 
+// Check reports SERVING for liveness checks, i.e. with an empty service
+// name, as long as the server is able to answer.
+//
+// For readiness checks, i.e. with ReadinessService as service name, the key
+// derivation and address encoding are exercised on a fixed test vector, and
+// NOT_SERVING is reported if the result is not the expected one.
 func (s *HealthChecker) Check(ctx context.Context, req *grpc_health_v1.HealthCheckRequest) (*grpc_health_v1.HealthCheckResponse, error) {
 	log.Info("Serving the Check request for health check")
+
+	servingStatus, err := s.servingStatus(ctx, req.Service)
+	if err != nil {
+		return nil, err
+	}
+
 	return &grpc_health_v1.HealthCheckResponse{
-		Status: grpc_health_v1.HealthCheckResponse_SERVING,
+		Status: servingStatus,
 	}, nil
 }
 
 func (s *HealthChecker) Watch(req *grpc_health_v1.HealthCheckRequest, server grpc_health_v1.Health_WatchServer) error {
 	log.Info("Serving the Watch request for health check")
+
+	servingStatus, err := s.servingStatus(server.Context(), req.Service)
+	if err != nil {
+		return err
+	}
+
 	return server.Send(&grpc_health_v1.HealthCheckResponse{
-		Status: grpc_health_v1.HealthCheckResponse_SERVING,
+		Status: servingStatus,
 	})
 }
 
+// servingStatus returns the serving status of a service, or a NotFound
+// error if the service is unknown.
+func (s *HealthChecker) servingStatus(
+	ctx context.Context, service string,
+) (grpc_health_v1.HealthCheckResponse_ServingStatus, error) {
+	switch service {
+	case "":
+		return grpc_health_v1.HealthCheckResponse_SERVING, nil
+	case ReadinessService:
+		if err := s.selfTest(ctx); err != nil {
+			log.Errorf("Readiness self-test failed: %v", err)
+			return grpc_health_v1.HealthCheckResponse_NOT_SERVING, nil
+		}
+
+		return grpc_health_v1.HealthCheckResponse_SERVING, nil
+	default:
+		return grpc_health_v1.HealthCheckResponse_SERVICE_UNKNOWN,
+			status.Errorf(codes.NotFound, "unknown service %s", service)
+	}
+}
+
+// selfTest derives the self-test extended key, encodes the address of the
+// derived public key, and compares both with the expected ones.
+func (s *HealthChecker) selfTest(ctx context.Context) error {
+	derived, err := s.svc.DeriveExtendedKey(ctx, selfTestParentKey, []uint32{1})
+	if err != nil {
+		return errors.Wrap(err, "failed to derive self-test key")
+	}
+
+	if derived.ExtendedKey != selfTestChildKey {
+		return errors.Errorf("derived self-test key %s, expected %s",
+			derived.ExtendedKey, selfTestChildKey)
+	}
+
+	address, err := s.svc.EncodeAddress(
+		derived.PublicKey, core.NativeSegwit, true, chaincfg.BitcoinMainNetParams)
+	if err != nil {
+		return errors.Wrap(err, "failed to encode self-test address")
+	}
+
+	if address != selfTestAddress {
+		return errors.Errorf("encoded self-test address %s, expected %s",
+			address, selfTestAddress)
+	}
+
+	return nil
+}
+
 func NewHealthChecker() *HealthChecker {
-	return &HealthChecker{}
+	return &HealthChecker{svc: &core.Service{}}
 }
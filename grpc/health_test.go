@@ -0,0 +1,53 @@
+package grpc
+
+import (
+	"context"
+	"testing"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/status"
+)
+
+func TestHealthChecker_Check(t *testing.T) {
+	tests := []struct {
+		name       string
+		service    string
+		wantStatus grpc_health_v1.HealthCheckResponse_ServingStatus
+		wantCode   codes.Code
+	}{
+		{
+			name:       "liveness",
+			service:    "",
+			wantStatus: grpc_health_v1.HealthCheckResponse_SERVING,
+			wantCode:   codes.OK,
+		},
+		{
+			name:       "readiness",
+			service:    ReadinessService,
+			wantStatus: grpc_health_v1.HealthCheckResponse_SERVING,
+			wantCode:   codes.OK,
+		},
+		{
+			name:     "unknown service",
+			service:  "unknown",
+			wantCode: codes.NotFound,
+		},
+	}
+
+	checker := NewHealthChecker()
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			response, err := checker.Check(context.Background(),
+				&grpc_health_v1.HealthCheckRequest{Service: tt.service})
+			if status.Code(err) != tt.wantCode {
+				t.Fatalf("Check() got error '%v', want code %v", err, tt.wantCode)
+			}
+
+			if err == nil && response.Status != tt.wantStatus {
+				t.Fatalf("Check() got status %v, want %v", response.Status, tt.wantStatus)
+			}
+		})
+	}
+}
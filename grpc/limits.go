@@ -0,0 +1,103 @@
+package grpc
+
+import (
+	"github.com/pkg/errors"
+)
+
+// Limits bounds the size of requests, so that a client cannot pin the CPU
+// with an oversized derivation path or transaction. A zero limit disables
+// the corresponding check.
+type Limits struct {
+	// MaxDerivationDepth is the maximum number of steps of a derivation
+	// path.
+	MaxDerivationDepth int
+
+	// MaxInputs is the maximum number of inputs of a transaction, or of
+	// utxos spent by a transaction to sign.
+	MaxInputs int
+
+	// MaxOutputs is the maximum number of outputs of a transaction.
+	MaxOutputs int
+
+	// MaxFeeSatPerKb is the maximum fee rate of a transaction to create,
+	// unless explicitly allowed by the request.
+	MaxFeeSatPerKb int64
+
+	// MaxBatchSize is the maximum number of transactions of a batch
+	// request, each transaction being bounded by the limits above.
+	MaxBatchSize int
+
+	// MaxAddressCount is the maximum number of addresses derived by a
+	// single unary request. Streamed addresses are not bounded, as they are
+	// not held in memory.
+	MaxAddressCount int
+}
+
+// DefaultLimits are the limits of controllers created with
+// NewBitcoinController.
+var DefaultLimits = Limits{
+	MaxDerivationDepth: 256,
+	MaxInputs:          10000,
+	MaxOutputs:         10000,
+	MaxBatchSize:       1000,
+	MaxAddressCount:    10000,
+
+	// 0.1 BTC/kvB, the default maximum fee rate of the transactions
+	// broadcast by Bitcoin Core.
+	MaxFeeSatPerKb: 10000000,
+}
+
+// checkDerivation returns an error if a derivation path has more steps than
+// allowed.
+func (l Limits) checkDerivation(derivation []uint32) error {
+	if l.MaxDerivationDepth > 0 && len(derivation) > l.MaxDerivationDepth {
+		return errors.Errorf("derivation path has %d steps, exceeding the limit of %d",
+			len(derivation), l.MaxDerivationDepth)
+	}
+
+	return nil
+}
+
+// checkInputs returns an error if a transaction has more inputs, or utxos,
+// than allowed.
+func (l Limits) checkInputs(count int) error {
+	if l.MaxInputs > 0 && count > l.MaxInputs {
+		return errors.Errorf("transaction has %d inputs, exceeding the limit of %d",
+			count, l.MaxInputs)
+	}
+
+	return nil
+}
+
+// checkOutputs returns an error if a transaction has more outputs than
+// allowed.
+func (l Limits) checkOutputs(count int) error {
+	if l.MaxOutputs > 0 && count > l.MaxOutputs {
+		return errors.Errorf("transaction has %d outputs, exceeding the limit of %d",
+			count, l.MaxOutputs)
+	}
+
+	return nil
+}
+
+// checkBatchSize returns an error if a batch request has more transactions
+// than allowed.
+func (l Limits) checkBatchSize(count int) error {
+	if l.MaxBatchSize > 0 && count > l.MaxBatchSize {
+		return errors.Errorf("batch has %d transactions, exceeding the limit of %d",
+			count, l.MaxBatchSize)
+	}
+
+	return nil
+}
+
+// checkAddressCount returns an error if a request derives more addresses
+// than allowed.
+func (l Limits) checkAddressCount(count uint32) error {
+	if l.MaxAddressCount > 0 && int64(count) > int64(l.MaxAddressCount) {
+		return errors.Errorf("requested %d addresses, exceeding the limit of %d",
+			count, l.MaxAddressCount)
+	}
+
+	return nil
+}
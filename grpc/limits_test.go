@@ -0,0 +1,192 @@
+package grpc
+
+import (
+	"context"
+	"testing"
+
+	pb "github.com/ledgerhq/bitcoin-lib-grpc/pb/bitcoin"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestLimits(t *testing.T) {
+	// BIP0032: Test Vector 1 (chain m)
+	const xpub = "xpub661MyMwAqRbcFtXgS5sYJABqqG9YLmC4Q1Rdap9gSE8NqtwybGhePY2gZ29ESFjqJoCu1Rupje8YtGqsefD265TMg7usUDFdp6W1EGMcet8"
+
+	c := NewBitcoinControllerWithLimits(Limits{
+		MaxDerivationDepth: 2,
+		MaxInputs:          2,
+		MaxOutputs:         2,
+		MaxBatchSize:       2,
+		MaxAddressCount:    2,
+	})
+
+	chainParams := &pb.ChainParams{
+		Network: &pb.ChainParams_BitcoinNetwork{
+			BitcoinNetwork: pb.BitcoinNetwork_BITCOIN_NETWORK_MAINNET,
+		},
+	}
+
+	tests := []struct {
+		name string
+		call func() error
+	}{
+		{
+			name: "derivation depth",
+			call: func() error {
+				_, err := c.DeriveExtendedKey(context.Background(), &pb.DeriveExtendedKeyRequest{
+					ExtendedKey: xpub,
+					Derivation:  []uint32{0, 1, 2},
+				})
+				return err
+			},
+		},
+		{
+			name: "transaction inputs",
+			call: func() error {
+				_, err := c.CreateTransaction(context.Background(), &pb.CreateTransactionRequest{
+					Inputs:      make([]*pb.Input, 3),
+					ChainParams: chainParams,
+				})
+				return err
+			},
+		},
+		{
+			name: "transaction outputs",
+			call: func() error {
+				_, err := c.CreateTransaction(context.Background(), &pb.CreateTransactionRequest{
+					Outputs:     make([]*pb.Output, 3),
+					ChainParams: chainParams,
+				})
+				return err
+			},
+		},
+		{
+			name: "batch size",
+			call: func() error {
+				_, err := c.CreateTransactions(context.Background(), &pb.CreateTransactionsRequest{
+					Transactions: make([]*pb.CreateTransactionRequest, 3),
+				})
+				return err
+			},
+		},
+		{
+			name: "addresses",
+			call: func() error {
+				_, err := c.DeriveAddresses(context.Background(), &pb.DeriveAddressesRequest{
+					AccountKey:  xpub,
+					Encoding:    pb.AddressEncoding_ADDRESS_ENCODING_P2PKH,
+					Count:       3,
+					ChainParams: chainParams,
+				})
+				return err
+			},
+		},
+		{
+			name: "change addresses",
+			call: func() error {
+				_, err := c.DeriveChangeAddresses(context.Background(), &pb.DeriveChangeAddressesRequest{
+					AccountKey:  xpub,
+					Encoding:    pb.AddressEncoding_ADDRESS_ENCODING_P2PKH,
+					Count:       3,
+					ChainParams: chainParams,
+				})
+				return err
+			},
+		},
+		{
+			name: "utxos to sign",
+			call: func() error {
+				_, err := c.GenerateDerSignatures(context.Background(), &pb.GenerateDerSignaturesRequest{
+					Utxos: make([]*pb.Utxo, 3),
+				})
+				return err
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.call(); status.Code(err) != codes.InvalidArgument {
+				t.Fatalf("got error '%v', want code %v", err, codes.InvalidArgument)
+			}
+		})
+	}
+
+	// The paths within the limit are derived.
+	if _, err := c.DeriveExtendedKey(context.Background(), &pb.DeriveExtendedKeyRequest{
+		ExtendedKey: xpub,
+		Derivation:  []uint32{0, 1},
+	}); err != nil {
+		t.Fatalf("DeriveExtendedKey() got error '%v'", err)
+	}
+
+	if _, err := c.DeriveAddresses(context.Background(), &pb.DeriveAddressesRequest{
+		AccountKey:  xpub,
+		Encoding:    pb.AddressEncoding_ADDRESS_ENCODING_P2PKH,
+		Count:       2,
+		ChainParams: chainParams,
+	}); err != nil {
+		t.Fatalf("DeriveAddresses() got error '%v'", err)
+	}
+
+	// The default derivation depth limit is 256 steps.
+	_, err := NewBitcoinController().DeriveExtendedKey(context.Background(), &pb.DeriveExtendedKeyRequest{
+		ExtendedKey: xpub,
+		Derivation:  make([]uint32, 257),
+	})
+	if status.Code(err) != codes.InvalidArgument {
+		t.Fatalf("DeriveExtendedKey() got error '%v', want code %v", err, codes.InvalidArgument)
+	}
+}
+
+func TestLimits_MaxFeeRate(t *testing.T) {
+	c := NewBitcoinControllerWithLimits(Limits{MaxFeeSatPerKb: 100000})
+
+	request := func(feeSatPerKb int64, allowHighFeeRate bool) *pb.CreateTransactionRequest {
+		return &pb.CreateTransactionRequest{
+			Inputs: []*pb.Input{
+				{
+					OutputHash:  "2f5dae23c2e18588c86cfc4e154f3b68bd8eb4265fe0b4b1341ad5aa40422f66",
+					OutputIndex: 0,
+					Value:       1000000,
+				},
+			},
+			Outputs: []*pb.Output{
+				{Address: "1MZbRqZGpiSWGRLg8DUdVrDKHwNe1oesUZ", Value: "100000"},
+			},
+			ChangeAddress:    "1GgX4cGLiqF9p4Sd1XcPQhEAAhNDA4wLYS",
+			FeeSatPerKb:      feeSatPerKb,
+			AllowHighFeeRate: allowHighFeeRate,
+			ChainParams: &pb.ChainParams{
+				Network: &pb.ChainParams_BitcoinNetwork{
+					BitcoinNetwork: pb.BitcoinNetwork_BITCOIN_NETWORK_MAINNET,
+				},
+			},
+		}
+	}
+
+	if _, err := c.CreateTransaction(context.Background(), request(100000, false)); err != nil {
+		t.Fatalf("CreateTransaction() got error '%v' at the maximum fee rate", err)
+	}
+
+	_, err := c.CreateTransaction(context.Background(), request(100001, false))
+	if status.Code(err) != codes.InvalidArgument {
+		t.Fatalf("CreateTransaction() got error '%v', want code %v", err, codes.InvalidArgument)
+	}
+
+	// The maximum fee rate is overridden by the request.
+	if _, err := c.CreateTransaction(context.Background(), request(100001, true)); err != nil {
+		t.Fatalf("CreateTransaction() got error '%v' with high fee rate allowed", err)
+	}
+
+	// The rate of an absolute fee is checked too, over the ~226 vbytes of
+	// the transaction.
+	absoluteFeeRequest := request(0, false)
+	absoluteFeeRequest.AbsoluteFee = 100000
+	_, err = c.CreateTransaction(context.Background(), absoluteFeeRequest)
+	if status.Code(err) != codes.InvalidArgument {
+		t.Fatalf("CreateTransaction() got error '%v' with absolute fee, want code %v",
+			err, codes.InvalidArgument)
+	}
+}
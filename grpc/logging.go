@@ -0,0 +1,190 @@
+package grpc
+
+import (
+	"context"
+	"time"
+
+	"github.com/ledgerhq/bitcoin-lib-grpc/log"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+)
+
+// redactedValue replaces the value of sensitive request fields in logs.
+const redactedValue = "REDACTED"
+
+// sensitiveFields lists the names of the request fields that are never
+// logged, as they hold secrets such as private keys, seeds or mnemonics.
+// Extended keys are included, since they may be extended private keys.
+var sensitiveFields = map[protoreflect.Name]bool{
+	"private_key":        true,
+	"seed":               true,
+	"mnemonic":           true,
+	"passphrase":         true,
+	"wif":                true,
+	"extended_key":       true,
+	"account_key":        true,
+	"change_account_key": true,
+	"master_xprv":        true,
+}
+
+// LoggingInterceptor returns a unary server interceptor that logs the
+// method name, the duration and the resulting status code of every RPC.
+//
+// withFields returns the logger used for each log entry, such as
+// log.WithFields, which follows the json_logs and loglevel configuration.
+// The request is also logged at debug level, with the sensitive fields
+// redacted.
+func LoggingInterceptor(withFields func(log.Fields) log.Logger) grpc.UnaryServerInterceptor {
+	return func(
+		ctx context.Context,
+		req interface{},
+		info *grpc.UnaryServerInfo,
+		handler grpc.UnaryHandler,
+	) (interface{}, error) {
+		start := time.Now()
+
+		withFields(log.Fields{
+			"method":  info.FullMethod,
+			"request": redactedRequest(req),
+		}).Debug("Received RPC request")
+
+		resp, err := handler(ctx, req)
+
+		logStatus(withFields, info.FullMethod, time.Since(start), err)
+
+		return resp, err
+	}
+}
+
+// LoggingStreamInterceptor returns a stream server interceptor that logs
+// streaming RPCs like LoggingInterceptor. Every message received from the
+// client is logged at debug level, with the sensitive fields redacted.
+func LoggingStreamInterceptor(withFields func(log.Fields) log.Logger) grpc.StreamServerInterceptor {
+	return func(
+		srv interface{},
+		ss grpc.ServerStream,
+		info *grpc.StreamServerInfo,
+		handler grpc.StreamHandler,
+	) error {
+		start := time.Now()
+
+		err := handler(srv, &loggingServerStream{
+			ServerStream: ss,
+			withFields:   withFields,
+			method:       info.FullMethod,
+		})
+
+		logStatus(withFields, info.FullMethod, time.Since(start), err)
+
+		return err
+	}
+}
+
+// loggingServerStream is a grpc.ServerStream logging the messages received
+// from the client.
+type loggingServerStream struct {
+	grpc.ServerStream
+
+	withFields func(log.Fields) log.Logger
+	method     string
+}
+
+func (s *loggingServerStream) RecvMsg(m interface{}) error {
+	if err := s.ServerStream.RecvMsg(m); err != nil {
+		return err
+	}
+
+	s.withFields(log.Fields{
+		"method":  s.method,
+		"request": redactedRequest(m),
+	}).Debug("Received RPC request")
+
+	return nil
+}
+
+// logStatus logs the duration and the resulting status code of an RPC.
+func logStatus(
+	withFields func(log.Fields) log.Logger, method string, duration time.Duration, err error,
+) {
+	code := status.Code(err)
+	logger := withFields(log.Fields{
+		"method":   method,
+		"duration": duration.String(),
+		"code":     code.String(),
+	})
+
+	if code == codes.OK {
+		logger.Info("Served RPC request")
+	} else {
+		logger.Warnf("Failed RPC request: %v", status.Convert(err).Message())
+	}
+}
+
+// redactedRequest returns the JSON serialization of a request, with the
+// value of sensitive fields replaced by redactedValue, at any depth.
+func redactedRequest(req interface{}) string {
+	message, ok := req.(proto.Message)
+	if !ok {
+		return ""
+	}
+
+	redacted := proto.Clone(message)
+	redactMessage(redacted.ProtoReflect())
+
+	serialized, err := protojson.Marshal(redacted)
+	if err != nil {
+		return ""
+	}
+
+	return string(serialized)
+}
+
+// redactMessage replaces the value of the sensitive fields of a message,
+// and of its nested messages.
+func redactMessage(message protoreflect.Message) {
+	// Sensitive fields are redacted after the iteration, which must not
+	// set fields of the message.
+	var redactedFields []protoreflect.FieldDescriptor
+
+	message.Range(func(field protoreflect.FieldDescriptor, value protoreflect.Value) bool {
+		switch {
+		case sensitiveFields[field.Name()]:
+			redactedFields = append(redactedFields, field)
+		case field.IsList() && field.Message() != nil:
+			list := value.List()
+			for idx := 0; idx < list.Len(); idx++ {
+				redactMessage(list.Get(idx).Message())
+			}
+		case !field.IsList() && !field.IsMap() && field.Message() != nil:
+			redactMessage(value.Message())
+		}
+
+		return true
+	})
+
+	for _, field := range redactedFields {
+		redactField(message, field)
+	}
+}
+
+// redactField replaces the value of a sensitive field by redactedValue, or
+// clears it if it cannot hold a string.
+func redactField(message protoreflect.Message, field protoreflect.FieldDescriptor) {
+	if field.IsList() || field.IsMap() {
+		message.Clear(field)
+		return
+	}
+
+	switch field.Kind() {
+	case protoreflect.StringKind:
+		message.Set(field, protoreflect.ValueOfString(redactedValue))
+	case protoreflect.BytesKind:
+		message.Set(field, protoreflect.ValueOfBytes([]byte(redactedValue)))
+	default:
+		message.Clear(field)
+	}
+}
@@ -0,0 +1,326 @@
+package grpc
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"strings"
+	"testing"
+
+	"github.com/ledgerhq/bitcoin-lib-grpc/log"
+	pb "github.com/ledgerhq/bitcoin-lib-grpc/pb/bitcoin"
+	"github.com/sirupsen/logrus"
+	"github.com/sirupsen/logrus/hooks/test"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+)
+
+func TestLoggingInterceptor(t *testing.T) {
+	logger, hook := test.NewNullLogger()
+	logger.Level = logrus.DebugLevel
+
+	interceptor := LoggingInterceptor(func(fields log.Fields) log.Logger {
+		return logger.WithFields(logrus.Fields(fields))
+	})
+
+	info := &grpc.UnaryServerInfo{FullMethod: "/pb.bitcoin.CoinService/GetKeypair"}
+	request := &pb.GetKeypairRequest{
+		Seed:       "000102030405060708090a0b0c0d0e0f",
+		Derivation: []uint32{0},
+	}
+
+	tests := []struct {
+		name     string
+		handler  grpc.UnaryHandler
+		wantCode codes.Code
+	}{
+		{
+			name: "success",
+			handler: func(ctx context.Context, req interface{}) (interface{}, error) {
+				return &pb.GetKeypairResponse{}, nil
+			},
+			wantCode: codes.OK,
+		},
+		{
+			name: "error",
+			handler: func(ctx context.Context, req interface{}) (interface{}, error) {
+				return nil, status.Errorf(codes.InvalidArgument, "invalid seed")
+			},
+			wantCode: codes.InvalidArgument,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			hook.Reset()
+
+			_, err := interceptor(context.Background(), request, info, tt.handler)
+			if status.Code(err) != tt.wantCode {
+				t.Fatalf("interceptor got error '%v', want code %s", err, tt.wantCode)
+			}
+
+			entries := hook.AllEntries()
+			if len(entries) != 2 {
+				t.Fatalf("interceptor logged %d entries, want 2", len(entries))
+			}
+
+			requestEntry, statusEntry := entries[0], entries[1]
+
+			if got := statusEntry.Data["code"]; got != tt.wantCode.String() {
+				t.Fatalf("interceptor logged code %v, want %s", got, tt.wantCode)
+			}
+
+			if got := statusEntry.Data["method"]; got != info.FullMethod {
+				t.Fatalf("interceptor logged method %v, want %s", got, info.FullMethod)
+			}
+
+			loggedRequest, _ := requestEntry.Data["request"].(string)
+			if strings.Contains(loggedRequest, request.Seed) ||
+				!strings.Contains(loggedRequest, redactedValue) {
+				t.Fatalf("interceptor logged request %s, want redacted seed", loggedRequest)
+			}
+		})
+	}
+}
+
+// recvServerStream is a grpc.ServerStream receiving a single request.
+type recvServerStream struct {
+	grpc.ServerStream
+
+	request proto.Message
+}
+
+func (s *recvServerStream) RecvMsg(m interface{}) error {
+	proto.Merge(m.(proto.Message), s.request)
+	return nil
+}
+
+func TestLoggingStreamInterceptor(t *testing.T) {
+	logger, hook := test.NewNullLogger()
+	logger.Level = logrus.DebugLevel
+
+	interceptor := LoggingStreamInterceptor(func(fields log.Fields) log.Logger {
+		return logger.WithFields(logrus.Fields(fields))
+	})
+
+	info := &grpc.StreamServerInfo{
+		FullMethod:     "/pb.bitcoin.CoinService/DeriveAddressesStream",
+		IsServerStream: true,
+	}
+	request := &pb.DeriveAddressesRequest{
+		AccountKey: "xprv9s21ZrQH143K3QTDL4LXw2F7HEK3wJUD2nW2nRk4stbPy6cq3jPPqjiChkVvvNKmPGJxWUtg6LnF5kejMRNNU3TGtRBeJgk33yuGBxrMPHi",
+		Count:      1,
+	}
+
+	handler := func(srv interface{}, stream grpc.ServerStream) error {
+		if err := stream.RecvMsg(&pb.DeriveAddressesRequest{}); err != nil {
+			return err
+		}
+
+		return status.Errorf(codes.InvalidArgument, "invalid account key")
+	}
+
+	err := interceptor(nil, &recvServerStream{request: request}, info, handler)
+	if status.Code(err) != codes.InvalidArgument {
+		t.Fatalf("interceptor got error '%v', want code %s", err, codes.InvalidArgument)
+	}
+
+	entries := hook.AllEntries()
+	if len(entries) != 2 {
+		t.Fatalf("interceptor logged %d entries, want 2", len(entries))
+	}
+
+	requestEntry, statusEntry := entries[0], entries[1]
+
+	if got := statusEntry.Data["code"]; got != codes.InvalidArgument.String() {
+		t.Fatalf("interceptor logged code %v, want %s", got, codes.InvalidArgument)
+	}
+
+	if got := statusEntry.Data["method"]; got != info.FullMethod {
+		t.Fatalf("interceptor logged method %v, want %s", got, info.FullMethod)
+	}
+
+	loggedRequest, _ := requestEntry.Data["request"].(string)
+	if strings.Contains(loggedRequest, request.AccountKey) ||
+		!strings.Contains(loggedRequest, redactedValue) {
+		t.Fatalf("interceptor logged request %s, want redacted account key", loggedRequest)
+	}
+}
+
+func TestRedactedRequest(t *testing.T) {
+	request := &pb.GenerateDerSignaturesFromScalarsRequest{
+		Keys: []*pb.ScalarKey{
+			{PrivateKey: []byte("secret scalar")},
+		},
+	}
+
+	// Bytes fields are serialized in base64.
+	got := redactedRequest(request)
+	if strings.Contains(got, base64.StdEncoding.EncodeToString([]byte("secret scalar"))) {
+		t.Fatalf("redactedRequest() got %s, want nested private key redacted", got)
+	}
+
+	// The request itself must not be modified.
+	if string(request.Keys[0].PrivateKey) != "secret scalar" {
+		t.Fatalf("redactedRequest() modified the request")
+	}
+}
+
+func TestLoggingInterceptor_SensitiveRequests(t *testing.T) {
+	// BIP0032: Test Vector 1 (chain m)
+	const xprv = "xprv9s21ZrQH143K3QTDL4LXw2F7HEK3wJUD2nW2nRk4stbPy6cq3jPPqjiChkVvvNKmPGJxWUtg6LnF5kejMRNNU3TGtRBeJgk33yuGBxrMPHi"
+
+	// The extended key with an invalid checksum is rejected, and must not
+	// be logged as part of the error either.
+	const corruptedXprv = "xprv9s21ZrQH143K3QTDL4LXw2F7HEK3wJUD2nW2nRk4stbPy6cq3jPPqjiChkVvvNKmPGJxWUtg6LnF5kejMRNNU3TGtRBeJgk33yuGBxrMPHj"
+
+	// Unsigned transaction spending a single output.
+	const rawTxHex = "0100000001" +
+		"662f4240aad51a34b1b4e05f26b48ebd683b4f154efc6cc88885e1c223ae5d2f" +
+		"0000000000ffffffff0000000000"
+
+	chainParams := &pb.ChainParams{
+		Network: &pb.ChainParams_BitcoinNetwork{
+			BitcoinNetwork: pb.BitcoinNetwork_BITCOIN_NETWORK_MAINNET,
+		},
+	}
+
+	c := NewBitcoinController()
+
+	// The context is canceled, so that derivations fail after the
+	// extended key is decoded.
+	canceledCtx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	tests := []struct {
+		name    string
+		method  string
+		secret  string
+		request interface{}
+		handler grpc.UnaryHandler
+	}{
+		{
+			name:    "seed",
+			method:  "GetKeypair",
+			secret:  "000102030405060708090a0b0c0d0e0f",
+			request: &pb.GetKeypairRequest{Seed: "000102030405060708090a0b0c0d0e0f"},
+			handler: func(ctx context.Context, req interface{}) (interface{}, error) {
+				return c.GetKeypair(ctx, req.(*pb.GetKeypairRequest))
+			},
+		},
+		{
+			name:   "mnemonic and passphrase",
+			method: "KeypairFromMnemonic",
+			secret: "abandon abandon abandon",
+			request: &pb.KeypairFromMnemonicRequest{
+				Mnemonic:   "abandon abandon abandon",
+				Passphrase: "abandon abandon abandon",
+			},
+			handler: func(ctx context.Context, req interface{}) (interface{}, error) {
+				return c.KeypairFromMnemonic(ctx, req.(*pb.KeypairFromMnemonicRequest))
+			},
+		},
+		{
+			name:   "extended key",
+			method: "DeriveExtendedKey",
+			secret: xprv,
+			request: &pb.DeriveExtendedKeyRequest{
+				ExtendedKey: xprv,
+				Derivation:  []uint32{0},
+			},
+			handler: func(ctx context.Context, req interface{}) (interface{}, error) {
+				return c.DeriveExtendedKey(canceledCtx, req.(*pb.DeriveExtendedKeyRequest))
+			},
+		},
+		{
+			name:   "account key",
+			method: "DeriveAddresses",
+			secret: corruptedXprv,
+			request: &pb.DeriveAddressesRequest{
+				AccountKey:  corruptedXprv,
+				Encoding:    pb.AddressEncoding_ADDRESS_ENCODING_P2PKH,
+				Count:       1,
+				ChainParams: chainParams,
+			},
+			handler: func(ctx context.Context, req interface{}) (interface{}, error) {
+				return c.DeriveAddresses(ctx, req.(*pb.DeriveAddressesRequest))
+			},
+		},
+		{
+			name:   "change account key",
+			method: "CreateTransaction",
+			secret: corruptedXprv,
+			request: &pb.CreateTransactionRequest{
+				ChangeAccountKey: corruptedXprv,
+				ChainParams:      chainParams,
+			},
+			handler: func(ctx context.Context, req interface{}) (interface{}, error) {
+				return c.CreateTransaction(ctx, req.(*pb.CreateTransactionRequest))
+			},
+		},
+		{
+			name:   "private key",
+			method: "GenerateDerSignatures",
+			secret: corruptedXprv,
+			request: &pb.GenerateDerSignaturesRequest{
+				RawTx:      &pb.RawTransactionResponse{Hex: rawTxHex},
+				Utxos:      []*pb.Utxo{{Value: "1000000"}},
+				PrivateKey: corruptedXprv,
+			},
+			handler: func(ctx context.Context, req interface{}) (interface{}, error) {
+				return c.GenerateDerSignatures(ctx, req.(*pb.GenerateDerSignaturesRequest))
+			},
+		},
+		{
+			name:   "master extended private key",
+			method: "Bip85DeriveMnemonic",
+			secret: xprv,
+			request: &pb.Bip85DeriveMnemonicRequest{
+				MasterXprv: xprv,
+				Words:      13,
+			},
+			handler: func(ctx context.Context, req interface{}) (interface{}, error) {
+				return c.Bip85DeriveMnemonic(ctx, req.(*pb.Bip85DeriveMnemonicRequest))
+			},
+		},
+		{
+			name:   "wif",
+			method: "ImportWif",
+			secret: "5HueCGU8rMjxEXxiPuD5BDku4MkFqeZyd4dxDjmfEn1RNR2EGu4",
+			request: &pb.ImportWifRequest{
+				Wif: "5HueCGU8rMjxEXxiPuD5BDku4MkFqeZyd4dxDjmfEn1RNR2EGu4",
+			},
+			handler: func(ctx context.Context, req interface{}) (interface{}, error) {
+				return c.ImportWif(ctx, req.(*pb.ImportWifRequest))
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var output bytes.Buffer
+
+			logger := logrus.New()
+			logger.Out = &output
+			logger.Level = logrus.DebugLevel
+
+			interceptor := LoggingInterceptor(func(fields log.Fields) log.Logger {
+				return logger.WithFields(logrus.Fields(fields))
+			})
+
+			info := &grpc.UnaryServerInfo{FullMethod: "/pb.bitcoin.CoinService/" + tt.method}
+
+			_, _ = interceptor(context.Background(), tt.request, info, tt.handler)
+
+			if !strings.Contains(output.String(), info.FullMethod) {
+				t.Fatalf("interceptor logged '%s', want method %s", output.String(), info.FullMethod)
+			}
+
+			if strings.Contains(output.String(), tt.secret) {
+				t.Fatalf("interceptor logged '%s', want secret redacted", output.String())
+			}
+		})
+	}
+}
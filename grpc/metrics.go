@@ -0,0 +1,111 @@
+package grpc
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/status"
+)
+
+// Metrics collects per-method RPC metrics, and serves them in the
+// Prometheus text exposition format:
+//   * rpc_requests_total: number of requests, by method.
+//   * rpc_errors_total: number of failed requests, by method and gRPC code.
+//   * rpc_duration_seconds: histogram of the request latency, by method.
+//
+// The metrics are registered in a registry of their own, so that several
+// Metrics can coexist, e.g. in tests. Metrics must be created with
+// NewMetrics.
+type Metrics struct {
+	requests  *prometheus.CounterVec
+	errors    *prometheus.CounterVec
+	latencies *prometheus.HistogramVec
+
+	handler http.Handler
+}
+
+// NewMetrics returns an empty collection of RPC metrics.
+func NewMetrics() *Metrics {
+	m := &Metrics{
+		requests: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "rpc_requests_total",
+			Help: "Number of RPC requests, by method.",
+		}, []string{"method"}),
+		errors: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "rpc_errors_total",
+			Help: "Number of failed RPC requests, by method and gRPC code.",
+		}, []string{"method", "code"}),
+		latencies: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Name:    "rpc_duration_seconds",
+			Help:    "Latency of RPC requests, by method.",
+			Buckets: prometheus.DefBuckets,
+		}, []string{"method"}),
+	}
+
+	registry := prometheus.NewRegistry()
+	registry.MustRegister(m.requests, m.errors, m.latencies)
+
+	m.handler = promhttp.HandlerFor(registry, promhttp.HandlerOpts{})
+
+	return m
+}
+
+// UnaryInterceptor returns a unary server interceptor that records the
+// metrics of every RPC.
+func (m *Metrics) UnaryInterceptor() grpc.UnaryServerInterceptor {
+	return func(
+		ctx context.Context,
+		req interface{},
+		info *grpc.UnaryServerInfo,
+		handler grpc.UnaryHandler,
+	) (interface{}, error) {
+		start := time.Now()
+
+		resp, err := handler(ctx, req)
+
+		m.observe(info.FullMethod, time.Since(start), err)
+
+		return resp, err
+	}
+}
+
+// StreamInterceptor returns a stream server interceptor that records the
+// metrics of every streaming RPC, over the whole lifetime of the stream.
+func (m *Metrics) StreamInterceptor() grpc.StreamServerInterceptor {
+	return func(
+		srv interface{},
+		ss grpc.ServerStream,
+		info *grpc.StreamServerInfo,
+		handler grpc.StreamHandler,
+	) error {
+		start := time.Now()
+
+		err := handler(srv, ss)
+
+		m.observe(info.FullMethod, time.Since(start), err)
+
+		return err
+	}
+}
+
+// observe records a request of a method, with its duration and resulting
+// error.
+func (m *Metrics) observe(method string, duration time.Duration, err error) {
+	m.requests.WithLabelValues(method).Inc()
+
+	if err != nil {
+		m.errors.WithLabelValues(method, status.Code(err).String()).Inc()
+	}
+
+	m.latencies.WithLabelValues(method).Observe(duration.Seconds())
+}
+
+// ServeHTTP serves the metrics with promhttp, to be served on the /metrics
+// endpoint.
+func (m *Metrics) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	m.handler.ServeHTTP(w, r)
+}
@@ -0,0 +1,90 @@
+package grpc
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestMetrics(t *testing.T) {
+	metrics := NewMetrics()
+	interceptor := metrics.UnaryInterceptor()
+
+	success := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return nil, nil
+	}
+
+	failure := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return nil, status.Errorf(codes.InvalidArgument, "invalid address")
+	}
+
+	validateAddress := &grpc.UnaryServerInfo{FullMethod: "/pb.bitcoin.CoinService/ValidateAddress"}
+	encodeAddress := &grpc.UnaryServerInfo{FullMethod: "/pb.bitcoin.CoinService/EncodeAddress"}
+
+	for _, handler := range []grpc.UnaryHandler{success, success, failure} {
+		_, _ = interceptor(context.Background(), nil, validateAddress, handler)
+	}
+
+	_, _ = interceptor(context.Background(), nil, encodeAddress, success)
+
+	recorder := httptest.NewRecorder()
+	metrics.ServeHTTP(recorder, httptest.NewRequest("GET", "/metrics", nil))
+
+	body, _ := ioutil.ReadAll(recorder.Result().Body)
+
+	for _, want := range []string{
+		`rpc_requests_total{method="/pb.bitcoin.CoinService/ValidateAddress"} 3`,
+		`rpc_requests_total{method="/pb.bitcoin.CoinService/EncodeAddress"} 1`,
+		`rpc_errors_total{code="InvalidArgument",method="/pb.bitcoin.CoinService/ValidateAddress"} 1`,
+		`rpc_duration_seconds_bucket{method="/pb.bitcoin.CoinService/ValidateAddress",le="+Inf"} 3`,
+		`rpc_duration_seconds_count{method="/pb.bitcoin.CoinService/EncodeAddress"} 1`,
+	} {
+		if !strings.Contains(string(body), want+"\n") {
+			t.Fatalf("ServeHTTP() got:\n%s\nwant line %s", body, want)
+		}
+	}
+
+	for _, line := range strings.Split(string(body), "\n") {
+		if strings.HasPrefix(line, "rpc_errors_total{") &&
+			strings.Contains(line, `method="/pb.bitcoin.CoinService/EncodeAddress"`) {
+			t.Fatalf("ServeHTTP() got errors for successful method:\n%s", body)
+		}
+	}
+}
+
+func TestMetrics_StreamInterceptor(t *testing.T) {
+	metrics := NewMetrics()
+	interceptor := metrics.StreamInterceptor()
+
+	failure := func(srv interface{}, stream grpc.ServerStream) error {
+		return status.Errorf(codes.Canceled, "client is gone")
+	}
+
+	info := &grpc.StreamServerInfo{
+		FullMethod:     "/pb.bitcoin.CoinService/DeriveAddressesStream",
+		IsServerStream: true,
+	}
+
+	_ = interceptor(nil, nil, info, failure)
+
+	recorder := httptest.NewRecorder()
+	metrics.ServeHTTP(recorder, httptest.NewRequest("GET", "/metrics", nil))
+
+	body, _ := ioutil.ReadAll(recorder.Result().Body)
+
+	for _, want := range []string{
+		`rpc_requests_total{method="/pb.bitcoin.CoinService/DeriveAddressesStream"} 1`,
+		`rpc_errors_total{code="Canceled",method="/pb.bitcoin.CoinService/DeriveAddressesStream"} 1`,
+		`rpc_duration_seconds_count{method="/pb.bitcoin.CoinService/DeriveAddressesStream"} 1`,
+	} {
+		if !strings.Contains(string(body), want+"\n") {
+			t.Fatalf("ServeHTTP() got:\n%s\nwant line %s", body, want)
+		}
+	}
+}
@@ -0,0 +1,63 @@
+package grpc
+
+import (
+	"context"
+	"runtime/debug"
+
+	"github.com/ledgerhq/bitcoin-lib-grpc/log"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// RecoveryInterceptor returns a unary server interceptor that recovers from
+// panics in RPC handlers, so that a malformed input cannot crash the server.
+//
+// The panic and its stack trace are logged, and the client gets an Internal
+// error instead, without the panic value, which may include request data.
+func RecoveryInterceptor() grpc.UnaryServerInterceptor {
+	return func(
+		ctx context.Context,
+		req interface{},
+		info *grpc.UnaryServerInfo,
+		handler grpc.UnaryHandler,
+	) (resp interface{}, err error) {
+		defer func() {
+			if r := recover(); r != nil {
+				resp, err = nil, recoveredError(info.FullMethod, r)
+			}
+		}()
+
+		return handler(ctx, req)
+	}
+}
+
+// RecoveryStreamInterceptor returns a stream server interceptor that
+// recovers from panics in streaming RPC handlers, like RecoveryInterceptor.
+func RecoveryStreamInterceptor() grpc.StreamServerInterceptor {
+	return func(
+		srv interface{},
+		ss grpc.ServerStream,
+		info *grpc.StreamServerInfo,
+		handler grpc.StreamHandler,
+	) (err error) {
+		defer func() {
+			if r := recover(); r != nil {
+				err = recoveredError(info.FullMethod, r)
+			}
+		}()
+
+		return handler(srv, ss)
+	}
+}
+
+// recoveredError logs a panic recovered while serving a method, with its
+// stack trace, and returns the Internal error sent to the client instead.
+func recoveredError(method string, r interface{}) error {
+	log.WithFields(log.Fields{
+		"method": method,
+		"stack":  string(debug.Stack()),
+	}).Errorf("Recovered from panic: %v", r)
+
+	return status.Errorf(codes.Internal, "internal error while serving %s", method)
+}
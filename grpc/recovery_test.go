@@ -0,0 +1,116 @@
+package grpc
+
+import (
+	"context"
+	"net"
+	"strings"
+	"testing"
+
+	pb "github.com/ledgerhq/bitcoin-lib-grpc/pb/bitcoin"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+)
+
+// panickingController panics on ValidateAddress and DeriveAddressesStream.
+type panickingController struct {
+	pb.UnimplementedCoinServiceServer
+}
+
+func (c *panickingController) ValidateAddress(
+	ctx context.Context, request *pb.ValidateAddressRequest,
+) (*pb.ValidateAddressResponse, error) {
+	panic("index out of range")
+}
+
+func (c *panickingController) DeriveAddressesStream(
+	request *pb.DeriveAddressesRequest, stream pb.CoinService_DeriveAddressesStreamServer,
+) error {
+	panic("index out of range")
+}
+
+func TestRecoveryInterceptor(t *testing.T) {
+	listener := bufconn.Listen(1024 * 1024)
+
+	s := grpc.NewServer(grpc.UnaryInterceptor(RecoveryInterceptor()))
+	pb.RegisterCoinServiceServer(s, &panickingController{})
+
+	go func() {
+		_ = s.Serve(listener)
+	}()
+
+	defer s.Stop()
+
+	conn, err := grpc.Dial("bufnet",
+		grpc.WithContextDialer(func(context.Context, string) (net.Conn, error) {
+			return listener.Dial()
+		}),
+		grpc.WithInsecure(),
+	)
+	if err != nil {
+		t.Fatalf("failed to dial bufnet: %v", err)
+	}
+
+	defer conn.Close()
+
+	client := pb.NewCoinServiceClient(conn)
+
+	// The server must keep serving after a panic.
+	for i := 0; i < 2; i++ {
+		_, err := client.ValidateAddress(context.Background(), &pb.ValidateAddressRequest{})
+		if status.Code(err) != codes.Internal {
+			t.Fatalf("ValidateAddress() got error '%v', want code %s", err, codes.Internal)
+		}
+
+		if strings.Contains(status.Convert(err).Message(), "index out of range") {
+			t.Fatalf("ValidateAddress() got message '%s', want sanitized message",
+				status.Convert(err).Message())
+		}
+	}
+}
+
+func TestRecoveryStreamInterceptor(t *testing.T) {
+	listener := bufconn.Listen(1024 * 1024)
+
+	s := grpc.NewServer(grpc.StreamInterceptor(RecoveryStreamInterceptor()))
+	pb.RegisterCoinServiceServer(s, &panickingController{})
+
+	go func() {
+		_ = s.Serve(listener)
+	}()
+
+	defer s.Stop()
+
+	conn, err := grpc.Dial("bufnet",
+		grpc.WithContextDialer(func(context.Context, string) (net.Conn, error) {
+			return listener.Dial()
+		}),
+		grpc.WithInsecure(),
+	)
+	if err != nil {
+		t.Fatalf("failed to dial bufnet: %v", err)
+	}
+
+	defer conn.Close()
+
+	client := pb.NewCoinServiceClient(conn)
+
+	// The server must keep serving after a panic.
+	for i := 0; i < 2; i++ {
+		stream, err := client.DeriveAddressesStream(context.Background(), &pb.DeriveAddressesRequest{})
+		if err != nil {
+			t.Fatalf("DeriveAddressesStream() got error '%v'", err)
+		}
+
+		_, err = stream.Recv()
+		if status.Code(err) != codes.Internal {
+			t.Fatalf("Recv() got error '%v', want code %s", err, codes.Internal)
+		}
+
+		if strings.Contains(status.Convert(err).Message(), "index out of range") {
+			t.Fatalf("Recv() got message '%s', want sanitized message",
+				status.Convert(err).Message())
+		}
+	}
+}
@@ -11,9 +11,10 @@ import (
 )
 
 const (
-	entryPoint = "cmd/lbs.go"
-	ldFlags    = "-X $PACKAGE/version/version.commitHash=$COMMIT_HASH " +
-		"-X $PACKAGE/version/version.buildDate=$BUILD_DATE"
+	packageName = "github.com/ledgerhq/bitcoin-lib-grpc"
+	entryPoint  = "cmd/lbs.go"
+	ldFlags     = "-X $PACKAGE/version.GitCommit=$COMMIT_HASH " +
+		"-X $PACKAGE/version.BuildDate=$BUILD_DATE"
 	protoPlugins        = "plugins=grpc"
 	protoDir            = "pb"
 	protoFileName       = "bitcoin/service.proto"
@@ -113,7 +114,7 @@ func Lint() error {
 func flagEnv() map[string]string {
 	hash, _ := sh.Output("git", "rev-parse", "--short", "HEAD")
 	return map[string]string{
-		"PACKAGE":     entryPoint,
+		"PACKAGE":     packageName,
 		"COMMIT_HASH": hash,
 		"BUILD_DATE":  time.Now().Format("2006-01-02T15:04:05Z0700"),
 	}
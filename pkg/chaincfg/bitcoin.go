@@ -1,6 +1,12 @@
 package chaincfg
 
-import "github.com/btcsuite/btcd/chaincfg"
+import (
+	"time"
+
+	"github.com/btcsuite/btcd/chaincfg"
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/btcsuite/btcd/wire"
+)
 
 // Bitcoin network params
 var (
@@ -11,7 +17,82 @@ var (
 	// (version 3).
 	BitcoinTestNet3Params = &chaincfg.TestNet3Params
 
+	// BitcoinTestNet4Params defines the network parameters for the test Bitcoin network
+	// (version 4).
+	BitcoinTestNet4Params *chaincfg.Params
+
 	// BitcoinRegressionNetParams defines the network parameters for the regression test
 	// Bitcoin network.
 	BitcoinRegressionNetParams = &chaincfg.RegressionNetParams
 )
+
+// testNet4GenesisCoinbaseTx is the coinbase transaction of the genesis block
+// of testnet4, paying 50 BTC to an unspendable public key of zero bytes.
+var testNet4GenesisCoinbaseTx = wire.MsgTx{
+	Version: 1,
+	TxIn: []*wire.TxIn{
+		{
+			PreviousOutPoint: wire.OutPoint{
+				Hash:  chainhash.Hash{},
+				Index: 0xffffffff,
+			},
+			// <0x1d00ffff> <4> "03/May/2024 000000000000000000001ebd58c2449
+			// 70b3aa9d783bb001011fbe8ea8e98e00e"
+			SignatureScript: append([]byte{
+				0x04, 0xff, 0xff, 0x00, 0x1d, 0x01, 0x04, 0x4c, 0x4c,
+			}, "03/May/2024 000000000000000000001ebd58c244970b3aa9d783bb001011fbe8ea8e98e00e"...),
+			Sequence: 0xffffffff,
+		},
+	},
+	TxOut: []*wire.TxOut{
+		{
+			Value: 0x12a05f200,
+			// <33 zero bytes> OP_CHECKSIG
+			PkScript: append(append([]byte{0x21}, make([]byte, 33)...), 0xac),
+		},
+	},
+	LockTime: 0,
+}
+
+func init() {
+	// Copy of Btc testnet3 params to construct BitcoinTestNet4Params, as
+	// defined in BIP 94. Addresses and extended keys are encoded like the
+	// testnet3 ones.
+	// For reference, see: https://github.com/bitcoin/bitcoin/blob/v28.0/src/kernel/chainparams.cpp#L299
+	fromBtcTestNet3Params := chaincfg.TestNet3Params
+
+	BitcoinTestNet4Params = &fromBtcTestNet3Params
+	BitcoinTestNet4Params.Name = "testnet4"
+
+	// Magic number
+	BitcoinTestNet4Params.Net = 0x283f161c
+	BitcoinTestNet4Params.DefaultPort = "48333"
+	BitcoinTestNet4Params.DNSSeeds = []chaincfg.DNSSeed{
+		{Host: "seed.testnet4.bitcoin.sprovoost.nl", HasFiltering: true},
+		{Host: "seed.testnet4.wiz.biz", HasFiltering: true},
+	}
+
+	genesisBlock := &wire.MsgBlock{
+		Header: wire.BlockHeader{
+			Version:    1,
+			PrevBlock:  chainhash.Hash{},
+			MerkleRoot: testNet4GenesisCoinbaseTx.TxHash(),
+			Timestamp:  time.Unix(1714777860, 0),
+			Bits:       0x1d00ffff,
+			Nonce:      393743547,
+		},
+		Transactions: []*wire.MsgTx{&testNet4GenesisCoinbaseTx},
+	}
+	genesisHash := genesisBlock.BlockHash()
+
+	BitcoinTestNet4Params.GenesisBlock = genesisBlock
+	BitcoinTestNet4Params.GenesisHash = &genesisHash
+
+	// The checkpoints of testnet3 do not apply to testnet4.
+	BitcoinTestNet4Params.Checkpoints = nil
+
+	// Register bitcoin testnet4 network params to the chaincfg
+	if err := chaincfg.Register(BitcoinTestNet4Params); err != nil {
+		panic(err)
+	}
+}
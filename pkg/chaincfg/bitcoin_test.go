@@ -0,0 +1,37 @@
+package chaincfg
+
+import (
+	"testing"
+
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/btcsuite/btcd/wire"
+)
+
+func TestBitcoinTestNet4Params(t *testing.T) {
+	// BIP0094: genesis block of testnet4.
+	wantHash, err := chainhash.NewHashFromStr("00000000da84f2bafbbc53dee25a72ae507ff4914b867c565be350b0da8bf043")
+	if err != nil {
+		t.Fatalf("NewHashFromStr() got error '%v'", err)
+	}
+
+	wantMerkleRoot, err := chainhash.NewHashFromStr("7aa0a7ae1e223414cb807e40cd57e667b718e42aaf9306db9102fe28912b7b4e")
+	if err != nil {
+		t.Fatalf("NewHashFromStr() got error '%v'", err)
+	}
+
+	if got := BitcoinTestNet4Params.Net; got != wire.BitcoinNet(0x283f161c) {
+		t.Fatalf("Net got 0x%08x, want 0x%08x", uint32(got), 0x283f161c)
+	}
+
+	if got := BitcoinTestNet4Params.GenesisHash; !got.IsEqual(wantHash) {
+		t.Fatalf("GenesisHash got %v, want %v", got, wantHash)
+	}
+
+	if got := BitcoinTestNet4Params.GenesisBlock.BlockHash(); !got.IsEqual(wantHash) {
+		t.Fatalf("GenesisBlock.BlockHash() got %v, want %v", got, wantHash)
+	}
+
+	if got := BitcoinTestNet4Params.GenesisBlock.Header.MerkleRoot; !got.IsEqual(wantMerkleRoot) {
+		t.Fatalf("GenesisBlock merkle root got %v, want %v", got, wantMerkleRoot)
+	}
+}
@@ -0,0 +1,62 @@
+package chaincfg
+
+import (
+	"github.com/btcsuite/btcd/chaincfg"
+)
+
+// Bitcoin Cash network params
+// For reference, see: https://github.com/gcash/bchd/blob/master/chaincfg/params.go
+var (
+	// BitcoinCashMainNetParams defines the network parameters for the main
+	// Bitcoin Cash network.
+	BitcoinCashMainNetParams *chaincfg.Params
+
+	// BitcoinCashTestNet3Params defines the network parameters for the test
+	// Bitcoin Cash network (version 3).
+	BitcoinCashTestNet3Params *chaincfg.Params
+)
+
+func init() {
+	// Copy of Btc main net params to construct BCH BitcoinCashMainNetParams
+	fromBtcMainNetParams := chaincfg.MainNetParams
+
+	BitcoinCashMainNetParams = &fromBtcMainNetParams
+	BitcoinCashMainNetParams.Name = "bchmainnet"
+
+	// Magic number
+	BitcoinCashMainNetParams.Net = 0xe8f3e1e3
+
+	// Bitcoin Cash does not support segwit, so there is no human-readable
+	// part for Bech32 encoded segwit addresses.
+	BitcoinCashMainNetParams.Bech32HRPSegwit = ""
+
+	// BIP44 coin type used in the hierarchical deterministic path for
+	// address generation.
+	BitcoinCashMainNetParams.HDCoinType = 145
+
+	// Copy of Btc testnet3 params to construct BCH BitcoinCashTestNet3Params
+	fromBtcTestNet3Params := chaincfg.TestNet3Params
+
+	BitcoinCashTestNet3Params = &fromBtcTestNet3Params
+	BitcoinCashTestNet3Params.Name = "bchtestnet3"
+
+	// Magic number
+	BitcoinCashTestNet3Params.Net = 0xf4e5f3f4
+
+	// Bitcoin Cash does not support segwit, so there is no human-readable
+	// part for Bech32 encoded segwit addresses.
+	BitcoinCashTestNet3Params.Bech32HRPSegwit = ""
+
+	// BIP44 coin type used in the hierarchical deterministic path for
+	// address generation.
+	BitcoinCashTestNet3Params.HDCoinType = 1
+
+	// Register bitcoin cash network params to the chaincfg
+	if err := chaincfg.Register(BitcoinCashMainNetParams); err != nil {
+		panic(err)
+	}
+
+	if err := chaincfg.Register(BitcoinCashTestNet3Params); err != nil {
+		panic(err)
+	}
+}
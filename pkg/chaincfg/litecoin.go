@@ -4,9 +4,27 @@ import (
 	"github.com/btcsuite/btcd/chaincfg"
 )
 
-// LitecoinMainNetParams defines the network parameters for the main Litecoin network.
-// For reference, see: https://github.com/ltcsuite/ltcd/blob/master/chaincfg/params.go#L229
-var LitecoinMainNetParams *chaincfg.Params
+// Litecoin network params
+// For reference, see: https://github.com/ltcsuite/ltcd/blob/master/chaincfg/params.go
+var (
+	// LitecoinMainNetParams defines the network parameters for the main Litecoin network.
+	LitecoinMainNetParams *chaincfg.Params
+
+	// LitecoinTestNet4Params defines the network parameters for the test
+	// Litecoin network (version 4).
+	LitecoinTestNet4Params *chaincfg.Params
+
+	// LitecoinRegTestParams defines the network parameters for the
+	// regression test Litecoin network.
+	LitecoinRegTestParams *chaincfg.Params
+)
+
+// litecoinRegTestNet is the magic number identifying Litecoin regtest in
+// this library. Litecoin regtest actually uses the magic number of Bitcoin
+// regtest, which btcd refuses to register twice, and which would make the
+// policies keyed by magic number ambiguous. The magic number only matters
+// in P2P messages, that this library does not handle.
+const litecoinRegTestNet = 0xdab5bffb
 
 func init() {
 	// Copy of Btc main net params to construct LTC LitecoinMainNetParams
@@ -28,16 +46,72 @@ func init() {
 	LitecoinMainNetParams.WitnessPubKeyHashAddrID = 0x06 // starts with p2
 	LitecoinMainNetParams.WitnessScriptHashAddrID = 0x0A // starts with 7Xh
 
-	// BIP32 hierarchical deterministic extended key magics
-	LitecoinMainNetParams.HDPrivateKeyID = [4]byte{0x04, 0x88, 0xad, 0xe4} // starts with Ltpv
-	LitecoinMainNetParams.HDPublicKeyID = [4]byte{0x04, 0x88, 0xb2, 0x1e}  // starts with Ltub
+	// BIP32 hierarchical deterministic extended key magics, the same as
+	// Bitcoin rather than the Ltpv and Ltub ones of SLIP-0132.
+	LitecoinMainNetParams.HDPrivateKeyID = [4]byte{0x04, 0x88, 0xad, 0xe4} // starts with xprv
+	LitecoinMainNetParams.HDPublicKeyID = [4]byte{0x04, 0x88, 0xb2, 0x1e}  // starts with xpub
 
 	// BIP44 coin type used in the hierarchical deterministic path for
 	// address generation.
 	LitecoinMainNetParams.HDCoinType = 2
 
+	// Copy of Btc testnet3 params to construct LTC LitecoinTestNet4Params
+	fromBtcTestNet3Params := chaincfg.TestNet3Params
+
+	LitecoinTestNet4Params = &fromBtcTestNet3Params
+	LitecoinTestNet4Params.Name = "ltctestnet4"
+
+	// Magic number
+	LitecoinTestNet4Params.Net = 0xf1c8d2fd
+
+	// Human-readable part for Bech32 encoded segwit addresses, as defined in
+	// BIP 173.
+	LitecoinTestNet4Params.Bech32HRPSegwit = "tltc"
+
+	setLitecoinTestAddressMagics(LitecoinTestNet4Params)
+
+	// Copy of Btc regtest params to construct LTC LitecoinRegTestParams
+	fromBtcRegTestParams := chaincfg.RegressionNetParams
+
+	LitecoinRegTestParams = &fromBtcRegTestParams
+	LitecoinRegTestParams.Name = "ltcregtest"
+
+	// Magic number
+	LitecoinRegTestParams.Net = litecoinRegTestNet
+
+	// Human-readable part for Bech32 encoded segwit addresses, as defined in
+	// BIP 173.
+	LitecoinRegTestParams.Bech32HRPSegwit = "rltc"
+
+	setLitecoinTestAddressMagics(LitecoinRegTestParams)
+
 	// Register litecoin network params to the changcfg
 	if err := chaincfg.Register(LitecoinMainNetParams); err != nil {
 		panic(err)
 	}
+
+	if err := chaincfg.Register(LitecoinTestNet4Params); err != nil {
+		panic(err)
+	}
+
+	if err := chaincfg.Register(LitecoinRegTestParams); err != nil {
+		panic(err)
+	}
+}
+
+// setLitecoinTestAddressMagics sets the address and extended key encoding
+// magics shared by the Litecoin test networks.
+func setLitecoinTestAddressMagics(params *chaincfg.Params) {
+	// Address encoding magics
+	params.PubKeyHashAddrID = 0x6f // starts with m or n
+	params.ScriptHashAddrID = 0x3a // starts with Q
+	params.PrivateKeyID = 0xef     // starts with 9 (uncompressed) or c (compressed)
+
+	// BIP32 hierarchical deterministic extended key magics of SLIP-0132.
+	params.HDPrivateKeyID = [4]byte{0x04, 0x36, 0xef, 0x7d} // starts with ttpv
+	params.HDPublicKeyID = [4]byte{0x04, 0x36, 0xf6, 0xe1}  // starts with ttub
+
+	// BIP44 coin type used in the hierarchical deterministic path for
+	// address generation.
+	params.HDCoinType = 1
 }
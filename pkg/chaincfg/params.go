@@ -1,7 +1,45 @@
 package chaincfg
 
-import "github.com/btcsuite/btcd/chaincfg"
+import (
+	"strings"
+
+	"github.com/btcsuite/btcd/chaincfg"
+	"github.com/pkg/errors"
+)
 
 // ChainParams is a type alias for chaincfg.Params, to allow external
 // packages to refer to the chain parameters without importing btcd.
 type ChainParams = *chaincfg.Params
+
+// ChainParamsByName returns the chain parameters of a network from its name,
+// case-insensitive. Bitcoin networks are also accepted without the
+// "bitcoin-" prefix:
+//   * bitcoin-mainnet, bitcoin-testnet3, bitcoin-testnet4, bitcoin-regtest
+//   * bitcoin-cash-mainnet, bitcoin-cash-testnet3
+//   * litecoin, litecoin-mainnet, litecoin-testnet4, litecoin-regtest
+func ChainParamsByName(name string) (ChainParams, error) {
+	// The parameters are looked up at call time, as some of them are only
+	// built by the init functions of the package.
+	switch strings.ToLower(name) {
+	case "bitcoin-mainnet", "mainnet":
+		return BitcoinMainNetParams, nil
+	case "bitcoin-testnet3", "testnet3":
+		return BitcoinTestNet3Params, nil
+	case "bitcoin-testnet4", "testnet4":
+		return BitcoinTestNet4Params, nil
+	case "bitcoin-regtest", "regtest":
+		return BitcoinRegressionNetParams, nil
+	case "bitcoin-cash-mainnet":
+		return BitcoinCashMainNetParams, nil
+	case "bitcoin-cash-testnet3":
+		return BitcoinCashTestNet3Params, nil
+	case "litecoin", "litecoin-mainnet":
+		return LitecoinMainNetParams, nil
+	case "litecoin-testnet4":
+		return LitecoinTestNet4Params, nil
+	case "litecoin-regtest":
+		return LitecoinRegTestParams, nil
+	default:
+		return nil, errors.Errorf("unknown network name %q", name)
+	}
+}
@@ -0,0 +1,42 @@
+package chaincfg
+
+import "testing"
+
+func TestChainParamsByName(t *testing.T) {
+	tests := []struct {
+		name    string
+		want    ChainParams
+		wantErr bool
+	}{
+		{name: "bitcoin-mainnet", want: BitcoinMainNetParams},
+		{name: "mainnet", want: BitcoinMainNetParams},
+		{name: "Bitcoin-Mainnet", want: BitcoinMainNetParams},
+		{name: "bitcoin-testnet3", want: BitcoinTestNet3Params},
+		{name: "testnet3", want: BitcoinTestNet3Params},
+		{name: "bitcoin-testnet4", want: BitcoinTestNet4Params},
+		{name: "TESTNET4", want: BitcoinTestNet4Params},
+		{name: "bitcoin-regtest", want: BitcoinRegressionNetParams},
+		{name: "regtest", want: BitcoinRegressionNetParams},
+		{name: "bitcoin-cash-mainnet", want: BitcoinCashMainNetParams},
+		{name: "bitcoin-cash-testnet3", want: BitcoinCashTestNet3Params},
+		{name: "litecoin", want: LitecoinMainNetParams},
+		{name: "litecoin-mainnet", want: LitecoinMainNetParams},
+		{name: "litecoin-testnet4", want: LitecoinTestNet4Params},
+		{name: "litecoin-regtest", want: LitecoinRegTestParams},
+		{name: "dogecoin", wantErr: true},
+		{name: "", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ChainParamsByName(tt.name)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ChainParamsByName() got error '%v', want error %v", err, tt.wantErr)
+			}
+
+			if got != tt.want {
+				t.Fatalf("ChainParamsByName() got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -1,15 +1,28 @@
 package core
 
 import (
+	"context"
+	"crypto/sha256"
 	"encoding/hex"
+	"fmt"
+	"strings"
 
-	"github.com/btcsuite/btcd/btcec"
+	"github.com/btcsuite/btcd/btcec/v2"
+	"github.com/btcsuite/btcd/btcec/v2/schnorr"
+	"github.com/btcsuite/btcd/btcutil"
+	"github.com/btcsuite/btcd/btcutil/base58"
+	"github.com/btcsuite/btcd/btcutil/hdkeychain"
 	"github.com/btcsuite/btcd/txscript"
-	"github.com/btcsuite/btcutil"
+	"github.com/btcsuite/btcd/wire"
+	"github.com/decred/dcrd/dcrec/secp256k1/v4"
 	"github.com/ledgerhq/bitcoin-lib-grpc/pkg/chaincfg"
 	"github.com/pkg/errors"
 )
 
+// maxStandardWitnessScriptSize is the maximum size of a P2WSH witness
+// script relayed by Bitcoin Core.
+const maxStandardWitnessScriptSize = 3600
+
 // AddressEncoding is an enum type for the various address encoding
 // schemes supported for Bitcoin.
 type AddressEncoding int
@@ -24,23 +37,277 @@ const (
 
 	// NativeSegwit indicates the P2WPKH address encoding scheme.
 	NativeSegwit
+
+	// Taproot indicates the P2TR address encoding scheme, paying to the
+	// BIP0086 output key of the public key, without script path.
+	Taproot
 )
 
-// ValidateAddress returns an error if the given address is malformed.
-// It returns the normalized address otherwise.
-func (s *Service) ValidateAddress(address string, chainParams chaincfg.ChainParams) (string, error) {
+func (e AddressEncoding) String() string {
+	switch e {
+	case Legacy:
+		return "P2PKH"
+	case WrappedSegwit:
+		return "P2SH-P2WPKH"
+	case NativeSegwit:
+		return "P2WPKH"
+	case Taproot:
+		return "P2TR"
+	default:
+		return fmt.Sprintf("AddressEncoding(%d)", int(e))
+	}
+}
+
+// AddressType is an enum type for the output types that an address can pay
+// to, as decoded by ValidateAddress.
+type AddressType int
+
+const (
+	// AddressTypeUnknown indicates an address that could not be decoded.
+	AddressTypeUnknown AddressType = iota
+
+	// AddressTypeP2PKH indicates a Pay-to-PubKey-Hash address.
+	AddressTypeP2PKH
+
+	// AddressTypeP2SH indicates a Pay-to-Script-Hash address, including
+	// P2SH-wrapped segwit addresses, which cannot be told apart.
+	AddressTypeP2SH
+
+	// AddressTypeP2WPKH indicates a Pay-to-Witness-PubKey-Hash address.
+	AddressTypeP2WPKH
+
+	// AddressTypeP2WSH indicates a Pay-to-Witness-Script-Hash address.
+	AddressTypeP2WSH
+
+	// AddressTypeP2TR indicates a Pay-to-Taproot address.
+	AddressTypeP2TR
+)
+
+func (t AddressType) String() string {
+	switch t {
+	case AddressTypeP2PKH:
+		return "P2PKH"
+	case AddressTypeP2SH:
+		return "P2SH"
+	case AddressTypeP2WPKH:
+		return "P2WPKH"
+	case AddressTypeP2WSH:
+		return "P2WSH"
+	case AddressTypeP2TR:
+		return "P2TR"
+	default:
+		return "Unknown"
+	}
+}
+
+// addressType returns the type of a decoded address, based on its concrete
+// type.
+//
+// Public keys are classified as P2PKH, since their address is the one of
+// their P2PKH output.
+func addressType(addr btcutil.Address) AddressType {
+	switch addr.(type) {
+	case *btcutil.AddressPubKeyHash, *btcutil.AddressPubKey:
+		return AddressTypeP2PKH
+	case *btcutil.AddressScriptHash:
+		return AddressTypeP2SH
+	case *btcutil.AddressWitnessPubKeyHash:
+		return AddressTypeP2WPKH
+	case *btcutil.AddressWitnessScriptHash:
+		return AddressTypeP2WSH
+	case *btcutil.AddressTaproot:
+		return AddressTypeP2TR
+	default:
+		return AddressTypeUnknown
+	}
+}
+
+// mwebHRPs maps the magic number of a Litecoin network to the
+// human-readable part of its MWEB addresses.
+var mwebHRPs = map[wire.BitcoinNet]string{
+	chaincfg.LitecoinMainNetParams.Net:  "ltcmweb",
+	chaincfg.LitecoinTestNet4Params.Net: "tmweb",
+	chaincfg.LitecoinRegTestParams.Net:  "tmweb",
+}
+
+// checkMwebAddress returns an error wrapping ErrMwebAddress if the address
+// is a Litecoin MWEB address for the network of the chain parameters.
+//
+// MWEB addresses are Bech32 strings with their own human-readable part, and
+// pay to the MimbleWimble extension block, which regular transaction outputs
+// cannot do.
+func checkMwebAddress(address string, chainParams chaincfg.ChainParams) error {
+	hrp, ok := mwebHRPs[chainParams.Net]
+	if !ok {
+		return nil
+	}
+
+	if strings.HasPrefix(strings.ToLower(address), hrp+"1") {
+		return errors.Wrapf(ErrMwebAddress, "address %s", address)
+	}
+
+	return nil
+}
+
+// decodeAddress decodes an address with btcutil.DecodeAddress.
+//
+// Litecoin MWEB addresses are rejected with ErrMwebAddress, and segwit
+// addresses encoded with the wrong checksum variant for their witness
+// version with ErrBech32Variant. Otherwise, the error of btcutil is returned
+// if the decoding fails.
+func decodeAddress(address string, chainParams chaincfg.ChainParams) (btcutil.Address, error) {
+	if err := checkMwebAddress(address, chainParams); err != nil {
+		return nil, err
+	}
+
 	addr, err := btcutil.DecodeAddress(address, chainParams)
+	if err == nil {
+		return addr, nil
+	}
+
+	if variantErr := checkBech32Variant(address); variantErr != nil {
+		return nil, variantErr
+	}
+
+	return nil, err
+}
+
+// isForeignBase58Address returns whether an address, which failed to decode
+// for the chain parameters, is a base58 address with the P2PKH or P2SH
+// version byte of another known network, such as a Litecoin address in a
+// Bitcoin transaction. Unlike segwit addresses, btcutil rejects such
+// addresses as of unknown type, rather than decoding them for their
+// network.
+func isForeignBase58Address(address string, chainParams chaincfg.ChainParams) bool {
+	_, version, err := base58.CheckDecode(address)
 	if err != nil {
-		return "", errors.Wrapf(err, "failed to decode address %s", address)
+		return false
+	}
+
+	if version == chainParams.PubKeyHashAddrID || version == chainParams.ScriptHashAddrID {
+		return false
+	}
+
+	for _, params := range knownChainParams() {
+		if version == params.PubKeyHashAddrID || version == params.ScriptHashAddrID {
+			return true
+		}
+	}
+
+	return false
+}
+
+// knownChainParams returns the chain parameters of all supported networks.
+// They are listed at call time, as some of them are only built by the init
+// functions of the chaincfg package.
+func knownChainParams() []chaincfg.ChainParams {
+	return []chaincfg.ChainParams{
+		chaincfg.BitcoinMainNetParams,
+		chaincfg.BitcoinTestNet3Params,
+		chaincfg.BitcoinTestNet4Params,
+		chaincfg.BitcoinRegressionNetParams,
+		chaincfg.BitcoinCashMainNetParams,
+		chaincfg.BitcoinCashTestNet3Params,
+		chaincfg.LitecoinMainNetParams,
+		chaincfg.LitecoinTestNet4Params,
+		chaincfg.LitecoinRegTestParams,
+	}
+}
+
+// addressEncodingFromScript infers the address encoding of an output from
+// its script.
+//
+// P2SH outputs are assumed to be P2WPKH nested in P2SH, which is the only
+// P2SH output type supported for signing.
+func addressEncodingFromScript(script []byte) (AddressEncoding, error) {
+	switch txscript.GetScriptClass(script) {
+	case txscript.PubKeyHashTy:
+		return Legacy, nil
+	case txscript.ScriptHashTy:
+		return WrappedSegwit, nil
+	case txscript.WitnessV0PubKeyHashTy:
+		return NativeSegwit, nil
+	case txscript.WitnessV1TaprootTy:
+		return Taproot, nil
+	default:
+		return -1, errors.Wrapf(ErrUnknownAddressType,
+			"unsupported output script %x", script)
+	}
+}
+
+// ValidateAddress returns an error if the given address is malformed.
+// It returns the normalized address, and the type of output it pays to,
+// otherwise.
+func (s *Service) ValidateAddress(
+	address string, chainParams chaincfg.ChainParams,
+) (string, AddressType, error) {
+	addr, err := decodeAddress(address, chainParams)
+	if err != nil {
+		return "", AddressTypeUnknown, errors.Wrapf(err, "failed to decode address %s", address)
 	}
 
 	// Normalize the original address
-	return addr.EncodeAddress(), nil
+	return addr.EncodeAddress(), addressType(addr), nil
+}
+
+// AddressValidation is the result of the validation of a single address by
+// ValidateAddresses.
+type AddressValidation struct {
+	// Address is the normalized address if valid, or the original address
+	// otherwise.
+	Address string
+
+	// IsValid is whether the address is valid for the chain parameters.
+	IsValid bool
+
+	// AddressType is the type of output the address pays to, and is
+	// AddressTypeUnknown if the address is invalid.
+	AddressType AddressType
+
+	// InvalidReason is the reason why the address is invalid, and is empty
+	// if the address is valid.
+	InvalidReason string
+}
+
+// ValidateAddresses validates a batch of addresses with ValidateAddress,
+// and returns one result per address, in the same order. An invalid address
+// does not prevent the validation of the next ones.
+func (s *Service) ValidateAddresses(
+	addresses []string, chainParams chaincfg.ChainParams,
+) []AddressValidation {
+	validations := make([]AddressValidation, len(addresses))
+
+	for idx, address := range addresses {
+		normalized, addrType, err := s.ValidateAddress(address, chainParams)
+		if err != nil {
+			validations[idx] = AddressValidation{
+				Address:       address,
+				IsValid:       false,
+				InvalidReason: err.Error(),
+			}
+
+			continue
+		}
+
+		validations[idx] = AddressValidation{
+			Address:     normalized,
+			IsValid:     true,
+			AddressType: addrType,
+		}
+	}
+
+	return validations
 }
 
 // EncodeAddress serializes a public key into a string, based on the
 // encoding and the chain parameters.
 //
+// The compressed flag selects the serialization of the public key that the
+// address commits to. Uncompressed keys are only supported by the Legacy
+// encoding, for wallets that historically used them, as segwit and taproot
+// outputs require compressed keys. Other encodings are rejected with
+// ErrUncompressedPublicKey if compressed is false.
+//
 // References:
 //   [Learn me a Bitcoin]: P2PKH - Pay To Pubkey Hash
 //   https://learnmeabitcoin.com/technical/p2pkh
@@ -50,8 +317,11 @@ func (s *Service) ValidateAddress(address string, chainParams chaincfg.ChainPara
 //
 //   [BIP173]: BIP0173 - Base32 address format for native v0-16 witness outputs
 //   https://github.com/bitcoin/bips/blob/master/bip-0173.mediawiki
+//
+//   [BIP86]: BIP0086 - Key Derivation for Single Key P2TR Outputs
+//   https://github.com/bitcoin/bips/blob/master/bip-0086.mediawiki
 func (s *Service) EncodeAddress(
-	publicKey []byte, encoding AddressEncoding, chainParams chaincfg.ChainParams,
+	publicKey []byte, encoding AddressEncoding, compressed bool, chainParams chaincfg.ChainParams,
 ) (string, error) {
 	// Load the serialized public key to a btcec.PublicKey type, in order to
 	// ensure that the:
@@ -63,12 +333,381 @@ func (s *Service) EncodeAddress(
 	//
 	// Using addresses encoded from incorrect public keys may lead to
 	// irrevocable fund loss.
-	loadedPublicKey, err := btcec.ParsePubKey(publicKey, btcec.S256())
+	loadedPublicKey, err := parsePublicKey(publicKey)
 	if err != nil {
 		return "", errors.Wrapf(err, "failed to parse public key %s",
 			hex.EncodeToString(publicKey))
 	}
 
+	if !compressed {
+		if encoding != Legacy {
+			return "", errors.Wrapf(ErrUncompressedPublicKey,
+				"unable to encode uncompressed public key to %s address", encoding)
+		}
+
+		address, err := btcutil.NewAddressPubKeyHash(
+			btcutil.Hash160(loadedPublicKey.SerializeUncompressed()), chainParams)
+		if err != nil {
+			return "", errors.Wrapf(err, "unable to encode public key %s to address",
+				hex.EncodeToString(publicKey))
+		}
+
+		return address.EncodeAddress(), nil
+	}
+
+	address, err := addressFromPublicKey(loadedPublicKey, encoding, chainParams)
+	if err != nil {
+		return "", errors.Wrapf(err, "unable to encode public key %s to address",
+			hex.EncodeToString(publicKey))
+	}
+
+	return address.EncodeAddress(), nil
+}
+
+// AddressSet contains the addresses of a public key for each single-key
+// address encoding.
+type AddressSet struct {
+	Legacy        string
+	WrappedSegwit string
+	NativeSegwit  string
+	Taproot       string
+}
+
+// AddressesFromPublicKey returns the P2PKH, P2SH-P2WPKH, P2WPKH and P2TR
+// addresses of a compressed public key, to avoid one EncodeAddress call
+// per encoding.
+//
+// Networks without segwit support, such as Bitcoin Cash, only get a legacy
+// address, and the segwit addresses are left empty.
+func (s *Service) AddressesFromPublicKey(
+	publicKey []byte, chainParams chaincfg.ChainParams,
+) (*AddressSet, error) {
+	if len(publicKey) != btcec.PubKeyBytesLenCompressed {
+		return nil, errors.Wrapf(ErrUncompressedPublicKey,
+			"got %d-byte public key %s", len(publicKey), hex.EncodeToString(publicKey))
+	}
+
+	addresses := &AddressSet{}
+
+	encodings := []struct {
+		encoding AddressEncoding
+		address  *string
+	}{
+		{Legacy, &addresses.Legacy},
+		{WrappedSegwit, &addresses.WrappedSegwit},
+		{NativeSegwit, &addresses.NativeSegwit},
+		{Taproot, &addresses.Taproot},
+	}
+
+	for _, e := range encodings {
+		if e.encoding != Legacy && chainParams.Bech32HRPSegwit == "" {
+			continue
+		}
+
+		address, err := s.EncodeAddress(publicKey, e.encoding, true, chainParams)
+		if err != nil {
+			return nil, errors.Wrapf(err, "failed to encode %s address", e.encoding)
+		}
+
+		*e.address = address
+	}
+
+	return addresses, nil
+}
+
+// EncodeScriptAddress returns the bare P2SH address of a redeem script, for
+// the network of the chain parameters:
+//   OP_HASH160 <hash160(redeemScript)> OP_EQUAL
+//
+// The redeem script is hashed as is, unlike the P2SH-P2WPKH encoding of
+// EncodeAddress, where it is the witness program of a public key. It must
+// fit in the 520-byte push of the scriptSig spending it.
+//
+// References:
+//   [BIP16]: BIP0016 - Pay to Script Hash
+//   https://github.com/bitcoin/bips/blob/master/bip-0016.mediawiki
+func (s *Service) EncodeScriptAddress(
+	redeemScript []byte, chainParams chaincfg.ChainParams,
+) (string, error) {
+	if len(redeemScript) == 0 || len(redeemScript) > txscript.MaxScriptElementSize {
+		return "", errors.Errorf("redeemScript is %d bytes long, expected between 1 and %d",
+			len(redeemScript), txscript.MaxScriptElementSize)
+	}
+
+	address, err := btcutil.NewAddressScriptHash(redeemScript, chainParams)
+	if err != nil {
+		return "", errors.Wrapf(err, "failed to encode P2SH address of redeemScript %x",
+			redeemScript)
+	}
+
+	return address.EncodeAddress(), nil
+}
+
+// EncodeWitnessScriptAddress returns the P2WSH address of a witness script,
+// for the network of the chain parameters:
+//   OP_0 <sha256(witnessScript)>
+//
+// The witness script must not exceed the 3600-byte standardness limit of
+// P2WSH witness scripts.
+//
+// References:
+//   [BIP141]: BIP0141 - Segregated Witness (Consensus layer)
+//   https://github.com/bitcoin/bips/blob/master/bip-0141.mediawiki#p2wsh
+func (s *Service) EncodeWitnessScriptAddress(
+	witnessScript []byte, chainParams chaincfg.ChainParams,
+) (string, error) {
+	if len(witnessScript) == 0 || len(witnessScript) > maxStandardWitnessScriptSize {
+		return "", errors.Errorf("witnessScript is %d bytes long, expected between 1 and %d",
+			len(witnessScript), maxStandardWitnessScriptSize)
+	}
+
+	if chainParams.Bech32HRPSegwit == "" {
+		return "", errors.Wrapf(ErrUnknownAddressType,
+			"no segwit support for network %s", chainParams.Name)
+	}
+
+	witnessScriptHash := sha256.Sum256(witnessScript)
+
+	address, err := btcutil.NewAddressWitnessScriptHash(witnessScriptHash[:], chainParams)
+	if err != nil {
+		return "", errors.Wrapf(err, "failed to encode P2WSH address of witnessScript %x",
+			witnessScript)
+	}
+
+	return address.EncodeAddress(), nil
+}
+
+// AddressToScript returns the output script, i.e. the scriptPubKey, that
+// pays to the given address, for the network of the chain parameters.
+func (s *Service) AddressToScript(
+	address string, chainParams chaincfg.ChainParams,
+) ([]byte, error) {
+	addr, err := decodeAddress(address, chainParams)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to decode address %s", address)
+	}
+
+	script, err := txscript.PayToAddrScript(addr)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to build output script of address %s",
+			address)
+	}
+
+	return script, nil
+}
+
+// ScriptToAddress returns the address an output script pays to, encoded for
+// the network of the chain parameters. It is the reverse of AddressToScript.
+//
+// Scripts that do not pay to a single address, such as bare multisig or
+// OP_RETURN scripts, are rejected.
+func (s *Service) ScriptToAddress(
+	script []byte, chainParams chaincfg.ChainParams,
+) (string, error) {
+	addr, err := addressFromScript(script, chainParams)
+	if err != nil {
+		return "", err
+	}
+
+	return addr.EncodeAddress(), nil
+}
+
+// AddressInfo contains an address derived from an account extended key,
+// along with its index at the address level of the derivation path.
+type AddressInfo struct {
+	Index     uint32
+	Address   string
+	PublicKey []byte
+}
+
+// DeriveAddresses derives count consecutive addresses from an account
+// extended key, starting at startIndex, on the given change chain.
+//
+// The account key MUST be at BIP32 level 3, and the addresses are derived
+// using the following scheme:
+//   account / change / address_index
+//
+// The change-level node is derived once, and reused for every address
+// index, which makes it suitable for scanning large gap limits. The
+// derivation stops with the error of ctx, wrapped, as soon as ctx is done.
+//
+// The HD version bytes of the account key must be those of the network of
+// the chain parameters, for any address encoding, e.g. tpub, upub or vpub
+// on the Bitcoin test network. Otherwise, ErrNetworkMismatch is returned.
+func (s *Service) DeriveAddresses(
+	ctx context.Context,
+	accountKey string,
+	encoding AddressEncoding,
+	change uint32,
+	startIndex uint32,
+	count uint32,
+	chainParams chaincfg.ChainParams,
+) ([]AddressInfo, error) {
+	// The addresses are not preallocated, as count is not bounded.
+	addresses := []AddressInfo{}
+
+	err := s.DeriveAddressesFunc(ctx, accountKey, encoding, change, startIndex,
+		count, chainParams, func(address AddressInfo) error {
+			addresses = append(addresses, address)
+			return nil
+		})
+	if err != nil {
+		return nil, err
+	}
+
+	return addresses, nil
+}
+
+// BIP0044 change chains, at BIP32 level 4 of the derivation path.
+const (
+	// ExternalChain is the chain of addresses meant to be visible outside
+	// of the wallet, e.g. for receiving payments.
+	ExternalChain uint32 = 0
+
+	// InternalChain is the chain of addresses not meant to be visible
+	// outside of the wallet, and used for return transaction change.
+	InternalChain uint32 = 1
+)
+
+// DeriveChangeAddresses derives count consecutive change addresses from an
+// account extended key, starting at startIndex, on the internal chain:
+//   account / 1 / address_index
+//
+// It is a convenience wrapper around DeriveAddresses, for pre-generating
+// change addresses.
+func (s *Service) DeriveChangeAddresses(
+	ctx context.Context,
+	accountKey string,
+	encoding AddressEncoding,
+	startIndex uint32,
+	count uint32,
+	chainParams chaincfg.ChainParams,
+) ([]AddressInfo, error) {
+	return s.DeriveAddresses(ctx, accountKey, encoding, InternalChain, startIndex,
+		count, chainParams)
+}
+
+// DeriveAddressesFunc is the incremental counterpart of DeriveAddresses. It
+// calls fn for each derived address, in order, as soon as it is derived.
+//
+// If fn returns an error, the derivation stops, and the error is returned
+// as is. This allows callers to stream large batches of addresses, and to
+// stop the derivation early.
+//
+// The derivation also stops with the error of ctx, wrapped, as soon as ctx
+// is done.
+func (s *Service) DeriveAddressesFunc(
+	ctx context.Context,
+	accountKey string,
+	encoding AddressEncoding,
+	change uint32,
+	startIndex uint32,
+	count uint32,
+	chainParams chaincfg.ChainParams,
+	fn func(AddressInfo) error,
+) error {
+	if startIndex >= hdkeychain.HardenedKeyStart ||
+		count > hdkeychain.HardenedKeyStart-startIndex {
+		return errors.Errorf(
+			"address indexes [%d, %d) must not be hardened", startIndex,
+			uint64(startIndex)+uint64(count))
+	}
+
+	accountXKey, err := hdkeychain.NewKeyFromString(accountKey)
+	if err != nil {
+		return errors.Wrap(err, "failed to decode xkey")
+	}
+
+	if err := checkExtendedKeyNetwork(accountXKey, chainParams); err != nil {
+		return err
+	}
+
+	if !accountXKey.IsPrivate() {
+		if err := checkPublicDerivationIndex(change); err != nil {
+			return errors.Wrap(err, "invalid change index for public xkey")
+		}
+	}
+
+	changeXKey, err := accountXKey.Derive(change)
+	if err != nil {
+		return errors.Wrapf(err, "failed to derive xkey at index %d", change)
+	}
+
+	for index := startIndex; index < startIndex+count; index++ {
+		if err := ctx.Err(); err != nil {
+			return errors.Wrapf(err, "derivation interrupted at path %d/%d",
+				change, index)
+		}
+
+		xKey, err := changeXKey.Derive(index)
+		if err != nil {
+			return errors.Wrapf(err, "failed to derive xkey at path %d/%d",
+				change, index)
+		}
+
+		pubKey, err := xKey.ECPubKey()
+		if err != nil {
+			return errors.Wrapf(err, "failed to get public key at path %d/%d",
+				change, index)
+		}
+
+		address, err := addressFromPublicKey(pubKey, encoding, chainParams)
+		if err != nil {
+			return errors.Wrapf(err, "unable to encode address at path %d/%d",
+				change, index)
+		}
+
+		if err := fn(AddressInfo{
+			Index:     index,
+			Address:   address.EncodeAddress(),
+			PublicKey: pubKey.SerializeCompressed(),
+		}); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// parsePublicKey loads a serialized public key, compressed or uncompressed,
+// to a btcec.PublicKey type.
+//
+// The terse errors of btcec are wrapped in stable messages, on which clients
+// can branch:
+//   * public key has invalid length N, expected 33 or 65
+//   * public key is not a valid point on secp256k1
+func parsePublicKey(publicKey []byte) (*btcec.PublicKey, error) {
+	loadedPublicKey, err := btcec.ParsePubKey(publicKey)
+	if err == nil {
+		return loadedPublicKey, nil
+	}
+
+	if len(publicKey) != btcec.PubKeyBytesLenCompressed &&
+		len(publicKey) != secp256k1.PubKeyBytesLenUncompressed {
+		return nil, errors.Wrapf(err, "public key has invalid length %d, expected %d or %d",
+			len(publicKey), btcec.PubKeyBytesLenCompressed, secp256k1.PubKeyBytesLenUncompressed)
+	}
+
+	return nil, errors.Wrap(err, "public key is not a valid point on secp256k1")
+}
+
+// checkSegwitPublicKey returns ErrUncompressedPublicKey if a public key to
+// commit to in a segwit script is not compressed. Segwit scripts only commit
+// to compressed public keys, as per the standardness rules of P2WSH.
+func checkSegwitPublicKey(publicKey []byte) error {
+	if len(publicKey) != btcec.PubKeyBytesLenCompressed {
+		return errors.Wrapf(ErrUncompressedPublicKey,
+			"got %d-byte public key", len(publicKey))
+	}
+
+	return nil
+}
+
+// addressFromPublicKey returns the address of a public key, based on the
+// encoding and the chain parameters.
+func addressFromPublicKey(
+	publicKey *btcec.PublicKey, encoding AddressEncoding, chainParams chaincfg.ChainParams,
+) (btcutil.Address, error) {
 	// Calculate the RIPEMD160 of the SHA256 of a public key, aka HASH160.
 	//
 	// As per Bitcoin protocol, the serialized public key MUST be compressed
@@ -76,47 +715,43 @@ func (s *Service) EncodeAddress(
 	// either compressed or uncompressed. Regarding P2PKH addresses, the
 	// convention at Ledger and in Bitcoin Wiki examples is to use compressed
 	// public keys.
-	publicKeyHash := btcutil.Hash160(loadedPublicKey.SerializeCompressed())
-
-	address, err := func() (btcutil.Address, error) {
-		switch encoding {
-		case Legacy:
-			// Ref: https://en.bitcoin.it/wiki/Technical_background_of_version_1_Bitcoin_addresses
-			return btcutil.NewAddressPubKeyHash(publicKeyHash, chainParams)
-		case WrappedSegwit:
-			// Ref: https://bitcoincore.org/en/segwit_wallet_dev/#creation-of-p2sh-p2wpkh-address
-
-			// Create a P2WPKH native-segwit address
-			p2wpkhAddress, err := btcutil.NewAddressWitnessPubKeyHash(publicKeyHash, chainParams)
-			if err != nil {
-				return nil, err
-			}
+	publicKeyHash := btcutil.Hash160(publicKey.SerializeCompressed())
 
-			// Create a P2SH redeemScript that pays to the P2WPKH address.
-			//
-			// The redeemScript is 22 bytes long, and starts with a OP_0,
-			// followed by a canonical push of the keyhash. The keyhash
-			// is HASH160 of the 33-byte compressed public key.
-			//
-			// scriptSig: OP_0 <hash160(compressed public key)>
-			redeemScript, err := txscript.PayToAddrScript(p2wpkhAddress)
-			if err != nil {
-				return nil, err
-			}
+	switch encoding {
+	case Legacy:
+		// Ref: https://en.bitcoin.it/wiki/Technical_background_of_version_1_Bitcoin_addresses
+		return btcutil.NewAddressPubKeyHash(publicKeyHash, chainParams)
+	case WrappedSegwit:
+		// Ref: https://bitcoincore.org/en/segwit_wallet_dev/#creation-of-p2sh-p2wpkh-address
 
-			return btcutil.NewAddressScriptHash(redeemScript, chainParams)
-		case NativeSegwit:
-			// Ref: https://bitcoincore.org/en/segwit_wallet_dev/#native-pay-to-witness-public-key-hash-p2wpkh
-			return btcutil.NewAddressWitnessPubKeyHash(publicKeyHash, chainParams)
-		default:
-			return nil, ErrUnknownAddressType
+		// Create a P2WPKH native-segwit address
+		p2wpkhAddress, err := btcutil.NewAddressWitnessPubKeyHash(publicKeyHash, chainParams)
+		if err != nil {
+			return nil, err
 		}
-	}()
 
-	if err != nil {
-		return "", errors.Wrapf(err, "unable to encode public key %s to address",
-			hex.EncodeToString(publicKey))
-	}
+		// Create a P2SH redeemScript that pays to the P2WPKH address.
+		//
+		// The redeemScript is 22 bytes long, and starts with a OP_0,
+		// followed by a canonical push of the keyhash. The keyhash
+		// is HASH160 of the 33-byte compressed public key.
+		//
+		// scriptSig: OP_0 <hash160(compressed public key)>
+		redeemScript, err := txscript.PayToAddrScript(p2wpkhAddress)
+		if err != nil {
+			return nil, err
+		}
 
-	return address.EncodeAddress(), nil
+		return btcutil.NewAddressScriptHash(redeemScript, chainParams)
+	case NativeSegwit:
+		// Ref: https://bitcoincore.org/en/segwit_wallet_dev/#native-pay-to-witness-public-key-hash-p2wpkh
+		return btcutil.NewAddressWitnessPubKeyHash(publicKeyHash, chainParams)
+	case Taproot:
+		// Ref: https://github.com/bitcoin/bips/blob/master/bip-0086.mediawiki#address-derivation
+		outputKey := txscript.ComputeTaprootKeyNoScript(publicKey)
+
+		return btcutil.NewAddressTaproot(schnorr.SerializePubKey(outputKey), chainParams)
+	default:
+		return nil, ErrUnknownAddressType
+	}
 }
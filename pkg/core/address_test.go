@@ -1,9 +1,14 @@
 package core
 
 import (
+	"context"
+	"encoding/hex"
 	"reflect"
+	"strings"
 	"testing"
+	"time"
 
+	"github.com/btcsuite/btcd/btcutil/hdkeychain"
 	"github.com/ledgerhq/bitcoin-lib-grpc/pkg/chaincfg"
 	"github.com/pkg/errors"
 )
@@ -14,6 +19,7 @@ func TestService_ValidateAddress(t *testing.T) {
 		address     string
 		chainParams chaincfg.ChainParams
 		want        string
+		wantType    AddressType
 		wantErr     error
 	}{
 		{
@@ -21,12 +27,54 @@ func TestService_ValidateAddress(t *testing.T) {
 			address:     "1MirQ9bwyQcGVJPwKUgapu5ouK2E2Ey4gX",
 			chainParams: chaincfg.BitcoinMainNetParams,
 			want:        "1MirQ9bwyQcGVJPwKUgapu5ouK2E2Ey4gX",
+			wantType:    AddressTypeP2PKH,
+		},
+		{
+			name:        "mainnet P2SH valid",
+			address:     "3DnW8JGpPViEZdpqat8qky1zc26EKbXnmM",
+			chainParams: chaincfg.BitcoinMainNetParams,
+			want:        "3DnW8JGpPViEZdpqat8qky1zc26EKbXnmM",
+			wantType:    AddressTypeP2SH,
+		},
+		{
+			name:        "mainnet P2WSH valid",
+			address:     "bc1qrp33g0q5c5txsp9arysrx4k6zdkfs4nce4xj0gdcccefvpysxf3qccfmv3",
+			chainParams: chaincfg.BitcoinMainNetParams,
+			want:        "bc1qrp33g0q5c5txsp9arysrx4k6zdkfs4nce4xj0gdcccefvpysxf3qccfmv3",
+			wantType:    AddressTypeP2WSH,
+		},
+		{
+			// https://github.com/bitcoin/bips/blob/master/bip-0086.mediawiki#test-vectors
+			name:        "mainnet P2TR valid",
+			address:     "bc1p5cyxnuxmeuwuvkwfem96lqzszd02n6xdcjrs20cac6yqjjwudpxqkedrcr",
+			chainParams: chaincfg.BitcoinMainNetParams,
+			want:        "bc1p5cyxnuxmeuwuvkwfem96lqzszd02n6xdcjrs20cac6yqjjwudpxqkedrcr",
+			wantType:    AddressTypeP2TR,
 		},
 		{
 			name:        "mainnet P2WPKH invalid checksum",
 			address:     "bc1qw508d6qejxtdg4y5r3zarvary0c5xw7kv8f3t5",
 			chainParams: chaincfg.BitcoinMainNetParams,
-			wantErr:     errors.New("checksum failed. Expected v8f3t4, got v8f3t5."),
+			wantErr:     errors.New("invalid checksum (expected (bech32=v8f3t4, bech32m=v8f3t4emeawh), got v8f3t5)"),
+		},
+		{
+			// https://github.com/bitcoin/bips/blob/master/bip-0350.mediawiki#test-vectors-for-v0-v16-native-segregated-witness-addresses
+			name:        "mainnet witness v1 encoded as bech32",
+			address:     "bc1p0xlxvlhemja6c4dqv22uapctqupfhlxm9h8z3k2e72q4k9hcz7vqh2y7hd",
+			chainParams: chaincfg.BitcoinMainNetParams,
+			wantErr:     ErrBech32Variant,
+		},
+		{
+			name:        "mainnet witness v16 encoded as bech32",
+			address:     "BC1S0XLXVLHEMJA6C4DQV22UAPCTQUPFHLXM9H8Z3K2E72Q4K9HCZ7VQ54WELL",
+			chainParams: chaincfg.BitcoinMainNetParams,
+			wantErr:     ErrBech32Variant,
+		},
+		{
+			name:        "mainnet witness v0 encoded as bech32m",
+			address:     "bc1qw508d6qejxtdg4y5r3zarvary0c5xw7kemeawh",
+			chainParams: chaincfg.BitcoinMainNetParams,
+			wantErr:     ErrBech32Variant,
 		},
 		{
 			name:        "testnet3 P2WPKH invalid mixed case",
@@ -34,11 +82,27 @@ func TestService_ValidateAddress(t *testing.T) {
 			chainParams: chaincfg.BitcoinTestNet3Params,
 			wantErr:     errors.New("string not all lowercase or all uppercase"),
 		},
+		{
+			// Testnet4 shares the address encoding of testnet3.
+			name:        "testnet4 P2WPKH valid",
+			address:     "tb1qkwgskuzmmwwvqajnyr7yp9hgvh5y45kg8wvdmd",
+			chainParams: chaincfg.BitcoinTestNet4Params,
+			want:        "tb1qkwgskuzmmwwvqajnyr7yp9hgvh5y45kg8wvdmd",
+			wantType:    AddressTypeP2WPKH,
+		},
+		{
+			name:        "testnet4 P2PKH valid",
+			address:     "mkpZhYtJu2r87Js3pDiWJDmPte2NRZ8bJV",
+			chainParams: chaincfg.BitcoinTestNet4Params,
+			want:        "mkpZhYtJu2r87Js3pDiWJDmPte2NRZ8bJV",
+			wantType:    AddressTypeP2PKH,
+		},
 		{
 			name:        "mainnet bech32 UPPERCASE valid",
 			address:     "BC1QH4KL0A0A3D7SU8UDC2RN62F8W939PRQPL34Z86",
 			chainParams: chaincfg.BitcoinMainNetParams,
 			want:        "bc1qh4kl0a0a3d7su8udc2rn62f8w939prqpl34z86",
+			wantType:    AddressTypeP2WPKH,
 		},
 		{
 			name:        "mainnet P2PKH UPPERCASE invalid",
@@ -46,11 +110,18 @@ func TestService_ValidateAddress(t *testing.T) {
 			chainParams: chaincfg.BitcoinMainNetParams,
 			wantErr:     errors.New("decoded address is of unknown format"),
 		},
+		{
+			name:        "LTC mainnet MWEB address",
+			address:     "ltcmweb1qqt5x3c4hw8fzyxmx6zme3qg2dlqs0jscyf4sj2hsemzp6ccqncnqgq4qjqpg3gy7gxwluwg84z7amj8f0qtf8yyzkhhz0tms0xh6qhmn5eaaz8wg",
+			chainParams: chaincfg.LitecoinMainNetParams,
+			wantErr:     ErrMwebAddress,
+		},
 		{
 			name:        "LTC mainnet P2WPKH valid",
 			address:     "ltc1q7qnj9xm8wp8ucmg64lk0h03as8k6ql6rk4wvsd",
 			chainParams: chaincfg.LitecoinMainNetParams,
 			want:        "ltc1q7qnj9xm8wp8ucmg64lk0h03as8k6ql6rk4wvsd",
+			wantType:    AddressTypeP2WPKH,
 		},
 	}
 
@@ -58,7 +129,7 @@ func TestService_ValidateAddress(t *testing.T) {
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			got, err := s.ValidateAddress(tt.address, tt.chainParams)
+			got, gotType, err := s.ValidateAddress(tt.address, tt.chainParams)
 			if err != nil && tt.wantErr == nil {
 				t.Fatalf("ValidateAddress() unexpected error: %v", err)
 			}
@@ -77,6 +148,262 @@ func TestService_ValidateAddress(t *testing.T) {
 				t.Fatalf("ValidateAddress() got error '%v', want '%v'",
 					got, tt.want)
 			}
+
+			if gotType != tt.wantType {
+				t.Fatalf("ValidateAddress() got type %s, want %s",
+					gotType, tt.wantType)
+			}
+		})
+	}
+}
+
+func TestService_ValidateAddresses(t *testing.T) {
+	addresses := []string{
+		"1MirQ9bwyQcGVJPwKUgapu5ouK2E2Ey4gX",
+		"bc1qw508d6qejxtdg4y5r3zarvary0c5xw7kv8f3t5",
+		"BC1QH4KL0A0A3D7SU8UDC2RN62F8W939PRQPL34Z86",
+		"1MIRQ9BWYQCGVJPWKUGAPU5OUK2E2EY4GX",
+		"1MirQ9bwyQcGVJPwKUgapu5ouK2E2Ey4gY",
+	}
+
+	want := []AddressValidation{
+		{
+			Address:     "1MirQ9bwyQcGVJPwKUgapu5ouK2E2Ey4gX",
+			IsValid:     true,
+			AddressType: AddressTypeP2PKH,
+		},
+		{
+			Address:       "bc1qw508d6qejxtdg4y5r3zarvary0c5xw7kv8f3t5",
+			InvalidReason: "failed to decode address bc1qw508d6qejxtdg4y5r3zarvary0c5xw7kv8f3t5: invalid checksum (expected (bech32=v8f3t4, bech32m=v8f3t4emeawh), got v8f3t5)",
+		},
+		{
+			Address:     "bc1qh4kl0a0a3d7su8udc2rn62f8w939prqpl34z86",
+			IsValid:     true,
+			AddressType: AddressTypeP2WPKH,
+		},
+		{
+			Address:       "1MIRQ9BWYQCGVJPWKUGAPU5OUK2E2EY4GX",
+			InvalidReason: "failed to decode address 1MIRQ9BWYQCGVJPWKUGAPU5OUK2E2EY4GX: decoded address is of unknown format",
+		},
+		{
+			Address:       "1MirQ9bwyQcGVJPwKUgapu5ouK2E2Ey4gY",
+			InvalidReason: "failed to decode address 1MirQ9bwyQcGVJPwKUgapu5ouK2E2Ey4gY: checksum mismatch",
+		},
+	}
+
+	s := &Service{}
+
+	got := s.ValidateAddresses(addresses, chaincfg.BitcoinMainNetParams)
+	if len(got) != len(want) {
+		t.Fatalf("ValidateAddresses() got %d results, want %d", len(got), len(want))
+	}
+
+	for idx := range want {
+		if got[idx] != want[idx] {
+			t.Fatalf("ValidateAddresses() got %+v for address %d, want %+v",
+				got[idx], idx, want[idx])
+		}
+	}
+}
+
+func TestAddressToScript(t *testing.T) {
+	tests := []struct {
+		name    string
+		address string
+		script  string
+	}{
+		{
+			name:    "P2PKH",
+			address: "1BgGZ9tcN4rm9KBzDn7KprQz87SZ26SAMH",
+			script:  "76a914751e76e8199196d454941c45d1b3a323f1433bd688ac",
+		},
+		{
+			name:    "P2SH",
+			address: "33hG2q39jRi2NqicRJB4ggY1J8EJm97Szz",
+			script:  "a91415fc0754e73eb85d1cbce08786fadb7320ecb8dc87",
+		},
+		{
+			// https://github.com/bitcoin/bips/blob/master/bip-0173.mediawiki#examples
+			name:    "P2WPKH",
+			address: "bc1qw508d6qejxtdg4y5r3zarvary0c5xw7kv8f3t4",
+			script:  "0014751e76e8199196d454941c45d1b3a323f1433bd6",
+		},
+		{
+			name:    "P2WSH",
+			address: "bc1qrp33g0q5c5txsp9arysrx4k6zdkfs4nce4xj0gdcccefvpysxf3qccfmv3",
+			script:  "00201863143c14c5166804bd19203356da136c985678cd4d27a1b8c6329604903262",
+		},
+		{
+			// https://github.com/bitcoin/bips/blob/master/bip-0086.mediawiki#test-vectors
+			name:    "P2TR",
+			address: "bc1p5cyxnuxmeuwuvkwfem96lqzszd02n6xdcjrs20cac6yqjjwudpxqkedrcr",
+			script:  "5120a60869f0dbcf1dc659c9cecbaf8050135ea9e8cdc487053f1dc6880949dc684c",
+		},
+	}
+
+	s := &Service{}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			script, err := s.AddressToScript(tt.address, chaincfg.BitcoinMainNetParams)
+			if err != nil {
+				t.Fatalf("AddressToScript() got error '%v'", err)
+			}
+
+			if hex.EncodeToString(script) != tt.script {
+				t.Fatalf("AddressToScript() got %x, want %s", script, tt.script)
+			}
+
+			address, err := s.ScriptToAddress(script, chaincfg.BitcoinMainNetParams)
+			if err != nil {
+				t.Fatalf("ScriptToAddress() got error '%v'", err)
+			}
+
+			if address != tt.address {
+				t.Fatalf("ScriptToAddress() got '%s', want '%s'", address, tt.address)
+			}
+		})
+	}
+
+	if _, err := s.AddressToScript("1BgGZ9tcN4rm9KBzDn7KprQz87SZ26SAMh", chaincfg.BitcoinMainNetParams); err == nil {
+		t.Fatalf("AddressToScript() got no error for invalid address")
+	}
+
+	// OP_RETURN outputs do not pay to any address.
+	opReturnScript, _ := hex.DecodeString("6a0568656c6c6f")
+	if _, err := s.ScriptToAddress(opReturnScript, chaincfg.BitcoinMainNetParams); err == nil {
+		t.Fatalf("ScriptToAddress() got no error for OP_RETURN script")
+	}
+}
+
+func TestEncodeScriptAddress(t *testing.T) {
+	// <500000> OP_CHECKLOCKTIMEVERIFY OP_DROP <G> OP_CHECKSIG, where G is the
+	// generator point of secp256k1.
+	redeemScript, _ := hex.DecodeString("0320a107b17521" +
+		"0279be667ef9dcbbac55a06295ce870b07029bfcdb2dce28d959f2815b16f81798ac")
+
+	tests := []struct {
+		name         string
+		redeemScript []byte
+		chainParams  chaincfg.ChainParams
+		want         string
+		wantScript   string
+		wantErr      bool
+	}{
+		{
+			name:         "mainnet",
+			redeemScript: redeemScript,
+			chainParams:  chaincfg.BitcoinMainNetParams,
+			want:         "37ErbjTPsTwAfY1wEUvYcZyQnvjvu9XSf1",
+			wantScript:   "a9143cde27f8cca7648e7e75f66b2e510cb52639b01787",
+		},
+		{
+			name:         "testnet3",
+			redeemScript: redeemScript,
+			chainParams:  chaincfg.BitcoinTestNet3Params,
+			want:         "2Mxo4fUPRUvSWsKeUucYREWxg1Gx6i1UZbu",
+			wantScript:   "a9143cde27f8cca7648e7e75f66b2e510cb52639b01787",
+		},
+		{
+			name:        "empty redeemScript",
+			chainParams: chaincfg.BitcoinMainNetParams,
+			wantErr:     true,
+		},
+		{
+			name:         "redeemScript above 520 bytes",
+			redeemScript: make([]byte, 521),
+			chainParams:  chaincfg.BitcoinMainNetParams,
+			wantErr:      true,
+		},
+	}
+
+	s := &Service{}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := s.EncodeScriptAddress(tt.redeemScript, tt.chainParams)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("EncodeScriptAddress() got error '%v', want error %v", err, tt.wantErr)
+			}
+
+			if got != tt.want {
+				t.Fatalf("EncodeScriptAddress() got '%s', want '%s'", got, tt.want)
+			}
+
+			if tt.wantErr {
+				return
+			}
+
+			// The address round-trips to a P2SH script committing to the
+			// redeemScript.
+			_, addressType, err := s.ValidateAddress(got, tt.chainParams)
+			if err != nil || addressType != AddressTypeP2SH {
+				t.Fatalf("ValidateAddress() got type %s, error '%v', want %s",
+					addressType, err, AddressTypeP2SH)
+			}
+
+			script, err := s.AddressToScript(got, tt.chainParams)
+			if err != nil {
+				t.Fatalf("AddressToScript() got error '%v'", err)
+			}
+
+			if hex.EncodeToString(script) != tt.wantScript {
+				t.Fatalf("AddressToScript() got %x, want %s", script, tt.wantScript)
+			}
+		})
+	}
+}
+
+func TestEncodeWitnessScriptAddress(t *testing.T) {
+	// <500000> OP_CHECKLOCKTIMEVERIFY OP_DROP <G> OP_CHECKSIG, where G is the
+	// generator point of secp256k1.
+	witnessScript, _ := hex.DecodeString("0320a107b17521" +
+		"0279be667ef9dcbbac55a06295ce870b07029bfcdb2dce28d959f2815b16f81798ac")
+
+	tests := []struct {
+		name          string
+		witnessScript []byte
+		chainParams   chaincfg.ChainParams
+		want          string
+		wantErr       bool
+	}{
+		{
+			name:          "mainnet",
+			witnessScript: witnessScript,
+			chainParams:   chaincfg.BitcoinMainNetParams,
+			want:          "bc1qfg7qkd4gwz4dgx57mpu23a5dsv7hzn7ykg5eznthmuajurn0hexsdun087",
+		},
+		{
+			name:          "network without segwit",
+			witnessScript: witnessScript,
+			chainParams:   chaincfg.BitcoinCashMainNetParams,
+			wantErr:       true,
+		},
+		{
+			name:        "empty witnessScript",
+			chainParams: chaincfg.BitcoinMainNetParams,
+			wantErr:     true,
+		},
+		{
+			name:          "witnessScript above 3600 bytes",
+			witnessScript: make([]byte, 3601),
+			chainParams:   chaincfg.BitcoinMainNetParams,
+			wantErr:       true,
+		},
+	}
+
+	s := &Service{}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := s.EncodeWitnessScriptAddress(tt.witnessScript, tt.chainParams)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("EncodeWitnessScriptAddress() got error '%v', want error %v", err, tt.wantErr)
+			}
+
+			if got != tt.want {
+				t.Fatalf("EncodeWitnessScriptAddress() got '%s', want '%s'", got, tt.want)
+			}
 		})
 	}
 }
@@ -88,7 +415,7 @@ func TestEncodeAddress(t *testing.T) {
 	derivePublicKey := func(extendedKey string, derivation []uint32) []byte {
 		s := &Service{}
 
-		response, err := s.DeriveExtendedKey(extendedKey, derivation)
+		response, err := s.DeriveExtendedKey(context.Background(), extendedKey, derivation)
 		if err != nil {
 			panic(err)
 		}
@@ -96,14 +423,42 @@ func TestEncodeAddress(t *testing.T) {
 		return response.PublicKey
 	}
 
+	// Public key of the private key 1, i.e. the secp256k1 generator point.
+	generatorPublicKey, _ := hex.DecodeString(
+		"0279be667ef9dcbbac55a06295ce870b07029bfcdb2dce28d959f2815b16f81798")
+
 	tests := []struct {
-		name        string
-		publicKey   []byte
-		encoding    AddressEncoding
-		chainParams chaincfg.ChainParams
-		want        string
-		wantErr     error
+		name         string
+		publicKey    []byte
+		encoding     AddressEncoding
+		uncompressed bool
+		chainParams  chaincfg.ChainParams
+		want         string
+		wantErr      error
 	}{
+		{
+			name:         "uncompressed P2PKH",
+			publicKey:    generatorPublicKey,
+			encoding:     Legacy,
+			uncompressed: true,
+			chainParams:  chaincfg.BitcoinMainNetParams,
+			want:         "1EHNa6Q4Jz2uvNExL497mE43ikXhwF6kZm",
+		},
+		{
+			name:        "compressed P2PKH",
+			publicKey:   generatorPublicKey,
+			encoding:    Legacy,
+			chainParams: chaincfg.BitcoinMainNetParams,
+			want:        "1BgGZ9tcN4rm9KBzDn7KprQz87SZ26SAMH",
+		},
+		{
+			name:         "uncompressed P2WPKH",
+			publicKey:    generatorPublicKey,
+			encoding:     NativeSegwit,
+			uncompressed: true,
+			chainParams:  chaincfg.BitcoinMainNetParams,
+			wantErr:      ErrUncompressedPublicKey,
+		},
 		{
 			// https://github.com/LedgerHQ/lib-ledger-core/blob/978a496/core/test/bitcoin/address_test.cpp#L89
 			name: "xpub P2PKH",
@@ -272,7 +627,7 @@ func TestEncodeAddress(t *testing.T) {
 			publicKey:   []byte{0x04},
 			encoding:    NativeSegwit,
 			chainParams: chaincfg.BitcoinMainNetParams,
-			wantErr:     errors.New("invalid pub key length 1"),
+			wantErr:     errors.New("malformed public key: invalid length: 1"),
 		},
 		{
 			// https://github.com/btcsuite/btcd/blob/69773a7/btcec/pubkey_test.go#L162-L174
@@ -290,7 +645,7 @@ func TestEncodeAddress(t *testing.T) {
 			},
 			encoding:    NativeSegwit,
 			chainParams: chaincfg.BitcoinMainNetParams,
-			wantErr:     errors.New("pubkey X parameter is >= to P"),
+			wantErr:     errors.New("invalid public key: x >= field prime"),
 		},
 		{
 			// https://github.com/decred/dcrd/blob/b60c60f/dcrec/secp256k1/pubkey_test.go#L105-L109
@@ -304,7 +659,7 @@ func TestEncodeAddress(t *testing.T) {
 			},
 			encoding:    NativeSegwit,
 			chainParams: chaincfg.BitcoinMainNetParams,
-			wantErr:     errors.New("invalid square root"), // FIXME: Improve error in btcd
+			wantErr:     errors.New("invalid public key: x coordinate ce0b14fb842b1ba549fdd675c98075f12e9c510f8ef52bd021a9a1f4809d3b4c is not on the secp256k1 curve"),
 		},
 		{
 			name: "ErrUnknownAddressType",
@@ -319,6 +674,28 @@ func TestEncodeAddress(t *testing.T) {
 			chainParams: chaincfg.BitcoinMainNetParams,
 			wantErr:     ErrUnknownAddressType,
 		},
+		{
+			// https://github.com/bitcoin/bips/blob/master/bip-0086.mediawiki#test-vectors
+			name: "xpub P2TR",
+			publicKey: derivePublicKey(
+				"xpub6BgBgsespWvERF3LHQu6CnqdvfEvtMcQjYrcRzx53QJjSxarj2afYWcLteoGVky7D3UKDP9QyrLprQ3VCECoY49yfdDEHGCtMMj92pReUsQ",
+				[]uint32{0, 0},
+			),
+			encoding:    Taproot,
+			chainParams: chaincfg.BitcoinMainNetParams,
+			want:        "bc1p5cyxnuxmeuwuvkwfem96lqzszd02n6xdcjrs20cac6yqjjwudpxqkedrcr",
+		},
+		{
+			// https://github.com/bitcoin/bips/blob/master/bip-0086.mediawiki#test-vectors
+			name: "xpub P2TR change",
+			publicKey: derivePublicKey(
+				"xpub6BgBgsespWvERF3LHQu6CnqdvfEvtMcQjYrcRzx53QJjSxarj2afYWcLteoGVky7D3UKDP9QyrLprQ3VCECoY49yfdDEHGCtMMj92pReUsQ",
+				[]uint32{1, 0},
+			),
+			encoding:    Taproot,
+			chainParams: chaincfg.BitcoinMainNetParams,
+			want:        "bc1p3qkhfews2uk44qtvauqyr2ttdsw7svhkl9nkm9s9c3x4ax5h60wqwruhk7",
+		},
 		// FORKS SUPPORT:
 		// LTC (Litecoin)
 		{
@@ -338,7 +715,7 @@ func TestEncodeAddress(t *testing.T) {
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			got, err := s.EncodeAddress(tt.publicKey, tt.encoding, tt.chainParams)
+			got, err := s.EncodeAddress(tt.publicKey, tt.encoding, !tt.uncompressed, tt.chainParams)
 			if err != nil && tt.wantErr == nil {
 				t.Fatalf("EncodeAddress() unexpected error: %v", err)
 			}
@@ -360,3 +737,377 @@ func TestEncodeAddress(t *testing.T) {
 		})
 	}
 }
+
+func TestEncodeAddress_InvalidPublicKey(t *testing.T) {
+	tests := []struct {
+		name      string
+		publicKey string
+		wantErr   string
+	}{
+		{
+			name:      "invalid length",
+			publicKey: "02530c548d402670b13ad8887ff99c294e67fc18097d236d57880c69261b42de",
+			wantErr:   "public key has invalid length 32, expected 33 or 65",
+		},
+		{
+			name:      "empty",
+			publicKey: "",
+			wantErr:   "public key has invalid length 0, expected 33 or 65",
+		},
+		{
+			name:      "compressed not on curve",
+			publicKey: "03ce0b14fb842b1ba549fdd675c98075f12e9c510f8ef52bd021a9a1f4809d3b4c",
+			wantErr:   "public key is not a valid point on secp256k1",
+		},
+		{
+			name: "uncompressed X > P",
+			publicKey: "04fffffffffffffffffffffffffffffffffffffffffffffffffffffffefffffd2f" +
+				"b2e0eaddfb84ccf9744464f82e160bfa9b8b64f9d4c03f999b8643f656b412a3",
+			wantErr: "public key is not a valid point on secp256k1",
+		},
+	}
+
+	s := &Service{}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			publicKey, _ := hex.DecodeString(tt.publicKey)
+
+			_, err := s.EncodeAddress(publicKey, NativeSegwit, true, chaincfg.BitcoinMainNetParams)
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Fatalf("EncodeAddress() got error '%v', want '%v'", err, tt.wantErr)
+			}
+
+			// The error of btcec remains available for debugging.
+			if errors.Cause(err) == err {
+				t.Fatalf("EncodeAddress() got error '%v' without underlying error", err)
+			}
+		})
+	}
+}
+
+func TestAddressesFromPublicKey(t *testing.T) {
+	// BIP0084: Test Vectors (first receiving address, m/84'/0'/0'/0/0)
+	bip84PublicKey, _ := hex.DecodeString("0330d54fd0dd420a6e5f8d3624f5f3482cae350f79d5f0753bf5beef9c2d91af3c")
+
+	// BIP0086: Test Vectors (first receiving address, m/86'/0'/0'/0/0)
+	s := &Service{}
+
+	bip86Key, err := s.DeriveExtendedKey(context.Background(),
+		"xpub6BgBgsespWvERF3LHQu6CnqdvfEvtMcQjYrcRzx53QJjSxarj2afYWcLteoGVky7D3UKDP9QyrLprQ3VCECoY49yfdDEHGCtMMj92pReUsQ",
+		[]uint32{0, 0})
+	if err != nil {
+		t.Fatalf("DeriveExtendedKey() got error '%v'", err)
+	}
+
+	// Public key of the private key 1, i.e. the secp256k1 generator point.
+	generatorPublicKey, _ := hex.DecodeString(
+		"0479be667ef9dcbbac55a06295ce870b07029bfcdb2dce28d959f2815b16f81798" +
+			"483ada7726a3c4655da4fbfc0e1108a8fd17b448a68554199c47d08ffb10d4b8")
+
+	tests := []struct {
+		name        string
+		publicKey   []byte
+		chainParams chaincfg.ChainParams
+		want        *AddressSet
+		wantErr     error
+	}{
+		{
+			name:        "BIP84 test vector",
+			publicKey:   bip84PublicKey,
+			chainParams: chaincfg.BitcoinMainNetParams,
+			want: &AddressSet{
+				Legacy:        "1JaUQDVNRdhfNsVncGkXedaPSM5Gc54Hso",
+				WrappedSegwit: "3GtVZYzsKF6Feikdjd4bDyPdAiyeHANY9b",
+				NativeSegwit:  "bc1qcr8te4kr609gcawutmrza0j4xv80jy8z306fyu",
+				Taproot:       "bc1p8knh0enfv47gmpuf66528zd4jtkgjq4sv5w5l2gqwgk8exu2ynns9g8c9m",
+			},
+		},
+		{
+			name:        "BIP86 test vector",
+			publicKey:   bip86Key.PublicKey,
+			chainParams: chaincfg.BitcoinMainNetParams,
+			want: &AddressSet{
+				Legacy:        "1NsJS4DAHLcegD63trZurmkLm23TRAujXd",
+				WrappedSegwit: "39oRj36VbCJdky8wsPCT5FMQNRUUekuoUr",
+				NativeSegwit:  "bc1qalwlmdxd2ggue4290ekzxl9tetg56neexr6amw",
+				Taproot:       "bc1p5cyxnuxmeuwuvkwfem96lqzszd02n6xdcjrs20cac6yqjjwudpxqkedrcr",
+			},
+		},
+		{
+			name:        "network without segwit",
+			publicKey:   bip84PublicKey,
+			chainParams: chaincfg.BitcoinCashMainNetParams,
+			want: &AddressSet{
+				Legacy: "1JaUQDVNRdhfNsVncGkXedaPSM5Gc54Hso",
+			},
+		},
+		{
+			name:        "uncompressed public key",
+			publicKey:   generatorPublicKey,
+			chainParams: chaincfg.BitcoinMainNetParams,
+			wantErr:     ErrUncompressedPublicKey,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := s.AddressesFromPublicKey(tt.publicKey, tt.chainParams)
+			if errors.Cause(err) != tt.wantErr {
+				t.Fatalf("AddressesFromPublicKey() got error '%v', want '%v'", err, tt.wantErr)
+			}
+
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Fatalf("AddressesFromPublicKey() got '%+v', want '%+v'", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDeriveAddresses(t *testing.T) {
+	// BIP0084: Test Vectors (account 0, m/84'/0'/0')
+	accountKey := "zpub6rFR7y4Q2AijBEqTUquhVz398htDFrtymD9xYYfG1m4wAcvPhXNfE3EfH1r1ADqtfSdVCToUG868RvUUkgDKf31mGDtKsAYz2oz2AGutZYs"
+
+	tests := []struct {
+		name        string
+		encoding    AddressEncoding
+		change      uint32
+		startIndex  uint32
+		count       uint32
+		chainParams chaincfg.ChainParams
+		want        []string
+		wantErr     bool
+	}{
+		{
+			name:        "receive addresses 0..5",
+			encoding:    NativeSegwit,
+			change:      0,
+			startIndex:  0,
+			count:       6,
+			chainParams: chaincfg.BitcoinMainNetParams,
+			want: []string{
+				"bc1qcr8te4kr609gcawutmrza0j4xv80jy8z306fyu",
+				"bc1qnjg0jd8228aq7egyzacy8cys3knf9xvrerkf9g",
+				"bc1qp59yckz4ae5c4efgw2s5wfyvrz0ala7rgvuz8z",
+				"bc1qgl5vlg0zdl7yvprgxj9fevsc6q6x5dmcyk3cn3",
+				"bc1qm97vqzgj934vnaq9s53ynkyf9dgr05rargr04n",
+				"bc1qnpzzqjzet8gd5gl8l6gzhuc4s9xv0djt0rlu7a",
+			},
+		},
+		{
+			name:        "change addresses 3..5",
+			encoding:    NativeSegwit,
+			change:      1,
+			startIndex:  3,
+			count:       3,
+			chainParams: chaincfg.BitcoinMainNetParams,
+			want: []string{
+				"bc1qv6vaedpeke2lxr3q0wek8dd7nzhut9w0eqkz9z",
+				"bc1qetrkzfslk0d4kqjnu29fdh04tkav9vj3k36vuh",
+				"bc1qu3936zt3c42xdz94752q07jg8656gfeh3agj6j",
+			},
+		},
+		{
+			name:        "no addresses",
+			encoding:    NativeSegwit,
+			startIndex:  10,
+			count:       0,
+			chainParams: chaincfg.BitcoinMainNetParams,
+			want:        []string{},
+		},
+		{
+			name:        "hardened address indexes",
+			encoding:    NativeSegwit,
+			startIndex:  h - 2,
+			count:       3,
+			chainParams: chaincfg.BitcoinMainNetParams,
+			wantErr:     true,
+		},
+		{
+			name:        "hardened change",
+			encoding:    NativeSegwit,
+			change:      h,
+			count:       1,
+			chainParams: chaincfg.BitcoinMainNetParams,
+			wantErr:     true,
+		},
+	}
+
+	s := &Service{}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := s.DeriveAddresses(context.Background(), accountKey, tt.encoding, tt.change,
+				tt.startIndex, tt.count, tt.chainParams)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("DeriveAddresses() error = %v, wantErr %v", err, tt.wantErr)
+			}
+
+			if tt.wantErr {
+				return
+			}
+
+			if len(got) != len(tt.want) {
+				t.Fatalf("DeriveAddresses() got %d addresses, want %d",
+					len(got), len(tt.want))
+			}
+
+			for i, info := range got {
+				if info.Index != tt.startIndex+uint32(i) {
+					t.Fatalf("DeriveAddresses() got index %d, want %d",
+						info.Index, tt.startIndex+uint32(i))
+				}
+
+				if info.Address != tt.want[i] {
+					t.Fatalf("DeriveAddresses() got address %s at index %d, want %s",
+						info.Address, info.Index, tt.want[i])
+				}
+			}
+		})
+	}
+}
+
+func TestDeriveAddresses_NetworkMismatch(t *testing.T) {
+	// BIP0084: Test Vectors (account 0, m/84'/0'/0')
+	zpub := "zpub6rFR7y4Q2AijBEqTUquhVz398htDFrtymD9xYYfG1m4wAcvPhXNfE3EfH1r1ADqtfSdVCToUG868RvUUkgDKf31mGDtKsAYz2oz2AGutZYs"
+
+	// The same key material, serialized for the Bitcoin test network.
+	key, _ := hdkeychain.NewKeyFromString(zpub)
+	testnetKey, _ := key.CloneWithVersion(chaincfg.BitcoinTestNet3Params.HDPublicKeyID[:])
+	tpub := testnetKey.String()
+
+	tests := []struct {
+		name        string
+		accountKey  string
+		chainParams chaincfg.ChainParams
+		want        string
+		wantErr     error
+	}{
+		{
+			name:        "tpub on testnet",
+			accountKey:  tpub,
+			chainParams: chaincfg.BitcoinTestNet3Params,
+			want:        "tb1qcr8te4kr609gcawutmrza0j4xv80jy8zmfp6l0",
+		},
+		{
+			name:        "tpub on mainnet",
+			accountKey:  tpub,
+			chainParams: chaincfg.BitcoinMainNetParams,
+			wantErr:     ErrNetworkMismatch,
+		},
+		{
+			name:        "zpub on testnet",
+			accountKey:  zpub,
+			chainParams: chaincfg.BitcoinTestNet3Params,
+			wantErr:     ErrNetworkMismatch,
+		},
+		{
+			name:        "zpub on litecoin",
+			accountKey:  zpub,
+			chainParams: chaincfg.LitecoinMainNetParams,
+			want:        "ltc1qcr8te4kr609gcawutmrza0j4xv80jy8z4nqduv",
+		},
+		{
+			// https://github.com/LedgerHQ/lib-ledger-core/blob/978a496/core/test/bitcoin/address_test.cpp#L130
+			name:        "Ltub on litecoin",
+			accountKey:  "Ltub2YC8XgcRjMJqvX8LsuBxdM7PKE5uih6247CpgK2rfEdzEGt1YHVHW4L865ss5eEy2K1KixTMkrHJbzTtqxpiGpM4wyrxYRFJFxuACSJqkyo",
+			chainParams: chaincfg.LitecoinMainNetParams,
+			want:        "ltc1q7qnj9xm8wp8ucmg64lk0h03as8k6ql6rk4wvsd",
+		},
+	}
+
+	s := &Service{}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := s.DeriveAddresses(context.Background(), tt.accountKey,
+				NativeSegwit, 0, 0, 1, tt.chainParams)
+			if errors.Cause(err) != tt.wantErr {
+				t.Fatalf("DeriveAddresses() got error '%v', want '%v'", err, tt.wantErr)
+			}
+
+			if tt.wantErr != nil {
+				return
+			}
+
+			if len(got) != 1 || got[0].Address != tt.want {
+				t.Fatalf("DeriveAddresses() got %v, want address %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDeriveChangeAddresses(t *testing.T) {
+	// BIP0084: Test Vectors (account 0, m/84'/0'/0')
+	accountKey := "zpub6rFR7y4Q2AijBEqTUquhVz398htDFrtymD9xYYfG1m4wAcvPhXNfE3EfH1r1ADqtfSdVCToUG868RvUUkgDKf31mGDtKsAYz2oz2AGutZYs"
+
+	s := &Service{}
+
+	got, err := s.DeriveChangeAddresses(context.Background(), accountKey, NativeSegwit, 0, 4,
+		chaincfg.BitcoinMainNetParams)
+	if err != nil {
+		t.Fatalf("DeriveChangeAddresses() got error '%v'", err)
+	}
+
+	want := map[uint32]string{
+		0: "bc1q8c6fshw2dlwun7ekn9qwf37cu2rn755upcp6el",
+		3: "bc1qv6vaedpeke2lxr3q0wek8dd7nzhut9w0eqkz9z",
+	}
+
+	if len(got) != 4 {
+		t.Fatalf("DeriveChangeAddresses() got %d addresses, want 4", len(got))
+	}
+
+	for idx, address := range got {
+		if address.Index != uint32(idx) {
+			t.Fatalf("DeriveChangeAddresses() got index %d, want %d",
+				address.Index, idx)
+		}
+
+		if wantAddress, ok := want[address.Index]; ok && address.Address != wantAddress {
+			t.Fatalf("DeriveChangeAddresses() got address '%s' at index %d, want '%s'",
+				address.Address, address.Index, wantAddress)
+		}
+	}
+}
+
+func TestDeriveAddresses_Cancelled(t *testing.T) {
+	accountKey := "xpub6DVHQNhjvVchuKeMGnKbbNSdczQ4yMqEW1H1qhQzk1oPxkSqyHZR9Pn7zZ494sVhZqK2WD8kxo9rqiJFL41P67JCdNYka2W5LnANDVWSjzm"
+
+	s := &Service{}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	// Deriving the 1000000 requested addresses takes minutes, so the call
+	// must return immediately, if it stops on cancellation.
+	start := time.Now()
+
+	_, err := s.DeriveAddresses(ctx, accountKey, NativeSegwit, 0, 0, 1000000,
+		chaincfg.BitcoinMainNetParams)
+	if errors.Cause(err) != context.Canceled {
+		t.Fatalf("DeriveAddresses() got error '%v', want '%v'", err, context.Canceled)
+	}
+
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Fatalf("DeriveAddresses() returned after %v, want immediately", elapsed)
+	}
+
+	_, err = s.DeriveExtendedKey(ctx, accountKey, []uint32{0, 1})
+	if errors.Cause(err) != context.Canceled {
+		t.Fatalf("DeriveExtendedKey() got error '%v', want '%v'", err, context.Canceled)
+	}
+}
+
+func BenchmarkDeriveAddresses(b *testing.B) {
+	accountKey := "xpub6DVHQNhjvVchuKeMGnKbbNSdczQ4yMqEW1H1qhQzk1oPxkSqyHZR9Pn7zZ494sVhZqK2WD8kxo9rqiJFL41P67JCdNYka2W5LnANDVWSjzm"
+
+	s := &Service{}
+
+	for i := 0; i < b.N; i++ {
+		if _, err := s.DeriveAddresses(context.Background(), accountKey, NativeSegwit, 0, 0, 100,
+			chaincfg.BitcoinMainNetParams); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
@@ -0,0 +1,117 @@
+package core
+
+import (
+	"crypto/hmac"
+	"crypto/sha512"
+
+	"github.com/btcsuite/btcd/btcutil/hdkeychain"
+	"github.com/pkg/errors"
+	"github.com/tyler-smith/go-bip39"
+)
+
+// References:
+//   [BIP85]: BIP0085 - Deterministic Entropy From BIP32 Keychains
+//   https://github.com/bitcoin/bips/blob/master/bip-0085.mediawiki
+
+const (
+	// bip85Purpose is the purpose of BIP0085 derivation paths, the ASCII
+	// encoding of "DEPTH" on a phone keypad.
+	bip85Purpose = 83696968
+
+	// bip85ApplicationBip39 is the BIP0085 application number of BIP0039
+	// mnemonics.
+	bip85ApplicationBip39 = 39
+
+	// bip85LanguageEnglish is the BIP0085 language code of the English
+	// BIP0039 wordlist.
+	bip85LanguageEnglish = 0
+)
+
+// bip85HMACKey is the HMAC-SHA512 key used to extract entropy from a
+// derived private key.
+var bip85HMACKey = []byte("bip-entropy-from-k")
+
+// Bip85DeriveMnemonic returns the BIP0039 child mnemonic of a BIP0032 root
+// extended private key, as specified by BIP0085, for the given language,
+// number of words, and index.
+//
+// The root key is derived at m/83696968'/39'/language'/words'/index'. The
+// entropy of the mnemonic is the first bytes of the HMAC-SHA512 of the
+// private key of the derived key, keyed with "bip-entropy-from-k".
+//
+// Only the English wordlist (language 0) is supported. words must be 12, 15,
+// 18, 21 or 24, and index must not be hardened. ErrInvalidBip85Parameters is
+// returned otherwise, or if the key is not a root key, i.e. of depth 0.
+// Extended public keys are rejected with ErrNotPrivateExtendedKey.
+func (s *Service) Bip85DeriveMnemonic(
+	masterXprv string, language uint32, words uint32, index uint32,
+) (string, error) {
+	if language != bip85LanguageEnglish {
+		return "", errors.Wrapf(ErrInvalidBip85Parameters,
+			"unsupported language %d, only English (0) is supported", language)
+	}
+
+	switch words {
+	case 12, 15, 18, 21, 24:
+	default:
+		return "", errors.Wrapf(ErrInvalidBip85Parameters,
+			"got %d words, expected 12, 15, 18, 21 or 24", words)
+	}
+
+	if index >= hdkeychain.HardenedKeyStart {
+		return "", errors.Wrapf(ErrInvalidBip85Parameters,
+			"index %d must not be hardened", index)
+	}
+
+	xKey, err := hdkeychain.NewKeyFromString(masterXprv)
+	if err != nil {
+		return "", errors.Wrap(err, "failed to decode xkey")
+	}
+
+	if !xKey.IsPrivate() {
+		return "", errors.Wrap(ErrNotPrivateExtendedKey,
+			"cannot derive BIP85 entropy from an extended public key")
+	}
+
+	if depth := xKey.Depth(); depth != 0 {
+		return "", errors.Wrapf(ErrInvalidBip85Parameters,
+			"got extended key of depth %d, expected a root key", depth)
+	}
+
+	derivation := []uint32{
+		bip85Purpose + hdkeychain.HardenedKeyStart,
+		bip85ApplicationBip39 + hdkeychain.HardenedKeyStart,
+		language + hdkeychain.HardenedKeyStart,
+		words + hdkeychain.HardenedKeyStart,
+		index + hdkeychain.HardenedKeyStart,
+	}
+
+	for _, childIndex := range derivation {
+		xKey, err = xKey.Derive(childIndex)
+		if err != nil {
+			return "", errors.Wrapf(err, "failed to derive xkey at index %d",
+				childIndex)
+		}
+	}
+
+	privKey, err := xKey.ECPrivKey()
+	if err != nil {
+		return "", errors.Wrap(err, "failed to get private key from xkey")
+	}
+
+	k := privKey.Serialize()
+	defer zeroBytes(k)
+
+	mac := hmac.New(sha512.New, bip85HMACKey)
+	mac.Write(k)
+	entropy := mac.Sum(nil)
+	defer zeroBytes(entropy)
+
+	// Each word encodes 11 bits, of which 32 bits out of 33 are entropy.
+	mnemonic, err := bip39.NewMnemonic(entropy[:words*4/3])
+	if err != nil {
+		return "", errors.Wrap(err, "failed to encode mnemonic")
+	}
+
+	return mnemonic, nil
+}
@@ -0,0 +1,105 @@
+package core
+
+import (
+	"testing"
+
+	"github.com/pkg/errors"
+)
+
+func TestBip85DeriveMnemonic(t *testing.T) {
+	// BIP0085: root key of the test vectors
+	masterXprv := "xprv9s21ZrQH143K2LBWUUQRFXhucrQqBpKdRRxNVq2zBqsx8HVqFk2uYo8kmbaLLHRdqtQpUm98uKfu3vca1LqdGhUtyoFnCNkfmXRyPXLjbKb"
+
+	tests := []struct {
+		name       string
+		masterXprv string
+		language   uint32
+		words      uint32
+		index      uint32
+		want       string
+		wantErr    error
+	}{
+		{
+			// BIP0085: BIP39 test vector (12 English words)
+			name:       "12 words",
+			masterXprv: masterXprv,
+			language:   0,
+			words:      12,
+			index:      0,
+			want:       "girl mad pet galaxy egg matter matrix prison refuse sense ordinary nose",
+		},
+		{
+			// BIP0085: BIP39 test vector (18 English words)
+			name:       "18 words",
+			masterXprv: masterXprv,
+			language:   0,
+			words:      18,
+			index:      0,
+			want:       "near account window bike charge season chef number sketch tomorrow excuse sniff circle vital hockey outdoor supply token",
+		},
+		{
+			// BIP0085: BIP39 test vector (24 English words)
+			name:       "24 words",
+			masterXprv: masterXprv,
+			language:   0,
+			words:      24,
+			index:      0,
+			want:       "puppy ocean match cereal symbol another shed magic wrap hammer bulb intact gadget divorce twin tonight reason outdoor destroy simple truth cigar social volcano",
+		},
+		{
+			name:       "unsupported language",
+			masterXprv: masterXprv,
+			language:   1,
+			words:      12,
+			wantErr:    ErrInvalidBip85Parameters,
+		},
+		{
+			name:       "invalid number of words",
+			masterXprv: masterXprv,
+			language:   0,
+			words:      13,
+			wantErr:    ErrInvalidBip85Parameters,
+		},
+		{
+			name:       "hardened index",
+			masterXprv: masterXprv,
+			language:   0,
+			words:      12,
+			index:      0x80000000,
+			wantErr:    ErrInvalidBip85Parameters,
+		},
+		{
+			// BIP0032: Test Vector 1 (chain m)
+			name:       "extended public key",
+			masterXprv: "xpub661MyMwAqRbcFtXgS5sYJABqqG9YLmC4Q1Rdap9gSE8NqtwybGhePY2gZ29ESFjqJoCu1Rupje8YtGqsefD265TMg7usUDFdp6W1EGMcet8",
+			language:   0,
+			words:      12,
+			wantErr:    ErrNotPrivateExtendedKey,
+		},
+		{
+			// BIP0032: Test Vector 1 (chain m/0H)
+			name:       "extended private key of depth 1",
+			masterXprv: "xprv9uHRZZhk6KAJC1avXpDAp4MDc3sQKNxDiPvvkX8Br5ngLNv1TxvUxt4cV1rGL5hj6KCesnDYUhd7oWgT11eZG7XnxHrnYeSvkzY7d2bhkJ7",
+			language:   0,
+			words:      12,
+			wantErr:    ErrInvalidBip85Parameters,
+		},
+	}
+
+	s := &Service{}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := s.Bip85DeriveMnemonic(
+				tt.masterXprv, tt.language, tt.words, tt.index)
+			if errors.Cause(err) != tt.wantErr {
+				t.Fatalf("Bip85DeriveMnemonic() got error '%v', want '%v'",
+					err, tt.wantErr)
+			}
+
+			if got != tt.want {
+				t.Fatalf("Bip85DeriveMnemonic() got '%s', want '%s'", got, tt.want)
+			}
+		})
+	}
+}
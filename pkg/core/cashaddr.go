@@ -0,0 +1,338 @@
+package core
+
+import (
+	"encoding/hex"
+	"strings"
+
+	"github.com/btcsuite/btcd/btcutil"
+	"github.com/btcsuite/btcd/btcutil/bech32"
+	"github.com/btcsuite/btcd/txscript"
+	"github.com/btcsuite/btcd/wire"
+	"github.com/ledgerhq/bitcoin-lib-grpc/pkg/chaincfg"
+	"github.com/pkg/errors"
+)
+
+// CashAddrType is an enum type for the address types supported by the
+// CashAddr encoding of Bitcoin Cash.
+type CashAddrType byte
+
+const (
+	// CashAddrP2PKH indicates the Pay-to-PubKey-Hash CashAddr type.
+	CashAddrP2PKH CashAddrType = 0
+
+	// CashAddrP2SH indicates the Pay-to-Script-Hash CashAddr type.
+	CashAddrP2SH CashAddrType = 1
+)
+
+// cashAddrPrefixes maps the magic number of a network to its CashAddr
+// prefix.
+var cashAddrPrefixes = map[wire.BitcoinNet]string{
+	chaincfg.BitcoinCashMainNetParams.Net:  "bitcoincash",
+	chaincfg.BitcoinCashTestNet3Params.Net: "bchtest",
+}
+
+// cashAddrCharset is the base32 alphabet of CashAddr, which is the same as
+// the one of Bech32.
+const cashAddrCharset = "qpzry9x8gf2tvdw0s3jn54khce6mua7l"
+
+// cashAddrHashSize160 is the size bits of the version byte, for a 160-bit
+// hash.
+const cashAddrHashSize160 = 0
+
+// References:
+//   [CashAddr]: Address format for Bitcoin Cash
+//   https://github.com/bitcoincashorg/bitcoincash.org/blob/master/spec/cashaddr.md
+
+// EncodeCashAddr serializes a public key into a CashAddr address, prefixed
+// with the network, based on the address type and the chain parameters.
+//
+// For CashAddrP2PKH, the address pays to the HASH160 of the compressed
+// public key. For CashAddrP2SH, the address pays to the HASH160 of the
+// following redeemScript:
+//   <compressed public key> OP_CHECKSIG
+func (s *Service) EncodeCashAddr(
+	publicKey []byte, addrType CashAddrType, chainParams chaincfg.ChainParams,
+) (string, error) {
+	prefix, ok := cashAddrPrefixes[chainParams.Net]
+	if !ok {
+		return "", errors.Wrapf(ErrUnknownAddressType,
+			"no CashAddr prefix for network %s", chainParams.Name)
+	}
+
+	// Load the serialized public key to a btcec.PublicKey type, in order to
+	// ensure that it is valid. Both compressed and uncompressed public keys
+	// are accepted.
+	loadedPublicKey, err := parsePublicKey(publicKey)
+	if err != nil {
+		return "", errors.Wrapf(err, "failed to parse public key %s",
+			hex.EncodeToString(publicKey))
+	}
+
+	serializedPublicKey := loadedPublicKey.SerializeCompressed()
+
+	var hash []byte
+
+	switch addrType {
+	case CashAddrP2PKH:
+		hash = btcutil.Hash160(serializedPublicKey)
+	case CashAddrP2SH:
+		redeemScript, err := txscript.NewScriptBuilder().
+			AddData(serializedPublicKey).
+			AddOp(txscript.OP_CHECKSIG).
+			Script()
+		if err != nil {
+			return "", errors.Wrap(err, "failed to build redeem script")
+		}
+
+		hash = btcutil.Hash160(redeemScript)
+	default:
+		return "", errors.Wrapf(ErrUnknownAddressType,
+			"invalid CashAddr type %d", addrType)
+	}
+
+	return encodeCashAddr(prefix, addrType, hash)
+}
+
+// LegacyToCashAddr converts a legacy Bitcoin Cash address, encoded in
+// base58, into the CashAddr address with the same type and hash, including
+// the network prefix.
+//
+// Only P2PKH and P2SH addresses are accepted.
+func (s *Service) LegacyToCashAddr(
+	address string, chainParams chaincfg.ChainParams,
+) (string, error) {
+	prefix, ok := cashAddrPrefixes[chainParams.Net]
+	if !ok {
+		return "", errors.Wrapf(ErrUnknownAddressType,
+			"no CashAddr prefix for network %s", chainParams.Name)
+	}
+
+	addr, err := btcutil.DecodeAddress(address, chainParams)
+	if err != nil {
+		return "", errors.Wrapf(err, "failed to decode address %s", address)
+	}
+
+	if !addr.IsForNet(chainParams) {
+		return "", errors.Wrapf(ErrNetworkMismatch,
+			"address %s is not for network %s", address, chainParams.Name)
+	}
+
+	switch addr := addr.(type) {
+	case *btcutil.AddressPubKeyHash:
+		return encodeCashAddr(prefix, CashAddrP2PKH, addr.ScriptAddress())
+	case *btcutil.AddressScriptHash:
+		return encodeCashAddr(prefix, CashAddrP2SH, addr.ScriptAddress())
+	default:
+		return "", errors.Wrapf(ErrUnknownAddressType,
+			"address %s is neither P2PKH nor P2SH", address)
+	}
+}
+
+// CashAddrToLegacy converts a CashAddr address, with or without the network
+// prefix, into the legacy Bitcoin Cash address with the same type and hash,
+// encoded in base58.
+func (s *Service) CashAddrToLegacy(
+	address string, chainParams chaincfg.ChainParams,
+) (string, error) {
+	prefix, ok := cashAddrPrefixes[chainParams.Net]
+	if !ok {
+		return "", errors.Wrapf(ErrUnknownAddressType,
+			"no CashAddr prefix for network %s", chainParams.Name)
+	}
+
+	addrType, hash, err := decodeCashAddr(address, prefix)
+	if err != nil {
+		return "", errors.Wrapf(err, "failed to decode address %s", address)
+	}
+
+	var addr btcutil.Address
+
+	switch addrType {
+	case CashAddrP2PKH:
+		addr, err = btcutil.NewAddressPubKeyHash(hash, chainParams)
+	case CashAddrP2SH:
+		addr, err = btcutil.NewAddressScriptHashFromHash(hash, chainParams)
+	default:
+		return "", errors.Wrapf(ErrUnknownAddressType,
+			"invalid CashAddr type %d", addrType)
+	}
+
+	if err != nil {
+		return "", errors.Wrapf(err, "failed to encode legacy address")
+	}
+
+	return addr.EncodeAddress(), nil
+}
+
+// ConvertBchAddress converts a Bitcoin Cash address, either legacy or
+// CashAddr, into the CashAddr address with the network prefix if toCashAddr
+// is set, or into the legacy address otherwise.
+//
+// The address is validated in both cases, and an address already in the
+// requested representation is returned normalized, e.g. a CashAddr address
+// gets its network prefix.
+func (s *Service) ConvertBchAddress(
+	address string, toCashAddr bool, chainParams chaincfg.ChainParams,
+) (string, error) {
+	prefix, ok := cashAddrPrefixes[chainParams.Net]
+	if !ok {
+		return "", errors.Wrapf(ErrUnknownAddressType,
+			"no CashAddr prefix for network %s", chainParams.Name)
+	}
+
+	// Addresses with a prefix can only be CashAddr addresses, and the ones
+	// without prefix are CashAddr addresses if they decode as such.
+	_, _, cashAddrErr := decodeCashAddr(address, prefix)
+	isCashAddr := strings.Contains(address, ":") || cashAddrErr == nil
+
+	switch {
+	case isCashAddr && toCashAddr:
+		legacy, err := s.CashAddrToLegacy(address, chainParams)
+		if err != nil {
+			return "", err
+		}
+
+		return s.LegacyToCashAddr(legacy, chainParams)
+	case isCashAddr:
+		return s.CashAddrToLegacy(address, chainParams)
+	case toCashAddr:
+		return s.LegacyToCashAddr(address, chainParams)
+	default:
+		cashAddr, err := s.LegacyToCashAddr(address, chainParams)
+		if err != nil {
+			return "", err
+		}
+
+		return s.CashAddrToLegacy(cashAddr, chainParams)
+	}
+}
+
+// encodeCashAddr encodes a 160-bit hash into a CashAddr address, including
+// the prefix.
+func encodeCashAddr(prefix string, addrType CashAddrType, hash []byte) (string, error) {
+	if len(hash) != 20 {
+		return "", errors.Errorf("invalid hash length %d, expected 20",
+			len(hash))
+	}
+
+	versionByte := byte(addrType)<<3 | cashAddrHashSize160
+
+	payload, err := bech32.ConvertBits(
+		append([]byte{versionByte}, hash...), 8, 5, true)
+	if err != nil {
+		return "", errors.Wrap(err, "failed to convert payload to base32")
+	}
+
+	checksum := cashAddrChecksum(prefix, payload)
+
+	encoded := make([]byte, 0, len(prefix)+1+len(payload)+len(checksum))
+	encoded = append(encoded, prefix...)
+	encoded = append(encoded, ':')
+	for _, b := range append(payload, checksum...) {
+		encoded = append(encoded, cashAddrCharset[b])
+	}
+
+	return string(encoded), nil
+}
+
+// decodeCashAddr decodes a CashAddr address into its type and 160-bit hash.
+//
+// The prefix of the address is optional, but must match the expected prefix
+// when present. Mixed case addresses are rejected.
+func decodeCashAddr(address string, expectedPrefix string) (CashAddrType, []byte, error) {
+	if strings.ToLower(address) != address && strings.ToUpper(address) != address {
+		return 0, nil, errors.Wrap(ErrInvalidCashAddr,
+			"string not all lowercase or all uppercase")
+	}
+
+	address = strings.ToLower(address)
+
+	prefix, encoded := expectedPrefix, address
+	if idx := strings.LastIndexByte(address, ':'); idx >= 0 {
+		prefix, encoded = address[:idx], address[idx+1:]
+	}
+
+	if prefix != expectedPrefix {
+		return 0, nil, errors.Wrapf(ErrNetworkMismatch,
+			"invalid prefix %s, expected %s", prefix, expectedPrefix)
+	}
+
+	values := make([]byte, len(encoded))
+	for i := 0; i < len(encoded); i++ {
+		idx := strings.IndexByte(cashAddrCharset, encoded[i])
+		if idx < 0 {
+			return 0, nil, errors.Wrapf(ErrInvalidCashAddr,
+				"invalid character %q", encoded[i])
+		}
+		values[i] = byte(idx)
+	}
+
+	if len(values) <= 8 {
+		return 0, nil, errors.Wrap(ErrInvalidCashAddr, "address too short")
+	}
+
+	if cashAddrPolyMod(append(cashAddrPrefixValues(prefix), values...)) != 0 {
+		return 0, nil, errors.Wrap(ErrInvalidCashAddr, "checksum failed")
+	}
+
+	payload, err := bech32.ConvertBits(values[:len(values)-8], 5, 8, false)
+	if err != nil {
+		return 0, nil, errors.Wrap(ErrInvalidCashAddr, err.Error())
+	}
+
+	if len(payload) != 21 || payload[0]&0x87 != cashAddrHashSize160 {
+		return 0, nil, errors.Wrap(ErrInvalidCashAddr,
+			"only 160-bit hashes are supported")
+	}
+
+	return CashAddrType(payload[0] >> 3), payload[1:], nil
+}
+
+// cashAddrChecksum computes the 40-bit checksum of a base32 payload, as
+// eight 5-bit groups.
+func cashAddrChecksum(prefix string, payload []byte) []byte {
+	values := cashAddrPrefixValues(prefix)
+	values = append(values, payload...)
+	values = append(values, make([]byte, 8)...)
+
+	mod := cashAddrPolyMod(values)
+
+	checksum := make([]byte, 8)
+	for i := range checksum {
+		checksum[i] = byte((mod >> (5 * uint(7-i))) & 0x1f)
+	}
+
+	return checksum
+}
+
+// cashAddrPrefixValues expands the prefix into the lower 5 bits of each of
+// its characters, followed by a zero separator.
+func cashAddrPrefixValues(prefix string) []byte {
+	values := make([]byte, 0, len(prefix)+1)
+	for i := 0; i < len(prefix); i++ {
+		values = append(values, prefix[i]&0x1f)
+	}
+
+	return append(values, 0)
+}
+
+// cashAddrPolyMod computes the BCH code used as CashAddr checksum.
+func cashAddrPolyMod(values []byte) uint64 {
+	generators := [5]uint64{
+		0x98f2bc8e61, 0x79b76d99e2, 0xf33e5fb3c4, 0xae2eabe2a8, 0x1e4f43e470,
+	}
+
+	c := uint64(1)
+	for _, d := range values {
+		c0 := byte(c >> 35)
+		c = ((c & 0x07ffffffff) << 5) ^ uint64(d)
+
+		for i, generator := range generators {
+			if (c0>>uint(i))&1 == 1 {
+				c ^= generator
+			}
+		}
+	}
+
+	return c ^ 1
+}
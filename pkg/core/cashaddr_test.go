@@ -0,0 +1,393 @@
+package core
+
+import (
+	"encoding/hex"
+	"testing"
+
+	"github.com/ledgerhq/bitcoin-lib-grpc/pkg/chaincfg"
+	"github.com/pkg/errors"
+)
+
+func TestEncodeCashAddr(t *testing.T) {
+	tests := []struct {
+		name        string
+		publicKey   []byte
+		addrType    CashAddrType
+		chainParams chaincfg.ChainParams
+		want        string
+		wantErr     error
+	}{
+		{
+			name:        "mainnet P2PKH",
+			publicKey:   wifCompressedPublicKey,
+			addrType:    CashAddrP2PKH,
+			chainParams: chaincfg.BitcoinCashMainNetParams,
+			want:        "bitcoincash:qp63uahgrxged4z5jswyt5dn5v3lzsem6cy4spdc2h",
+		},
+		{
+			name:        "mainnet P2PKH from uncompressed public key",
+			publicKey:   wifUncompressedPublicKey,
+			addrType:    CashAddrP2PKH,
+			chainParams: chaincfg.BitcoinCashMainNetParams,
+			want:        "bitcoincash:qp63uahgrxged4z5jswyt5dn5v3lzsem6cy4spdc2h",
+		},
+		{
+			name:        "mainnet P2SH",
+			publicKey:   wifCompressedPublicKey,
+			addrType:    CashAddrP2SH,
+			chainParams: chaincfg.BitcoinCashMainNetParams,
+			want:        "bitcoincash:pq3mptf5wlep0z7qk0hdymjwvvt0f6p65y50jpsj2u",
+		},
+		{
+			name:        "testnet3 P2PKH",
+			publicKey:   wifCompressedPublicKey,
+			addrType:    CashAddrP2PKH,
+			chainParams: chaincfg.BitcoinCashTestNet3Params,
+			want:        "bchtest:qp63uahgrxged4z5jswyt5dn5v3lzsem6cq85x00dt",
+		},
+		{
+			name:        "testnet3 P2SH",
+			publicKey:   wifCompressedPublicKey,
+			addrType:    CashAddrP2SH,
+			chainParams: chaincfg.BitcoinCashTestNet3Params,
+			want:        "bchtest:pq3mptf5wlep0z7qk0hdymjwvvt0f6p65ysakxj9dq",
+		},
+		{
+			name:        "bitcoin network",
+			publicKey:   wifCompressedPublicKey,
+			addrType:    CashAddrP2PKH,
+			chainParams: chaincfg.BitcoinMainNetParams,
+			wantErr:     ErrUnknownAddressType,
+		},
+		{
+			name:        "invalid address type",
+			publicKey:   wifCompressedPublicKey,
+			addrType:    CashAddrType(2),
+			chainParams: chaincfg.BitcoinCashMainNetParams,
+			wantErr:     ErrUnknownAddressType,
+		},
+	}
+
+	s := &Service{}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := s.EncodeCashAddr(tt.publicKey, tt.addrType, tt.chainParams)
+			if err != nil && errors.Cause(err) != tt.wantErr {
+				t.Fatalf("EncodeCashAddr() unexpected error = %v", err)
+			}
+
+			if err == nil && tt.wantErr != nil {
+				t.Fatalf("EncodeCashAddr() got no error, want %v", tt.wantErr)
+			}
+
+			if got != tt.want {
+				t.Fatalf("EncodeCashAddr() got = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+// CashAddr: Examples of address translation
+// https://github.com/bitcoincashorg/bitcoincash.org/blob/master/spec/cashaddr.md#examples-of-address-translation
+var cashAddrVectors = []struct {
+	legacy   string
+	hash     string
+	addrType CashAddrType
+	want     string
+}{
+	{
+		legacy:   "1BpEi6DfDAUFd7GtittLSdBeYJvcoaVggu",
+		hash:     "76a04053bda0a88bda5177b86a15c3b29f559873",
+		addrType: CashAddrP2PKH,
+		want:     "bitcoincash:qpm2qsznhks23z7629mms6s4cwef74vcwvy22gdx6a",
+	},
+	{
+		legacy:   "1KXrWXciRDZUpQwQmuM1DbwsKDLYAYsVLR",
+		hash:     "cb481232299cd5743151ac4b2d63ae198e7bb0a9",
+		addrType: CashAddrP2PKH,
+		want:     "bitcoincash:qr95sy3j9xwd2ap32xkykttr4cvcu7as4y0qverfuy",
+	},
+	{
+		legacy:   "16w1D5WRVKJuZUsSRzdLp9w3YGcgoxDXb",
+		hash:     "011f28e473c95f4013d7d53ec5fbc3b42df8ed10",
+		addrType: CashAddrP2PKH,
+		want:     "bitcoincash:qqq3728yw0y47sqn6l2na30mcw6zm78dzqre909m2r",
+	},
+	{
+		legacy:   "3CWFddi6m4ndiGyKqzYvsFYagqDLPVMTzC",
+		hash:     "76a04053bda0a88bda5177b86a15c3b29f559873",
+		addrType: CashAddrP2SH,
+		want:     "bitcoincash:ppm2qsznhks23z7629mms6s4cwef74vcwvn0h829pq",
+	},
+	{
+		legacy:   "3LDsS579y7sruadqu11beEJoTjdFiFCdX4",
+		hash:     "cb481232299cd5743151ac4b2d63ae198e7bb0a9",
+		addrType: CashAddrP2SH,
+		want:     "bitcoincash:pr95sy3j9xwd2ap32xkykttr4cvcu7as4yc93ky28e",
+	},
+	{
+		legacy:   "31nwvkZwyPdgzjBJZXfDmSWsC4ZLKpYyUw",
+		hash:     "011f28e473c95f4013d7d53ec5fbc3b42df8ed10",
+		addrType: CashAddrP2SH,
+		want:     "bitcoincash:pqq3728yw0y47sqn6l2na30mcw6zm78dzq5ucqzc37",
+	},
+}
+
+func TestEncodeCashAddrVectors(t *testing.T) {
+	for _, tt := range cashAddrVectors {
+		t.Run(tt.legacy, func(t *testing.T) {
+			hash, err := hex.DecodeString(tt.hash)
+			if err != nil {
+				t.Fatalf("invalid hash %s: %v", tt.hash, err)
+			}
+
+			got, err := encodeCashAddr("bitcoincash", tt.addrType, hash)
+			if err != nil {
+				t.Fatalf("encodeCashAddr() unexpected error = %v", err)
+			}
+
+			if got != tt.want {
+				t.Fatalf("encodeCashAddr() got = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestLegacyToCashAddr(t *testing.T) {
+	s := &Service{}
+
+	for _, tt := range cashAddrVectors {
+		t.Run(tt.legacy, func(t *testing.T) {
+			got, err := s.LegacyToCashAddr(tt.legacy, chaincfg.BitcoinCashMainNetParams)
+			if err != nil {
+				t.Fatalf("LegacyToCashAddr() unexpected error = %v", err)
+			}
+
+			if got != tt.want {
+				t.Fatalf("LegacyToCashAddr() got = %v, want %v", got, tt.want)
+			}
+
+			legacy, err := s.CashAddrToLegacy(got, chaincfg.BitcoinCashMainNetParams)
+			if err != nil {
+				t.Fatalf("CashAddrToLegacy() unexpected error = %v", err)
+			}
+
+			if legacy != tt.legacy {
+				t.Fatalf("CashAddrToLegacy() got = %v, want %v", legacy, tt.legacy)
+			}
+		})
+	}
+
+	errorTests := []struct {
+		name        string
+		address     string
+		chainParams chaincfg.ChainParams
+		wantErr     error
+	}{
+		{
+			name:        "CashAddr address",
+			address:     "bitcoincash:qpm2qsznhks23z7629mms6s4cwef74vcwvy22gdx6a",
+			chainParams: chaincfg.BitcoinCashMainNetParams,
+			wantErr:     errors.New("decoded address is of unknown format"),
+		},
+		{
+			name:        "P2PK address",
+			address:     "0279be667ef9dcbbac55a06295ce870b07029bfcdb2dce28d959f2815b16f81798",
+			chainParams: chaincfg.BitcoinCashMainNetParams,
+			wantErr:     ErrUnknownAddressType,
+		},
+		{
+			name:        "bitcoin network",
+			address:     "1BpEi6DfDAUFd7GtittLSdBeYJvcoaVggu",
+			chainParams: chaincfg.BitcoinMainNetParams,
+			wantErr:     ErrUnknownAddressType,
+		},
+	}
+
+	for _, tt := range errorTests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := s.LegacyToCashAddr(tt.address, tt.chainParams)
+			if err == nil {
+				t.Fatalf("LegacyToCashAddr() got no error, want %v", tt.wantErr)
+			}
+
+			if errors.Cause(err).Error() != tt.wantErr.Error() {
+				t.Fatalf("LegacyToCashAddr() got error '%v', want '%v'",
+					err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestCashAddrToLegacy(t *testing.T) {
+	tests := []struct {
+		name        string
+		address     string
+		chainParams chaincfg.ChainParams
+		want        string
+		wantErr     error
+	}{
+		{
+			name:        "without prefix",
+			address:     "qpm2qsznhks23z7629mms6s4cwef74vcwvy22gdx6a",
+			chainParams: chaincfg.BitcoinCashMainNetParams,
+			want:        "1BpEi6DfDAUFd7GtittLSdBeYJvcoaVggu",
+		},
+		{
+			name:        "uppercase",
+			address:     "BITCOINCASH:PPM2QSZNHKS23Z7629MMS6S4CWEF74VCWVN0H829PQ",
+			chainParams: chaincfg.BitcoinCashMainNetParams,
+			want:        "3CWFddi6m4ndiGyKqzYvsFYagqDLPVMTzC",
+		},
+		{
+			name:        "testnet3",
+			address:     "bchtest:qp63uahgrxged4z5jswyt5dn5v3lzsem6cq85x00dt",
+			chainParams: chaincfg.BitcoinCashTestNet3Params,
+			want:        "mrCDrCybB6J1vRfbwM5hemdJz73FwDBC8r",
+		},
+		{
+			name:        "mixed case",
+			address:     "bitcoincash:qpm2qsznhks23z7629mms6s4cwef74vcwvY22gdx6a",
+			chainParams: chaincfg.BitcoinCashMainNetParams,
+			wantErr:     ErrInvalidCashAddr,
+		},
+		{
+			name:        "invalid checksum",
+			address:     "bitcoincash:qpm2qsznhks23z7629mms6s4cwef74vcwvy22gdx6b",
+			chainParams: chaincfg.BitcoinCashMainNetParams,
+			wantErr:     ErrInvalidCashAddr,
+		},
+		{
+			name:        "legacy address",
+			address:     "1BpEi6DfDAUFd7GtittLSdBeYJvcoaVggu",
+			chainParams: chaincfg.BitcoinCashMainNetParams,
+			wantErr:     ErrInvalidCashAddr,
+		},
+		{
+			name:        "mainnet address on testnet3",
+			address:     "bitcoincash:qpm2qsznhks23z7629mms6s4cwef74vcwvy22gdx6a",
+			chainParams: chaincfg.BitcoinCashTestNet3Params,
+			wantErr:     ErrNetworkMismatch,
+		},
+	}
+
+	s := &Service{}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := s.CashAddrToLegacy(tt.address, tt.chainParams)
+			if err != nil && errors.Cause(err) != tt.wantErr {
+				t.Fatalf("CashAddrToLegacy() unexpected error = %v", err)
+			}
+
+			if err == nil && tt.wantErr != nil {
+				t.Fatalf("CashAddrToLegacy() got no error, want %v", tt.wantErr)
+			}
+
+			if got != tt.want {
+				t.Fatalf("CashAddrToLegacy() got = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestConvertBchAddress(t *testing.T) {
+	s := &Service{}
+
+	for _, tt := range cashAddrVectors {
+		t.Run(tt.legacy, func(t *testing.T) {
+			cashAddr, err := s.ConvertBchAddress(tt.legacy, true, chaincfg.BitcoinCashMainNetParams)
+			if err != nil {
+				t.Fatalf("ConvertBchAddress() unexpected error = %v", err)
+			}
+
+			if cashAddr != tt.want {
+				t.Fatalf("ConvertBchAddress() got = %v, want %v", cashAddr, tt.want)
+			}
+
+			legacy, err := s.ConvertBchAddress(cashAddr, false, chaincfg.BitcoinCashMainNetParams)
+			if err != nil {
+				t.Fatalf("ConvertBchAddress() unexpected error = %v", err)
+			}
+
+			if legacy != tt.legacy {
+				t.Fatalf("ConvertBchAddress() got = %v, want %v", legacy, tt.legacy)
+			}
+		})
+	}
+
+	tests := []struct {
+		name        string
+		address     string
+		toCashAddr  bool
+		chainParams chaincfg.ChainParams
+		want        string
+		wantErr     error
+	}{
+		{
+			name:        "CashAddr without prefix to CashAddr",
+			address:     "qpm2qsznhks23z7629mms6s4cwef74vcwvy22gdx6a",
+			toCashAddr:  true,
+			chainParams: chaincfg.BitcoinCashMainNetParams,
+			want:        "bitcoincash:qpm2qsznhks23z7629mms6s4cwef74vcwvy22gdx6a",
+		},
+		{
+			name:        "legacy to legacy",
+			address:     "1BpEi6DfDAUFd7GtittLSdBeYJvcoaVggu",
+			chainParams: chaincfg.BitcoinCashMainNetParams,
+			want:        "1BpEi6DfDAUFd7GtittLSdBeYJvcoaVggu",
+		},
+		{
+			name:        "testnet3 legacy to CashAddr",
+			address:     "mrCDrCybB6J1vRfbwM5hemdJz73FwDBC8r",
+			toCashAddr:  true,
+			chainParams: chaincfg.BitcoinCashTestNet3Params,
+			want:        "bchtest:qp63uahgrxged4z5jswyt5dn5v3lzsem6cq85x00dt",
+		},
+		{
+			name:        "invalid CashAddr checksum",
+			address:     "bitcoincash:qpm2qsznhks23z7629mms6s4cwef74vcwvy22gdx6b",
+			chainParams: chaincfg.BitcoinCashMainNetParams,
+			wantErr:     ErrInvalidCashAddr,
+		},
+		{
+			name:        "mainnet CashAddr on testnet3",
+			address:     "bitcoincash:qpm2qsznhks23z7629mms6s4cwef74vcwvy22gdx6a",
+			toCashAddr:  true,
+			chainParams: chaincfg.BitcoinCashTestNet3Params,
+			wantErr:     ErrNetworkMismatch,
+		},
+		{
+			name:        "P2PK address",
+			address:     "0279be667ef9dcbbac55a06295ce870b07029bfcdb2dce28d959f2815b16f81798",
+			toCashAddr:  true,
+			chainParams: chaincfg.BitcoinCashMainNetParams,
+			wantErr:     ErrUnknownAddressType,
+		},
+		{
+			name:        "bitcoin network",
+			address:     "1BpEi6DfDAUFd7GtittLSdBeYJvcoaVggu",
+			toCashAddr:  true,
+			chainParams: chaincfg.BitcoinMainNetParams,
+			wantErr:     ErrUnknownAddressType,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := s.ConvertBchAddress(tt.address, tt.toCashAddr, tt.chainParams)
+			if err != nil && errors.Cause(err) != tt.wantErr {
+				t.Fatalf("ConvertBchAddress() unexpected error = %v", err)
+			}
+
+			if err == nil && tt.wantErr != nil {
+				t.Fatalf("ConvertBchAddress() got no error, want %v", tt.wantErr)
+			}
+
+			if got != tt.want {
+				t.Fatalf("ConvertBchAddress() got = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,346 @@
+package core
+
+import (
+	"bytes"
+	"encoding/hex"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/btcsuite/btcd/btcutil/hdkeychain"
+	"github.com/ledgerhq/bitcoin-lib-grpc/pkg/chaincfg"
+	"github.com/pkg/errors"
+)
+
+// References:
+//   [BIP380]: BIP0380 - Output Script Descriptors General Operation
+//   https://github.com/bitcoin/bips/blob/master/bip-0380.mediawiki
+//
+//   [BIP389]: BIP0389 - Multipath Descriptor Key Expressions
+//   https://github.com/bitcoin/bips/blob/master/bip-0389.mediawiki
+
+// descriptorInputCharset is the character set of descriptors. The position
+// of a character is the value it contributes to the checksum.
+const descriptorInputCharset = "0123456789()[],'/*abcdefgh@:$%{}" +
+	"IJKLMNOPQRSTUVWXYZ&+-.;<=>?!^_|~" +
+	"ijklmnopqrstuvwxyzABCDEFGH`#\"\\ "
+
+// descriptorChecksumCharset is the character set of descriptor checksums.
+const descriptorChecksumCharset = "qpzry9x8gf2tvdw0s3jn54khce6mua7l"
+
+// descriptorChecksumLen is the number of characters of a descriptor
+// checksum.
+const descriptorChecksumLen = 8
+
+// AccountDescriptor returns the receive and the change output script
+// descriptors of an account extended public key, with their key origin and
+// checksum, e.g.
+//   wpkh([3442193e/84h/0h/0h]xpub.../0/*)#checksum
+//   wpkh([3442193e/84h/0h/0h]xpub.../1/*)#checksum
+//
+// The key origin is made of the master key fingerprint, and of the
+// derivation path m / purpose' / coin_type' / account' of the account key.
+// purpose, coinType and account must NOT add the BIP32 harden bit.
+//
+// The descriptors are single-path, since BIP0389 multipath expressions are
+// not supported by every wallet.
+//
+// The account key MUST be an extended public key at BIP32 level 3. It is
+// embedded as is, so its version bytes should be the ones of the chain
+// parameters (xpub or tpub), and not SLIP-0132 ones.
+func (s *Service) AccountDescriptor(
+	accountKey string,
+	encoding AddressEncoding,
+	fingerprint [4]byte,
+	purpose uint32,
+	coinType uint32,
+	account uint32,
+) (string, string, error) {
+	key, err := hdkeychain.NewKeyFromString(accountKey)
+	if err != nil {
+		return "", "", errors.Wrap(err, "failed to decode account key")
+	}
+
+	if key.IsPrivate() {
+		return "", "", errors.New("account key must be an extended public key")
+	}
+
+	if key.Depth() != 3 {
+		return "", "", errors.Errorf("account key has depth %d, expected 3",
+			key.Depth())
+	}
+
+	for _, index := range []uint32{purpose, coinType, account} {
+		if index >= hdkeychain.HardenedKeyStart {
+			return "", "", errors.Errorf(
+				"index %d must not include the harden bit", index)
+		}
+	}
+
+	accountKeyExpression := fmt.Sprintf("[%s/%dh/%dh/%dh]%s",
+		hex.EncodeToString(fingerprint[:]), purpose, coinType, account, accountKey)
+
+	receive, err := chainDescriptor(accountKeyExpression, encoding, ExternalChain)
+	if err != nil {
+		return "", "", err
+	}
+
+	change, err := chainDescriptor(accountKeyExpression, encoding, InternalChain)
+	if err != nil {
+		return "", "", err
+	}
+
+	return receive, change, nil
+}
+
+// chainDescriptor returns the ranged descriptor of the given change chain
+// of an account key expression, with its checksum.
+func chainDescriptor(
+	accountKeyExpression string, encoding AddressEncoding, change uint32,
+) (string, error) {
+	keyExpression := fmt.Sprintf("%s/%d/*", accountKeyExpression, change)
+
+	var descriptor string
+
+	switch encoding {
+	case Legacy:
+		descriptor = "pkh(" + keyExpression + ")"
+	case WrappedSegwit:
+		descriptor = "sh(wpkh(" + keyExpression + "))"
+	case NativeSegwit:
+		descriptor = "wpkh(" + keyExpression + ")"
+	case Taproot:
+		descriptor = "tr(" + keyExpression + ")"
+	default:
+		return "", ErrUnknownAddressType
+	}
+
+	checksum, err := descriptorChecksum(descriptor)
+	if err != nil {
+		return "", err
+	}
+
+	return descriptor + "#" + checksum, nil
+}
+
+// descriptorScripts lists the script expressions of the descriptors
+// supported by DeriveFromDescriptor, with the address encoding of their
+// outputs. sh(wpkh(...)) must be matched before pkh(...) and wpkh(...).
+var descriptorScripts = []struct {
+	prefix   string
+	suffix   string
+	encoding AddressEncoding
+}{
+	{prefix: "sh(wpkh(", suffix: "))", encoding: WrappedSegwit},
+	{prefix: "pkh(", suffix: ")", encoding: Legacy},
+	{prefix: "wpkh(", suffix: ")", encoding: NativeSegwit},
+	{prefix: "tr(", suffix: ")", encoding: Taproot},
+}
+
+// DeriveFromDescriptor returns the address at the given index of a ranged
+// output script descriptor, such as the ones returned by AccountDescriptor.
+//
+// The descriptor must end with a valid BIP0380 checksum, and its script
+// expression must be pkh, sh(wpkh), wpkh, or tr without script path. Its
+// key expression must be an extended key, with an optional key origin,
+// followed by non-hardened derivation steps ending with the /* wildcard,
+// e.g. /0/* for receive addresses and /1/* for change addresses.
+//
+// BIP0389 multipath steps, such as /<0;1>/*, are rejected, since the
+// branch to derive would be ambiguous. Each path must be derived from its
+// own single-path descriptor instead.
+//
+// The extended key must be encoded for the network of the chain
+// parameters. Any error in the descriptor is wrapped in ErrInvalidDescriptor.
+func (s *Service) DeriveFromDescriptor(
+	descriptor string, index uint32, chainParams chaincfg.ChainParams,
+) (string, error) {
+	encoding, key, path, err := parseDescriptor(descriptor)
+	if err != nil {
+		return "", err
+	}
+
+	if !bytes.Equal(key.Version(), chainParams.HDPublicKeyID[:]) &&
+		!bytes.Equal(key.Version(), chainParams.HDPrivateKeyID[:]) {
+		return "", errors.Wrapf(ErrNetworkMismatch,
+			"descriptor key is not for network %s", chainParams.Name)
+	}
+
+	if err := checkPublicDerivationIndex(index); err != nil {
+		return "", err
+	}
+
+	for _, childIndex := range append(path, index) {
+		key, err = key.Derive(childIndex)
+		if err != nil {
+			return "", errors.Wrapf(err, "failed to derive index %d", childIndex)
+		}
+	}
+
+	publicKey, err := key.ECPubKey()
+	if err != nil {
+		return "", errors.Wrap(err, "failed to get public key")
+	}
+
+	address, err := addressFromPublicKey(publicKey, encoding, chainParams)
+	if err != nil {
+		return "", errors.Wrapf(err, "failed to encode %s address", encoding)
+	}
+
+	return address.EncodeAddress(), nil
+}
+
+// parseDescriptor checks the checksum of a ranged descriptor, and returns
+// the address encoding of its outputs, its extended key, and the derivation
+// steps between the extended key and the wildcard.
+func parseDescriptor(descriptor string) (AddressEncoding, *hdkeychain.ExtendedKey, []uint32, error) {
+	separator := strings.LastIndex(descriptor, "#")
+	if separator < 0 {
+		return 0, nil, nil, errors.Wrap(ErrInvalidDescriptor, "missing checksum")
+	}
+
+	body, checksum := descriptor[:separator], descriptor[separator+1:]
+
+	expectedChecksum, err := descriptorChecksum(body)
+	if err != nil {
+		return 0, nil, nil, errors.Wrap(ErrInvalidDescriptor, err.Error())
+	}
+
+	if checksum != expectedChecksum {
+		return 0, nil, nil, errors.Wrapf(ErrInvalidDescriptor,
+			"checksum mismatch: got %s, expected %s", checksum, expectedChecksum)
+	}
+
+	var (
+		keyExpression string
+		encoding      AddressEncoding
+		matched       bool
+	)
+
+	for _, script := range descriptorScripts {
+		if strings.HasPrefix(body, script.prefix) && strings.HasSuffix(body, script.suffix) &&
+			len(body) >= len(script.prefix)+len(script.suffix) {
+			keyExpression = body[len(script.prefix) : len(body)-len(script.suffix)]
+			encoding = script.encoding
+			matched = true
+
+			break
+		}
+	}
+
+	if !matched || strings.ContainsAny(keyExpression, "(),") {
+		return 0, nil, nil, errors.Wrapf(ErrInvalidDescriptor,
+			"unsupported script expression in %s", body)
+	}
+
+	// Skip the key origin, which has no impact on the derived addresses.
+	if strings.HasPrefix(keyExpression, "[") {
+		end := strings.Index(keyExpression, "]")
+		if end < 0 {
+			return 0, nil, nil, errors.Wrap(ErrInvalidDescriptor,
+				"unterminated key origin")
+		}
+
+		keyExpression = keyExpression[end+1:]
+	}
+
+	steps := strings.Split(keyExpression, "/")
+	if len(steps) < 2 || steps[len(steps)-1] != "*" {
+		return 0, nil, nil, errors.Wrapf(ErrInvalidDescriptor,
+			"key expression %s is not ranged with a /* wildcard", keyExpression)
+	}
+
+	key, err := hdkeychain.NewKeyFromString(steps[0])
+	if err != nil {
+		return 0, nil, nil, errors.Wrapf(ErrInvalidDescriptor,
+			"failed to decode extended key %s: %v", steps[0], err)
+	}
+
+	path := make([]uint32, 0, len(steps)-2)
+
+	for _, step := range steps[1 : len(steps)-1] {
+		if strings.HasPrefix(step, "<") {
+			return 0, nil, nil, errors.Wrapf(ErrInvalidDescriptor,
+				"unsupported multipath step '%s', expected a single path", step)
+		}
+
+		childIndex, err := strconv.ParseUint(step, 10, 32)
+		if err != nil || childIndex >= hdkeychain.HardenedKeyStart {
+			return 0, nil, nil, errors.Wrapf(ErrInvalidDescriptor,
+				"unsupported derivation step '%s', expected a non-hardened index", step)
+		}
+
+		path = append(path, uint32(childIndex))
+	}
+
+	return encoding, key, path, nil
+}
+
+// descriptorChecksum computes the BIP0380 checksum of a descriptor, without
+// the "#" separator.
+func descriptorChecksum(descriptor string) (string, error) {
+	checksum := uint64(1)
+	addToChecksum := func(value uint64) {
+		checksum = descriptorPolymod(checksum, value)
+	}
+
+	classes := make([]uint64, 0, 3)
+
+	for _, char := range descriptor {
+		position := strings.IndexRune(descriptorInputCharset, char)
+		if position < 0 {
+			return "", errors.Errorf(
+				"invalid character '%c' in descriptor", char)
+		}
+
+		// Each character contributes its position in its group of 32
+		// characters, and every 3 characters, their groups are combined.
+		addToChecksum(uint64(position & 31))
+
+		classes = append(classes, uint64(position>>5))
+		if len(classes) == 3 {
+			addToChecksum(classes[0]*9 + classes[1]*3 + classes[2])
+			classes = classes[:0]
+		}
+	}
+
+	switch len(classes) {
+	case 1:
+		addToChecksum(classes[0])
+	case 2:
+		addToChecksum(classes[0]*3 + classes[1])
+	}
+
+	for idx := 0; idx < descriptorChecksumLen; idx++ {
+		addToChecksum(0)
+	}
+
+	checksum ^= 1
+
+	var result strings.Builder
+	for idx := 0; idx < descriptorChecksumLen; idx++ {
+		shift := 5 * (descriptorChecksumLen - 1 - idx)
+		result.WriteByte(descriptorChecksumCharset[(checksum>>shift)&31])
+	}
+
+	return result.String(), nil
+}
+
+// descriptorPolymod feeds a 5-bit value to the BCH code of descriptor
+// checksums, as specified by BIP0380.
+func descriptorPolymod(checksum uint64, value uint64) uint64 {
+	generators := [5]uint64{
+		0xf5dee51989, 0xa9fdca3312, 0x1bab10e32d, 0x3706b1677a, 0x644d626ffd,
+	}
+
+	top := checksum >> 35
+	checksum = (checksum&0x7ffffffff)<<5 ^ value
+
+	for idx, generator := range generators {
+		if (top>>uint(idx))&1 == 1 {
+			checksum ^= generator
+		}
+	}
+
+	return checksum
+}
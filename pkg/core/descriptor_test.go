@@ -0,0 +1,273 @@
+package core
+
+import (
+	"context"
+	"testing"
+
+	"github.com/ledgerhq/bitcoin-lib-grpc/pkg/chaincfg"
+	"github.com/pkg/errors"
+)
+
+// Account keys derived from the BIP0032 Test Vector 1 master key, whose
+// fingerprint is 3442193e, at m / purpose' / 0' / 0'.
+const (
+	descriptorAccountKey44 = "xpub6CDEarkRoiwWPj3n3gYygGwgoGchxYg3g6Zs5L2nB4B6wdojzcWCKKHMu9XuY1GyYygRfrVembjAko1T5xTsxj7ecKXxEPzDxx7nCK8Dxtx"
+	descriptorAccountKey49 = "xpub6CGm4atcpu4jeT1T4htkkgct5LcPdheajmdxDpKuimWvBfL2f2o34kc2N3znM1YrVjkJoMBbdVBwuq6fYhNWD3kjEdPGJaS8gqBe3C5tQPm"
+	descriptorAccountKey84 = "xpub6C1HVMz946r433QEjZGpYYWYcspxXXBPys5PBGkmQboRXE6RLfFiStEkKbWKCZaPgDrzZh9nUEunxuiuy6MNdw23du2Ek7GoKYMJVH8eK5E"
+	descriptorAccountKey86 = "xpub6DRX1xNPHKaApgDnqaMNxJ8Lz35KCn3mRcW3LUep3JKhxWisRwaZJPn4BuZiaJ4kJ3cdqwbn4vZcsGiLGJJabZbqa65LGX2uhU9CtPWSgEn"
+)
+
+func TestAccountDescriptor(t *testing.T) {
+	fingerprint := [4]byte{0x34, 0x42, 0x19, 0x3e}
+
+	// Expected descriptors are the ones returned by Bitcoin Core's
+	// getdescriptorinfo.
+	tests := []struct {
+		name        string
+		accountKey  string
+		encoding    AddressEncoding
+		purpose     uint32
+		wantReceive string
+		wantChange  string
+		wantErr     bool
+	}{
+		{
+			name:        "pkh",
+			accountKey:  descriptorAccountKey44,
+			encoding:    Legacy,
+			purpose:     44,
+			wantReceive: "pkh([3442193e/44h/0h/0h]" + descriptorAccountKey44 + "/0/*)#jf4j4lp8",
+			wantChange:  "pkh([3442193e/44h/0h/0h]" + descriptorAccountKey44 + "/1/*)#rasng23l",
+		},
+		{
+			name:        "sh(wpkh)",
+			accountKey:  descriptorAccountKey49,
+			encoding:    WrappedSegwit,
+			purpose:     49,
+			wantReceive: "sh(wpkh([3442193e/49h/0h/0h]" + descriptorAccountKey49 + "/0/*))#qyh5697h",
+			wantChange:  "sh(wpkh([3442193e/49h/0h/0h]" + descriptorAccountKey49 + "/1/*))#49ezz6tg",
+		},
+		{
+			name:        "wpkh",
+			accountKey:  descriptorAccountKey84,
+			encoding:    NativeSegwit,
+			purpose:     84,
+			wantReceive: "wpkh([3442193e/84h/0h/0h]" + descriptorAccountKey84 + "/0/*)#ve9j2qeg",
+			wantChange:  "wpkh([3442193e/84h/0h/0h]" + descriptorAccountKey84 + "/1/*)#adqnh4fs",
+		},
+		{
+			name:        "tr",
+			accountKey:  descriptorAccountKey86,
+			encoding:    Taproot,
+			purpose:     86,
+			wantReceive: "tr([3442193e/86h/0h/0h]" + descriptorAccountKey86 + "/0/*)#lk9r7xnh",
+			wantChange:  "tr([3442193e/86h/0h/0h]" + descriptorAccountKey86 + "/1/*)#wzqzrnr0",
+		},
+		{
+			name:       "private account key",
+			accountKey: "xprv9s21ZrQH143K3QTDL4LXw2F7HEK3wJUD2nW2nRk4stbPy6cq3jPPqjiChkVvvNKmPGJxWUtg6LnF5kejMRNNU3TGtRBeJgk33yuGBxrMPHi",
+			encoding:   NativeSegwit,
+			purpose:    84,
+			wantErr:    true,
+		},
+		{
+			name:       "master public key",
+			accountKey: "xpub661MyMwAqRbcFtXgS5sYJABqqG9YLmC4Q1Rdap9gSE8NqtwybGhePY2gZ29ESFjqJoCu1Rupje8YtGqsefD265TMg7usUDFdp6W1EGMcet8",
+			encoding:   NativeSegwit,
+			purpose:    84,
+			wantErr:    true,
+		},
+		{
+			name:       "hardened purpose",
+			accountKey: descriptorAccountKey84,
+			encoding:   NativeSegwit,
+			purpose:    84 + h,
+			wantErr:    true,
+		},
+	}
+
+	s := &Service{}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			gotReceive, gotChange, err := s.AccountDescriptor(
+				tt.accountKey, tt.encoding, fingerprint, tt.purpose, 0, 0)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("AccountDescriptor() got error '%v', wantErr %v", err, tt.wantErr)
+			}
+
+			if gotReceive != tt.wantReceive {
+				t.Fatalf("AccountDescriptor() got receive '%s', want '%s'",
+					gotReceive, tt.wantReceive)
+			}
+
+			if gotChange != tt.wantChange {
+				t.Fatalf("AccountDescriptor() got change '%s', want '%s'",
+					gotChange, tt.wantChange)
+			}
+		})
+	}
+}
+
+func TestDescriptorChecksum(t *testing.T) {
+	// Examples of Bitcoin Core's doc/descriptors.md.
+	tests := []struct {
+		descriptor string
+		want       string
+	}{
+		{
+			descriptor: "raw(deadbeef)",
+			want:       "89f8spxm",
+		},
+		{
+			descriptor: "pkh([d34db33f/44'/0'/0']xpub6ERApfZwUNrhLCkDtcHTcxd75RbzS1ed54G1LkBUHQVHQKqhMkhgbmJbZRkrgZw4koxb5JaHWkY4ALHY2grBGRjaDMzQLcgJvLJuZZvRcEL/1/*)",
+			want:       "ml40v0wf",
+		},
+	}
+
+	for _, tt := range tests {
+		got, err := descriptorChecksum(tt.descriptor)
+		if err != nil {
+			t.Fatalf("descriptorChecksum() got error '%v'", err)
+		}
+
+		if got != tt.want {
+			t.Fatalf("descriptorChecksum(%s) got '%s', want '%s'",
+				tt.descriptor, got, tt.want)
+		}
+	}
+
+	if _, err := descriptorChecksum("raw(deadbeef)é"); err == nil {
+		t.Fatalf("descriptorChecksum() got no error for invalid character")
+	}
+}
+
+func TestDeriveFromDescriptor(t *testing.T) {
+	tests := []struct {
+		name       string
+		descriptor string
+		index      uint32
+		want       string
+		wantErr    error
+	}{
+		{
+			name:       "pkh receive",
+			descriptor: "pkh([3442193e/44h/0h/0h]" + descriptorAccountKey44 + "/0/*)#jf4j4lp8",
+			index:      1,
+			want:       "16qTdEma9YHFPCZ8sB51nNrbfVg8Nkzy6P",
+		},
+		{
+			name:       "sh(wpkh) receive",
+			descriptor: "sh(wpkh([3442193e/49h/0h/0h]" + descriptorAccountKey49 + "/0/*))#qyh5697h",
+			index:      0,
+			want:       "35KsULTNUcaFcJC3aKBnP38ZZW2Yu36khW",
+		},
+		{
+			name:       "wpkh change",
+			descriptor: "wpkh([3442193e/84h/0h/0h]" + descriptorAccountKey84 + "/1/*)#adqnh4fs",
+			index:      1,
+			want:       "bc1qstsv22jacyptlgle5rv7ew9ymht8v5a5fqt8ta",
+		},
+		{
+			name:       "tr change",
+			descriptor: "tr([3442193e/86h/0h/0h]" + descriptorAccountKey86 + "/1/*)#wzqzrnr0",
+			index:      0,
+			want:       "bc1pze68k8k30zu29nzzllmhvet26avtxyfec5n88ymwzmd59mxw0wpqlt3mwu",
+		},
+		{
+			name:       "multipath",
+			descriptor: "wpkh([3442193e/84h/0h/0h]" + descriptorAccountKey84 + "/<0;1>/*)#m8yy595j",
+			wantErr:    ErrInvalidDescriptor,
+		},
+		{
+			name:       "missing checksum",
+			descriptor: "wpkh([3442193e/84h/0h/0h]" + descriptorAccountKey84 + "/1/*)",
+			wantErr:    ErrInvalidDescriptor,
+		},
+		{
+			name:       "checksum mismatch",
+			descriptor: "wpkh([3442193e/84h/0h/0h]" + descriptorAccountKey84 + "/0/*)#adqnh4fs",
+			wantErr:    ErrInvalidDescriptor,
+		},
+		{
+			name:       "hardened step",
+			descriptor: "wpkh(" + descriptorAccountKey84 + "/0h/*)#4889zdj8",
+			wantErr:    ErrInvalidDescriptor,
+		},
+		{
+			name:       "unsupported script",
+			descriptor: "sh(multi(1," + descriptorAccountKey84 + "/0/*))#fl2tgatl",
+			wantErr:    ErrInvalidDescriptor,
+		},
+		{
+			name:       "not ranged",
+			descriptor: "wpkh(" + descriptorAccountKey84 + "/0/0)#sczs6m5d",
+			wantErr:    ErrInvalidDescriptor,
+		},
+		{
+			name:       "hardened index",
+			descriptor: "wpkh([3442193e/84h/0h/0h]" + descriptorAccountKey84 + "/1/*)#adqnh4fs",
+			index:      h,
+			wantErr:    ErrDeriveHardFromPublic,
+		},
+	}
+
+	s := &Service{}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := s.DeriveFromDescriptor(tt.descriptor, tt.index, chaincfg.BitcoinMainNetParams)
+			if errors.Cause(err) != tt.wantErr {
+				t.Fatalf("DeriveFromDescriptor() got error '%v', want '%v'", err, tt.wantErr)
+			}
+
+			if got != tt.want {
+				t.Fatalf("DeriveFromDescriptor() got '%s', want '%s'", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDeriveFromDescriptor_AccountDescriptor(t *testing.T) {
+	s := &Service{}
+
+	receive, change, err := s.AccountDescriptor(descriptorAccountKey84, NativeSegwit,
+		[4]byte{0x34, 0x42, 0x19, 0x3e}, 84, 0, 0)
+	if err != nil {
+		t.Fatalf("AccountDescriptor() got error '%v'", err)
+	}
+
+	// The addresses derived from each descriptor must be the ones of its
+	// chain of the account key.
+	tests := []struct {
+		name       string
+		descriptor string
+		change     uint32
+	}{
+		{name: "receive", descriptor: receive, change: ExternalChain},
+		{name: "change", descriptor: change, change: InternalChain},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			want, err := s.DeriveAddresses(context.Background(), descriptorAccountKey84,
+				NativeSegwit, tt.change, 0, 2, chaincfg.BitcoinMainNetParams)
+			if err != nil {
+				t.Fatalf("DeriveAddresses() got error '%v'", err)
+			}
+
+			for _, address := range want {
+				got, err := s.DeriveFromDescriptor(tt.descriptor, address.Index,
+					chaincfg.BitcoinMainNetParams)
+				if err != nil {
+					t.Fatalf("DeriveFromDescriptor() got error '%v'", err)
+				}
+
+				if got != address.Address {
+					t.Fatalf("DeriveFromDescriptor() got '%s' at index %d, want '%s'",
+						got, address.Index, address.Address)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,101 @@
+package core
+
+import (
+	"encoding/binary"
+
+	"github.com/btcsuite/btcd/btcec/v2"
+	"github.com/btcsuite/btcd/btcec/v2/ecdsa"
+	"github.com/btcsuite/btcd/txscript"
+)
+
+// References:
+//   [RFC6979]: Deterministic Usage of the Digital Signature Algorithm (DSA)
+//   and Elliptic Curve Digital Signature Algorithm (ECDSA)
+//   https://tools.ietf.org/html/rfc6979#section-3.6
+//
+//   [Bitcoin Core]: Low R signatures
+//   https://github.com/bitcoin/bitcoin/pull/13666
+
+// lowRSignature returns the DER signature of a signature hash, followed by
+// the signature hash type, with an R value lower than 2^255.
+//
+// A low R value is serialized in 32 bytes, i.e. without the leading 0x00 of
+// a DER integer with the highest bit set, which saves one byte in half of
+// the signatures. Like Bitcoin Core, the RFC6979 nonce is ground by adding
+// an incremented 32-byte little-endian counter as additional data, until R
+// is low. The first attempt uses no additional data, and is thus the
+// signature produced by ecdsa.Sign.
+func lowRSignature(
+	hash []byte, hashType txscript.SigHashType, privKey *btcec.PrivateKey,
+) DerSignature {
+	privKeyBytes := privKey.Serialize()
+	defer zeroBytes(privKeyBytes)
+
+	var extraData []byte
+
+	for counter := uint32(1); ; counter++ {
+		signature := signWithExtraData(privKey, privKeyBytes, hash, extraData)
+
+		if r := signature.R(); r.Bytes()[0] < 0x80 {
+			return append(signature.Serialize(), byte(hashType))
+		}
+
+		extraData = make([]byte, 32)
+		binary.LittleEndian.PutUint32(extraData, counter)
+	}
+}
+
+// signWithExtraData returns the ECDSA signature of a hash, with a low S
+// value as per BIP0062, using the RFC6979 nonce of btcec.NonceRFC6979 with
+// the given additional data.
+//
+// Like ecdsa.Sign, the next nonce of the RFC6979 stream is used in the
+// unlikely event that a nonce results in an invalid signature.
+func signWithExtraData(
+	privKey *btcec.PrivateKey, privKeyBytes []byte, hash []byte, extraData []byte,
+) *ecdsa.Signature {
+	for iteration := uint32(0); ; iteration++ {
+		k := btcec.NonceRFC6979(privKeyBytes, hash, extraData, nil, iteration)
+		signature, ok := signWithNonce(&privKey.Key, k, hash)
+		k.Zero()
+
+		if ok {
+			return signature
+		}
+	}
+}
+
+// signWithNonce returns the ECDSA signature of a hash with the nonce k, or
+// false if k results in an invalid signature. It follows the signing steps
+// of ecdsa.Sign, with the same btcec scalar and point operations, since
+// ecdsa.Sign has no way to pass additional data to the nonce.
+func signWithNonce(
+	privKey *btcec.ModNScalar, k *btcec.ModNScalar, hash []byte,
+) (*ecdsa.Signature, bool) {
+	// r = (k*G).x mod n
+	var kG btcec.JacobianPoint
+	btcec.ScalarBaseMultNonConst(k, &kG)
+	kG.ToAffine()
+
+	var r btcec.ModNScalar
+	r.SetBytes(kG.X.Bytes())
+	if r.IsZero() {
+		return nil, false
+	}
+
+	// s = k^-1 * (e + r * d) mod n
+	var e btcec.ModNScalar
+	e.SetByteSlice(hash)
+
+	kInv := new(btcec.ModNScalar).InverseValNonConst(k)
+	s := new(btcec.ModNScalar).Mul2(privKey, &r).Add(&e).Mul(kInv)
+	if s.IsZero() {
+		return nil, false
+	}
+
+	if s.IsOverHalfOrder() {
+		s.Negate()
+	}
+
+	return ecdsa.NewSignature(&r, s), true
+}
@@ -0,0 +1,135 @@
+package core
+
+import (
+	"bytes"
+	"encoding/hex"
+	"testing"
+
+	"github.com/btcsuite/btcd/btcec/v2"
+	"github.com/btcsuite/btcd/btcec/v2/ecdsa"
+	"github.com/btcsuite/btcd/btcutil"
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/btcsuite/btcd/txscript"
+)
+
+func TestLowRSignature(t *testing.T) {
+	decodeHex := func(hexStr string) []byte {
+		b, err := hex.DecodeString(hexStr)
+		if err != nil {
+			panic(err)
+		}
+		return b
+	}
+
+	// Deterministic signature of Bitcoin Core, from src/test/key_tests.cpp.
+	wif, err := btcutil.DecodeWIF("5HxWvvfubhXpYYpS3tJkw6fq9jE9j18THftkZjHHfmFiWtmAbrj")
+	if err != nil {
+		t.Fatalf("DecodeWIF() got error '%v'", err)
+	}
+
+	privKey, _ := btcec.PrivKeyFromBytes(chainhash.HashB([]byte{2}))
+
+	tests := []struct {
+		name    string
+		privKey *btcec.PrivateKey
+		hash    []byte
+		want    []byte
+	}{
+		{
+			name:    "low R without additional data",
+			privKey: wif.PrivKey,
+			hash:    chainhash.DoubleHashB([]byte("Very deterministic message")),
+			want: decodeHex("304402205dbbddda71772d95ce91cd2d14b592cfbc1dd0aabd6a394b6c2d377bbe59d31d" +
+				"022014ddda21494a4e221f0824f0b8b924c43fa43c0ad57dccdaa11f81a6bd4582f601"),
+		},
+		{
+			// R is only low with the third counter, cross-checked with an
+			// independent implementation of RFC6979 and ECDSA.
+			name:    "low R with additional data",
+			privKey: privKey,
+			hash:    chainhash.DoubleHashB([]byte{2}),
+			want: decodeHex("304402203c55bb8eb710ee01044f0c70760e5d812dafaf4c3565ea478f26f2385cc154c4" +
+				"022076762bc431ef0c3f19253bb52dec8fc9f4a131c656600baf3d5c68e6ba8ff3d101"),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := lowRSignature(tt.hash, txscript.SigHashAll, tt.privKey)
+			if !bytes.Equal(got, tt.want) {
+				t.Fatalf("lowRSignature() got %x, want %x", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSignWithExtraData(t *testing.T) {
+	// Without additional data, signatures are the ones of ecdsa.Sign, with
+	// low and high R values alike.
+	for i := byte(1); i <= 32; i++ {
+		privKey, _ := btcec.PrivKeyFromBytes(chainhash.HashB([]byte{i}))
+		hash := chainhash.DoubleHashB([]byte{i})
+
+		got := signWithExtraData(privKey, privKey.Serialize(), hash, nil)
+		if want := ecdsa.Sign(privKey, hash); !got.IsEqual(want) {
+			t.Fatalf("signWithExtraData() got %x, want %x for key %d",
+				got.Serialize(), want.Serialize(), i)
+		}
+
+		extraData := make([]byte, 32)
+		extraData[0] = i
+
+		got = signWithExtraData(privKey, privKey.Serialize(), hash, extraData)
+		if !got.Verify(hash, privKey.PubKey()) {
+			t.Fatalf("signWithExtraData() got invalid signature %x for key %d",
+				got.Serialize(), i)
+		}
+	}
+}
+
+func TestLowRSignature_CrossCheck(t *testing.T) {
+	var ground int
+
+	for i := byte(1); i <= 64; i++ {
+		privKey, _ := btcec.PrivKeyFromBytes(chainhash.HashB([]byte{i}))
+		hash := chainhash.DoubleHashB([]byte{i})
+
+		got := lowRSignature(hash, txscript.SigHashAll, privKey)
+		if hashType := got[len(got)-1]; hashType != byte(txscript.SigHashAll) {
+			t.Fatalf("lowRSignature() got hash type 0x%02x, want 0x%02x for key %d",
+				hashType, byte(txscript.SigHashAll), i)
+		}
+
+		signature, err := ecdsa.ParseDERSignature(got[:len(got)-1])
+		if err != nil {
+			t.Fatalf("ParseDERSignature() got error '%v' for key %d", err, i)
+		}
+
+		if r := signature.R(); r.Bytes()[0] >= 0x80 {
+			t.Fatalf("lowRSignature() got high R signature %x for key %d", got, i)
+		}
+
+		if !signature.Verify(hash, privKey.PubKey()) {
+			t.Fatalf("lowRSignature() got invalid signature %x for key %d", got, i)
+		}
+
+		// The first attempt, without additional data, is the signature of
+		// ecdsa.Sign, which is kept as is if its R value is low.
+		want := ecdsa.Sign(privKey, hash)
+		if r := want.R(); r.Bytes()[0] < 0x80 {
+			if !bytes.Equal(got[:len(got)-1], want.Serialize()) {
+				t.Fatalf("lowRSignature() got %x, want %x for key %d",
+					got[:len(got)-1], want.Serialize(), i)
+			}
+
+			continue
+		}
+
+		ground++
+	}
+
+	// About half of the signatures of ecdsa.Sign have a high R value.
+	if ground == 0 {
+		t.Fatalf("lowRSignature() ground no signature, want some")
+	}
+}
@@ -1,7 +1,200 @@
 package core
 
-import "github.com/btcsuite/btcutil"
+import (
+	"errors"
+	"fmt"
+
+	"github.com/btcsuite/btcd/btcutil"
+	"github.com/btcsuite/btcd/btcutil/hdkeychain"
+)
 
 // ErrUnknownAddressType is a type alias to allow reference in external
 // packages without importing btcutil.
 var ErrUnknownAddressType = btcutil.ErrUnknownAddressType
+
+// ErrNotPrivateExtendedKey is a type alias to allow reference in external
+// packages without importing hdkeychain.
+var ErrNotPrivateExtendedKey = hdkeychain.ErrNotPrivExtKey
+
+// ErrDeriveHardFromPublic is a type alias to allow reference in external
+// packages without importing hdkeychain.
+var ErrDeriveHardFromPublic = hdkeychain.ErrDeriveHardFromPublic
+
+// ErrUncompressedPublicKey is returned when an uncompressed public key is
+// used for a segwit or taproot address, which only commit to compressed
+// public keys.
+var ErrUncompressedPublicKey = errors.New("compressed public key required")
+
+// ErrBech32Variant is returned when a segwit address has a valid checksum,
+// but of the wrong variant for its witness version, as specified in BIP0350.
+var ErrBech32Variant = errors.New("wrong bech32 checksum variant")
+
+// ErrMwebAddress is returned when a Litecoin MWEB address is used where a
+// regular address is expected, as MWEB outputs cannot be built by the
+// service.
+var ErrMwebAddress = errors.New("MWEB addresses are not supported")
+
+// ErrUnenforcedLockTime is returned when a transaction has a non-zero lock
+// time, but only inputs with the final sequence number 0xffffffff, so that
+// the lock time is not enforced.
+var ErrUnenforcedLockTime = errors.New("lock time not enforced by any input sequence number")
+
+// ErrInvalidPrivateKey is returned when a raw private key is malformed, or
+// is not a valid secp256k1 scalar.
+var ErrInvalidPrivateKey = errors.New("invalid private key")
+
+// ErrPublicKeyMismatch is returned when a private key does not correspond to
+// the public key it is expected to match.
+var ErrPublicKeyMismatch = errors.New("public key mismatch")
+
+// ErrNetworkMismatch is returned when an address or a key is not encoded for
+// the network of the chain parameters.
+var ErrNetworkMismatch = errors.New("network mismatch")
+
+// ErrUnknownHDKeyVersion is returned when the HD version bytes of an
+// extended key are unknown for the network of the chain parameters.
+var ErrUnknownHDKeyVersion = errors.New("unknown HD key version")
+
+// ErrInvalidCashAddr is returned when a CashAddr address is malformed.
+var ErrInvalidCashAddr = errors.New("invalid CashAddr address")
+
+// ErrPreviousTxMismatch is returned when the previous transaction of a utxo
+// does not match the outpoint, the script, or the value of the utxo.
+var ErrPreviousTxMismatch = errors.New("previous transaction mismatch")
+
+// ErrNonCanonicalSignature is returned when a signature provided for an
+// input is malformed, or is not canonically encoded.
+var ErrNonCanonicalSignature = errors.New("non-canonical signature")
+
+// ErrInvalidControlBlock is returned when the control block of a P2TR
+// script-path spend is malformed, or does not commit the tap leaf script to
+// the output key of the utxo.
+var ErrInvalidControlBlock = errors.New("invalid control block")
+
+// ErrInvalidMessageSignature is returned when a compact signature, such as
+// a signed message signature, is malformed, or does not allow to recover a
+// public key.
+var ErrInvalidMessageSignature = errors.New("invalid message signature")
+
+// ErrAddressEncodingMismatch is returned when the address encoding declared
+// for an input does not match the script of the utxo it spends.
+var ErrAddressEncodingMismatch = errors.New("address encoding mismatch")
+
+// ErrInvalidMnemonic is returned when a BIP0039 mnemonic has an invalid
+// number of words, a word that is not in the wordlist, or an invalid
+// checksum.
+var ErrInvalidMnemonic = errors.New("invalid mnemonic")
+
+// ErrInvalidEntropySize is returned when the entropy size of a mnemonic to
+// generate is not 128, 160, 192, 224 or 256 bits.
+var ErrInvalidEntropySize = errors.New("invalid entropy size")
+
+// ErrInvalidDescriptor is returned when an output script descriptor is
+// malformed, has an invalid checksum, or is not supported.
+var ErrInvalidDescriptor = errors.New("invalid descriptor")
+
+// ErrInvalidSeedLength is returned when a seed is too short or too long to
+// generate a BIP0032 master key.
+var ErrInvalidSeedLength = errors.New("seed must be between 16 and 64 bytes long")
+
+// ErrInvalidBip85Parameters is returned when the language, the number of
+// words, or the index of a BIP0085 child mnemonic is invalid or not
+// supported.
+var ErrInvalidBip85Parameters = errors.New("invalid BIP85 parameters")
+
+// ErrNonStandardScript is returned when the raw script of an output of a
+// transaction to create is not of a standard type.
+var ErrNonStandardScript = errors.New("non-standard output script")
+
+// ErrInvalidRedeemScript is returned when the redeem script of a P2SH utxo
+// is missing, is not a P2WPKH witness program, or does not match the script
+// hash of the utxo.
+var ErrInvalidRedeemScript = errors.New("invalid redeem script")
+
+// ErrInvalidSendMax is returned when send max is requested for a
+// transaction to create without exactly one output.
+var ErrInvalidSendMax = errors.New("send max requires exactly one output")
+
+// ErrInvalidFee is returned when a transaction to create does not set
+// exactly one of a positive fee rate and a positive absolute fee.
+var ErrInvalidFee = errors.New("exactly one of fee rate and absolute fee must be set")
+
+// ErrInvalidChange is returned when the change outputs of a transaction to
+// create are missing, or set in mutually exclusive ways, e.g. with both a
+// change address and a change derivation.
+var ErrInvalidChange = errors.New("invalid change output")
+
+// ErrInvalidChangeRatio is returned when the ratios of the split change
+// outputs of a transaction to create are not positive, or do not sum to 1.
+var ErrInvalidChangeRatio = errors.New("invalid change split ratio")
+
+// ErrUnknownOrdering is returned when the ordering of the inputs and
+// outputs of a transaction to create is unknown.
+var ErrUnknownOrdering = errors.New("unknown ordering")
+
+// ErrInvalidDustChangePolicy is returned when the dust change policy of a
+// transaction to create is unknown, or requires a change output that the
+// transaction never has.
+var ErrInvalidDustChangePolicy = errors.New("invalid dust change policy")
+
+// ErrInvalidSizePadding is returned when the size padding of a transaction
+// to create is out of range.
+var ErrInvalidSizePadding = errors.New("size padding out of range")
+
+// ErrLengthMismatch is returned when the utxos, keys or signatures of a
+// transaction are not as many as its inputs.
+var ErrLengthMismatch = errors.New("length mismatch with the inputs")
+
+// ErrNoOutputs is returned when a transaction to create has neither
+// outputs nor change output.
+var ErrNoOutputs = errors.New("transaction has no outputs")
+
+// ErrDustOutput is returned when the value of an output of a transaction to
+// create is below the dust threshold of its script.
+var ErrDustOutput = errors.New("output value below dust threshold")
+
+// ErrOutputValueTooHigh is returned when the value of an output of a
+// transaction to create is above the maximum value allowed.
+var ErrOutputValueTooHigh = errors.New("output value above maximum")
+
+// ErrFeeRateTooHigh is returned when the fee rate of a transaction to create
+// is above the maximum fee rate allowed.
+var ErrFeeRateTooHigh = errors.New("fee rate above maximum")
+
+// ErrFeeRateTooLow is returned when the fee rate of a transaction to create
+// is below the minimum relay fee rate, so that nodes would not relay it.
+var ErrFeeRateTooLow = errors.New("fee rate below minimum relay fee rate")
+
+// ErrInsufficientFunds is returned when the inputs of a transaction are not
+// enough to pay for its outputs and fees. Use errors.As to retrieve the
+// missing amount.
+type ErrInsufficientFunds struct {
+	MissingAmount int64
+}
+
+func (e *ErrInsufficientFunds) Error() string {
+	return fmt.Sprintf("insufficient funds: missing %d satoshis", e.MissingAmount)
+}
+
+// ErrInvalidAddress is returned when an output or change address of a
+// transaction to create cannot be decoded. Its cause is the decoding error,
+// such as ErrMwebAddress or ErrBech32Variant, or an error of btcutil, e.g.
+// for a mistyped address. Use errors.As to retrieve the address.
+type ErrInvalidAddress struct {
+	Address string
+	Err     error
+}
+
+func (e *ErrInvalidAddress) Error() string {
+	return fmt.Sprintf("failed to decode address %s: %v", e.Address, e.Err)
+}
+
+// Cause returns the decoding error, for errors.Cause of pkg/errors.
+func (e *ErrInvalidAddress) Cause() error {
+	return e.Err
+}
+
+// Unwrap returns the decoding error, for errors.Is and errors.As.
+func (e *ErrInvalidAddress) Unwrap() error {
+	return e.Err
+}
@@ -0,0 +1,166 @@
+package core
+
+import (
+	"bytes"
+
+	"github.com/btcsuite/btcd/btcutil"
+	"github.com/btcsuite/btcd/txscript"
+	"github.com/btcsuite/btcd/wire"
+	"github.com/ledgerhq/bitcoin-lib-grpc/pkg/chaincfg"
+	"github.com/pkg/errors"
+)
+
+// HardwareSigningInput contains everything a hardware wallet needs to sign
+// an input of a transaction, without access to the transaction itself.
+type HardwareSigningInput struct {
+	// Derivation is the derivation path of the key locking the utxo, as
+	// given in the Utxo.
+	Derivation []uint32
+
+	// Value and Script are the amount and the output script of the utxo.
+	Value  int64
+	Script []byte
+
+	// Address is the address of the utxo, and AddrEncoding is its type.
+	Address      string
+	AddrEncoding AddressEncoding
+
+	// SigHashType is the signature hash type of the signature to produce,
+	// i.e. SIGHASH_DEFAULT for P2TR inputs, and SIGHASH_ALL otherwise.
+	SigHashType txscript.SigHashType
+
+	// SigHash is the 32-byte message to sign.
+	SigHash []byte
+}
+
+// PrepareForHardwareSigning computes, for each input of a transaction, the
+// payload to send to a hardware wallet in order to sign it.
+//
+// Utxos are matched to inputs by position. The signature hashes are the
+// ones signed by GenerateDerSignatures, i.e. computed with the legacy
+// algorithm for P2PKH utxos, the BIP0341 algorithm for P2TR utxos, of a
+// script-path spend if the utxo has a tap leaf script, and the BIP0143
+// algorithm otherwise.
+//
+// P2SH utxos must carry their redeem script, the P2WPKH witness program
+// used as the BIP0143 scriptCode, or ErrInvalidRedeemScript is returned.
+func (s *Service) PrepareForHardwareSigning(
+	msgTx *wire.MsgTx, utxos []Utxo, chainParams chaincfg.ChainParams,
+) ([]HardwareSigningInput, error) {
+	// Validation
+	if len(msgTx.TxIn) != len(utxos) {
+		return nil, errors.Wrap(ErrLengthMismatch, "inputs length != utxos length")
+	}
+
+	// Build sig hashes
+	prevOuts, err := newPrevOutFetcher(msgTx, utxos)
+	if err != nil {
+		return nil, err
+	}
+
+	sigHashes := txscript.NewTxSigHashes(msgTx, prevOuts)
+
+	inputs := make([]HardwareSigningInput, len(msgTx.TxIn))
+
+	for idx, utxo := range utxos {
+		if err := checkPreviousTx(msgTx.TxIn[idx], utxo); err != nil {
+			return nil, errors.Wrapf(err, "invalid previous tx for input %d", idx)
+		}
+
+		encoding, err := addressEncodingFromScript(utxo.Script)
+		if err != nil {
+			return nil, errors.Wrapf(err, "invalid utxo for input %d", idx)
+		}
+
+		address, err := addressFromScript(utxo.Script, chainParams)
+		if err != nil {
+			return nil, errors.Wrapf(err, "invalid utxo for input %d", idx)
+		}
+
+		var (
+			sigHashType = txscript.SigHashAll
+			sigHash     []byte
+		)
+
+		switch encoding {
+		case Taproot:
+			sigHashType = txscript.SigHashDefault
+			if len(utxo.TapLeafScript) > 0 {
+				sigHash, err = txscript.CalcTapscriptSignaturehash(sigHashes, sigHashType,
+					msgTx, idx, prevOuts, txscript.NewBaseTapLeaf(utxo.TapLeafScript))
+			} else {
+				sigHash, err = txscript.CalcTaprootSignatureHash(
+					sigHashes, sigHashType, msgTx, idx, prevOuts)
+			}
+		case Legacy:
+			sigHash, err = txscript.CalcSignatureHash(utxo.Script, sigHashType, msgTx, idx)
+		case WrappedSegwit:
+			if err := checkRedeemScript(utxo); err != nil {
+				return nil, errors.Wrapf(err, "invalid utxo for input %d", idx)
+			}
+
+			sigHash, err = txscript.CalcWitnessSigHash(
+				utxo.RedeemScript, sigHashes, sigHashType, msgTx, idx, utxo.Value)
+		default:
+			sigHash, err = txscript.CalcWitnessSigHash(
+				utxo.Script, sigHashes, sigHashType, msgTx, idx, utxo.Value)
+		}
+
+		if err != nil {
+			return nil, errors.Wrapf(err,
+				"failed to compute signature hash for input %d", idx)
+		}
+
+		inputs[idx] = HardwareSigningInput{
+			Derivation:   utxo.Derivation,
+			Value:        utxo.Value,
+			Script:       utxo.Script,
+			Address:      address.EncodeAddress(),
+			AddrEncoding: encoding,
+			SigHashType:  sigHashType,
+			SigHash:      sigHash,
+		}
+	}
+
+	return inputs, nil
+}
+
+// checkRedeemScript returns an error wrapping ErrInvalidRedeemScript if the
+// redeem script of a P2SH utxo is not a P2WPKH witness program hashing to
+// the script hash of the utxo.
+func checkRedeemScript(utxo Utxo) error {
+	if len(utxo.RedeemScript) == 0 {
+		return errors.Wrap(ErrInvalidRedeemScript,
+			"the redeem script of a P2SH utxo is required")
+	}
+
+	if !txscript.IsPayToWitnessPubKeyHash(utxo.RedeemScript) {
+		return errors.Wrapf(ErrInvalidRedeemScript,
+			"redeem script %x is not a P2WPKH witness program", utxo.RedeemScript)
+	}
+
+	// The script hash is pushed after OP_HASH160.
+	if !bytes.Equal(btcutil.Hash160(utxo.RedeemScript), utxo.Script[2:22]) {
+		return errors.Wrapf(ErrInvalidRedeemScript,
+			"redeem script %x does not match script %x", utxo.RedeemScript, utxo.Script)
+	}
+
+	return nil
+}
+
+// addressFromScript returns the address an output script pays to, encoded
+// for the network of the given chain parameters.
+func addressFromScript(script []byte, chainParams chaincfg.ChainParams) (btcutil.Address, error) {
+	_, addresses, _, err := txscript.ExtractPkScriptAddrs(script, chainParams)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to extract address from script %x",
+			script)
+	}
+
+	if len(addresses) != 1 {
+		return nil, errors.Wrapf(ErrUnknownAddressType,
+			"no single address in script %x", script)
+	}
+
+	return addresses[0], nil
+}
@@ -0,0 +1,164 @@
+package core
+
+import (
+	"testing"
+
+	"github.com/btcsuite/btcd/btcec/v2"
+	"github.com/btcsuite/btcd/btcec/v2/ecdsa"
+	"github.com/btcsuite/btcd/btcec/v2/schnorr"
+	"github.com/btcsuite/btcd/btcutil"
+	"github.com/btcsuite/btcd/txscript"
+	"github.com/btcsuite/btcd/wire"
+	"github.com/ledgerhq/bitcoin-lib-grpc/pkg/chaincfg"
+	"github.com/pkg/errors"
+)
+
+func TestPrepareForHardwareSigning(t *testing.T) {
+	// BIP0032: Test Vector 1 (chain m)
+	privKey := "xprv9s21ZrQH143K3QTDL4LXw2F7HEK3wJUD2nW2nRk4stbPy6cq3jPPqjiChkVvvNKmPGJxWUtg6LnF5kejMRNNU3TGtRBeJgk33yuGBxrMPHi"
+
+	s := &Service{}
+
+	// Helper to derive the public key, the address and the output script
+	// of an input, for the given address encoding.
+	getInputKey := func(derivation []uint32, encoding AddressEncoding) (*btcec.PublicKey, string, []byte) {
+		keyMaterial, err := s.DerivePrivateKey(privKey, derivation)
+		if err != nil {
+			panic(err)
+		}
+
+		pubKey, err := btcec.ParsePubKey(keyMaterial.PublicKey)
+		if err != nil {
+			panic(err)
+		}
+
+		address, err := addressFromPublicKey(pubKey, encoding, chaincfg.BitcoinMainNetParams)
+		if err != nil {
+			panic(err)
+		}
+
+		script, err := txscript.NewScriptBuilder().
+			AddOp(txscript.OP_1).AddData(address.ScriptAddress()).Script()
+		if encoding != Taproot {
+			script, err = txscript.PayToAddrScript(address)
+		}
+		if err != nil {
+			panic(err)
+		}
+
+		return pubKey, address.EncodeAddress(), script
+	}
+
+	pubKey0, address0, script0 := getInputKey([]uint32{0}, Legacy)
+	pubKey1, address1, script1 := getInputKey([]uint32{1}, NativeSegwit)
+	pubKey2, address2, script2 := getInputKey([]uint32{2}, Taproot)
+	pubKey3, address3, script3 := getInputKey([]uint32{3}, WrappedSegwit)
+
+	// The redeem script of the P2SH-P2WPKH input is its witness program.
+	redeemScript3, err := txscript.NewScriptBuilder().
+		AddOp(txscript.OP_0).AddData(btcutil.Hash160(pubKey3.SerializeCompressed())).Script()
+	if err != nil {
+		t.Fatalf("NewScriptBuilder() got error '%v'", err)
+	}
+
+	msgTx := wire.NewMsgTx(wire.TxVersion)
+	for idx := uint32(0); idx < 4; idx++ {
+		msgTx.AddTxIn(wire.NewTxIn(
+			wire.NewOutPoint(btcutil.NewTx(wire.NewMsgTx(1)).Hash(), idx),
+			nil,
+			nil,
+		))
+	}
+	msgTx.AddTxOut(wire.NewTxOut(250000, script1))
+
+	utxos := []Utxo{
+		{Script: script0, Value: 100000, Derivation: []uint32{0}},
+		{Script: script1, Value: 90000, Derivation: []uint32{1}},
+		{Script: script2, Value: 80000, Derivation: []uint32{2}},
+		{Script: script3, Value: 70000, Derivation: []uint32{3}, RedeemScript: redeemScript3},
+	}
+
+	got, err := s.PrepareForHardwareSigning(msgTx, utxos, chaincfg.BitcoinMainNetParams)
+	if err != nil {
+		t.Fatalf("PrepareForHardwareSigning() got error '%v'", err)
+	}
+
+	want := []struct {
+		address     string
+		encoding    AddressEncoding
+		sigHashType txscript.SigHashType
+	}{
+		{address: address0, encoding: Legacy, sigHashType: txscript.SigHashAll},
+		{address: address1, encoding: NativeSegwit, sigHashType: txscript.SigHashAll},
+		{address: address2, encoding: Taproot, sigHashType: txscript.SigHashDefault},
+		{address: address3, encoding: WrappedSegwit, sigHashType: txscript.SigHashAll},
+	}
+
+	for idx, input := range got {
+		if input.Address != want[idx].address || input.AddrEncoding != want[idx].encoding ||
+			input.SigHashType != want[idx].sigHashType || input.Value != utxos[idx].Value {
+			t.Fatalf("PrepareForHardwareSigning() got input %d '%+v', want '%+v'",
+				idx, input, want[idx])
+		}
+
+		if len(input.SigHash) != 32 {
+			t.Fatalf("PrepareForHardwareSigning() got sighash %x, want 32 bytes",
+				input.SigHash)
+		}
+	}
+
+	// The signature hashes must be the ones signed by GenerateDerSignatures.
+	derSignatures, err := s.GenerateDerSignatures(msgTx, utxos, privKey, false)
+	if err != nil {
+		t.Fatalf("GenerateDerSignatures() got error '%v'", err)
+	}
+
+	for idx, pubKey := range []*btcec.PublicKey{pubKey0, pubKey1, nil, pubKey3} {
+		if pubKey == nil {
+			continue
+		}
+
+		derSig := derSignatures[idx]
+		sig, err := ecdsa.ParseDERSignature(derSig[:len(derSig)-1])
+		if err != nil {
+			t.Fatalf("ParseDERSignature() got error '%v'", err)
+		}
+
+		if !sig.Verify(got[idx].SigHash, pubKey) {
+			t.Fatalf("PrepareForHardwareSigning() got sighash %x for input %d, "+
+				"not signed by GenerateDerSignatures()", got[idx].SigHash, idx)
+		}
+	}
+
+	schnorrSig, err := schnorr.ParseSignature(derSignatures[2])
+	if err != nil {
+		t.Fatalf("ParseSignature() got error '%v'", err)
+	}
+
+	if !schnorrSig.Verify(got[2].SigHash, txscript.ComputeTaprootKeyNoScript(pubKey2)) {
+		t.Fatalf("PrepareForHardwareSigning() got sighash %x for input 2, "+
+			"not signed by GenerateDerSignatures()", got[2].SigHash)
+	}
+
+	// Unsupported utxo scripts are rejected.
+	_, err = s.PrepareForHardwareSigning(msgTx, []Utxo{
+		utxos[0], utxos[1], {Script: []byte{txscript.OP_TRUE}, Value: 80000}, utxos[3],
+	}, chaincfg.BitcoinMainNetParams)
+	if errors.Cause(err) != ErrUnknownAddressType {
+		t.Fatalf("PrepareForHardwareSigning() got error '%v', want '%v'",
+			err, ErrUnknownAddressType)
+	}
+
+	// P2SH utxos without their redeem script, or with the redeem script of
+	// another key, are rejected.
+	for _, redeemScript := range [][]byte{nil, script1} {
+		_, err = s.PrepareForHardwareSigning(msgTx, []Utxo{
+			utxos[0], utxos[1], utxos[2],
+			{Script: script3, Value: 70000, Derivation: []uint32{3}, RedeemScript: redeemScript},
+		}, chaincfg.BitcoinMainNetParams)
+		if errors.Cause(err) != ErrInvalidRedeemScript {
+			t.Fatalf("PrepareForHardwareSigning() got error '%v', want '%v'",
+				err, ErrInvalidRedeemScript)
+		}
+	}
+}
@@ -1,11 +1,15 @@
 package core
 
 import (
+	"bytes"
+	"context"
+	"encoding/binary"
 	"encoding/hex"
 
-	"github.com/btcsuite/btcd/btcec"
-	"github.com/btcsuite/btcutil"
-	"github.com/btcsuite/btcutil/hdkeychain"
+	"github.com/btcsuite/btcd/btcutil"
+	"github.com/btcsuite/btcd/btcutil/base58"
+	"github.com/btcsuite/btcd/btcutil/hdkeychain"
+	"github.com/btcsuite/btcd/wire"
 	"github.com/ledgerhq/bitcoin-lib-grpc/pkg/chaincfg"
 	"github.com/pkg/errors"
 )
@@ -18,6 +22,15 @@ type PublicKeyMaterial struct {
 	ChainCode   []byte
 }
 
+// PrivateKeyMaterial contains an extended private key, and the corresponding
+// private key, public key and chain code.
+type PrivateKeyMaterial struct {
+	ExtendedKey string
+	PrivateKey  []byte
+	PublicKey   []byte
+	ChainCode   []byte
+}
+
 // Keypair contains en extended public key and the corresponding private key
 type Keypair struct {
 	ExtendedPublicKey string
@@ -39,35 +52,58 @@ type Keypair struct {
 // The derivation is agnostic of chain parameters. Derived extended keys
 // are associated to the same network as the parent extended key.
 //
+// Child indexes are raw BIP0032 indexes: any index >= 0x80000000 has the
+// harden bit set, e.g. 2147483648 is 0'. Hardened indexes cannot be derived
+// from an extended public key, and are rejected with ErrDeriveHardFromPublic,
+// reporting the offending index in both notations, and its position in the
+// derivation path.
+//
+// The derivation stops with the error of ctx, wrapped, as soon as ctx is
+// done, which allows callers to bound the time spent on long paths.
+//
 // The method's response includes the following fields:
 //     ExtendedKey: extended key as a human-readable base58-encoded string.
 //     PublicKey:   33-byte compressed public key of the derived extended key.
 //     ChainCode:   32-byte chain code of the derived extended key.
 func (s *Service) DeriveExtendedKey(
-	extendedKey string, derivation []uint32,
+	ctx context.Context, extendedKey string, derivation []uint32,
 ) (PublicKeyMaterial, error) {
 	response := PublicKeyMaterial{}
 
 	xKey, err := hdkeychain.NewKeyFromString(extendedKey)
 	if err != nil {
-		return response, errors.Wrapf(err, "failed to decode xkey %s",
-			extendedKey)
+		return response, errors.Wrap(err, "failed to decode xkey")
+	}
+
+	// Reject hardened indexes up front, before deriving any level, so that
+	// the error names the offending index and its position in the path.
+	if !xKey.IsPrivate() {
+		for position, childIndex := range derivation {
+			if err := checkPublicDerivationIndex(childIndex); err != nil {
+				return response, errors.Wrapf(err,
+					"cannot derive hardened index %d at path position %d from a public key",
+					childIndex, position)
+			}
+		}
 	}
 
 	// Derive len(request.Derivation) HD levels, starting from extendedKey
 	// as the parent node.
 	for _, childIndex := range derivation {
+		if err := ctx.Err(); err != nil {
+			return response, errors.Wrap(err, "derivation of xkey interrupted")
+		}
+
 		xKey, err = xKey.Derive(childIndex)
 		if err != nil {
-			return response, errors.Wrapf(err, "failed to derive xkey %s at index %d",
-				extendedKey, childIndex)
+			return response, errors.Wrapf(err, "failed to derive xkey at index %d",
+				childIndex)
 		}
 	}
 
 	pubKey, err := xKey.ECPubKey()
 	if err != nil {
-		return response, errors.Wrapf(err, "failed to get public key from xkey %s",
-			extendedKey)
+		return response, errors.Wrap(err, "failed to get public key from xkey")
 	}
 
 	response.ExtendedKey = xKey.String()
@@ -76,23 +112,164 @@ func (s *Service) DeriveExtendedKey(
 	return response, nil
 }
 
+// KeyWithAddresses contains a derived public key, its HASH160, and the
+// addresses of the public key for each single-key address encoding.
+type KeyWithAddresses struct {
+	PublicKey            []byte
+	Hash160              []byte
+	LegacyAddress        string
+	WrappedSegwitAddress string
+	NativeSegwitAddress  string
+}
+
+// DeriveKeyWithAddresses derives an extended key like DeriveExtendedKey,
+// and returns the compressed public key of the derived key, its HASH160,
+// and its P2PKH, P2SH-P2WPKH and P2WPKH addresses, to avoid one
+// EncodeAddress call per encoding when scanning a wallet.
+//
+// Extended keys of a network other than the one of the chain parameters
+// are rejected with ErrNetworkMismatch, like in DeriveAddresses.
+func (s *Service) DeriveKeyWithAddresses(
+	ctx context.Context,
+	extendedKey string,
+	derivation []uint32,
+	chainParams chaincfg.ChainParams,
+) (*KeyWithAddresses, error) {
+	xKey, err := hdkeychain.NewKeyFromString(extendedKey)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to decode xkey")
+	}
+
+	if err := checkExtendedKeyNetwork(xKey, chainParams); err != nil {
+		return nil, err
+	}
+
+	derived, err := s.DeriveExtendedKey(ctx, extendedKey, derivation)
+	if err != nil {
+		return nil, err
+	}
+
+	legacyAddress, err := s.EncodeAddress(derived.PublicKey, Legacy, true, chainParams)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to encode %s address", Legacy)
+	}
+
+	wrappedSegwitAddress, err := s.EncodeAddress(
+		derived.PublicKey, WrappedSegwit, true, chainParams)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to encode %s address", WrappedSegwit)
+	}
+
+	nativeSegwitAddress, err := s.EncodeAddress(
+		derived.PublicKey, NativeSegwit, true, chainParams)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to encode %s address", NativeSegwit)
+	}
+
+	return &KeyWithAddresses{
+		PublicKey:            derived.PublicKey,
+		Hash160:              btcutil.Hash160(derived.PublicKey),
+		LegacyAddress:        legacyAddress,
+		WrappedSegwitAddress: wrappedSegwitAddress,
+		NativeSegwitAddress:  nativeSegwitAddress,
+	}, nil
+}
+
+// checkPublicDerivationIndex returns ErrDeriveHardFromPublic if the child
+// index has the BIP0032 harden bit set. The error describes the index as a
+// hardened index, since callers often pass 0x80000000 + i meaning i', or a
+// raw value at the boundary by mistake.
+func checkPublicDerivationIndex(childIndex uint32) error {
+	if childIndex < hdkeychain.HardenedKeyStart {
+		return nil
+	}
+
+	return errors.Wrapf(ErrDeriveHardFromPublic,
+		"index %d is the hardened index %d' (>= 0x%x), and public derivation "+
+			"only accepts indexes below 0x%x", childIndex,
+		childIndex-hdkeychain.HardenedKeyStart, hdkeychain.HardenedKeyStart,
+		hdkeychain.HardenedKeyStart)
+}
+
+// DerivePrivateKey is the private counterpart of DeriveExtendedKey. It
+// derives a child extended private key from a parent extended private key,
+// according to BIP0032 derivation rules.
+//
+// Unlike DeriveExtendedKey, both hardened and non-hardened child indexes are
+// allowed in the derivation path. Extended public keys are rejected with
+// ErrNotPrivateExtendedKey.
+//
+// The method's response includes the following fields:
+//     ExtendedKey: extended private key as a base58-encoded string.
+//     PrivateKey:  32-byte raw private key of the derived extended key.
+//     PublicKey:   33-byte compressed public key of the derived extended key.
+//     ChainCode:   32-byte chain code of the derived extended key.
+func (s *Service) DerivePrivateKey(
+	extendedKey string, derivation []uint32,
+) (PrivateKeyMaterial, error) {
+	response := PrivateKeyMaterial{}
+
+	xKey, err := hdkeychain.NewKeyFromString(extendedKey)
+	if err != nil {
+		return response, errors.Wrap(err, "failed to decode xkey")
+	}
+
+	if !xKey.IsPrivate() {
+		return response, errors.Wrapf(ErrNotPrivateExtendedKey,
+			"cannot derive private key from xkey %s", extendedKey)
+	}
+
+	for _, childIndex := range derivation {
+		xKey, err = xKey.Derive(childIndex)
+		if err != nil {
+			return response, errors.Wrapf(err, "failed to derive xkey at index %d",
+				childIndex)
+		}
+	}
+
+	privKey, err := xKey.ECPrivKey()
+	if err != nil {
+		return response, errors.Wrap(err, "failed to get private key from xkey")
+	}
+
+	response.ExtendedKey = xKey.String()
+	response.PrivateKey = privKey.Serialize()
+	response.PublicKey = privKey.PubKey().SerializeCompressed()
+	response.ChainCode = xKey.ChainCode()
+	return response, nil
+}
+
 // GetAccountExtendedKey returns the serialized extended key from public key
 // material, and various parameters. This is typically provided by the HSM.
 //
-// Certain assumptions have been made for the parent fingerprint. Please read
-// the corresponding note in the code.
+// parentPublicKey is the optional public key of the parent extended key, at
+// BIP32 level 2, used to compute the parent fingerprint. Certain assumptions
+// are made when it is not provided. Please read the corresponding note in
+// the code.
 //
 // accountIndex must NOT add the BIP32 harden bit. The account MUST have
 // been derived using the following scheme:
 //   m / purpose' / coin_type' / account'
 //
 // It also implies that accountIndex is at BIP32 level 3.
+//
+// The extended key is serialized with the SLIP-0132 HD version bytes of the
+// given address encoding, e.g. xpub for Legacy, or Mtub for WrappedSegwit on
+// the Litecoin main network. The public key material carries no network, so
+// the chain parameters MUST be those of the network the account belongs to.
 func (s *Service) GetAccountExtendedKey(
 	publicKey []byte,
 	chainCode []byte,
 	accountIndex uint32,
+	parentPublicKey []byte,
+	encoding AddressEncoding,
 	chainParams chaincfg.ChainParams,
 ) (string, error) {
+	version, err := hdPublicKeyID(encoding, chainParams)
+	if err != nil {
+		return "", err
+	}
+
 	// Load the serialized public key to a btcec.PublicKey type, in order to
 	// ensure that the:
 	//   * public point is on the secp256k1 elliptic curve.
@@ -101,7 +278,7 @@ func (s *Service) GetAccountExtendedKey(
 	//   * public key used for serializing the extended key is compressed.
 	//
 	// Both compressed and uncompressed public keys are accepted.
-	loadedPublicKey, err := btcec.ParsePubKey(publicKey, btcec.S256())
+	loadedPublicKey, err := parsePublicKey(publicKey)
 	if err != nil {
 		return "", errors.Wrapf(err, "failed to parse public key %s",
 			hex.EncodeToString(publicKey))
@@ -114,13 +291,24 @@ func (s *Service) GetAccountExtendedKey(
 	// The fingerprint of the parent for the derived child is the first 4
 	// bytes of the RIPEMD160(SHA256(parentPubKey)).
 	//
-	// Caution: The HSM does NOT provide the parent fingerprint, so we use
-	// the fingerprint of the child (BIP32 depth 3). While this is incorrect,
-	// the fingerprint has no impact on the derived addresses.
+	// Caution: The HSM does NOT provide the parent fingerprint, so unless
+	// the caller provides the parent public key, we use the fingerprint of
+	// the child (BIP32 depth 3). While this is incorrect, the fingerprint
+	// has no impact on the derived addresses.
 	parentFP := btcutil.Hash160(serializedPublicKey)[:4]
 
+	if len(parentPublicKey) > 0 {
+		loadedParentPublicKey, err := parsePublicKey(parentPublicKey)
+		if err != nil {
+			return "", errors.Wrapf(err, "failed to parse parent public key %s",
+				hex.EncodeToString(parentPublicKey))
+		}
+
+		parentFP = btcutil.Hash160(loadedParentPublicKey.SerializeCompressed())[:4]
+	}
+
 	key := hdkeychain.NewExtendedKey(
-		chainParams.HDPublicKeyID[:],
+		version[:],
 		serializedPublicKey,
 		chainCode,
 		parentFP,
@@ -134,7 +322,19 @@ func (s *Service) GetAccountExtendedKey(
 
 // Useful service to get keypair (xpub + privKey) from a seed for testing.
 // Random seed is generated if no seed is provided.
-func (s *Service) GetKeypair(seed string, chainParams chaincfg.ChainParams, derivation []uint32) (Keypair, error) {
+//
+// If xpubOnly is set, the PrivateKey field of the keypair is left empty.
+//
+// The seed buffer, and the private keys of the master and intermediate
+// nodes, are zeroed before returning. The derivation stops with the error
+// of ctx, wrapped, as soon as ctx is done.
+func (s *Service) GetKeypair(
+	ctx context.Context,
+	seed string,
+	chainParams chaincfg.ChainParams,
+	derivation []uint32,
+	xpubOnly bool,
+) (Keypair, error) {
 	var (
 		seedBytes []byte
 		response  Keypair
@@ -153,19 +353,181 @@ func (s *Service) GetKeypair(seed string, chainParams chaincfg.ChainParams, deri
 		seedBytes = []byte(seed)
 	}
 
+	defer zeroBytes(seedBytes)
+
+	// BIP0032 requires the seed to be between 128 and 512 bits. Validate it
+	// here, to report a clear error rather than hdkeychain.ErrInvalidSeedLen.
+	if len(seedBytes) < hdkeychain.MinSeedBytes || len(seedBytes) > hdkeychain.MaxSeedBytes {
+		return response, errors.Wrapf(ErrInvalidSeedLength,
+			"seed is %d bytes long", len(seedBytes))
+	}
+
+	return keypairFromSeed(ctx, seedBytes, chainParams, derivation, xpubOnly)
+}
+
+// GetAccountXpubFromSeed returns the extended public key of an account,
+// derived from a hex-encoded BIP0032 seed, such as the seed of a BIP0039
+// mnemonic, along the hardened path:
+//   m / purpose' / coin_type' / account'
+//
+// purpose, coinType and account must NOT add the BIP32 harden bit, e.g.
+// 84, 0, 0 for the first BIP0084 account of the Bitcoin main network.
+//
+// The extended key is serialized with the SLIP-0132 HD version bytes of the
+// given address encoding, i.e. xpub for Legacy, ypub for WrappedSegwit, and
+// zpub for NativeSegwit on the Bitcoin main network.
+//
+// The decoded seed, and the private keys of the master node and of every
+// derived node, are zeroed before returning.
+func (s *Service) GetAccountXpubFromSeed(
+	seed string,
+	purpose uint32,
+	coinType uint32,
+	account uint32,
+	chainParams chaincfg.ChainParams,
+	encoding AddressEncoding,
+) (string, error) {
+	seedBytes, err := hex.DecodeString(seed)
+	if err != nil {
+		return "", errors.Wrap(err, "failed to decode seed hex")
+	}
+
+	defer zeroBytes(seedBytes)
+
+	if len(seedBytes) < hdkeychain.MinSeedBytes || len(seedBytes) > hdkeychain.MaxSeedBytes {
+		return "", errors.Wrapf(ErrInvalidSeedLength,
+			"seed is %d bytes long", len(seedBytes))
+	}
+
+	for _, index := range []uint32{purpose, coinType, account} {
+		if index >= hdkeychain.HardenedKeyStart {
+			return "", errors.Errorf(
+				"index %d must not include the harden bit", index)
+		}
+	}
+
+	version, err := hdPublicKeyID(encoding, chainParams)
+	if err != nil {
+		return "", err
+	}
+
+	key, err := hdkeychain.NewMaster(seedBytes, chainParams)
+	if err != nil {
+		return "", errors.Wrap(err, "failed to generate master key")
+	}
+
+	// The key is replaced at each derivation level, so that the deferred
+	// function zeroes the private key of the account.
+	defer func() { key.Zero() }()
+
+	for _, index := range []uint32{purpose, coinType, account} {
+		childKey, err := key.Derive(index + hdkeychain.HardenedKeyStart)
+		if err != nil {
+			return "", errors.Wrapf(err, "failed to derive account key at index %d'",
+				index)
+		}
+
+		key.Zero()
+		key = childKey
+	}
+
+	accountKey, err := key.Neuter()
+	if err != nil {
+		return "", errors.Wrap(err, "failed to get account extended public key")
+	}
+
+	accountKey, err = accountKey.CloneWithVersion(version[:])
+	if err != nil {
+		return "", errors.Wrap(err, "failed to set account key version")
+	}
+
+	return accountKey.String(), nil
+}
+
+// MasterFingerprint returns the fingerprint of the BIP0032 master key of a
+// hex-encoded seed, i.e. the first 4 bytes of the HASH160 of its compressed
+// public key, as used in the key origins of descriptors and PSBTs. The
+// master key itself is never returned.
+func (s *Service) MasterFingerprint(
+	seed string, chainParams chaincfg.ChainParams,
+) ([4]byte, error) {
+	seedBytes, err := hex.DecodeString(seed)
+	if err != nil {
+		return [4]byte{}, errors.Wrap(err, "failed to decode seed hex")
+	}
+
+	defer zeroBytes(seedBytes)
+
+	if len(seedBytes) < hdkeychain.MinSeedBytes || len(seedBytes) > hdkeychain.MaxSeedBytes {
+		return [4]byte{}, errors.Wrapf(ErrInvalidSeedLength,
+			"seed is %d bytes long", len(seedBytes))
+	}
+
+	return masterFingerprint(seedBytes, chainParams)
+}
+
+// masterFingerprint returns the fingerprint of the master key of a seed,
+// zeroing the private key of the master key before returning.
+func masterFingerprint(seedBytes []byte, chainParams chaincfg.ChainParams) ([4]byte, error) {
+	var fingerprint [4]byte
+
+	masterKey, err := hdkeychain.NewMaster(seedBytes, chainParams)
+	if err != nil {
+		return fingerprint, errors.Wrap(err, "failed to generate master key")
+	}
+
+	defer masterKey.Zero()
+
+	publicKey, err := masterKey.ECPubKey()
+	if err != nil {
+		return fingerprint, errors.Wrap(err, "failed to get master public key")
+	}
+
+	copy(fingerprint[:], btcutil.Hash160(publicKey.SerializeCompressed()))
+
+	return fingerprint, nil
+}
+
+// keypairFromSeed generates the master node of a seed, and returns the
+// keypair of the extended key derived from it at the given derivation path.
+// If xpubOnly is set, the PrivateKey field of the keypair is left empty.
+//
+// The private keys of the master node and of every derived node are zeroed
+// before returning, although the serialized private key, if returned, is
+// an immutable string that cannot be.
+func keypairFromSeed(
+	ctx context.Context,
+	seedBytes []byte,
+	chainParams chaincfg.ChainParams,
+	derivation []uint32,
+	xpubOnly bool,
+) (Keypair, error) {
+	var response Keypair
+
 	// Generate a new master node using the seed.
 	extendedKey, err := hdkeychain.NewMaster(seedBytes, chainParams)
 	if err != nil {
 		return response, err
 	}
 
+	// The key is replaced at each derivation level, so that the deferred
+	// function zeroes the last one.
+	defer func() { extendedKey.Zero() }()
+
 	// Derive the extended key for given derivation path
 	for _, childIndex := range derivation {
-		extendedKey, err = extendedKey.Derive(childIndex)
+		if err := ctx.Err(); err != nil {
+			return response, errors.Wrap(err, "derivation of keypair interrupted")
+		}
+
+		childKey, err := extendedKey.Derive(childIndex)
 		if err != nil {
-			return response, errors.Wrapf(err, "failed to derive extendedKey %s at index %d",
-				extendedKey, childIndex)
+			return response, errors.Wrapf(err, "failed to derive extended key at index %d",
+				childIndex)
 		}
+
+		extendedKey.Zero()
+		extendedKey = childKey
 	}
 
 	// Get the human readable extended public key
@@ -175,7 +537,337 @@ func (s *Service) GetKeypair(seed string, chainParams chaincfg.ChainParams, deri
 	}
 
 	response.ExtendedPublicKey = accountExtendedPublicKey.String()
-	response.PrivateKey = extendedKey.String()
+
+	if !xpubOnly {
+		response.PrivateKey = extendedKey.String()
+	}
 
 	return response, nil
 }
+
+// zeroBytes overwrites a buffer holding sensitive data, such as a seed,
+// with zeros.
+func zeroBytes(b []byte) {
+	for idx := range b {
+		b[idx] = 0
+	}
+}
+
+// hdVersion holds the HD version bytes of extended public and private keys.
+type hdVersion struct {
+	public  [4]byte
+	private [4]byte
+}
+
+// slip132Versions maps the magic number of a network to the HD version
+// bytes of extended keys, for each segwit address encoding.
+//
+// The version bytes for the Legacy encoding are those of the chain
+// parameters.
+//
+// Litecoin has no registered version bytes for P2WPKH keys, nor for segwit
+// keys of its test networks, so the Bitcoin ones are used, as done by
+// Electrum-LTC.
+//
+// References:
+//   [SLIP-0132]: Registered HD version bytes for BIP-0032
+//   https://github.com/satoshilabs/slips/blob/master/slip-0132.md
+var slip132Versions = map[wire.BitcoinNet]map[AddressEncoding]hdVersion{
+	chaincfg.BitcoinMainNetParams.Net: {
+		WrappedSegwit: {
+			public:  [4]byte{0x04, 0x9d, 0x7c, 0xb2}, // ypub
+			private: [4]byte{0x04, 0x9d, 0x78, 0x78}, // yprv
+		},
+		NativeSegwit: {
+			public:  [4]byte{0x04, 0xb2, 0x47, 0x46}, // zpub
+			private: [4]byte{0x04, 0xb2, 0x43, 0x0c}, // zprv
+		},
+	},
+	chaincfg.BitcoinTestNet3Params.Net: {
+		WrappedSegwit: {
+			public:  [4]byte{0x04, 0x4a, 0x52, 0x62}, // upub
+			private: [4]byte{0x04, 0x4a, 0x4e, 0x28}, // uprv
+		},
+		NativeSegwit: {
+			public:  [4]byte{0x04, 0x5f, 0x1c, 0xf6}, // vpub
+			private: [4]byte{0x04, 0x5f, 0x18, 0xbc}, // vprv
+		},
+	},
+	chaincfg.BitcoinTestNet4Params.Net: {
+		WrappedSegwit: {
+			public:  [4]byte{0x04, 0x4a, 0x52, 0x62}, // upub
+			private: [4]byte{0x04, 0x4a, 0x4e, 0x28}, // uprv
+		},
+		NativeSegwit: {
+			public:  [4]byte{0x04, 0x5f, 0x1c, 0xf6}, // vpub
+			private: [4]byte{0x04, 0x5f, 0x18, 0xbc}, // vprv
+		},
+	},
+	chaincfg.BitcoinRegressionNetParams.Net: {
+		WrappedSegwit: {
+			public:  [4]byte{0x04, 0x4a, 0x52, 0x62}, // upub
+			private: [4]byte{0x04, 0x4a, 0x4e, 0x28}, // uprv
+		},
+		NativeSegwit: {
+			public:  [4]byte{0x04, 0x5f, 0x1c, 0xf6}, // vpub
+			private: [4]byte{0x04, 0x5f, 0x18, 0xbc}, // vprv
+		},
+	},
+	chaincfg.LitecoinMainNetParams.Net: {
+		WrappedSegwit: {
+			public:  [4]byte{0x01, 0xb2, 0x6e, 0xf6}, // Mtub
+			private: [4]byte{0x01, 0xb2, 0x67, 0x92}, // Mtpv
+		},
+		NativeSegwit: {
+			public:  [4]byte{0x04, 0xb2, 0x47, 0x46}, // zpub
+			private: [4]byte{0x04, 0xb2, 0x43, 0x0c}, // zprv
+		},
+	},
+	chaincfg.LitecoinTestNet4Params.Net: {
+		WrappedSegwit: {
+			public:  [4]byte{0x04, 0x4a, 0x52, 0x62}, // upub
+			private: [4]byte{0x04, 0x4a, 0x4e, 0x28}, // uprv
+		},
+		NativeSegwit: {
+			public:  [4]byte{0x04, 0x5f, 0x1c, 0xf6}, // vpub
+			private: [4]byte{0x04, 0x5f, 0x18, 0xbc}, // vprv
+		},
+	},
+	chaincfg.LitecoinRegTestParams.Net: {
+		WrappedSegwit: {
+			public:  [4]byte{0x04, 0x4a, 0x52, 0x62}, // upub
+			private: [4]byte{0x04, 0x4a, 0x4e, 0x28}, // uprv
+		},
+		NativeSegwit: {
+			public:  [4]byte{0x04, 0x5f, 0x1c, 0xf6}, // vpub
+			private: [4]byte{0x04, 0x5f, 0x18, 0xbc}, // vprv
+		},
+	},
+}
+
+// legacyHDVersionAliases maps the magic number of a network to the SLIP-0132
+// HD version bytes of P2PKH extended keys, when they differ from those of
+// the chain parameters. Such keys are accepted, but never produced.
+var legacyHDVersionAliases = map[wire.BitcoinNet]hdVersion{
+	chaincfg.LitecoinMainNetParams.Net: {
+		public:  [4]byte{0x01, 0x9d, 0xa4, 0x62}, // Ltub
+		private: [4]byte{0x01, 0x9d, 0x9c, 0xfe}, // Ltpv
+	},
+}
+
+// hdVersions returns the HD version bytes of extended keys for each address
+// encoding of the network of the given chain parameters.
+func hdVersions(chainParams chaincfg.ChainParams) (map[AddressEncoding]hdVersion, error) {
+	segwitVersions, ok := slip132Versions[chainParams.Net]
+	if !ok {
+		return nil, errors.Wrapf(ErrUnknownHDKeyVersion,
+			"no HD version bytes for network %s", chainParams.Name)
+	}
+
+	versions := map[AddressEncoding]hdVersion{
+		Legacy: {
+			public:  chainParams.HDPublicKeyID,
+			private: chainParams.HDPrivateKeyID,
+		},
+	}
+
+	for encoding, version := range segwitVersions {
+		versions[encoding] = version
+	}
+
+	return versions, nil
+}
+
+// hdPublicKeyID returns the HD version bytes of extended public keys for an
+// address encoding. The version bytes for the Legacy encoding are those of
+// the chain parameters, for any network.
+func hdPublicKeyID(encoding AddressEncoding, chainParams chaincfg.ChainParams) ([4]byte, error) {
+	if encoding == Legacy {
+		return chainParams.HDPublicKeyID, nil
+	}
+
+	versions, err := hdVersions(chainParams)
+	if err != nil {
+		return [4]byte{}, err
+	}
+
+	version, ok := versions[encoding]
+	if !ok {
+		return [4]byte{}, errors.Wrapf(ErrUnknownAddressType,
+			"invalid address encoding %d", encoding)
+	}
+
+	return version.public, nil
+}
+
+// checkExtendedKeyNetwork returns ErrNetworkMismatch if the HD version bytes
+// of an extended key are not those of the network of the given chain
+// parameters, for any address encoding, e.g. for a tpub with the Bitcoin
+// main network. Deriving addresses from such a key would silently produce
+// addresses of a network other than the one of the key.
+//
+// Networks sharing the same version bytes, such as the Bitcoin test and
+// regression networks, cannot be told apart.
+func checkExtendedKeyNetwork(key *hdkeychain.ExtendedKey, chainParams chaincfg.ChainParams) error {
+	versions := []hdVersion{{
+		public:  chainParams.HDPublicKeyID,
+		private: chainParams.HDPrivateKeyID,
+	}}
+
+	if alias, ok := legacyHDVersionAliases[chainParams.Net]; ok {
+		versions = append(versions, alias)
+	}
+
+	for _, version := range slip132Versions[chainParams.Net] {
+		versions = append(versions, version)
+	}
+
+	for _, version := range versions {
+		if (key.IsPrivate() && bytes.Equal(key.Version(), version.private[:])) ||
+			(!key.IsPrivate() && bytes.Equal(key.Version(), version.public[:])) {
+			return nil
+		}
+	}
+
+	return errors.Wrapf(ErrNetworkMismatch,
+		"version %x of extended key is not for network %s",
+		key.Version(), chainParams.Name)
+}
+
+// ConvertExtendedKeyVersion re-serializes an extended key with the SLIP-0132
+// HD version bytes matching the target address encoding, i.e. xpub for
+// Legacy, ypub for WrappedSegwit, and zpub for NativeSegwit on the Bitcoin
+// main network. The key data is left unchanged.
+//
+// Both extended public and private keys are accepted. The version bytes of
+// extendedKey must be one of the versions of the network of the given chain
+// parameters.
+func (s *Service) ConvertExtendedKeyVersion(
+	extendedKey string, targetEncoding AddressEncoding, chainParams chaincfg.ChainParams,
+) (string, error) {
+	key, err := hdkeychain.NewKeyFromString(extendedKey)
+	if err != nil {
+		return "", errors.Wrap(err, "failed to decode extended key")
+	}
+
+	versions, err := hdVersions(chainParams)
+	if err != nil {
+		return "", err
+	}
+
+	targetVersion, ok := versions[targetEncoding]
+	if !ok {
+		return "", errors.Wrapf(ErrUnknownAddressType,
+			"invalid address encoding %d", targetEncoding)
+	}
+
+	isKnownVersion := false
+	for _, version := range versions {
+		if (key.IsPrivate() && bytes.Equal(key.Version(), version.private[:])) ||
+			(!key.IsPrivate() && bytes.Equal(key.Version(), version.public[:])) {
+			isKnownVersion = true
+			break
+		}
+	}
+
+	if !isKnownVersion {
+		return "", errors.Wrapf(ErrUnknownHDKeyVersion,
+			"version %x of extended key is not for network %s",
+			key.Version(), chainParams.Name)
+	}
+
+	version := targetVersion.public
+	if key.IsPrivate() {
+		version = targetVersion.private
+	}
+
+	convertedKey, err := key.CloneWithVersion(version[:])
+	if err != nil {
+		return "", errors.Wrap(err, "failed to convert extended key")
+	}
+
+	return convertedKey.String(), nil
+}
+
+// ExtendedKeyInfo is the metadata of an extended key, as returned by
+// InspectExtendedKey.
+type ExtendedKeyInfo struct {
+	// Depth is the BIP0032 depth of the key, 0 for a master key.
+	Depth uint8
+
+	// ChildNumber is the raw BIP0032 index of the key in its parent, with
+	// the harden bit set for hardened keys.
+	ChildNumber uint32
+
+	// ParentFingerprint is the fingerprint of the parent key, zero for a
+	// master key.
+	ParentFingerprint [4]byte
+
+	IsPrivate bool
+
+	// Encoding is the address encoding implied by the SLIP-0132 HD version
+	// bytes of the key, e.g. NativeSegwit for a zpub.
+	Encoding AddressEncoding
+
+	// ChainParams are the chain parameters of the network of the key.
+	ChainParams chaincfg.ChainParams
+}
+
+// InspectExtendedKey returns the metadata of a base58-encoded extended key,
+// without deriving it.
+//
+// The network and the address encoding are inferred from the HD version
+// bytes of the key, among the networks known to the library. Networks
+// sharing the same version bytes cannot be told apart, in which case the
+// first of them is returned, with Bitcoin networks first, e.g. the Bitcoin
+// main network for an xpub. ErrUnknownHDKeyVersion is returned if no known
+// network uses the version bytes.
+func (s *Service) InspectExtendedKey(extendedKey string) (*ExtendedKeyInfo, error) {
+	key, err := hdkeychain.NewKeyFromString(extendedKey)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to decode extended key")
+	}
+
+	// The checksum was checked above. The child number is serialized after
+	// the version, the depth and the parent fingerprint.
+	payload := base58.Decode(extendedKey)
+
+	info := &ExtendedKeyInfo{
+		Depth:       key.Depth(),
+		ChildNumber: binary.BigEndian.Uint32(payload[9:13]),
+		IsPrivate:   key.IsPrivate(),
+	}
+
+	binary.BigEndian.PutUint32(info.ParentFingerprint[:], key.ParentFingerprint())
+
+	for _, chainParams := range knownChainParams() {
+		versions := map[AddressEncoding][]hdVersion{
+			Legacy: {{
+				public:  chainParams.HDPublicKeyID,
+				private: chainParams.HDPrivateKeyID,
+			}},
+		}
+
+		if alias, ok := legacyHDVersionAliases[chainParams.Net]; ok {
+			versions[Legacy] = append(versions[Legacy], alias)
+		}
+
+		for encoding, version := range slip132Versions[chainParams.Net] {
+			versions[encoding] = append(versions[encoding], version)
+		}
+
+		for encoding, encodingVersions := range versions {
+			for _, version := range encodingVersions {
+				if (key.IsPrivate() && bytes.Equal(key.Version(), version.private[:])) ||
+					(!key.IsPrivate() && bytes.Equal(key.Version(), version.public[:])) {
+					info.Encoding = encoding
+					info.ChainParams = chainParams
+					return info, nil
+				}
+			}
+		}
+	}
+
+	return nil, errors.Wrapf(ErrUnknownHDKeyVersion,
+		"version %x of extended key is not for any known network", key.Version())
+}
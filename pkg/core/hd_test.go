@@ -1,10 +1,15 @@
 package core
 
 import (
+	"context"
+	"encoding/binary"
+	"encoding/hex"
 	"reflect"
+	"strings"
 	"testing"
 
-	"github.com/btcsuite/btcutil/hdkeychain"
+	"github.com/btcsuite/btcd/btcutil"
+	"github.com/btcsuite/btcd/btcutil/hdkeychain"
 	"github.com/ledgerhq/bitcoin-lib-grpc/pkg/chaincfg"
 	"github.com/pkg/errors"
 )
@@ -129,7 +134,7 @@ func TestDeriveExtendedKey(t *testing.T) {
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			got, err := s.DeriveExtendedKey(tt.key, tt.derivation)
+			got, err := s.DeriveExtendedKey(context.Background(), tt.key, tt.derivation)
 
 			if err != nil && tt.wantErr == nil {
 				t.Fatalf("DeriveExtendedKey() unexpected error: %v", err)
@@ -153,12 +158,309 @@ func TestDeriveExtendedKey(t *testing.T) {
 	}
 }
 
+func TestDeriveExtendedKey_HardenedBoundary(t *testing.T) {
+	// BIP0032: Test Vector 1 (chain m/0H/1)
+	const xpub = "xpub6ASuArnXKPbfEwhqN6e3mwBcDTgzisQN1wXN9BJcM47sSikHjJf3UFHKkNAWbWMiGj7Wf5uMash7SyYq527Hqck2AxYysAA7xmALppuCkwQ"
+
+	tests := []struct {
+		name      string
+		index     uint32
+		wantErr   error
+		wantInErr string
+	}{
+		{
+			name:  "last non-hardened index",
+			index: h - 1,
+		},
+		{
+			name:      "first hardened index",
+			index:     h,
+			wantErr:   ErrDeriveHardFromPublic,
+			wantInErr: "index 2147483648 is the hardened index 0'",
+		},
+		{
+			name:      "last hardened index",
+			index:     h + (h - 1),
+			wantErr:   ErrDeriveHardFromPublic,
+			wantInErr: "index 4294967295 is the hardened index 2147483647'",
+		},
+	}
+
+	s := &Service{}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := s.DeriveExtendedKey(context.Background(), xpub, []uint32{tt.index})
+			if errors.Cause(err) != tt.wantErr {
+				t.Fatalf("DeriveExtendedKey() got error '%v', want '%v'",
+					err, tt.wantErr)
+			}
+
+			if err != nil && !strings.Contains(err.Error(), tt.wantInErr) {
+				t.Fatalf("DeriveExtendedKey() got error '%v', want it to contain '%s'",
+					err, tt.wantInErr)
+			}
+		})
+	}
+}
+
+func TestDeriveExtendedKey_HardenedPathPosition(t *testing.T) {
+	// BIP0032: Test Vector 1 (chain m/0H/1)
+	const xpub = "xpub6ASuArnXKPbfEwhqN6e3mwBcDTgzisQN1wXN9BJcM47sSikHjJf3UFHKkNAWbWMiGj7Wf5uMash7SyYq527Hqck2AxYysAA7xmALppuCkwQ"
+
+	tests := []struct {
+		name       string
+		derivation []uint32
+		wantInErr  string
+	}{
+		{
+			name:       "first position",
+			derivation: []uint32{h, 0},
+			wantInErr:  "cannot derive hardened index 2147483648 at path position 0 from a public key",
+		},
+		{
+			name:       "last position",
+			derivation: []uint32{0, 1, 2 + h},
+			wantInErr:  "cannot derive hardened index 2147483650 at path position 2 from a public key",
+		},
+	}
+
+	s := &Service{}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := s.DeriveExtendedKey(context.Background(), xpub, tt.derivation)
+			if errors.Cause(err) != ErrDeriveHardFromPublic {
+				t.Fatalf("DeriveExtendedKey() got error '%v', want '%v'",
+					err, ErrDeriveHardFromPublic)
+			}
+
+			if !strings.Contains(err.Error(), tt.wantInErr) {
+				t.Fatalf("DeriveExtendedKey() got error '%v', want it to contain '%s'",
+					err, tt.wantInErr)
+			}
+		})
+	}
+}
+
+func TestDeriveKeyWithAddresses(t *testing.T) {
+	bip32PublicKey, _ := hex.DecodeString("03501e454bf00751f24b1b489aa925215d66af2234e3891c3b21a52bedb3cd711c")
+	bip32Hash160, _ := hex.DecodeString("bef5a2f9a56a94aab12459f72ad9cf8cf19c7bbe")
+	bip84PublicKey, _ := hex.DecodeString("0330d54fd0dd420a6e5f8d3624f5f3482cae350f79d5f0753bf5beef9c2d91af3c")
+	bip84Hash160, _ := hex.DecodeString("c0cebcd6c3d3ca8c75dc5ec62ebe55330ef910e2")
+
+	tests := []struct {
+		name        string
+		extendedKey string
+		derivation  []uint32
+		chainParams chaincfg.ChainParams
+		want        *KeyWithAddresses
+		wantErr     error
+	}{
+		{
+			// BIP0032: Test Vector 1 (chain m/0H/1)
+			name:        "BIP32 test vector 1",
+			extendedKey: "xpub68Gmy5EdvgibQVfPdqkBBCHxA5htiqg55crXYuXoQRKfDBFA1WEjWgP6LHhwBZeNK1VTsfTFUHCdrfp1bgwQ9xv5ski8PX9rL2dZXvgGDnw",
+			derivation:  []uint32{1},
+			chainParams: chaincfg.BitcoinMainNetParams,
+			want: &KeyWithAddresses{
+				PublicKey:            bip32PublicKey,
+				Hash160:              bip32Hash160,
+				LegacyAddress:        "1JQheacLPdM5ySCkrZkV66G2ApAXe1mqLj",
+				WrappedSegwitAddress: "3DymAvEWH38HuzHZ3VwLus673bNZnYwNXu",
+				NativeSegwitAddress:  "bc1qhm6697d9d2224vfyt8mj4kw03ncec7a7fdafvt",
+			},
+		},
+		{
+			// BIP0084: Test Vectors (first receiving address, m/84'/0'/0'/0/0)
+			name:        "BIP84 test vector",
+			extendedKey: "zpub6rFR7y4Q2AijBEqTUquhVz398htDFrtymD9xYYfG1m4wAcvPhXNfE3EfH1r1ADqtfSdVCToUG868RvUUkgDKf31mGDtKsAYz2oz2AGutZYs",
+			derivation:  []uint32{0, 0},
+			chainParams: chaincfg.BitcoinMainNetParams,
+			want: &KeyWithAddresses{
+				PublicKey:            bip84PublicKey,
+				Hash160:              bip84Hash160,
+				LegacyAddress:        "1JaUQDVNRdhfNsVncGkXedaPSM5Gc54Hso",
+				WrappedSegwitAddress: "3GtVZYzsKF6Feikdjd4bDyPdAiyeHANY9b",
+				NativeSegwitAddress:  "bc1qcr8te4kr609gcawutmrza0j4xv80jy8z306fyu",
+			},
+		},
+		{
+			// BIP0032: Test Vector 1 (chain m/0H/1), with ttub version bytes
+			name:        "litecoin testnet4 ttub",
+			extendedKey: "ttub4ZdeS9QeHwGbBN7n8AnZfbitis1KrcT7JR4NwVGa4By7h51efiW8beca2tybGtQAXEehqY1beiwN2brKFEmzS4N3QoN9kBBJpsZYaYFXEZJ",
+			derivation:  []uint32{1},
+			chainParams: chaincfg.LitecoinTestNet4Params,
+			want: &KeyWithAddresses{
+				PublicKey:            bip32PublicKey,
+				Hash160:              bip32Hash160,
+				LegacyAddress:        "mxvewdhKCenLkYgNa8irv1UM2omEWPMdEE",
+				WrappedSegwitAddress: "QYtjMg2mubgjFxg9LjbEcWWoQL2ZPuePVV",
+				NativeSegwitAddress:  "tltc1qhm6697d9d2224vfyt8mj4kw03ncec7a76ryy83",
+			},
+		},
+		{
+			name:        "litecoin regtest ttub",
+			extendedKey: "ttub4ZdeS9QeHwGbBN7n8AnZfbitis1KrcT7JR4NwVGa4By7h51efiW8beca2tybGtQAXEehqY1beiwN2brKFEmzS4N3QoN9kBBJpsZYaYFXEZJ",
+			derivation:  []uint32{1},
+			chainParams: chaincfg.LitecoinRegTestParams,
+			want: &KeyWithAddresses{
+				PublicKey:            bip32PublicKey,
+				Hash160:              bip32Hash160,
+				LegacyAddress:        "mxvewdhKCenLkYgNa8irv1UM2omEWPMdEE",
+				WrappedSegwitAddress: "QYtjMg2mubgjFxg9LjbEcWWoQL2ZPuePVV",
+				NativeSegwitAddress:  "rltc1qhm6697d9d2224vfyt8mj4kw03ncec7a7l097h0",
+			},
+		},
+		{
+			name:        "ttub on bitcoin testnet3",
+			extendedKey: "ttub4ZdeS9QeHwGbBN7n8AnZfbitis1KrcT7JR4NwVGa4By7h51efiW8beca2tybGtQAXEehqY1beiwN2brKFEmzS4N3QoN9kBBJpsZYaYFXEZJ",
+			derivation:  []uint32{1},
+			chainParams: chaincfg.BitcoinTestNet3Params,
+			wantErr:     ErrNetworkMismatch,
+		},
+		{
+			name:        "hardened index from public key",
+			extendedKey: "xpub68Gmy5EdvgibQVfPdqkBBCHxA5htiqg55crXYuXoQRKfDBFA1WEjWgP6LHhwBZeNK1VTsfTFUHCdrfp1bgwQ9xv5ski8PX9rL2dZXvgGDnw",
+			derivation:  []uint32{1 + h},
+			chainParams: chaincfg.BitcoinMainNetParams,
+			wantErr:     ErrDeriveHardFromPublic,
+		},
+		{
+			name:        "extended key of another network",
+			extendedKey: "xpub68Gmy5EdvgibQVfPdqkBBCHxA5htiqg55crXYuXoQRKfDBFA1WEjWgP6LHhwBZeNK1VTsfTFUHCdrfp1bgwQ9xv5ski8PX9rL2dZXvgGDnw",
+			derivation:  []uint32{1},
+			chainParams: chaincfg.BitcoinTestNet3Params,
+			wantErr:     ErrNetworkMismatch,
+		},
+	}
+
+	s := &Service{}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := s.DeriveKeyWithAddresses(
+				context.Background(), tt.extendedKey, tt.derivation, tt.chainParams)
+			if errors.Cause(err) != tt.wantErr {
+				t.Fatalf("DeriveKeyWithAddresses() got error '%v', want '%v'", err, tt.wantErr)
+			}
+
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Fatalf("DeriveKeyWithAddresses() got '%+v', want '%+v'", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDerivePrivateKey(t *testing.T) {
+	tests := []struct {
+		name       string
+		key        string
+		derivation []uint32
+		want       PrivateKeyMaterial
+		wantErr    error
+	}{
+		{
+			// BIP0032: Test Vector 1 (chain m/0H/1/2H)
+			name:       "mainnet derive from root",
+			key:        "xprv9s21ZrQH143K3QTDL4LXw2F7HEK3wJUD2nW2nRk4stbPy6cq3jPPqjiChkVvvNKmPGJxWUtg6LnF5kejMRNNU3TGtRBeJgk33yuGBxrMPHi",
+			derivation: []uint32{0 + h, 1, 2 + h}, // m/0H/1/2H
+			want: PrivateKeyMaterial{
+				ExtendedKey: "xprv9z4pot5VBttmtdRTWfWQmoH1taj2axGVzFqSb8C9xaxKymcFzXBDptWmT7FwuEzG3ryjH4ktypQSAewRiNMjANTtpgP4mLTj34bhnZX7UiM",
+				PrivateKey: []byte{
+					0xcb, 0xce, 0x0d, 0x71, 0x9e, 0xcf, 0x74, 0x31,
+					0xd8, 0x8e, 0x6a, 0x89, 0xfa, 0x14, 0x83, 0xe0,
+					0x2e, 0x35, 0x09, 0x2a, 0xf6, 0x0c, 0x04, 0x2b,
+					0x1d, 0xf2, 0xff, 0x59, 0xfa, 0x42, 0x4d, 0xca,
+				},
+				PublicKey: []byte{
+					0x03, 0x57, 0xbf, 0xe1, 0xe3, 0x41, 0xd0, 0x1c,
+					0x69, 0xfe, 0x56, 0x54, 0x30, 0x99, 0x56, 0xcb,
+					0xea, 0x51, 0x68, 0x22, 0xfb, 0xa8, 0xa6, 0x01,
+					0x74, 0x3a, 0x01, 0x2a, 0x78, 0x96, 0xee, 0x8d,
+					0xc2,
+				},
+				ChainCode: []byte{
+					0x04, 0x46, 0x6b, 0x9c, 0xc8, 0xe1, 0x61, 0xe9,
+					0x66, 0x40, 0x9c, 0xa5, 0x29, 0x86, 0xc5, 0x84,
+					0xf0, 0x7e, 0x9d, 0xc8, 0x1f, 0x73, 0x5d, 0xb6,
+					0x83, 0xc3, 0xff, 0x6e, 0xc7, 0xb1, 0x50, 0x3f,
+				},
+			},
+		},
+		{
+			// BIP0032: Test Vector 1 (chain m/0H/1/2H/2/1000000000)
+			name:       "mainnet derive from child",
+			key:        "xprv9uHRZZhk6KAJC1avXpDAp4MDc3sQKNxDiPvvkX8Br5ngLNv1TxvUxt4cV1rGL5hj6KCesnDYUhd7oWgT11eZG7XnxHrnYeSvkzY7d2bhkJ7",
+			derivation: []uint32{1, 2 + h, 2, 1000000000}, // m/0H/1/2H/2/1000000000
+			want: PrivateKeyMaterial{
+				ExtendedKey: "xprvA41z7zogVVwxVSgdKUHDy1SKmdb533PjDz7J6N6mV6uS3ze1ai8FHa8kmHScGpWmj4WggLyQjgPie1rFSruoUihUZREPSL39UNdE3BBDu76",
+				PrivateKey: []byte{
+					0x47, 0x1b, 0x76, 0xe3, 0x89, 0xe5, 0x28, 0xd6,
+					0xde, 0x6d, 0x81, 0x68, 0x57, 0xe0, 0x12, 0xc5,
+					0x45, 0x50, 0x51, 0xca, 0xd6, 0x66, 0x08, 0x50,
+					0xe5, 0x83, 0x72, 0xa6, 0xc3, 0xe6, 0xe7, 0xc8,
+				},
+				PublicKey: []byte{
+					0x02, 0x2a, 0x47, 0x14, 0x24, 0xda, 0x5e, 0x65,
+					0x74, 0x99, 0xd1, 0xff, 0x51, 0xcb, 0x43, 0xc4,
+					0x74, 0x81, 0xa0, 0x3b, 0x1e, 0x77, 0xf9, 0x51,
+					0xfe, 0x64, 0xce, 0xc9, 0xf5, 0xa4, 0x8f, 0x70,
+					0x11,
+				},
+				ChainCode: []byte{
+					0xc7, 0x83, 0xe6, 0x7b, 0x92, 0x1d, 0x2b, 0xeb,
+					0x8f, 0x6b, 0x38, 0x9c, 0xc6, 0x46, 0xd7, 0x26,
+					0x3b, 0x41, 0x45, 0x70, 0x1d, 0xad, 0xd2, 0x16,
+					0x15, 0x48, 0xa8, 0xb0, 0x78, 0xe6, 0x5e, 0x9e,
+				},
+			},
+		},
+		{
+			// BIP0032: Test Vector 1 (chain m/0H/1/2H)
+			name:       "ErrNotPrivateExtendedKey",
+			key:        "xpub6D4BDPcP2GT577Vvch3R8wDkScZWzQzMMUm3PWbmWvVJrZwQY4VUNgqFJPMM3No2dFDFGTsxxpG5uJh7n7epu4trkrX7x7DogT5Uv6fcLW5",
+			derivation: []uint32{2},
+			wantErr:    ErrNotPrivateExtendedKey,
+		},
+	}
+
+	s := &Service{}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := s.DerivePrivateKey(tt.key, tt.derivation)
+
+			if err != nil && tt.wantErr == nil {
+				t.Fatalf("DerivePrivateKey() unexpected error: %v", err)
+			}
+
+			if err == nil && tt.wantErr != nil {
+				t.Fatalf("DerivePrivateKey() got no error, want '%v'",
+					tt.wantErr)
+			}
+
+			if err != nil && tt.wantErr.Error() != errors.Cause(err).Error() {
+				t.Fatalf("DerivePrivateKey() got error '%v', want '%v'",
+					err, tt.wantErr)
+			}
+
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Fatalf("DerivePrivateKey() got '%v', want '%v'",
+					got, tt.want)
+			}
+		})
+	}
+}
+
 func TestGetAccountExtendedKey(t *testing.T) {
 	tests := []struct {
 		name               string
 		publicKey          []byte
 		chainCode          []byte
 		accountIndex       uint32
+		parentPublicKey    []byte
+		encoding           AddressEncoding
 		chainParams        chaincfg.ChainParams
 		want               string
 		wantAddress        string
@@ -187,6 +489,120 @@ func TestGetAccountExtendedKey(t *testing.T) {
 			encodingForAddress: Legacy,
 			want:               "xpub6DVHQNhjvVchuKeMGnKbbNSdczQ4yMqEW1H1qhQzk1oPxkSqyHZR9Pn7zZ494sVhZqK2WD8kxo9rqiJFL41P67JCdNYka2W5LnANDVWSjzm",
 		},
+		{
+			// BIP0032: Test Vector 1 (chain m/0H/1/2H)
+			name:         "mainnet with parent public key",
+			accountIndex: 2,
+			publicKey: []byte{
+				0x03, 0x57, 0xbf, 0xe1, 0xe3, 0x41, 0xd0, 0x1c,
+				0x69, 0xfe, 0x56, 0x54, 0x30, 0x99, 0x56, 0xcb,
+				0xea, 0x51, 0x68, 0x22, 0xfb, 0xa8, 0xa6, 0x01,
+				0x74, 0x3a, 0x01, 0x2a, 0x78, 0x96, 0xee, 0x8d,
+				0xc2,
+			},
+			chainCode: []byte{
+				0x04, 0x46, 0x6b, 0x9c, 0xc8, 0xe1, 0x61, 0xe9,
+				0x66, 0x40, 0x9c, 0xa5, 0x29, 0x86, 0xc5, 0x84,
+				0xf0, 0x7e, 0x9d, 0xc8, 0x1f, 0x73, 0x5d, 0xb6,
+				0x83, 0xc3, 0xff, 0x6e, 0xc7, 0xb1, 0x50, 0x3f,
+			},
+			// BIP0032: Test Vector 1 (chain m/0H/1)
+			parentPublicKey: []byte{
+				0x03, 0x50, 0x1e, 0x45, 0x4b, 0xf0, 0x07, 0x51,
+				0xf2, 0x4b, 0x1b, 0x48, 0x9a, 0xa9, 0x25, 0x21,
+				0x5d, 0x66, 0xaf, 0x22, 0x34, 0xe3, 0x89, 0x1c,
+				0x3b, 0x21, 0xa5, 0x2b, 0xed, 0xb3, 0xcd, 0x71,
+				0x1c,
+			},
+			chainParams:        chaincfg.BitcoinMainNetParams,
+			wantAddress:        "1r1msgrPfqCMRAhg23cPBD9ZXH1UQ6jec",
+			encodingForAddress: Legacy,
+			want:               "xpub6D4BDPcP2GT577Vvch3R8wDkScZWzQzMMUm3PWbmWvVJrZwQY4VUNgqFJPMM3No2dFDFGTsxxpG5uJh7n7epu4trkrX7x7DogT5Uv6fcLW5",
+		},
+		{
+			name:         "litecoin P2SH-P2WPKH",
+			accountIndex: 0,
+			publicKey: []byte{
+				0x02, 0xc3, 0x68, 0xbd, 0xec, 0x47, 0xa1, 0xb6,
+				0xfa, 0xa7, 0x6d, 0x62, 0x4e, 0xad, 0x0c, 0xd2,
+				0x78, 0x32, 0x34, 0x98, 0x3c, 0x46, 0x67, 0x67,
+				0x21, 0x6e, 0xcd, 0xac, 0x8c, 0x47, 0x2d, 0xf3,
+				0xa6,
+			},
+			chainCode: []byte{
+				0xb6, 0xb8, 0xa4, 0x9c, 0x62, 0x34, 0xb2, 0x6c,
+				0x91, 0xbf, 0xaf, 0xac, 0xd9, 0x05, 0x4c, 0x18,
+				0x56, 0x21, 0x30, 0x23, 0x4d, 0xc3, 0x9e, 0x94,
+				0x63, 0x56, 0x1c, 0xa6, 0x66, 0x7f, 0x40, 0xf8,
+			},
+			encoding:           WrappedSegwit,
+			chainParams:        chaincfg.LitecoinMainNetParams,
+			wantAddress:        "MV6r9axRYsfMVAUdw34QwXTw7KQj6PMJim",
+			encodingForAddress: WrappedSegwit,
+			want:               "Mtub2tkfAgagxcUBzz7Qhd7DfKeMsks5fmLsYQ1DTB3zVX1ykDtssxDib6vhNdXkjBYsZgqQqp7sGV9nq6GvxeWqjGmDnr8dpd5c6zzMWbDR8hG",
+		},
+		{
+			name:         "litecoin P2WPKH",
+			accountIndex: 0,
+			publicKey: []byte{
+				0x02, 0xc3, 0x68, 0xbd, 0xec, 0x47, 0xa1, 0xb6,
+				0xfa, 0xa7, 0x6d, 0x62, 0x4e, 0xad, 0x0c, 0xd2,
+				0x78, 0x32, 0x34, 0x98, 0x3c, 0x46, 0x67, 0x67,
+				0x21, 0x6e, 0xcd, 0xac, 0x8c, 0x47, 0x2d, 0xf3,
+				0xa6,
+			},
+			chainCode: []byte{
+				0xb6, 0xb8, 0xa4, 0x9c, 0x62, 0x34, 0xb2, 0x6c,
+				0x91, 0xbf, 0xaf, 0xac, 0xd9, 0x05, 0x4c, 0x18,
+				0x56, 0x21, 0x30, 0x23, 0x4d, 0xc3, 0x9e, 0x94,
+				0x63, 0x56, 0x1c, 0xa6, 0x66, 0x7f, 0x40, 0xf8,
+			},
+			encoding:           NativeSegwit,
+			chainParams:        chaincfg.LitecoinMainNetParams,
+			wantAddress:        "ltc1qy40c4nwc60nwyc9xrvmy8q7mrwqsz34gn4h40l",
+			encodingForAddress: NativeSegwit,
+			want:               "zpub6s9p1i3aDrhfbv2awVtr1YddxvgxrbpELEKTQVCmW2ZA4x5JUbtYPX6Q2xyK4goYP7Ye1AKst7rxcHXNmSqQgafQN3wbjr93tEHezgTPQmQ",
+		},
+		{
+			name:         "taproot version bytes",
+			accountIndex: 0,
+			publicKey: []byte{
+				0x02, 0xc3, 0x68, 0xbd, 0xec, 0x47, 0xa1, 0xb6,
+				0xfa, 0xa7, 0x6d, 0x62, 0x4e, 0xad, 0x0c, 0xd2,
+				0x78, 0x32, 0x34, 0x98, 0x3c, 0x46, 0x67, 0x67,
+				0x21, 0x6e, 0xcd, 0xac, 0x8c, 0x47, 0x2d, 0xf3,
+				0xa6,
+			},
+			chainCode: []byte{
+				0xb6, 0xb8, 0xa4, 0x9c, 0x62, 0x34, 0xb2, 0x6c,
+				0x91, 0xbf, 0xaf, 0xac, 0xd9, 0x05, 0x4c, 0x18,
+				0x56, 0x21, 0x30, 0x23, 0x4d, 0xc3, 0x9e, 0x94,
+				0x63, 0x56, 0x1c, 0xa6, 0x66, 0x7f, 0x40, 0xf8,
+			},
+			encoding:    Taproot,
+			chainParams: chaincfg.LitecoinMainNetParams,
+			wantErr:     ErrUnknownAddressType,
+		},
+		{
+			name:         "invalid parent public key",
+			accountIndex: 2,
+			publicKey: []byte{
+				0x03, 0x57, 0xbf, 0xe1, 0xe3, 0x41, 0xd0, 0x1c,
+				0x69, 0xfe, 0x56, 0x54, 0x30, 0x99, 0x56, 0xcb,
+				0xea, 0x51, 0x68, 0x22, 0xfb, 0xa8, 0xa6, 0x01,
+				0x74, 0x3a, 0x01, 0x2a, 0x78, 0x96, 0xee, 0x8d,
+				0xc2,
+			},
+			chainCode: []byte{
+				0x04, 0x46, 0x6b, 0x9c, 0xc8, 0xe1, 0x61, 0xe9,
+				0x66, 0x40, 0x9c, 0xa5, 0x29, 0x86, 0xc5, 0x84,
+				0xf0, 0x7e, 0x9d, 0xc8, 0x1f, 0x73, 0x5d, 0xb6,
+				0x83, 0xc3, 0xff, 0x6e, 0xc7, 0xb1, 0x50, 0x3f,
+			},
+			parentPublicKey: []byte{0x03, 0x50, 0x1e},
+			chainParams:     chaincfg.BitcoinMainNetParams,
+			wantErr:         errors.New("malformed public key: invalid length: 3"),
+		},
 	}
 
 	s := &Service{}
@@ -194,7 +610,8 @@ func TestGetAccountExtendedKey(t *testing.T) {
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
 			got, err := s.GetAccountExtendedKey(
-				tt.publicKey, tt.chainCode, tt.accountIndex, tt.chainParams)
+				tt.publicKey, tt.chainCode, tt.accountIndex, tt.parentPublicKey,
+				tt.encoding, tt.chainParams)
 
 			if err != nil && tt.wantErr == nil {
 				t.Fatalf("GetAccountExtendedKey() unexpected error: %v", err)
@@ -215,14 +632,32 @@ func TestGetAccountExtendedKey(t *testing.T) {
 					got, tt.want)
 			}
 
+			if tt.wantErr != nil {
+				return
+			}
+
+			if len(tt.parentPublicKey) > 0 {
+				key, err := hdkeychain.NewKeyFromString(got)
+				if err != nil {
+					t.Fatalf("cannot decode extended key '%v': %v", got, err)
+				}
+
+				wantFP := binary.BigEndian.Uint32(
+					btcutil.Hash160(tt.parentPublicKey)[:4])
+				if key.ParentFingerprint() != wantFP {
+					t.Fatalf("GetAccountExtendedKey() got parent fingerprint %08x, want %08x",
+						key.ParentFingerprint(), wantFP)
+				}
+			}
+
 			deriveAddress := func(key string, derivation []uint32) (string, error) {
-				keyMaterial, err := s.DeriveExtendedKey(key, derivation)
+				keyMaterial, err := s.DeriveExtendedKey(context.Background(), key, derivation)
 				if err != nil {
 					return "", err
 				}
 
 				addr, err := s.EncodeAddress(
-					keyMaterial.PublicKey, tt.encodingForAddress, tt.chainParams)
+					keyMaterial.PublicKey, tt.encodingForAddress, true, tt.chainParams)
 				if err != nil {
 					return "", err
 				}
@@ -244,6 +679,67 @@ func TestGetAccountExtendedKey(t *testing.T) {
 	}
 }
 
+func TestGetAccountExtendedKey_InvalidPublicKey(t *testing.T) {
+	chainCode := make([]byte, 32)
+	validPublicKey := []byte{
+		0x03, 0x57, 0xbf, 0xe1, 0xe3, 0x41, 0xd0, 0x1c,
+		0x69, 0xfe, 0x56, 0x54, 0x30, 0x99, 0x56, 0xcb,
+		0xea, 0x51, 0x68, 0x22, 0xfb, 0xa8, 0xa6, 0x01,
+		0x74, 0x3a, 0x01, 0x2a, 0x78, 0x96, 0xee, 0x8d,
+		0xc2,
+	}
+	notOnCurve := []byte{
+		0x03, 0xce, 0x0b, 0x14, 0xfb, 0x84, 0x2b, 0x1b,
+		0xa5, 0x49, 0xfd, 0xd6, 0x75, 0xc9, 0x80, 0x75,
+		0xf1, 0x2e, 0x9c, 0x51, 0x0f, 0x8e, 0xf5, 0x2b,
+		0xd0, 0x21, 0xa9, 0xa1, 0xf4, 0x80, 0x9d, 0x3b,
+		0x4c,
+	}
+
+	tests := []struct {
+		name            string
+		publicKey       []byte
+		parentPublicKey []byte
+		wantErr         string
+	}{
+		{
+			name:      "public key of invalid length",
+			publicKey: validPublicKey[:20],
+			wantErr:   "public key has invalid length 20, expected 33 or 65",
+		},
+		{
+			name:      "public key not on curve",
+			publicKey: notOnCurve,
+			wantErr:   "public key is not a valid point on secp256k1",
+		},
+		{
+			name:            "parent public key of invalid length",
+			publicKey:       validPublicKey,
+			parentPublicKey: []byte{0x03, 0x50, 0x1e},
+			wantErr:         "public key has invalid length 3, expected 33 or 65",
+		},
+		{
+			name:            "parent public key not on curve",
+			publicKey:       validPublicKey,
+			parentPublicKey: notOnCurve,
+			wantErr:         "public key is not a valid point on secp256k1",
+		},
+	}
+
+	s := &Service{}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := s.GetAccountExtendedKey(
+				tt.publicKey, chainCode, 0, tt.parentPublicKey, Legacy,
+				chaincfg.BitcoinMainNetParams)
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Fatalf("GetAccountExtendedKey() got error '%v', want '%v'", err, tt.wantErr)
+			}
+		})
+	}
+}
+
 func TestGetKeypair(t *testing.T) {
 	tests := []struct {
 		name        string
@@ -263,13 +759,26 @@ func TestGetKeypair(t *testing.T) {
 				PrivateKey:        "xprv9yv8fLFeRhD7NcKbjGS4GesBvy2PjvoRcwEKKaz7zJvM2cQ1eiCwhcHGQNEBwsXthHbPtZNQg5SBBEWS1QH941SKitBdaUT7VDTxzdS8vu7",
 			},
 		},
+		{
+			name:        "seed too short",
+			seed:        "abc",
+			chainParams: chaincfg.BitcoinMainNetParams,
+			wantErr:     ErrInvalidSeedLength,
+		},
+		{
+			name:        "seed too long",
+			seed:        strings.Repeat("a", 65),
+			chainParams: chaincfg.BitcoinMainNetParams,
+			wantErr:     ErrInvalidSeedLength,
+		},
 	}
 
 	s := &Service{}
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			got, err := s.GetKeypair(tt.seed, tt.chainParams, tt.derivation)
+			got, err := s.GetKeypair(
+				context.Background(), tt.seed, tt.chainParams, tt.derivation, false)
 
 			if err != nil && tt.wantErr == nil {
 				t.Fatalf("GetKeypair() unexpected error: %v", err)
@@ -292,3 +801,373 @@ func TestGetKeypair(t *testing.T) {
 		})
 	}
 }
+
+func TestGetKeypair_XpubOnly(t *testing.T) {
+	s := &Service{}
+
+	got, err := s.GetKeypair(context.Background(), "I am the Lama from Lama land",
+		chaincfg.BitcoinMainNetParams, []uint32{44 + h, 0 + h, 0 + h}, true)
+	if err != nil {
+		t.Fatalf("GetKeypair() got error '%v'", err)
+	}
+
+	want := Keypair{
+		ExtendedPublicKey: "xpub6CuV4qnYG4mQb6Q4qHy4dnovUzrt9PXGzA9v7yPjYeTKuQjACFXCFQbkFfvCTz8WsR3ggq7MaNDkwLjvoy6FZby3rZ9PLNGy51rVFdmwhrZ",
+	}
+
+	if got != want {
+		t.Fatalf("GetKeypair() got '%v', want '%v'", got, want)
+	}
+}
+
+func TestGetKeypair_Cancelled(t *testing.T) {
+	s := &Service{}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	_, err := s.GetKeypair(ctx, "I am the Lama from Lama land",
+		chaincfg.BitcoinMainNetParams, []uint32{44 + h, 0 + h, 0 + h}, false)
+	if errors.Cause(err) != context.Canceled {
+		t.Fatalf("GetKeypair() got error '%v', want '%v'", err, context.Canceled)
+	}
+}
+
+func TestGetAccountXpubFromSeed(t *testing.T) {
+	// BIP0039 seed of the mnemonic "abandon abandon ... about", without
+	// passphrase.
+	seed := "5eb00bbddcf069084889a8ab9155568165f5c453ccb85e70811aaed6f6da5fc1" +
+		"9a5ac40b389cd370d086206dec8aa6c43daea6690f20ad3d8d48b2d2ce9e38e4"
+
+	tests := []struct {
+		name        string
+		seed        string
+		purpose     uint32
+		coinType    uint32
+		account     uint32
+		chainParams chaincfg.ChainParams
+		encoding    AddressEncoding
+		want        string
+		wantErr     error
+	}{
+		{
+			name:        "BIP0084 account zpub",
+			seed:        seed,
+			purpose:     84,
+			chainParams: chaincfg.BitcoinMainNetParams,
+			encoding:    NativeSegwit,
+			want:        "zpub6rFR7y4Q2AijBEqTUquhVz398htDFrtymD9xYYfG1m4wAcvPhXNfE3EfH1r1ADqtfSdVCToUG868RvUUkgDKf31mGDtKsAYz2oz2AGutZYs",
+		},
+		{
+			name:        "BIP0044 account xpub",
+			seed:        seed,
+			purpose:     44,
+			chainParams: chaincfg.BitcoinMainNetParams,
+			encoding:    Legacy,
+			want:        "xpub6BosfCnifzxcFwrSzQiqu2DBVTshkCXacvNsWGYJVVhhawA7d4R5WSWGFNbi8Aw6ZRc1brxMyWMzG3DSSSSoekkudhUd9yLb6qx39T9nMdj",
+		},
+		{
+			name:        "BIP0049 account ypub",
+			seed:        seed,
+			purpose:     49,
+			chainParams: chaincfg.BitcoinMainNetParams,
+			encoding:    WrappedSegwit,
+			want:        "ypub6Ww3ibxVfGzLrAH1PNcjyAWenMTbbAosGNB6VvmSEgytSER9azLDWCxoJwW7Ke7icmizBMXrzBx9979FfaHxHcrArf3zbeJJJUZPf663zsP",
+		},
+		{
+			name:        "Taproot is not supported",
+			seed:        seed,
+			purpose:     86,
+			chainParams: chaincfg.BitcoinMainNetParams,
+			encoding:    Taproot,
+			wantErr:     ErrUnknownAddressType,
+		},
+		{
+			name:        "seed too short",
+			seed:        "000102030405060708090a0b0c0d0e",
+			purpose:     84,
+			chainParams: chaincfg.BitcoinMainNetParams,
+			encoding:    NativeSegwit,
+			wantErr:     ErrInvalidSeedLength,
+		},
+	}
+
+	s := &Service{}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := s.GetAccountXpubFromSeed(
+				tt.seed, tt.purpose, tt.coinType, tt.account, tt.chainParams, tt.encoding)
+			if errors.Cause(err) != tt.wantErr {
+				t.Fatalf("GetAccountXpubFromSeed() got error '%v', want '%v'", err, tt.wantErr)
+			}
+
+			if got != tt.want {
+				t.Fatalf("GetAccountXpubFromSeed() got '%s', want '%s'", got, tt.want)
+			}
+		})
+	}
+
+	// Indexes are hardened by GetAccountXpubFromSeed.
+	if _, err := s.GetAccountXpubFromSeed(seed, 84+h, 0, 0, chaincfg.BitcoinMainNetParams, NativeSegwit); err == nil {
+		t.Fatalf("GetAccountXpubFromSeed() got no error for a hardened purpose")
+	}
+
+	if _, err := s.GetAccountXpubFromSeed("not hex", 84, 0, 0, chaincfg.BitcoinMainNetParams, NativeSegwit); err == nil {
+		t.Fatalf("GetAccountXpubFromSeed() got no error for a non-hex seed")
+	}
+}
+
+func TestMasterFingerprint(t *testing.T) {
+	tests := []struct {
+		name    string
+		seed    string
+		want    string
+		wantErr error
+	}{
+		{
+			// BIP0032: Test Vector 1, parent fingerprint of chain m/0H
+			name: "BIP32 test vector 1",
+			seed: "000102030405060708090a0b0c0d0e0f",
+			want: "3442193e",
+		},
+		{
+			// BIP0084: Test Vectors, key origin of the account descriptor
+			name: "BIP39 seed of abandon ... about",
+			seed: "5eb00bbddcf069084889a8ab9155568165f5c453ccb85e70811aaed6f6da5fc1" +
+				"9a5ac40b389cd370d086206dec8aa6c43daea6690f20ad3d8d48b2d2ce9e38e4",
+			want: "73c5da0a",
+		},
+		{
+			name:    "seed too short",
+			seed:    "000102030405060708090a0b0c0d0e",
+			wantErr: ErrInvalidSeedLength,
+		},
+	}
+
+	s := &Service{}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := s.MasterFingerprint(tt.seed, chaincfg.BitcoinMainNetParams)
+			if errors.Cause(err) != tt.wantErr {
+				t.Fatalf("MasterFingerprint() got error '%v', want '%v'", err, tt.wantErr)
+			}
+
+			if tt.wantErr == nil && hex.EncodeToString(got[:]) != tt.want {
+				t.Fatalf("MasterFingerprint() got '%x', want '%s'", got, tt.want)
+			}
+		})
+	}
+
+	if _, err := s.MasterFingerprint("not hex", chaincfg.BitcoinMainNetParams); err == nil {
+		t.Fatalf("MasterFingerprint() got no error for a non-hex seed")
+	}
+}
+
+func TestConvertExtendedKeyVersion(t *testing.T) {
+	// BIP0084: Test Vectors (account 0, m/84'/0'/0')
+	const (
+		xpub = "xpub6CatWdiZiodmUeTDp8LT5or8nmbKNcuyvz7WyksVFkKB4RHwCD3XyuvPEbvqAQY3rAPshWcMLoP2fMFMKHPJ4ZeZXYVUhLv1VMrjPC7PW6V"
+		ypub = "ypub6XR9pJPUsVBFKweLeV85HtwdxjjmKEuUr6djm9mNdkh47X7ASsD6byaXFotRAKByFoWgSzCuoTjaYdrv2yoJroLAPtBuHFjVm5vNmhyNehE"
+		zpub = "zpub6rFR7y4Q2AijBEqTUquhVz398htDFrtymD9xYYfG1m4wAcvPhXNfE3EfH1r1ADqtfSdVCToUG868RvUUkgDKf31mGDtKsAYz2oz2AGutZYs"
+		Mtub = "Mtub2srGGwbWkvVFaJvHEy859m3s3Y4L52RcyNqibEWV1FXkqtjy6shqRd4xcgQSpibDr1vG37bTeVNxejE2wstkhj7ah25MwwVYFagigHNTnSn"
+	)
+
+	tests := []struct {
+		name           string
+		extendedKey    string
+		targetEncoding AddressEncoding
+		chainParams    chaincfg.ChainParams
+		want           string
+		wantErr        error
+	}{
+		{
+			name:           "mainnet xpub to ypub",
+			extendedKey:    xpub,
+			targetEncoding: WrappedSegwit,
+			chainParams:    chaincfg.BitcoinMainNetParams,
+			want:           ypub,
+		},
+		{
+			name:           "mainnet xpub to zpub",
+			extendedKey:    xpub,
+			targetEncoding: NativeSegwit,
+			chainParams:    chaincfg.BitcoinMainNetParams,
+			want:           zpub,
+		},
+		{
+			name:           "mainnet ypub to xpub",
+			extendedKey:    ypub,
+			targetEncoding: Legacy,
+			chainParams:    chaincfg.BitcoinMainNetParams,
+			want:           xpub,
+		},
+		{
+			name:           "mainnet zpub to xpub",
+			extendedKey:    zpub,
+			targetEncoding: Legacy,
+			chainParams:    chaincfg.BitcoinMainNetParams,
+			want:           xpub,
+		},
+		{
+			name:           "mainnet zpub to zpub",
+			extendedKey:    zpub,
+			targetEncoding: NativeSegwit,
+			chainParams:    chaincfg.BitcoinMainNetParams,
+			want:           zpub,
+		},
+		{
+			// BIP0032: Test Vector 1 (chain m)
+			name:           "mainnet xprv to zprv",
+			extendedKey:    "xprv9s21ZrQH143K3QTDL4LXw2F7HEK3wJUD2nW2nRk4stbPy6cq3jPPqjiChkVvvNKmPGJxWUtg6LnF5kejMRNNU3TGtRBeJgk33yuGBxrMPHi",
+			targetEncoding: NativeSegwit,
+			chainParams:    chaincfg.BitcoinMainNetParams,
+			want:           "zprvAWgYBBk7JR8GjzqSzmunMCS7dAbwpYTCs1YUMDXqduMA5JFHZ3iX5s2UkAR6vBdcCYYa1S5o1fVLrKsrnpCQ4WpUd6aVUWP1bS2Yy5DoaKv",
+		},
+		{
+			name:           "testnet3 tpub to vpub",
+			extendedKey:    "tpubD6NzVbkrYhZ4XgiXtGrdW5XDAPFCL9h7we1vwNCpn8tGbBcgfVYjXyhWo4E1xkh56hjod1RhGjxbaTLV3X4FyWuejifB9jusQ46QzG87VKp",
+			targetEncoding: NativeSegwit,
+			chainParams:    chaincfg.BitcoinTestNet3Params,
+			want:           "vpub5SLqN2bLY4WeZJ9SmNJHsyzqVKreTXD4ZnPC22MugDNcjhKX5xNX9QiQWcE4SSRzVWyHWUihpKRT7hckDGNzVc69wSX2JPcfGeNiT5c2XZy",
+		},
+		{
+			name:           "litecoin xpub to Mtub",
+			extendedKey:    xpub,
+			targetEncoding: WrappedSegwit,
+			chainParams:    chaincfg.LitecoinMainNetParams,
+			want:           Mtub,
+		},
+		{
+			name:           "litecoin Mtub to xpub",
+			extendedKey:    Mtub,
+			targetEncoding: Legacy,
+			chainParams:    chaincfg.LitecoinMainNetParams,
+			want:           xpub,
+		},
+		{
+			name:           "ypub on testnet3",
+			extendedKey:    ypub,
+			targetEncoding: Legacy,
+			chainParams:    chaincfg.BitcoinTestNet3Params,
+			wantErr:        ErrUnknownHDKeyVersion,
+		},
+		{
+			name:           "Mtub on mainnet",
+			extendedKey:    Mtub,
+			targetEncoding: Legacy,
+			chainParams:    chaincfg.BitcoinMainNetParams,
+			wantErr:        ErrUnknownHDKeyVersion,
+		},
+		{
+			name:           "invalid encoding",
+			extendedKey:    xpub,
+			targetEncoding: AddressEncoding(-1),
+			chainParams:    chaincfg.BitcoinMainNetParams,
+			wantErr:        ErrUnknownAddressType,
+		},
+	}
+
+	s := &Service{}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := s.ConvertExtendedKeyVersion(
+				tt.extendedKey, tt.targetEncoding, tt.chainParams)
+			if err != nil && errors.Cause(err) != tt.wantErr {
+				t.Fatalf("ConvertExtendedKeyVersion() unexpected error = %v", err)
+			}
+
+			if err == nil && tt.wantErr != nil {
+				t.Fatalf("ConvertExtendedKeyVersion() got no error, want %v",
+					tt.wantErr)
+			}
+
+			if got != tt.want {
+				t.Fatalf("ConvertExtendedKeyVersion() got = %v, want %v",
+					got, tt.want)
+			}
+		})
+	}
+}
+
+func TestInspectExtendedKey(t *testing.T) {
+	tests := []struct {
+		name        string
+		extendedKey string
+		want        *ExtendedKeyInfo
+		wantErr     error
+	}{
+		{
+			// BIP0084: Test Vectors (account 0 extended public key)
+			name:        "BIP84 zpub",
+			extendedKey: "zpub6rFR7y4Q2AijBEqTUquhVz398htDFrtymD9xYYfG1m4wAcvPhXNfE3EfH1r1ADqtfSdVCToUG868RvUUkgDKf31mGDtKsAYz2oz2AGutZYs",
+			want: &ExtendedKeyInfo{
+				Depth:             3,
+				ChildNumber:       0 + h,
+				ParentFingerprint: [4]byte{0x7e, 0xf3, 0x2b, 0xdb},
+				IsPrivate:         false,
+				Encoding:          NativeSegwit,
+				ChainParams:       chaincfg.BitcoinMainNetParams,
+			},
+		},
+		{
+			// BIP0032: Test Vector 1 (chain m)
+			name:        "master xprv",
+			extendedKey: "xprv9s21ZrQH143K3QTDL4LXw2F7HEK3wJUD2nW2nRk4stbPy6cq3jPPqjiChkVvvNKmPGJxWUtg6LnF5kejMRNNU3TGtRBeJgk33yuGBxrMPHi",
+			want: &ExtendedKeyInfo{
+				Depth:       0,
+				ChildNumber: 0,
+				IsPrivate:   true,
+				Encoding:    Legacy,
+				ChainParams: chaincfg.BitcoinMainNetParams,
+			},
+		},
+		{
+			// BIP0032: Test Vector 1 (chain m/0H), with ttub version bytes
+			name:        "litecoin testnet4 ttub",
+			extendedKey: "ttub4ZdeS9QeHwGbBN7n8AnZfbitis1KrcT7JR4NwVGa4By7h51efiW8beca2tybGtQAXEehqY1beiwN2brKFEmzS4N3QoN9kBBJpsZYaYFXEZJ",
+			want: &ExtendedKeyInfo{
+				Depth:             1,
+				ChildNumber:       0 + h,
+				ParentFingerprint: [4]byte{0x34, 0x42, 0x19, 0x3e},
+				IsPrivate:         false,
+				Encoding:          Legacy,
+				ChainParams:       chaincfg.LitecoinTestNet4Params,
+			},
+		},
+		{
+			name:        "litecoin Mtub",
+			extendedKey: "Mtub2tkfAgagxcUBzz7Qhd7DfKeMsks5fmLsYQ1DTB3zVX1ykDtssxDib6vhNdXkjBYsZgqQqp7sGV9nq6GvxeWqjGmDnr8dpd5c6zzMWbDR8hG",
+			want: &ExtendedKeyInfo{
+				Depth:             3,
+				ChildNumber:       0 + h,
+				ParentFingerprint: [4]byte{0xf9, 0xda, 0x40, 0x03},
+				IsPrivate:         false,
+				Encoding:          WrappedSegwit,
+				ChainParams:       chaincfg.LitecoinMainNetParams,
+			},
+		},
+		{
+			name:        "invalid checksum",
+			extendedKey: "zpub6rFR7y4Q2AijBEqTUquhVz398htDFrtymD9xYYfG1m4wAcvPhXNfE3EfH1r1ADqtfSdVCToUG868RvUUkgDKf31mGDtKsAYz2oz2AGutZYt",
+			wantErr:     hdkeychain.ErrBadChecksum,
+		},
+	}
+
+	s := &Service{}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := s.InspectExtendedKey(tt.extendedKey)
+			if errors.Cause(err) != tt.wantErr {
+				t.Fatalf("InspectExtendedKey() got error '%v', want '%v'", err, tt.wantErr)
+			}
+
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Fatalf("InspectExtendedKey() got '%+v', want '%+v'", got, tt.want)
+			}
+		})
+	}
+}
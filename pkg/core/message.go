@@ -0,0 +1,215 @@
+package core
+
+import (
+	"bytes"
+	"encoding/base64"
+
+	"github.com/btcsuite/btcd/btcec/v2"
+	"github.com/btcsuite/btcd/btcec/v2/ecdsa"
+	"github.com/btcsuite/btcd/btcutil"
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/btcsuite/btcd/wire"
+	"github.com/ledgerhq/bitcoin-lib-grpc/pkg/chaincfg"
+	"github.com/pkg/errors"
+)
+
+// References:
+//   [Bitcoin Wiki]: Message signing
+//   https://en.bitcoin.it/wiki/Message_signing
+//
+//   [BIP137]: BIP0137 - Signatures of Messages using Private Keys
+//   https://github.com/bitcoin/bips/blob/master/bip-0137.mediawiki
+
+// messageMagic is the prefix of the messages signed with the Bitcoin
+// "signed message" format. Like the message, it is serialized with its
+// length, i.e. as "\x18Bitcoin Signed Message:\n".
+const messageMagic = "Bitcoin Signed Message:\n"
+
+// Header bytes of a compact signature, as specified by BIP0137. The
+// recovery id of the signature, in [0, 3], is added to the header byte.
+const (
+	headerUncompressedP2PKH byte = 27
+	headerCompressedP2PKH   byte = 31
+	headerP2SHP2WPKH        byte = 35
+	headerP2WPKH            byte = 39
+	headerMax               byte = 42
+)
+
+// compactSignatureLen is the length of a compact signature, i.e. a header
+// byte followed by the 32-byte R and S values.
+const compactSignatureLen = 65
+
+// SignMessage signs a message with a 32-byte raw private key, using the
+// Bitcoin "signed message" format, and returns the base64 encoded compact
+// signature.
+//
+// The header byte of the signature encodes the address type of the signing
+// key, as specified by BIP0137. Segwit encodings require a compressed
+// public key, and P2TR is not supported.
+func (s *Service) SignMessage(
+	privKey []byte, message string, encoding AddressEncoding, compressed bool,
+) (string, error) {
+	privateKey, err := parseScalarKey(ScalarKey{PrivateKey: privKey})
+	if err != nil {
+		return "", err
+	}
+
+	var header byte
+
+	switch encoding {
+	case Legacy:
+		header = headerUncompressedP2PKH
+		if compressed {
+			header = headerCompressedP2PKH
+		}
+	case WrappedSegwit:
+		header = headerP2SHP2WPKH
+	case NativeSegwit:
+		header = headerP2WPKH
+	default:
+		return "", errors.Wrapf(ErrUnknownAddressType,
+			"cannot sign message for %s address", encoding)
+	}
+
+	if encoding != Legacy && !compressed {
+		return "", errors.Wrapf(ErrUncompressedPublicKey,
+			"%s address requires a compressed public key", encoding)
+	}
+
+	signature := ecdsa.SignCompact(privateKey, messageHash(message), compressed)
+
+	// Replace the header byte set by btcec, which only knows about P2PKH,
+	// while keeping the recovery id.
+	signature[0] = header + recoveryID(signature[0])
+
+	return base64.StdEncoding.EncodeToString(signature), nil
+}
+
+// VerifyMessage returns whether a base64 encoded compact signature of a
+// message, in the Bitcoin "signed message" format, was produced by the key
+// of an address.
+//
+// The public key is recovered from the signature, and the address type to
+// compare with is read from the header byte, as specified by BIP0137, i.e.
+// P2PKH, P2SH-P2WPKH or P2WPKH.
+//
+// An error is returned if the address or the signature is malformed. A
+// well-formed signature of another key or message returns false.
+func (s *Service) VerifyMessage(
+	address string, message string, signature string, chainParams chaincfg.ChainParams,
+) (bool, error) {
+	addr, err := btcutil.DecodeAddress(address, chainParams)
+	if err != nil {
+		return false, errors.Wrapf(err, "failed to decode address %s", address)
+	}
+
+	if !addr.IsForNet(chainParams) {
+		return false, errors.Wrapf(ErrNetworkMismatch,
+			"address %s is not for network %s", address, chainParams.Name)
+	}
+
+	sig, err := base64.StdEncoding.DecodeString(signature)
+	if err != nil {
+		return false, errors.Wrapf(ErrInvalidMessageSignature,
+			"failed to decode base64 signature: %v", err)
+	}
+
+	publicKey, err := recoverCompact(messageHash(message), sig)
+	if err != nil {
+		return false, err
+	}
+
+	header := sig[0]
+
+	var recoveredAddr btcutil.Address
+
+	switch {
+	case header < headerCompressedP2PKH:
+		recoveredAddr, err = btcutil.NewAddressPubKeyHash(
+			btcutil.Hash160(publicKey.SerializeUncompressed()), chainParams)
+	case header < headerP2SHP2WPKH:
+		recoveredAddr, err = addressFromPublicKey(publicKey, Legacy, chainParams)
+	case header < headerP2WPKH:
+		recoveredAddr, err = addressFromPublicKey(publicKey, WrappedSegwit, chainParams)
+	default:
+		recoveredAddr, err = addressFromPublicKey(publicKey, NativeSegwit, chainParams)
+	}
+
+	if err != nil {
+		return false, errors.Wrap(err, "failed to encode recovered public key")
+	}
+
+	return recoveredAddr.EncodeAddress() == addr.EncodeAddress(), nil
+}
+
+// RecoverPublicKey recovers the public key of a 65-byte compact signature
+// of a 32-byte message hash, and returns it in compressed form.
+//
+// The header byte of the signature must be in [27, 42], i.e. a P2PKH header
+// set by ecdsa.SignCompact, or a BIP0137 header set by SignMessage, and it
+// encodes the recovery id of the signature.
+func (s *Service) RecoverPublicKey(messageHash []byte, signature []byte) ([]byte, error) {
+	if len(messageHash) != chainhash.HashSize {
+		return nil, errors.Errorf("message hash has invalid length %d, expected %d",
+			len(messageHash), chainhash.HashSize)
+	}
+
+	publicKey, err := recoverCompact(messageHash, signature)
+	if err != nil {
+		return nil, err
+	}
+
+	return publicKey.SerializeCompressed(), nil
+}
+
+// recoverCompact recovers the public key of a compact signature of a hash,
+// after checking its length and header byte.
+func recoverCompact(hash []byte, signature []byte) (*btcec.PublicKey, error) {
+	if len(signature) != compactSignatureLen {
+		return nil, errors.Wrapf(ErrInvalidMessageSignature,
+			"signature has invalid length %d, expected %d",
+			len(signature), compactSignatureLen)
+	}
+
+	header := signature[0]
+	if header < headerUncompressedP2PKH || header > headerMax {
+		return nil, errors.Wrapf(ErrInvalidMessageSignature,
+			"signature has invalid header byte %d, expected [%d, %d]",
+			header, headerUncompressedP2PKH, headerMax)
+	}
+
+	// Normalize the header byte to the P2PKH one understood by btcec.
+	normalizedSig := make([]byte, compactSignatureLen)
+	copy(normalizedSig, signature)
+	normalizedSig[0] = headerUncompressedP2PKH + recoveryID(header)
+	if header >= headerCompressedP2PKH {
+		normalizedSig[0] = headerCompressedP2PKH + recoveryID(header)
+	}
+
+	publicKey, _, err := ecdsa.RecoverCompact(normalizedSig, hash)
+	if err != nil {
+		return nil, errors.Wrapf(ErrInvalidMessageSignature,
+			"failed to recover public key: %v", err)
+	}
+
+	return publicKey, nil
+}
+
+// messageHash returns the double-SHA256 of a message, prefixed with the
+// magic and the length of the message, as signed in the Bitcoin "signed
+// message" format.
+func messageHash(message string) []byte {
+	var buf bytes.Buffer
+
+	// Writing to a bytes.Buffer never fails.
+	_ = wire.WriteVarString(&buf, 0, messageMagic)
+	_ = wire.WriteVarString(&buf, 0, message)
+
+	return chainhash.DoubleHashB(buf.Bytes())
+}
+
+// recoveryID returns the recovery id encoded in the header byte of a compact
+// signature.
+func recoveryID(header byte) byte {
+	return (header - headerUncompressedP2PKH) & 3
+}
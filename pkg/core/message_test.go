@@ -0,0 +1,266 @@
+package core
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/hex"
+	"testing"
+
+	"github.com/btcsuite/btcd/btcec/v2"
+	"github.com/ledgerhq/bitcoin-lib-grpc/pkg/chaincfg"
+	"github.com/pkg/errors"
+)
+
+// Test vectors of bitcoinjs-message, signed with the private key of the WIF
+// L4rK1yDtCWekvXuE6oXD9jCYfFNV2cWRpVuPLBcCU2z8TrisoyY1.
+const (
+	messageVectorPrivKey = "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855"
+	messageVectorMessage = "This is an example of a signed message."
+)
+
+func TestSignMessage(t *testing.T) {
+	privKey, _ := hex.DecodeString(messageVectorPrivKey)
+
+	tests := []struct {
+		name          string
+		privKey       []byte
+		encoding      AddressEncoding
+		compressed    bool
+		wantSignature string
+		wantErr       error
+	}{
+		{
+			name:          "P2PKH uncompressed",
+			privKey:       privKey,
+			encoding:      Legacy,
+			compressed:    false,
+			wantSignature: "G9L5yLFjti0QTHhPyFrZCT1V/MMnBtXKmoiKDZ78NDBjERki6ZTQZdSMCtkgoNmp17By9ItJr8o7ChX0XxY91nk=",
+		},
+		{
+			name:          "P2PKH compressed",
+			privKey:       privKey,
+			encoding:      Legacy,
+			compressed:    true,
+			wantSignature: "H9L5yLFjti0QTHhPyFrZCT1V/MMnBtXKmoiKDZ78NDBjERki6ZTQZdSMCtkgoNmp17By9ItJr8o7ChX0XxY91nk=",
+		},
+		{
+			name:          "P2SH-P2WPKH",
+			privKey:       privKey,
+			encoding:      WrappedSegwit,
+			compressed:    true,
+			wantSignature: "I9L5yLFjti0QTHhPyFrZCT1V/MMnBtXKmoiKDZ78NDBjERki6ZTQZdSMCtkgoNmp17By9ItJr8o7ChX0XxY91nk=",
+		},
+		{
+			name:          "P2WPKH",
+			privKey:       privKey,
+			encoding:      NativeSegwit,
+			compressed:    true,
+			wantSignature: "J9L5yLFjti0QTHhPyFrZCT1V/MMnBtXKmoiKDZ78NDBjERki6ZTQZdSMCtkgoNmp17By9ItJr8o7ChX0XxY91nk=",
+		},
+		{
+			name:       "P2TR",
+			privKey:    privKey,
+			encoding:   Taproot,
+			compressed: true,
+			wantErr:    ErrUnknownAddressType,
+		},
+		{
+			name:     "zero scalar",
+			privKey:  make([]byte, 32),
+			encoding: Legacy,
+			wantErr:  ErrInvalidPrivateKey,
+		},
+	}
+
+	s := &Service{}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := s.SignMessage(tt.privKey, messageVectorMessage, tt.encoding, tt.compressed)
+			if errors.Cause(err) != tt.wantErr {
+				t.Fatalf("SignMessage() got error '%v', want '%v'", err, tt.wantErr)
+			}
+
+			if got != tt.wantSignature {
+				t.Fatalf("SignMessage() got signature '%s', want '%s'", got, tt.wantSignature)
+			}
+		})
+	}
+
+	// Segwit addresses cannot be derived from uncompressed public keys.
+	if _, err := s.SignMessage(privKey, messageVectorMessage, NativeSegwit, false); errors.Cause(err) != ErrUncompressedPublicKey {
+		t.Fatalf("SignMessage() got error '%v', want '%v'", err, ErrUncompressedPublicKey)
+	}
+}
+
+func TestVerifyMessage(t *testing.T) {
+	tests := []struct {
+		name        string
+		address     string
+		message     string
+		signature   string
+		chainParams chaincfg.ChainParams
+		want        bool
+		wantErr     error
+	}{
+		{
+			name:        "P2PKH uncompressed",
+			address:     "1HZwkjkeaoZfTSaJxDw6aKkxp45agDiEzN",
+			message:     messageVectorMessage,
+			signature:   "G9L5yLFjti0QTHhPyFrZCT1V/MMnBtXKmoiKDZ78NDBjERki6ZTQZdSMCtkgoNmp17By9ItJr8o7ChX0XxY91nk=",
+			chainParams: chaincfg.BitcoinMainNetParams,
+			want:        true,
+		},
+		{
+			name:        "P2PKH compressed",
+			address:     "1F3sAm6ZtwLAUnj7d38pGFxtP3RVEvtsbV",
+			message:     messageVectorMessage,
+			signature:   "H9L5yLFjti0QTHhPyFrZCT1V/MMnBtXKmoiKDZ78NDBjERki6ZTQZdSMCtkgoNmp17By9ItJr8o7ChX0XxY91nk=",
+			chainParams: chaincfg.BitcoinMainNetParams,
+			want:        true,
+		},
+		{
+			name:        "P2SH-P2WPKH",
+			address:     "3DnW8JGpPViEZdpqat8qky1zc26EKbXnmM",
+			message:     messageVectorMessage,
+			signature:   "I9L5yLFjti0QTHhPyFrZCT1V/MMnBtXKmoiKDZ78NDBjERki6ZTQZdSMCtkgoNmp17By9ItJr8o7ChX0XxY91nk=",
+			chainParams: chaincfg.BitcoinMainNetParams,
+			want:        true,
+		},
+		{
+			name:        "P2WPKH",
+			address:     "bc1qngw83fg8dz0k749cg7k3emc7v98wy0c74dlrkd",
+			message:     messageVectorMessage,
+			signature:   "J9L5yLFjti0QTHhPyFrZCT1V/MMnBtXKmoiKDZ78NDBjERki6ZTQZdSMCtkgoNmp17By9ItJr8o7ChX0XxY91nk=",
+			chainParams: chaincfg.BitcoinMainNetParams,
+			want:        true,
+		},
+		{
+			name:        "other message",
+			address:     "1F3sAm6ZtwLAUnj7d38pGFxtP3RVEvtsbV",
+			message:     "This is another message.",
+			signature:   "H9L5yLFjti0QTHhPyFrZCT1V/MMnBtXKmoiKDZ78NDBjERki6ZTQZdSMCtkgoNmp17By9ItJr8o7ChX0XxY91nk=",
+			chainParams: chaincfg.BitcoinMainNetParams,
+			want:        false,
+		},
+		{
+			name:        "header of another address type",
+			address:     "bc1qngw83fg8dz0k749cg7k3emc7v98wy0c74dlrkd",
+			message:     messageVectorMessage,
+			signature:   "H9L5yLFjti0QTHhPyFrZCT1V/MMnBtXKmoiKDZ78NDBjERki6ZTQZdSMCtkgoNmp17By9ItJr8o7ChX0XxY91nk=",
+			chainParams: chaincfg.BitcoinMainNetParams,
+			want:        false,
+		},
+		{
+			name:        "invalid base64",
+			address:     "1F3sAm6ZtwLAUnj7d38pGFxtP3RVEvtsbV",
+			message:     messageVectorMessage,
+			signature:   "H9L5yLFjti0QTHhPyFrZCT1V!",
+			chainParams: chaincfg.BitcoinMainNetParams,
+			wantErr:     ErrInvalidMessageSignature,
+		},
+		{
+			name:        "invalid length",
+			address:     "1F3sAm6ZtwLAUnj7d38pGFxtP3RVEvtsbV",
+			message:     messageVectorMessage,
+			signature:   "H9L5yLFjti0QTHhPyFrZCT1V/MMnBtXKmoiKDZ78NDBjERki6ZTQZdSMCtkgoNmp17By9ItJr8o7ChX0XxY9",
+			chainParams: chaincfg.BitcoinMainNetParams,
+			wantErr:     ErrInvalidMessageSignature,
+		},
+		{
+			name:        "invalid header byte",
+			address:     "1F3sAm6ZtwLAUnj7d38pGFxtP3RVEvtsbV",
+			message:     messageVectorMessage,
+			signature:   "K9L5yLFjti0QTHhPyFrZCT1V/MMnBtXKmoiKDZ78NDBjERki6ZTQZdSMCtkgoNmp17By9ItJr8o7ChX0XxY91nk=",
+			chainParams: chaincfg.BitcoinMainNetParams,
+			wantErr:     ErrInvalidMessageSignature,
+		},
+		{
+			name:        "address of another network",
+			address:     "1F3sAm6ZtwLAUnj7d38pGFxtP3RVEvtsbV",
+			message:     messageVectorMessage,
+			signature:   "H9L5yLFjti0QTHhPyFrZCT1V/MMnBtXKmoiKDZ78NDBjERki6ZTQZdSMCtkgoNmp17By9ItJr8o7ChX0XxY91nk=",
+			chainParams: chaincfg.LitecoinMainNetParams,
+			wantErr:     ErrUnknownAddressType,
+		},
+	}
+
+	s := &Service{}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := s.VerifyMessage(tt.address, tt.message, tt.signature, tt.chainParams)
+			if errors.Cause(err) != tt.wantErr {
+				t.Fatalf("VerifyMessage() got error '%v', want '%v'", err, tt.wantErr)
+			}
+
+			if got != tt.want {
+				t.Fatalf("VerifyMessage() got '%v', want '%v'", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRecoverPublicKey(t *testing.T) {
+	privKey, _ := hex.DecodeString(messageVectorPrivKey)
+	_, wantPubKey := btcec.PrivKeyFromBytes(privKey)
+
+	s := &Service{}
+
+	for _, encoding := range []AddressEncoding{Legacy, WrappedSegwit, NativeSegwit} {
+		signature, err := s.SignMessage(privKey, messageVectorMessage, encoding, true)
+		if err != nil {
+			t.Fatalf("SignMessage() got error '%v'", err)
+		}
+
+		sig, _ := base64.StdEncoding.DecodeString(signature)
+
+		got, err := s.RecoverPublicKey(messageHash(messageVectorMessage), sig)
+		if err != nil {
+			t.Fatalf("RecoverPublicKey() got error '%v' for %s signature", err, encoding)
+		}
+
+		if !bytes.Equal(got, wantPubKey.SerializeCompressed()) {
+			t.Fatalf("RecoverPublicKey() got %x for %s signature, want %x",
+				got, encoding, wantPubKey.SerializeCompressed())
+		}
+	}
+
+	sig, _ := base64.StdEncoding.DecodeString(
+		"H9L5yLFjti0QTHhPyFrZCT1V/MMnBtXKmoiKDZ78NDBjERki6ZTQZdSMCtkgoNmp17By9ItJr8o7ChX0XxY91nk=")
+
+	invalidHeaderSig := append([]byte{26}, sig[1:]...)
+
+	tests := []struct {
+		name      string
+		hash      []byte
+		signature []byte
+		wantErr   error
+	}{
+		{
+			name:      "invalid length",
+			hash:      messageHash(messageVectorMessage),
+			signature: sig[:64],
+			wantErr:   ErrInvalidMessageSignature,
+		},
+		{
+			name:      "invalid header byte",
+			hash:      messageHash(messageVectorMessage),
+			signature: invalidHeaderSig,
+			wantErr:   ErrInvalidMessageSignature,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := s.RecoverPublicKey(tt.hash, tt.signature)
+			if errors.Cause(err) != tt.wantErr {
+				t.Fatalf("RecoverPublicKey() got error '%v', want '%v'", err, tt.wantErr)
+			}
+		})
+	}
+
+	if _, err := s.RecoverPublicKey(sig[:31], sig); err == nil {
+		t.Fatalf("RecoverPublicKey() got no error for a 31-byte hash")
+	}
+}
@@ -0,0 +1,118 @@
+package core
+
+import (
+	"context"
+	"crypto/rand"
+	"strings"
+
+	"github.com/ledgerhq/bitcoin-lib-grpc/pkg/chaincfg"
+	"github.com/pkg/errors"
+	"github.com/tyler-smith/go-bip39"
+)
+
+// References:
+//   [BIP39]: BIP0039 - Mnemonic code for generating deterministic keys
+//   https://github.com/bitcoin/bips/blob/master/bip-0039.mediawiki
+
+// KeypairFromMnemonic returns the keypair of the extended key derived at
+// the given derivation path, from the seed of a BIP0039 mnemonic.
+//
+// The mnemonic must be made of 12, 15, 18, 21 or 24 words of the English
+// wordlist, with a valid checksum. It is rejected with ErrInvalidMnemonic
+// otherwise. Words may be separated by any whitespace.
+//
+// The 64-byte seed is derived from the mnemonic and the optional
+// passphrase with PBKDF2-HMAC-SHA512, as specified by BIP0039.
+func (s *Service) KeypairFromMnemonic(
+	mnemonic string,
+	passphrase string,
+	chainParams chaincfg.ChainParams,
+	derivation []uint32,
+) (Keypair, error) {
+	// Normalize the separators, which are part of the PBKDF2 password.
+	mnemonic = strings.Join(strings.Fields(mnemonic), " ")
+
+	if err := validateMnemonic(mnemonic); err != nil {
+		return Keypair{}, err
+	}
+
+	seed := bip39.NewSeed(mnemonic, passphrase)
+	defer zeroBytes(seed)
+
+	return keypairFromSeed(context.Background(), seed, chainParams, derivation, false)
+}
+
+// MasterFingerprintFromMnemonic returns the fingerprint of the BIP0032
+// master key of the seed of a BIP0039 mnemonic, like MasterFingerprint.
+// The mnemonic is validated like in KeypairFromMnemonic.
+func (s *Service) MasterFingerprintFromMnemonic(
+	mnemonic string,
+	passphrase string,
+	chainParams chaincfg.ChainParams,
+) ([4]byte, error) {
+	mnemonic = strings.Join(strings.Fields(mnemonic), " ")
+
+	if err := validateMnemonic(mnemonic); err != nil {
+		return [4]byte{}, err
+	}
+
+	seed := bip39.NewSeed(mnemonic, passphrase)
+	defer zeroBytes(seed)
+
+	return masterFingerprint(seed, chainParams)
+}
+
+// GenerateMnemonic returns a new BIP0039 mnemonic of the English wordlist,
+// encoding entropyBits bits of entropy read from crypto/rand.
+//
+// The entropy size must be 128, 160, 192, 224 or 256 bits, for a mnemonic
+// of 12, 15, 18, 21 or 24 words respectively. It is rejected with
+// ErrInvalidEntropySize otherwise.
+func (s *Service) GenerateMnemonic(entropyBits int) (string, error) {
+	if entropyBits < 128 || entropyBits > 256 || entropyBits%32 != 0 {
+		return "", errors.Wrapf(ErrInvalidEntropySize,
+			"got %d bits, expected 128, 160, 192, 224 or 256", entropyBits)
+	}
+
+	entropy := make([]byte, entropyBits/8)
+	if _, err := rand.Read(entropy); err != nil {
+		return "", errors.Wrap(err, "failed to read entropy")
+	}
+
+	mnemonic, err := bip39.NewMnemonic(entropy)
+	if err != nil {
+		return "", errors.Wrap(err, "failed to encode mnemonic")
+	}
+
+	return mnemonic, nil
+}
+
+// validateMnemonic checks the words and the checksum of a BIP0039 mnemonic,
+// and returns a descriptive error wrapping ErrInvalidMnemonic, if invalid.
+func validateMnemonic(mnemonic string) error {
+	words := strings.Fields(mnemonic)
+
+	switch len(words) {
+	case 12, 15, 18, 21, 24:
+	default:
+		return errors.Wrapf(ErrInvalidMnemonic,
+			"mnemonic has %d words, expected 12, 15, 18, 21 or 24", len(words))
+	}
+
+	for idx, word := range words {
+		if _, ok := bip39.GetWordIndex(word); !ok {
+			return errors.Wrapf(ErrInvalidMnemonic,
+				"word %d '%s' is not in the BIP0039 English wordlist", idx+1, word)
+		}
+	}
+
+	if _, err := bip39.EntropyFromMnemonic(mnemonic); err != nil {
+		if err == bip39.ErrChecksumIncorrect {
+			return errors.Wrap(ErrInvalidMnemonic, "checksum mismatch")
+		}
+
+		return errors.Wrapf(ErrInvalidMnemonic, "%v", err)
+	}
+
+	return nil
+}
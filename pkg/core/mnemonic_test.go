@@ -0,0 +1,153 @@
+package core
+
+import (
+	"encoding/hex"
+	"strings"
+	"testing"
+
+	"github.com/ledgerhq/bitcoin-lib-grpc/pkg/chaincfg"
+	"github.com/pkg/errors"
+)
+
+func TestKeypairFromMnemonic(t *testing.T) {
+	tests := []struct {
+		name           string
+		mnemonic       string
+		passphrase     string
+		wantPrivateKey string
+		wantErr        error
+	}{
+		// BIP0039: Test vectors, with the passphrase "TREZOR". The
+		// expected keys are the BIP0032 root keys.
+		{
+			name:           "12 words",
+			mnemonic:       "abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon about",
+			passphrase:     "TREZOR",
+			wantPrivateKey: "xprv9s21ZrQH143K3h3fDYiay8mocZ3afhfULfb5GX8kCBdno77K4HiA15Tg23wpbeF1pLfs1c5SPmYHrEpTuuRhxMwvKDwqdKiGJS9XFKzUsAF",
+		},
+		{
+			name:           "12 words with 0x7f entropy",
+			mnemonic:       "legal winner thank year wave sausage worth useful legal winner thank yellow",
+			passphrase:     "TREZOR",
+			wantPrivateKey: "xprv9s21ZrQH143K2gA81bYFHqU68xz1cX2APaSq5tt6MFSLeXnCKV1RVUJt9FWNTbrrryem4ZckN8k4Ls1H6nwdvDTvnV7zEXs2HgPezuVccsq",
+		},
+		{
+			name:           "12 words with 0xff entropy",
+			mnemonic:       "zoo zoo zoo zoo zoo zoo zoo zoo zoo zoo zoo wrong",
+			passphrase:     "TREZOR",
+			wantPrivateKey: "xprv9s21ZrQH143K2V4oox4M8Zmhi2Fjx5XK4Lf7GKRvPSgydU3mjZuKGCTg7UPiBUD7ydVPvSLtg9hjp7MQTYsW67rZHAXeccqYqrsx8LcXnyd",
+		},
+		{
+			name:           "24 words",
+			mnemonic:       "abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon art",
+			passphrase:     "TREZOR",
+			wantPrivateKey: "xprv9s21ZrQH143K32qBagUJAMU2LsHg3ka7jqMcV98Y7gVeVyNStwYS3U7yVVoDZ4btbRNf4h6ibWpY22iRmXq35qgLs79f312g2kj5539ebPM",
+		},
+		{
+			name:           "extra whitespace",
+			mnemonic:       "  abandon abandon abandon abandon abandon abandon\tabandon abandon abandon abandon abandon  about ",
+			passphrase:     "TREZOR",
+			wantPrivateKey: "xprv9s21ZrQH143K3h3fDYiay8mocZ3afhfULfb5GX8kCBdno77K4HiA15Tg23wpbeF1pLfs1c5SPmYHrEpTuuRhxMwvKDwqdKiGJS9XFKzUsAF",
+		},
+		{
+			name:     "invalid checksum",
+			mnemonic: "abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon",
+			wantErr:  ErrInvalidMnemonic,
+		},
+		{
+			name:     "unknown word",
+			mnemonic: "abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon lama",
+			wantErr:  ErrInvalidMnemonic,
+		},
+		{
+			name:     "invalid number of words",
+			mnemonic: "abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon about",
+			wantErr:  ErrInvalidMnemonic,
+		},
+	}
+
+	s := &Service{}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := s.KeypairFromMnemonic(
+				tt.mnemonic, tt.passphrase, chaincfg.BitcoinMainNetParams, nil)
+			if errors.Cause(err) != tt.wantErr {
+				t.Fatalf("KeypairFromMnemonic() got error '%v', want '%v'",
+					err, tt.wantErr)
+			}
+
+			if got.PrivateKey != tt.wantPrivateKey {
+				t.Fatalf("KeypairFromMnemonic() got private key '%s', want '%s'",
+					got.PrivateKey, tt.wantPrivateKey)
+			}
+		})
+	}
+}
+
+func TestMasterFingerprintFromMnemonic(t *testing.T) {
+	tests := []struct {
+		name       string
+		mnemonic   string
+		passphrase string
+		want       string
+		wantErr    error
+	}{
+		{
+			// BIP0084: Test Vectors, key origin of the account descriptor
+			name:     "12 words without passphrase",
+			mnemonic: "abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon about",
+			want:     "73c5da0a",
+		},
+		{
+			name:     "invalid checksum",
+			mnemonic: "abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon",
+			wantErr:  ErrInvalidMnemonic,
+		},
+	}
+
+	s := &Service{}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := s.MasterFingerprintFromMnemonic(
+				tt.mnemonic, tt.passphrase, chaincfg.BitcoinMainNetParams)
+			if errors.Cause(err) != tt.wantErr {
+				t.Fatalf("MasterFingerprintFromMnemonic() got error '%v', want '%v'", err, tt.wantErr)
+			}
+
+			if tt.wantErr == nil && hex.EncodeToString(got[:]) != tt.want {
+				t.Fatalf("MasterFingerprintFromMnemonic() got '%x', want '%s'", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestGenerateMnemonic(t *testing.T) {
+	s := &Service{}
+
+	for _, entropyBits := range []int{128, 160, 192, 224, 256} {
+		mnemonic, err := s.GenerateMnemonic(entropyBits)
+		if err != nil {
+			t.Fatalf("GenerateMnemonic(%d) got error '%v'", entropyBits, err)
+		}
+
+		if err := validateMnemonic(mnemonic); err != nil {
+			t.Fatalf("GenerateMnemonic(%d) got invalid mnemonic '%s': %v",
+				entropyBits, mnemonic, err)
+		}
+
+		if got, want := len(strings.Fields(mnemonic)), entropyBits*3/32; got != want {
+			t.Fatalf("GenerateMnemonic(%d) got %d words, want %d",
+				entropyBits, got, want)
+		}
+	}
+
+	for _, entropyBits := range []int{0, 96, 127, 130, 288} {
+		_, err := s.GenerateMnemonic(entropyBits)
+		if errors.Cause(err) != ErrInvalidEntropySize {
+			t.Fatalf("GenerateMnemonic(%d) got error '%v', want '%v'",
+				entropyBits, err, ErrInvalidEntropySize)
+		}
+	}
+}
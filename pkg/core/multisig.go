@@ -0,0 +1,124 @@
+package core
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+
+	"github.com/btcsuite/btcd/btcutil"
+	"github.com/btcsuite/btcd/txscript"
+	"github.com/ledgerhq/bitcoin-lib-grpc/pkg/chaincfg"
+	"github.com/pkg/errors"
+)
+
+// maxP2SHMultisigKeys is the maximum number of public keys of a multisig
+// redeemScript in P2SH. With 15 compressed public keys, the redeemScript is
+// close to the 520-byte limit of the push in the scriptSig.
+const maxP2SHMultisigKeys = 15
+
+// EncodeMultisigAddress returns the address of a threshold-of-n multisig
+// script, built from the public keys in the given order:
+//   <threshold> <public key 1> ... <public key n> <n> OP_CHECKMULTISIG
+//
+// The encoding selects how the multisig script is wrapped:
+//   * Legacy: P2SH, with the multisig script as redeemScript.
+//   * WrappedSegwit: P2SH-P2WSH, with the multisig script as witnessScript.
+//   * NativeSegwit: P2WSH, with the multisig script as witnessScript.
+//
+// P2SH accepts up to 15 public keys, compressed or uncompressed, as long as
+// the redeemScript fits in 520 bytes. Segwit encodings accept up to 20
+// compressed public keys.
+//
+// References:
+//   [BIP16]: BIP0016 - Pay to Script Hash
+//   https://github.com/bitcoin/bips/blob/master/bip-0016.mediawiki
+//
+//   [BIP141]: BIP0141 - Segregated Witness (Consensus layer)
+//   https://github.com/bitcoin/bips/blob/master/bip-0141.mediawiki#p2wsh
+func (s *Service) EncodeMultisigAddress(
+	publicKeys [][]byte,
+	threshold int,
+	encoding AddressEncoding,
+	chainParams chaincfg.ChainParams,
+) (string, error) {
+	maxKeys := txscript.MaxPubKeysPerMultiSig
+	if encoding == Legacy {
+		maxKeys = maxP2SHMultisigKeys
+	}
+
+	if len(publicKeys) == 0 || len(publicKeys) > maxKeys {
+		return "", errors.Errorf("got %d public keys, expected between 1 and %d for %s multisig",
+			len(publicKeys), maxKeys, encoding)
+	}
+
+	if threshold < 1 || threshold > len(publicKeys) {
+		return "", errors.Errorf("threshold %d must be between 1 and the number of public keys %d",
+			threshold, len(publicKeys))
+	}
+
+	keys := make([]*btcutil.AddressPubKey, len(publicKeys))
+
+	for idx, publicKey := range publicKeys {
+		if encoding != Legacy {
+			if err := checkSegwitPublicKey(publicKey); err != nil {
+				return "", errors.Wrapf(err, "public key %d of %s multisig", idx, encoding)
+			}
+		}
+
+		key, err := btcutil.NewAddressPubKey(publicKey, chainParams)
+		if err != nil {
+			return "", errors.Wrapf(err, "failed to parse public key %s",
+				hex.EncodeToString(publicKey))
+		}
+
+		keys[idx] = key
+	}
+
+	multisigScript, err := txscript.MultiSigScript(keys, threshold)
+	if err != nil {
+		return "", errors.Wrap(err, "failed to build multisig script")
+	}
+
+	var address btcutil.Address
+
+	switch encoding {
+	case Legacy:
+		if len(multisigScript) > txscript.MaxScriptElementSize {
+			return "", errors.Errorf("redeemScript is %d bytes long, exceeding the limit of %d",
+				len(multisigScript), txscript.MaxScriptElementSize)
+		}
+
+		address, err = btcutil.NewAddressScriptHash(multisigScript, chainParams)
+	case WrappedSegwit:
+		witnessScriptHash := sha256.Sum256(multisigScript)
+
+		var p2wshAddress *btcutil.AddressWitnessScriptHash
+
+		p2wshAddress, err = btcutil.NewAddressWitnessScriptHash(witnessScriptHash[:], chainParams)
+		if err != nil {
+			return "", errors.Wrap(err, "failed to create P2WSH address")
+		}
+
+		// Create a P2SH redeemScript that pays to the P2WSH address:
+		//   OP_0 <sha256(witnessScript)>
+		var redeemScript []byte
+
+		redeemScript, err = txscript.PayToAddrScript(p2wshAddress)
+		if err != nil {
+			return "", errors.Wrap(err, "failed to build redeemScript")
+		}
+
+		address, err = btcutil.NewAddressScriptHash(redeemScript, chainParams)
+	case NativeSegwit:
+		witnessScriptHash := sha256.Sum256(multisigScript)
+		address, err = btcutil.NewAddressWitnessScriptHash(witnessScriptHash[:], chainParams)
+	default:
+		return "", errors.Wrapf(ErrUnknownAddressType,
+			"unsupported encoding %s for multisig", encoding)
+	}
+
+	if err != nil {
+		return "", errors.Wrapf(err, "failed to encode %s multisig address", encoding)
+	}
+
+	return address.EncodeAddress(), nil
+}
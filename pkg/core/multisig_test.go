@@ -0,0 +1,129 @@
+package core
+
+import (
+	"encoding/hex"
+	"testing"
+
+	"github.com/ledgerhq/bitcoin-lib-grpc/pkg/chaincfg"
+	"github.com/pkg/errors"
+)
+
+func TestEncodeMultisigAddress(t *testing.T) {
+	// Compressed public keys of the private keys 1, 2 and 3.
+	var publicKeys [][]byte
+	for _, publicKey := range []string{
+		"0279be667ef9dcbbac55a06295ce870b07029bfcdb2dce28d959f2815b16f81798",
+		"02c6047f9441ed7d6d3045406e95c07cd85c778e4b8cef3ca7abac09b95c709ee5",
+		"02f9308a019258c31049344f85f89d5229b531c845836f99b08601f113bce036f9",
+	} {
+		decoded, _ := hex.DecodeString(publicKey)
+		publicKeys = append(publicKeys, decoded)
+	}
+
+	uncompressedPublicKey, _ := hex.DecodeString(
+		"0479be667ef9dcbbac55a06295ce870b07029bfcdb2dce28d959f2815b16f81798" +
+			"483ada7726a3c4655da4fbfc0e1108a8fd17b448a68554199c47d08ffb10d4b8")
+
+	tooManyPublicKeys := make([][]byte, maxP2SHMultisigKeys+1)
+	for idx := range tooManyPublicKeys {
+		tooManyPublicKeys[idx] = publicKeys[0]
+	}
+
+	tests := []struct {
+		name       string
+		publicKeys [][]byte
+		threshold  int
+		encoding   AddressEncoding
+		want       string
+		wantErr    bool
+	}{
+		{
+			name:       "2-of-3 P2SH",
+			publicKeys: publicKeys,
+			threshold:  2,
+			encoding:   Legacy,
+			want:       "33hG2q39jRi2NqicRJB4ggY1J8EJm97Szz",
+		},
+		{
+			name:       "2-of-3 P2SH-P2WSH",
+			publicKeys: publicKeys,
+			threshold:  2,
+			encoding:   WrappedSegwit,
+			want:       "3L3mWb3pAZfMACpEjSEcmDWnsyHqt4yJym",
+		},
+		{
+			name:       "2-of-3 P2WSH",
+			publicKeys: publicKeys,
+			threshold:  2,
+			encoding:   NativeSegwit,
+			want:       "bc1qztp0l0rwc8846ardl02fkyrrx43p96j47scz8l7qz3vnfteqc4eqtfqwcm",
+		},
+		{
+			name:       "threshold above key count",
+			publicKeys: publicKeys,
+			threshold:  4,
+			encoding:   NativeSegwit,
+			wantErr:    true,
+		},
+		{
+			name:       "zero threshold",
+			publicKeys: publicKeys,
+			threshold:  0,
+			encoding:   NativeSegwit,
+			wantErr:    true,
+		},
+		{
+			name:       "too many keys for P2SH",
+			publicKeys: tooManyPublicKeys,
+			threshold:  1,
+			encoding:   Legacy,
+			wantErr:    true,
+		},
+		{
+			name:       "taproot",
+			publicKeys: publicKeys,
+			threshold:  2,
+			encoding:   Taproot,
+			wantErr:    true,
+		},
+		{
+			name:       "invalid public key",
+			publicKeys: [][]byte{publicKeys[0], make([]byte, 33)},
+			threshold:  1,
+			encoding:   Legacy,
+			wantErr:    true,
+		},
+	}
+
+	s := &Service{}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := s.EncodeMultisigAddress(
+				tt.publicKeys, tt.threshold, tt.encoding, chaincfg.BitcoinMainNetParams)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("EncodeMultisigAddress() got error '%v', wantErr %v", err, tt.wantErr)
+			}
+
+			if got != tt.want {
+				t.Fatalf("EncodeMultisigAddress() got '%s', want '%s'", got, tt.want)
+			}
+		})
+	}
+
+	// Segwit scripts only accept compressed public keys.
+	_, err := s.EncodeMultisigAddress(
+		[][]byte{publicKeys[0], uncompressedPublicKey}, 1, NativeSegwit,
+		chaincfg.BitcoinMainNetParams)
+	if errors.Cause(err) != ErrUncompressedPublicKey {
+		t.Fatalf("EncodeMultisigAddress() got error '%v', want '%v'",
+			err, ErrUncompressedPublicKey)
+	}
+
+	// Uncompressed public keys are accepted in P2SH.
+	if _, err := s.EncodeMultisigAddress(
+		[][]byte{publicKeys[0], uncompressedPublicKey}, 1, Legacy,
+		chaincfg.BitcoinMainNetParams); err != nil {
+		t.Fatalf("EncodeMultisigAddress() got error '%v'", err)
+	}
+}
@@ -2,4 +2,8 @@ package core
 
 // Service type provides a bridge to access functions related to the
 // Bitcoin protocol.
+//
+// Service holds no state, and its methods only read package-level tables
+// initialized at startup, so that a single Service is safe for concurrent
+// use by multiple goroutines.
 type Service struct{}
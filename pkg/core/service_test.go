@@ -0,0 +1,103 @@
+package core
+
+import (
+	"context"
+	"encoding/hex"
+	"reflect"
+	"sync"
+	"testing"
+
+	"github.com/ledgerhq/bitcoin-lib-grpc/pkg/chaincfg"
+)
+
+// TestService_Concurrency calls the methods of a single Service from many
+// goroutines, and checks that they return the same results as sequential
+// calls. Run with -race to detect shared state.
+func TestService_Concurrency(t *testing.T) {
+	const (
+		goroutines = 16
+		iterations = 20
+	)
+
+	publicKey, _ := hex.DecodeString(
+		"0330d54fd0dd420a6e5f8d3624f5f3482cae350f79d5f0753bf5beef9c2d91af3c")
+
+	s := &Service{}
+
+	deriveExtendedKey := func() (interface{}, error) {
+		// BIP0032: Test Vector 1 (chain m/0H/1)
+		return s.DeriveExtendedKey(context.Background(),
+			"xpub6ASuArnXKPbfEwhqN6e3mwBcDTgzisQN1wXN9BJcM47sSikHjJf3UFHKkNAWbWMiGj7Wf5uMash7SyYq527Hqck2AxYysAA7xmALppuCkwQ",
+			[]uint32{2, 1000000000})
+	}
+
+	encodeAddress := func() (interface{}, error) {
+		return s.EncodeAddress(publicKey, NativeSegwit, true,
+			chaincfg.BitcoinMainNetParams)
+	}
+
+	// The change output is at a random position, unless sorted.
+	createTransaction := func() (interface{}, error) {
+		return s.CreateTransaction(&Tx{
+			Inputs: []Input{
+				{
+					OutputHash:  "2f5dae23c2e18588c86cfc4e154f3b68bd8eb4265fe0b4b1341ad5aa40422f66",
+					OutputIndex: 0,
+					Value:       1000000,
+				},
+			},
+			Outputs: []Output{
+				{
+					Address: "1MZbRqZGpiSWGRLg8DUdVrDKHwNe1oesUZ",
+					Value:   100000,
+				},
+			},
+			ChangeAddress: "1GgX4cGLiqF9p4Sd1XcPQhEAAhNDA4wLYS",
+			FeeSatPerKb:   1000,
+			Ordering:      Bip69,
+		}, chaincfg.BitcoinMainNetParams)
+	}
+
+	tests := []struct {
+		name string
+		call func() (interface{}, error)
+	}{
+		{name: "DeriveExtendedKey", call: deriveExtendedKey},
+		{name: "EncodeAddress", call: encodeAddress},
+		{name: "CreateTransaction", call: createTransaction},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			want, err := tt.call()
+			if err != nil {
+				t.Fatalf("%s() unexpected error = %v", tt.name, err)
+			}
+
+			var wg sync.WaitGroup
+
+			for i := 0; i < goroutines; i++ {
+				wg.Add(1)
+
+				go func() {
+					defer wg.Done()
+
+					for j := 0; j < iterations; j++ {
+						got, err := tt.call()
+						if err != nil {
+							t.Errorf("%s() unexpected error = %v", tt.name, err)
+							return
+						}
+
+						if !reflect.DeepEqual(got, want) {
+							t.Errorf("%s() got '%+v', want '%+v'", tt.name, got, want)
+							return
+						}
+					}
+				}()
+			}
+
+			wg.Wait()
+		})
+	}
+}
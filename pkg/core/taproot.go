@@ -0,0 +1,268 @@
+package core
+
+import (
+	"bytes"
+
+	"github.com/btcsuite/btcd/btcec/v2"
+	"github.com/btcsuite/btcd/btcec/v2/schnorr"
+	"github.com/btcsuite/btcd/btcutil"
+	"github.com/btcsuite/btcd/btcutil/bech32"
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/btcsuite/btcd/txscript"
+	"github.com/btcsuite/btcd/wire"
+	"github.com/decred/dcrd/dcrec/secp256k1/v4"
+	"github.com/ledgerhq/bitcoin-lib-grpc/pkg/chaincfg"
+	"github.com/pkg/errors"
+)
+
+// References:
+//   [BIP340]: BIP0340 - Schnorr Signatures for secp256k1
+//   https://github.com/bitcoin/bips/blob/master/bip-0340.mediawiki
+//
+//   [BIP341]: BIP0341 - Taproot: SegWit version 1 spending rules
+//   https://github.com/bitcoin/bips/blob/master/bip-0341.mediawiki
+//
+//   [BIP350]: BIP0350 - Bech32m format for v1+ witness addresses
+//   https://github.com/bitcoin/bips/blob/master/bip-0350.mediawiki
+//
+//   [BIP86]: BIP0086 - Key Derivation for Single Key P2TR Outputs
+//   https://github.com/bitcoin/bips/blob/master/bip-0086.mediawiki
+
+// checkBech32Variant returns an error wrapping ErrBech32Variant if a segwit
+// address has a valid checksum, but of the wrong variant for its witness
+// version: BIP0350 requires Bech32 for witness version 0, and Bech32m for
+// witness versions 1 and above.
+//
+// Strings that are not valid Bech32 or Bech32m strings are left to other
+// decoding errors.
+func checkBech32Variant(address string) error {
+	_, data, version, err := bech32.DecodeGeneric(address)
+	if err != nil || len(data) == 0 {
+		return nil
+	}
+
+	switch witnessVersion := data[0]; {
+	case witnessVersion == 0 && version != bech32.Version0:
+		return errors.Wrap(ErrBech32Variant,
+			"witness v0 addresses must use bech32")
+	case witnessVersion > 0 && version != bech32.VersionM:
+		return errors.Wrap(ErrBech32Variant,
+			"witness v1+ addresses must use bech32m")
+	default:
+		return nil
+	}
+}
+
+// TaprootScriptAddress is a P2TR address committing to a script tree, along
+// with the data needed to spend it using the script path.
+type TaprootScriptAddress struct {
+	Address    string
+	OutputKey  []byte
+	MerkleRoot []byte
+
+	// ControlBlocks holds the BIP0341 control block of each tap leaf, in
+	// the same order as the tap leaves.
+	ControlBlocks [][]byte
+}
+
+// EncodeTaprootScriptAddress computes the P2TR address of an internal key,
+// committing to a script tree built from the given tapscript leaves.
+//
+// The internal key may be a 32-byte x-only public key, e.g. a NUMS point
+// for outputs that can only be spent using the script path, or a 33-byte
+// compressed public key.
+//
+// The tree is built by pairing adjacent nodes at each level, starting from
+// the leaves. A node without sibling is moved up to the next level as is.
+// For example, the leaves [A, B, C] result in the tree ((A, B), C).
+func (s *Service) EncodeTaprootScriptAddress(
+	internalKey []byte, tapLeaves [][]byte, chainParams chaincfg.ChainParams,
+) (*TaprootScriptAddress, error) {
+	var (
+		key *btcec.PublicKey
+		err error
+	)
+
+	if len(internalKey) == schnorr.PubKeyBytesLen {
+		key, err = schnorr.ParsePubKey(internalKey)
+	} else {
+		key, err = btcec.ParsePubKey(internalKey)
+	}
+
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to parse internal key %x",
+			internalKey)
+	}
+
+	if len(tapLeaves) == 0 {
+		return nil, errors.New("script tree must have at least one tap leaf")
+	}
+
+	merkleRoot, inclusionProofs := tapTree(tapLeaves)
+
+	outputKey := txscript.ComputeTaprootOutputKey(key, merkleRoot[:])
+
+	address, err := btcutil.NewAddressTaproot(
+		schnorr.SerializePubKey(outputKey), chainParams)
+	if err != nil {
+		return nil, err
+	}
+
+	// The control block commits to the parity of the output key, and to the
+	// x-only internal key, followed by the merkle path of the leaf.
+	outputKeyYIsOdd := outputKey.SerializeCompressed()[0] == secp256k1.PubKeyFormatCompressedOdd
+
+	controlBlocks := make([][]byte, len(tapLeaves))
+	for idx, inclusionProof := range inclusionProofs {
+		controlBlock := txscript.ControlBlock{
+			InternalKey:     key,
+			OutputKeyYIsOdd: outputKeyYIsOdd,
+			LeafVersion:     txscript.BaseLeafVersion,
+			InclusionProof:  inclusionProof,
+		}
+
+		controlBlocks[idx], err = controlBlock.ToBytes()
+		if err != nil {
+			return nil, errors.Wrapf(err, "failed to serialize control block "+
+				"of tap leaf %d", idx)
+		}
+	}
+
+	return &TaprootScriptAddress{
+		Address:       address.EncodeAddress(),
+		OutputKey:     schnorr.SerializePubKey(outputKey),
+		MerkleRoot:    merkleRoot[:],
+		ControlBlocks: controlBlocks,
+	}, nil
+}
+
+// checkControlBlock verifies that a BIP0341 control block is well-formed for
+// a tapscript leaf, and, if outputKey is not empty, that it proves the
+// commitment of the x-only output key to the leaf.
+func checkControlBlock(controlBlock []byte, tapLeafScript []byte, outputKey []byte) error {
+	parsedControlBlock, err := txscript.ParseControlBlock(controlBlock)
+	if err != nil {
+		return errors.Wrapf(ErrInvalidControlBlock, "%v", err)
+	}
+
+	if leafVersion := parsedControlBlock.LeafVersion; leafVersion != txscript.BaseLeafVersion {
+		return errors.Wrapf(ErrInvalidControlBlock,
+			"unsupported leaf version 0x%02x", byte(leafVersion))
+	}
+
+	if len(outputKey) == 0 {
+		return nil
+	}
+
+	if err := txscript.VerifyTaprootLeafCommitment(
+		parsedControlBlock, outputKey, tapLeafScript,
+	); err != nil {
+		return errors.Wrapf(ErrInvalidControlBlock,
+			"tap leaf script is not committed to by output key %x: %v", outputKey, err)
+	}
+
+	return nil
+}
+
+// tapTree computes the merkle root of a script tree built from tapscript
+// leaves, and the inclusion proof of each leaf, i.e. the concatenated hashes
+// of its merkle path, from the leaf to the root.
+func tapTree(tapLeaves [][]byte) (chainhash.Hash, [][]byte) {
+	type node struct {
+		txscript.TapNode
+		leaves []int
+	}
+
+	inclusionProofs := make([][]byte, len(tapLeaves))
+
+	nodes := make([]node, len(tapLeaves))
+	for idx, script := range tapLeaves {
+		nodes[idx] = node{TapNode: txscript.NewBaseTapLeaf(script), leaves: []int{idx}}
+	}
+
+	for len(nodes) > 1 {
+		var parents []node
+
+		for i := 0; i < len(nodes); i += 2 {
+			if i+1 == len(nodes) {
+				parents = append(parents, nodes[i])
+				break
+			}
+
+			left, right := nodes[i], nodes[i+1]
+			leftHash, rightHash := left.TapHash(), right.TapHash()
+
+			// The sibling of every leaf below a node is added to its
+			// inclusion proof.
+			for _, leaf := range left.leaves {
+				inclusionProofs[leaf] = append(inclusionProofs[leaf], rightHash[:]...)
+			}
+
+			for _, leaf := range right.leaves {
+				inclusionProofs[leaf] = append(inclusionProofs[leaf], leftHash[:]...)
+			}
+
+			parents = append(parents, node{
+				TapNode: txscript.NewTapBranch(left.TapNode, right.TapNode),
+				leaves:  append(left.leaves, right.leaves...),
+			})
+		}
+
+		nodes = parents
+	}
+
+	return nodes[0].TapHash(), inclusionProofs
+}
+
+// signTaprootInput produces the BIP0340 signature of the P2TR input at index
+// idx, using the SIGHASH_DEFAULT signature hash type.
+//
+// For key-path spends, the private key is the one of the BIP0086 internal
+// key, and is tweaked before signing. For script-path spends, i.e. if the
+// utxo has a tap leaf script, the private key is the one of an x-only public
+// key pushed by the tap leaf script, and is used as is.
+func signTaprootInput(
+	msgTx *wire.MsgTx,
+	sigHashes *txscript.TxSigHashes,
+	idx int,
+	utxo Utxo,
+	privKey *btcec.PrivateKey,
+) ([]byte, error) {
+	if len(utxo.TapLeafScript) > 0 {
+		if !tapLeafHasKey(utxo.TapLeafScript, privKey.PubKey()) {
+			return nil, errors.Wrapf(ErrPublicKeyMismatch,
+				"private key does not match a key of the tap leaf script of input %d", idx)
+		}
+
+		return txscript.RawTxInTapscriptSignature(msgTx, sigHashes, idx, utxo.Value,
+			utxo.Script, txscript.NewBaseTapLeaf(utxo.TapLeafScript),
+			txscript.SigHashDefault, privKey)
+	}
+
+	outputKey := txscript.ComputeTaprootKeyNoScript(privKey.PubKey())
+	if !bytes.Equal(schnorr.SerializePubKey(outputKey), utxo.Script[2:]) {
+		return nil, errors.Wrapf(ErrPublicKeyMismatch,
+			"private key does not match taproot output key of input %d", idx)
+	}
+
+	return txscript.RawTxInTaprootSignature(msgTx, sigHashes, idx, utxo.Value,
+		utxo.Script, nil, txscript.SigHashDefault, privKey)
+}
+
+// tapLeafHasKey returns whether a tapscript leaf pushes the x-only form of a
+// public key, e.g. to be checked by OP_CHECKSIG.
+func tapLeafHasKey(tapLeafScript []byte, pubKey *btcec.PublicKey) bool {
+	pushes, err := txscript.PushedData(tapLeafScript)
+	if err != nil {
+		return false
+	}
+
+	xOnlyKey := schnorr.SerializePubKey(pubKey)
+	for _, push := range pushes {
+		if bytes.Equal(push, xOnlyKey) {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,163 @@
+package core
+
+import (
+	"bytes"
+	"encoding/hex"
+	"testing"
+
+	"github.com/btcsuite/btcd/txscript"
+	"github.com/btcsuite/btcd/wire"
+	"github.com/ledgerhq/bitcoin-lib-grpc/pkg/chaincfg"
+)
+
+func TestVerifyInputs_TaprootKeySpend(t *testing.T) {
+	// Key-path spend signed by Bitcoin Core, from the BIP0371 test vectors:
+	// https://github.com/bitcoin/bips/blob/master/bip-0371.mediawiki#test-vectors
+	rawTx, _ := hex.DecodeString(
+		"020000000127744ababf3027fe0d6cf23a96eee2efb188ef52301954585883e69b" +
+			"6624b2420000000000ffffffff0148e6052a01000000160014768e1eeb4cf42086" +
+			"6033f80aceff0f972074496900000000")
+	script, _ := hex.DecodeString(
+		"51205a2c2cf5b52cf31f83ad2e8da63ff03183ecd8f609c7510ae8a48e03910a0757")
+	signature, _ := hex.DecodeString(
+		"bb53ec917bad9d906af1ba87181c48b86ace5aae2b53605a725ca74625631476" +
+			"fc6f5baedaf4f2ee0f477f36f58f3970d5b8273b7e497b97af2e3f125c97af34")
+
+	msgTx := wire.NewMsgTx(wire.TxVersion)
+	if err := msgTx.Deserialize(bytes.NewReader(rawTx)); err != nil {
+		t.Fatalf("Deserialize() unexpected error: %v", err)
+	}
+
+	utxos := []Utxo{{Script: script, Value: 5000000000}}
+
+	msgTx.TxIn[0].Witness = wire.TxWitness{signature}
+	if failures := verifyInputs(msgTx, utxos); len(failures) > 0 {
+		t.Fatalf("verifyInputs() unexpected failures: %+v", failures)
+	}
+
+	// Any change to the spent amount invalidates the signature.
+	utxos[0].Value--
+
+	if failures := verifyInputs(msgTx, utxos); len(failures) != 1 {
+		t.Fatalf("verifyInputs() got %d failures, want 1", len(failures))
+	}
+}
+
+func TestEncodeTaprootScriptAddress(t *testing.T) {
+	decodeHex := func(hexStr string) []byte {
+		b, err := hex.DecodeString(hexStr)
+		if err != nil {
+			panic(err)
+		}
+		return b
+	}
+
+	tests := []struct {
+		name             string
+		internalKey      []byte
+		tapLeaves        [][]byte
+		chainParams      chaincfg.ChainParams
+		wantAddress      string
+		wantOutputKey    string
+		wantMerkleRoot   string
+		wantControlBlock []string
+		wantErr          bool
+	}{
+		{
+			// https://github.com/bitcoin/bips/blob/master/bip-0341/wallet-test-vectors.json
+			name:        "single leaf",
+			internalKey: decodeHex("187791b6f712a8ea41c8ecdd0ee77fab3e85263b37e1ec18a3651926b3a6cf27"),
+			tapLeaves: [][]byte{
+				decodeHex("20d85a959b0290bf19bb89ed43c916be835475d013da4b362117393e25a48229b8ac"),
+			},
+			chainParams:    chaincfg.BitcoinMainNetParams,
+			wantAddress:    "bc1pz37fc4cn9ah8anwm4xqqhvxygjf9rjf2resrw8h8w4tmvcs0863sa2e586",
+			wantOutputKey:  "147c9c57132f6e7ecddba9800bb0c4449251c92a1e60371ee77557b6620f3ea3",
+			wantMerkleRoot: "5b75adecf53548f3ec6ad7d78383bf84cc57b55a3127c72b9a2481752dd88b21",
+			wantControlBlock: []string{
+				"c1187791b6f712a8ea41c8ecdd0ee77fab3e85263b37e1ec18a3651926b3a6cf27",
+			},
+		},
+		{
+			// Script tree of three leaves, committed to by the BIP0341 NUMS
+			// point, from the BIP0371 test vectors:
+			// https://github.com/bitcoin/bips/blob/master/bip-0371.mediawiki#test-vectors
+			name:        "three leaves with NUMS internal key",
+			internalKey: decodeHex("50929b74c1a04954b78b4b6035e97a5e078a5a0f28ec96d547bfee9ace803ac0"),
+			tapLeaves: [][]byte{
+				decodeHex("202cb13ac68248de806aa6a3659cf3c03eb6821d09c8114a4e868febde865bb6d2ac"),
+				decodeHex("20fa0f7a3cef3b1d0c0a6ce7d26e17ada0b2e5c92d19efad48b41859cb8a451ca9ac"),
+				decodeHex("204320b0bf16f011b53ea7be615924aa7f27e5d29ad20ea1155d848676c3bad1b2ac"),
+			},
+			chainParams:    chaincfg.BitcoinMainNetParams,
+			wantAddress:    "bc1pcgj8a7laj2ky0ah5pwx595tfzadpn75l5y8y5fwh7d0tfhv9k6fql58rps",
+			wantOutputKey:  "c2247efbfd92ac47f6f40b8d42d169175a19fa9fa10e4a25d7f35eb4dd85b692",
+			wantMerkleRoot: "f0362e2f75a6f420a5bde3eb221d96ae6720cf25f81890c95b1d775acb515e65",
+			wantControlBlock: []string{
+				"c150929b74c1a04954b78b4b6035e97a5e078a5a0f28ec96d547bfee9ace803ac0" +
+					"6f7d62059e9497a1a4a267569d9876da60101aff38e3529b9b939ce7f91ae970" +
+					"115f2e490af7cc45c4f78511f36057ce5c5a5c56325a29fb44dfc203f356e1f8",
+				"c150929b74c1a04954b78b4b6035e97a5e078a5a0f28ec96d547bfee9ace803ac0" +
+					"cd970e15f53fc0c82f950fd560ffa919b76172be017368a89913af074f400b09" +
+					"115f2e490af7cc45c4f78511f36057ce5c5a5c56325a29fb44dfc203f356e1f8",
+				"c150929b74c1a04954b78b4b6035e97a5e078a5a0f28ec96d547bfee9ace803ac0" +
+					"97c6e6fea5ff714ff5724499990810e406e98aa10f5bf7e5f6784bc1d0a9a6ce",
+			},
+		},
+		{
+			name:        "no tap leaves",
+			internalKey: decodeHex("50929b74c1a04954b78b4b6035e97a5e078a5a0f28ec96d547bfee9ace803ac0"),
+			chainParams: chaincfg.BitcoinMainNetParams,
+			wantErr:     true,
+		},
+		{
+			name:        "invalid internal key",
+			internalKey: decodeHex("eefdea4cdb677750a420fee807eacf21eb9898ae79b9768766e4faa04a2d4a34"),
+			tapLeaves:   [][]byte{{txscript.OP_TRUE}},
+			chainParams: chaincfg.BitcoinMainNetParams,
+			wantErr:     true,
+		},
+	}
+
+	s := &Service{}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := s.EncodeTaprootScriptAddress(tt.internalKey, tt.tapLeaves, tt.chainParams)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("EncodeTaprootScriptAddress() error = %v, wantErr %v", err, tt.wantErr)
+			}
+
+			if tt.wantErr {
+				return
+			}
+
+			if got.Address != tt.wantAddress {
+				t.Fatalf("EncodeTaprootScriptAddress() got address '%s', want '%s'",
+					got.Address, tt.wantAddress)
+			}
+
+			if hex.EncodeToString(got.OutputKey) != tt.wantOutputKey {
+				t.Fatalf("EncodeTaprootScriptAddress() got output key %x, want %s",
+					got.OutputKey, tt.wantOutputKey)
+			}
+
+			if hex.EncodeToString(got.MerkleRoot) != tt.wantMerkleRoot {
+				t.Fatalf("EncodeTaprootScriptAddress() got merkle root %x, want %s",
+					got.MerkleRoot, tt.wantMerkleRoot)
+			}
+
+			if len(got.ControlBlocks) != len(tt.wantControlBlock) {
+				t.Fatalf("EncodeTaprootScriptAddress() got %d control blocks, want %d",
+					len(got.ControlBlocks), len(tt.wantControlBlock))
+			}
+
+			for idx, controlBlock := range got.ControlBlocks {
+				if hex.EncodeToString(controlBlock) != tt.wantControlBlock[idx] {
+					t.Fatalf("EncodeTaprootScriptAddress() got control block %x "+
+						"for leaf %d, want %s", controlBlock, idx, tt.wantControlBlock[idx])
+				}
+			}
+		})
+	}
+}
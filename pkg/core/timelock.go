@@ -0,0 +1,53 @@
+package core
+
+import (
+	"encoding/hex"
+
+	"github.com/btcsuite/btcd/txscript"
+	"github.com/pkg/errors"
+)
+
+// CreateCltvScript returns a script locking funds to a compressed public key
+// until an absolute lock time:
+//   <locktime> OP_CHECKLOCKTIMEVERIFY OP_DROP <public key> OP_CHECKSIG
+//
+// Lock times below txscript.LockTimeThreshold (500000000) are block heights,
+// and lock times above are Unix timestamps. The transaction spending the
+// script must have a lock time of the same kind, at least equal to the
+// locktime, and a non-final sequence number in the spending input.
+//
+// The script is meant to be wrapped in P2WSH, with
+// EncodeWitnessScriptAddress, or in P2SH, with EncodeScriptAddress.
+//
+// References:
+//   [BIP65]: BIP0065 - OP_CHECKLOCKTIMEVERIFY
+//   https://github.com/bitcoin/bips/blob/master/bip-0065.mediawiki
+func (s *Service) CreateCltvScript(publicKey []byte, locktime uint32) ([]byte, error) {
+	// A zero lock time is always satisfied, and would leave the funds
+	// spendable at once.
+	if locktime == 0 {
+		return nil, errors.New("locktime must be a non-zero block height or timestamp")
+	}
+
+	if err := checkSegwitPublicKey(publicKey); err != nil {
+		return nil, err
+	}
+
+	if _, err := parsePublicKey(publicKey); err != nil {
+		return nil, errors.Wrapf(err, "failed to parse public key %s",
+			hex.EncodeToString(publicKey))
+	}
+
+	script, err := txscript.NewScriptBuilder().
+		AddInt64(int64(locktime)).
+		AddOp(txscript.OP_CHECKLOCKTIMEVERIFY).
+		AddOp(txscript.OP_DROP).
+		AddData(publicKey).
+		AddOp(txscript.OP_CHECKSIG).
+		Script()
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to build CLTV script")
+	}
+
+	return script, nil
+}
@@ -0,0 +1,101 @@
+package core
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"testing"
+
+	"github.com/ledgerhq/bitcoin-lib-grpc/pkg/chaincfg"
+	"github.com/pkg/errors"
+)
+
+func TestCreateCltvScript(t *testing.T) {
+	// Public key of the private key 1, i.e. the secp256k1 generator point.
+	generatorPublicKey, _ := hex.DecodeString(
+		"0279be667ef9dcbbac55a06295ce870b07029bfcdb2dce28d959f2815b16f81798")
+
+	uncompressedPublicKey, _ := hex.DecodeString(
+		"0479be667ef9dcbbac55a06295ce870b07029bfcdb2dce28d959f2815b16f81798" +
+			"483ada7726a3c4655da4fbfc0e1108a8fd17b448a68554199c47d08ffb10d4b8")
+
+	tests := []struct {
+		name        string
+		publicKey   []byte
+		locktime    uint32
+		want        string
+		wantAddress string
+		wantErr     error
+	}{
+		{
+			name:        "block height",
+			publicKey:   generatorPublicKey,
+			locktime:    500000,
+			want:        "0320a107b175210279be667ef9dcbbac55a06295ce870b07029bfcdb2dce28d959f2815b16f81798ac",
+			wantAddress: "bc1qfg7qkd4gwz4dgx57mpu23a5dsv7hzn7ykg5eznthmuajurn0hexsdun087",
+		},
+		{
+			name:        "timestamp",
+			publicKey:   generatorPublicKey,
+			locktime:    1700000000,
+			want:        "0400f15365b175210279be667ef9dcbbac55a06295ce870b07029bfcdb2dce28d959f2815b16f81798ac",
+			wantAddress: "bc1qmevhzgk2g23tzndsrf7anvjzgtmjpn2fpayr55zf7pp7zk58pqhqhvenwf",
+		},
+		{
+			name:      "uncompressed public key",
+			publicKey: uncompressedPublicKey,
+			locktime:  500000,
+			wantErr:   ErrUncompressedPublicKey,
+		},
+	}
+
+	s := &Service{}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := s.CreateCltvScript(tt.publicKey, tt.locktime)
+			if errors.Cause(err) != tt.wantErr {
+				t.Fatalf("CreateCltvScript() got error '%v', want '%v'", err, tt.wantErr)
+			}
+
+			if hex.EncodeToString(got) != tt.want {
+				t.Fatalf("CreateCltvScript() got %x, want %s", got, tt.want)
+			}
+
+			if tt.wantErr != nil {
+				return
+			}
+
+			address, err := s.EncodeWitnessScriptAddress(got, chaincfg.BitcoinMainNetParams)
+			if err != nil {
+				t.Fatalf("EncodeWitnessScriptAddress() got error '%v'", err)
+			}
+
+			if address != tt.wantAddress {
+				t.Fatalf("EncodeWitnessScriptAddress() got '%s', want '%s'", address, tt.wantAddress)
+			}
+
+			// The address round-trips to a P2WSH script committing to the
+			// witness script.
+			script, err := s.AddressToScript(address, chaincfg.BitcoinMainNetParams)
+			if err != nil {
+				t.Fatalf("AddressToScript() got error '%v'", err)
+			}
+
+			witnessScriptHash := sha256.Sum256(got)
+			if wantScript := "0020" + hex.EncodeToString(witnessScriptHash[:]); hex.EncodeToString(script) != wantScript {
+				t.Fatalf("AddressToScript() got %x, want %s", script, wantScript)
+			}
+		})
+	}
+
+	if _, err := s.CreateCltvScript(generatorPublicKey, 0); err == nil {
+		t.Fatalf("CreateCltvScript() got no error for a zero locktime")
+	}
+
+	// Compressed public key not on the curve.
+	invalidPublicKey, _ := hex.DecodeString(
+		"03ce0b14fb842b1ba549fdd675c98075f12e9c510f8ef52bd021a9a1f4809d3b4c")
+	if _, err := s.CreateCltvScript(invalidPublicKey, 500000); err == nil {
+		t.Fatalf("CreateCltvScript() got no error for an invalid public key")
+	}
+}
@@ -2,14 +2,23 @@ package core
 
 import (
 	"bytes"
+	"context"
 	"encoding/hex"
-
-	"github.com/btcsuite/btcd/btcec"
+	"fmt"
+	"math"
+	"math/big"
+	"strings"
+
+	"github.com/btcsuite/btcd/blockchain"
+	"github.com/btcsuite/btcd/btcec/v2"
+	"github.com/btcsuite/btcd/btcec/v2/ecdsa"
+	"github.com/btcsuite/btcd/btcec/v2/schnorr"
+	"github.com/btcsuite/btcd/btcutil"
+	"github.com/btcsuite/btcd/btcutil/hdkeychain"
+	"github.com/btcsuite/btcd/btcutil/txsort"
 	"github.com/btcsuite/btcd/chaincfg/chainhash"
 	"github.com/btcsuite/btcd/txscript"
 	"github.com/btcsuite/btcd/wire"
-	"github.com/btcsuite/btcutil"
-	"github.com/btcsuite/btcutil/hdkeychain"
 	"github.com/btcsuite/btcwallet/wallet/txauthor"
 	"github.com/btcsuite/btcwallet/wallet/txrules"
 	"github.com/btcsuite/btcwallet/wallet/txsizes"
@@ -20,21 +29,169 @@ import (
 type Input struct {
 	OutputHash  string
 	OutputIndex uint32
-	Script      []byte
-	Value       int64
+
+	// Script is the script of the utxo spent by the input. Its type
+	// determines the size of the signed input, used to estimate the fees.
+	Script []byte
+	Value  int64
+
+	// Sequence is the sequence number of the input, e.g. to enable a
+	// relative locktime as per BIP0068. If zero, the input has the maximum
+	// sequence number 0xffffffff.
+	//
+	// Relative locktimes are only enforced in version 2 transactions, which
+	// is used if any input enables one.
+	Sequence uint32
 }
 
 type Output struct {
 	Address string
 	Value   int64
+
+	// Script is the raw output script, used instead of Address, which must
+	// not be set then, e.g. for OP_RETURN outputs. Non-standard scripts are
+	// rejected, unless AllowNonStandard is set for the transaction.
+	Script []byte
+}
+
+// ChangeSplit is an output receiving a share of the change of a
+// transaction, e.g. 0.5 for half of the change.
+type ChangeSplit struct {
+	Address string
+	Ratio   float64
 }
 
+// Ordering is an enum type for the ordering of the inputs and outputs of a
+// transaction built by CreateTransaction.
+type Ordering int
+
+const (
+	// AsProvided keeps the inputs and outputs in the order they are
+	// provided, with the change outputs at random positions.
+	AsProvided Ordering = iota
+
+	// Bip69 sorts the inputs by previous outpoint hash and index, and the
+	// outputs by value and script, in lexicographic order, as per BIP0069.
+	//
+	// Ref: https://github.com/bitcoin/bips/blob/master/bip-0069.mediawiki
+	Bip69
+)
+
+// DustChangePolicy is an enum type for the destination of the change of a
+// transaction built by CreateTransaction, when it is below the dust limit
+// and no change output is added.
+type DustChangePolicy int
+
+const (
+	// ToFee adds the dust change to the fees of the transaction.
+	ToFee DustChangePolicy = iota
+
+	// ToFirstOutput adds the dust change to the value of the first output
+	// of the transaction, as provided, so that the recipient receives it
+	// instead of the miners.
+	ToFirstOutput
+)
+
 type Tx struct {
-	Inputs        []Input
+	Inputs []Input
+
+	// Outputs are the outputs of the transaction, besides the change
+	// outputs. Without outputs, e.g. to consolidate utxos, the change
+	// outputs receive the total amount of the inputs minus the fees, and
+	// must not be dropped as dust.
 	Outputs       []Output
 	ChangeAddress string
 	FeeSatPerKb   int64
 	LockTime      uint32
+
+	// DustLimit is the minimum value of the change output, below which it
+	// is dropped. If zero, the dust threshold of the change script is
+	// computed from the dust relay fee of the network.
+	DustLimit int64
+
+	// MinRelayFeeSatPerKb is the minimum fee rate of the transaction. If
+	// zero, the minimum relay fee of the network is used. A FeeSatPerKb
+	// below this rate is rejected with ErrFeeRateTooLow.
+	MinRelayFeeSatPerKb int64
+
+	// AbsoluteFee is the exact fee of the transaction, used instead of a
+	// fee computed at the FeeSatPerKb rate. Exactly one of FeeSatPerKb and
+	// AbsoluteFee must be set, or ErrInvalidFee is returned. The minimum
+	// relay fee does not apply to it.
+	AbsoluteFee int64
+
+	// SendMax spends all inputs to the single output of the transaction,
+	// whose value is set to the total amount of the inputs minus the fees.
+	// The value of the output and the change address are ignored, and no
+	// change output is added.
+	//
+	// Without outputs, all inputs are already spent to the change outputs,
+	// so that SendMax has no effect. With several outputs, ErrInvalidSendMax
+	// is returned.
+	SendMax bool
+
+	// ChangeAccountKey, ChangeDerivation and ChangeEncoding select a change
+	// address derived from an account extended key, instead of
+	// ChangeAddress, e.g. account / 1 / address_index. Exactly one of
+	// ChangeAddress and ChangeDerivation must be set, unless SendMax is set,
+	// or ErrInvalidChange is returned.
+	ChangeAccountKey string
+	ChangeDerivation []uint32
+	ChangeEncoding   AddressEncoding
+
+	// StrictLockTime rejects a non-zero LockTime with ErrUnenforcedLockTime
+	// if all inputs have the final sequence number 0xffffffff, as the lock
+	// time is not enforced then. Otherwise, it is only reported in the
+	// LockTimeUnenforced field of the result.
+	StrictLockTime bool
+
+	// SplitChange splits the change across several outputs, in proportion
+	// to their ratios, which must be positive and sum to 1, or
+	// ErrInvalidChangeRatio is returned. It is used instead of ChangeAddress
+	// and ChangeDerivation, which must not be set.
+	//
+	// Change outputs below the dust limit are dropped, and their share is
+	// distributed to the other change outputs.
+	SplitChange []ChangeSplit
+
+	// Ordering is the ordering of the inputs and outputs of the
+	// transaction, including the change outputs. Since the inputs are
+	// signed after the transaction is built, the signatures commit to this
+	// ordering.
+	Ordering Ordering
+
+	// MaxOutputValue is the maximum value of an output, above which the
+	// transaction is rejected with ErrOutputValueTooHigh, to guard against
+	// mistyped amounts. If zero, there is no maximum.
+	//
+	// Outputs below the dust threshold of their script are always rejected
+	// with ErrDustOutput. Neither check applies to the output of SendMax,
+	// whose value is computed. With the ToFirstOutput dust change policy,
+	// the first output is checked including the dust change.
+	MaxOutputValue int64
+
+	// DustChangePolicy selects the destination of the change when it is
+	// below the dust limit, and the change output is dropped. It only
+	// applies to transactions with a change output, and is rejected with
+	// SendMax otherwise, with ErrInvalidDustChangePolicy.
+	DustChangePolicy DustChangePolicy
+
+	// MaxFeeSatPerKb is the maximum fee rate, above which the transaction is
+	// rejected with ErrFeeRateTooHigh, to guard against mistyped fee rates
+	// burning funds. If zero, there is no maximum. The rate of AbsoluteFee
+	// is the fee over the estimated virtual size of the transaction.
+	MaxFeeSatPerKb int64
+
+	// SizePaddingVbytes is added to the estimated virtual size of the
+	// transaction when computing the fee at the FeeSatPerKb rate, to
+	// overestimate the fee. It must be between 0 and 1000 vbytes, or
+	// ErrInvalidSizePadding is returned. It has no effect with AbsoluteFee.
+	SizePaddingVbytes int
+
+	// AllowNonStandard allows raw output scripts that are not standard, and
+	// would be rejected with ErrNonStandardScript otherwise. Such outputs
+	// are not relayed by most nodes.
+	AllowNonStandard bool
 }
 
 // RawTx represents the serialized transaction encoded using legacy encoding
@@ -42,38 +199,110 @@ type Tx struct {
 //
 // Hash and WitnessHash are the same if transaction has no witness data.
 type RawTx struct {
-	Hex           string
-	Hash          string
-	WitnessHash   string
-	NotEnoughUtxo *NotEnoughUtxo
+	Hex         string
+	Hash        string
+	WitnessHash string
+
+	// StrippedHex is the serialized transaction without witness data, from
+	// which Hash is computed. It is the same as Hex if the transaction has
+	// no witness data.
+	StrippedHex string
 }
 
 type RawTxWithChangeFees struct {
-	RawTx     RawTx
+	RawTx RawTx
+
+	// Change is the total value of the change outputs.
 	Change    int64
 	TotalFees int64
-}
 
-type NotEnoughUtxo struct {
-	MissingAmount int64
+	// FeeRateSatPerVByte and FeeRateSatPerKb are the fee rates realized by
+	// TotalFees over the estimated virtual size of the signed transaction.
+	// They may differ from the requested fee rate due to rounding.
+	FeeRateSatPerVByte float64
+	FeeRateSatPerKb    int64
+
+	// ChangeDropped indicates that the change was below the dust threshold
+	// of the change address. In this case, the transaction has no change
+	// output, Change is zero, and the remainder is added to TotalFees, or to
+	// the first output with the ToFirstOutput dust change policy.
+	ChangeDropped bool
+
+	// LockTimeUnenforced indicates that the transaction has a non-zero lock
+	// time, which is not enforced since all inputs have the final sequence
+	// number 0xffffffff.
+	LockTimeUnenforced bool
 }
 
+// DerSignature is the signature of an input, i.e. a DER-encoded ECDSA
+// signature followed by its signature hash type, or a BIP0340 Schnorr
+// signature for P2TR inputs.
 type DerSignature = []byte
 
 type Utxo struct {
 	Script     []byte
 	Value      int64
 	Derivation []uint32
+
+	// PreviousTx is the optional serialized transaction that created the
+	// utxo. If provided, the output it references is checked against the
+	// script and value of the utxo before signing, to prevent signing
+	// against a forged prevout.
+	PreviousTx []byte
+
+	// RedeemScript is the redeem script of a P2SH utxo, i.e. the P2WPKH
+	// witness program of a nested segwit utxo. It is required by
+	// PrepareForHardwareSigning, which has no key to rebuild it from.
+	RedeemScript []byte
+
+	// TapLeafScript is the tapscript leaf executed by a script-path spend
+	// of a P2TR utxo. If set, the signature is the one checked by the tap
+	// leaf, instead of the one of a key-path spend.
+	TapLeafScript []byte
+}
+
+// ScalarKey holds a raw 32-byte private scalar used to sign an input, and
+// optionally the public key that the input is expected to be locked to.
+type ScalarKey struct {
+	PrivateKey []byte
+	PublicKey  []byte
 }
 
 type SignatureMetadata struct {
 	DerSig       DerSignature
 	PubKey       *btcec.PublicKey
 	AddrEncoding AddressEncoding
+
+	// UtxoScript is the optional script of the output spent by the input.
+	// If provided, AddrEncoding is cross-checked against the type of the
+	// script, as spending an output with the scripts of another type would
+	// produce an invalid transaction.
+	UtxoScript []byte
+
+	// UncompressedPubKey indicates that PubKey is pushed uncompressed in
+	// the sigScript, to spend a P2PKH output paying to the hash of the
+	// uncompressed public key. It is only allowed for Legacy inputs, since
+	// segwit scripts only commit to compressed public keys.
+	UncompressedPubKey bool
+
+	// TapLeafScript and ControlBlock are set for script-path spends of P2TR
+	// inputs, with the tapscript leaf executed, and its BIP0341 control
+	// block, such as returned by EncodeTaprootScriptAddress. DerSig is then
+	// the Schnorr signature checked by the tapscript leaf. The control block
+	// is checked against UtxoScript, if provided.
+	TapLeafScript []byte
+	ControlBlock  []byte
+
+	// NormalizeLowS replaces a high S value of DerSig by its low S
+	// equivalent, instead of rejecting the signature as non-canonical. It
+	// is ignored for Taproot inputs, whose signatures are Schnorr
+	// signatures.
+	NormalizeLowS bool
 }
 
 func (s *Service) CreateTransaction(tx *Tx, chainParams chaincfg.ChainParams) (*RawTxWithChangeFees, error) {
 	var inputAmount, targetAmount int64
+	var utxoScripts [][]byte
 
 	// Create a new btcd transaction
 	msgTx := wire.NewMsgTx(wire.TxVersion)
@@ -94,32 +323,30 @@ func (s *Service) CreateTransaction(tx *Tx, chainParams chaincfg.ChainParams) (*
 
 		// Create new Input from previous outpoint
 		txIn := wire.NewTxIn(prevOut, nil, nil)
+		if input.Sequence != 0 {
+			txIn.Sequence = input.Sequence
+		}
 
 		// Add TxIn to MsgTx
 		msgTx.AddTxIn(txIn)
 
 		inputAmount = inputAmount + input.Value
+
+		// The fees depend on the types of the utxos to spend.
+		utxoScripts = append(utxoScripts, input.Script)
+	}
+
+	// BIP0068 relative locktimes are only enforced in version 2
+	// transactions.
+	if hasRelativeLockTime(msgTx) {
+		msgTx.Version = 2
 	}
 
 	// For each output to send, add a TxOut
 	for _, output := range tx.Outputs {
-		// Decode address from string
-		address, err := btcutil.DecodeAddress(output.Address, chainParams)
-
-		if err != nil {
-			return nil, errors.Wrapf(err,
-				"failed to decode address from output address %s",
-				output.Address,
-			)
-		}
-
-		// Create a 'pay to' script that pays to the address depending on the address type.
-		outputScript, err := txscript.PayToAddrScript(address)
+		outputScript, err := resolveOutputScript(output, tx.AllowNonStandard, chainParams)
 		if err != nil {
-			return nil, errors.Wrapf(err,
-				"failed to build 'pay to' script from address %v",
-				address,
-			)
+			return nil, err
 		}
 
 		// Create Output from value and script
@@ -132,255 +359,2001 @@ func (s *Service) CreateTransaction(tx *Tx, chainParams chaincfg.ChainParams) (*
 		targetAmount = targetAmount + output.Value
 	}
 
-	// Decode change address from string
-	changeAddress, err := btcutil.DecodeAddress(tx.ChangeAddress, chainParams)
-	if err != nil {
-		return nil, errors.Wrapf(err,
-			"failed to decode address from change address %v",
-			tx.ChangeAddress,
-		)
+	if (tx.FeeSatPerKb == 0) == (tx.AbsoluteFee == 0) ||
+		tx.FeeSatPerKb < 0 || tx.AbsoluteFee < 0 {
+		return nil, errors.Wrapf(ErrInvalidFee, "got fee rate %d and absolute fee %d",
+			tx.FeeSatPerKb, tx.AbsoluteFee)
 	}
 
-	// Compute change script
-	changeScript, err := txscript.PayToAddrScript(changeAddress)
-	if err != nil {
-		return nil, errors.Wrapf(err,
-			"failed to build 'pay to' script from change address %v",
-			tx.ChangeAddress,
-		)
+	// Apply the relay policy of the network, unless overridden.
+	policy := networkRelayPolicy(chainParams)
+
+	if !tx.SendMax {
+		if err := checkOutputValues(msgTx.TxOut, tx.MaxOutputValue, policy); err != nil {
+			return nil, err
+		}
 	}
 
-	// Estimate fee without change
-	var txOutsWithEstimatedChange []*wire.TxOut
-	maxRequiredFee := getMaxRequiredFee(msgTx.TxOut, nil, tx.FeeSatPerKb)
-	changeAmount := inputAmount - targetAmount - maxRequiredFee
-	changeTxOut := wire.NewTxOut(changeAmount, changeScript)
-	txOutsWithEstimatedChange = append(msgTx.TxOut, changeTxOut)
+	minRelayFeeSatPerKb := tx.MinRelayFeeSatPerKb
+	if minRelayFeeSatPerKb == 0 {
+		minRelayFeeSatPerKb = policy.minRelayFeeSatPerKb
+	}
 
-	// Esimate fee with change
-	maxRequiredFee = getMaxRequiredFee(txOutsWithEstimatedChange, nil, tx.FeeSatPerKb)
-	changeAmount = inputAmount - targetAmount - maxRequiredFee
-	changeTxOut = wire.NewTxOut(changeAmount, changeScript)
+	feeSatPerKb := tx.FeeSatPerKb
+	if feeSatPerKb != 0 && feeSatPerKb < minRelayFeeSatPerKb {
+		return nil, errors.Wrapf(ErrFeeRateTooLow,
+			"fee rate %d sat/kB is below the minimum relay fee of %d sat/kB",
+			feeSatPerKb, minRelayFeeSatPerKb)
+	}
 
-	// Not enough utxos to pay fees
-	if changeAmount < 0 {
-		retval := RawTxWithChangeFees{
-			RawTx:     RawTx{NotEnoughUtxo: &NotEnoughUtxo{maxRequiredFee}},
-			Change:    changeAmount,
-			TotalFees: 0,
+	if feeSatPerKb != 0 && tx.MaxFeeSatPerKb > 0 && feeSatPerKb > tx.MaxFeeSatPerKb {
+		return nil, errors.Wrapf(ErrFeeRateTooHigh,
+			"fee rate %d sat/kB exceeds the maximum of %d sat/kB",
+			feeSatPerKb, tx.MaxFeeSatPerKb)
+	}
+
+	if tx.SizePaddingVbytes < 0 || tx.SizePaddingVbytes > maxSizePaddingVbytes {
+		return nil, errors.Wrapf(ErrInvalidSizePadding,
+			"size padding %d vbytes must be between 0 and %d vbytes",
+			tx.SizePaddingVbytes, maxSizePaddingVbytes)
+	}
+
+	paddingFee := int64(tx.SizePaddingVbytes) * feeSatPerKb / 1000
+
+	// requiredFee returns the fee of the transaction paying to the given
+	// outputs.
+	requiredFee := func(outputs []*wire.TxOut) int64 {
+		if tx.AbsoluteFee != 0 {
+			return tx.AbsoluteFee
+		}
+
+		return getMaxRequiredFee(outputs, utxoScripts, feeSatPerKb) + paddingFee
+	}
+
+	var (
+		changeAmount  int64
+		changeDropped bool
+		err           error
+	)
+
+	switch tx.DustChangePolicy {
+	case ToFee:
+	case ToFirstOutput:
+		if tx.SendMax {
+			return nil, errors.Wrap(ErrInvalidDustChangePolicy,
+				"dust change policy requires a change output, which send max never adds")
+		}
+	default:
+		return nil, errors.Wrapf(ErrInvalidDustChangePolicy,
+			"unknown dust change policy %d", tx.DustChangePolicy)
+	}
+
+	if len(tx.Outputs) == 0 && tx.ChangeAddress == "" &&
+		len(tx.ChangeDerivation) == 0 && len(tx.SplitChange) == 0 {
+		return nil, errors.Wrap(ErrNoOutputs, "neither outputs nor change address set")
+	}
+
+	if tx.SendMax && len(tx.Outputs) > 0 {
+		targetAmount, err = setSendMaxOutputValue(
+			msgTx, tx, inputAmount, requiredFee, policy)
+	} else {
+		var changeOutputs []changeOutput
+
+		changeOutputs, err = s.resolveChangeOutputs(tx, chainParams)
+		if err != nil {
+			return nil, err
+		}
+
+		changeAmount, changeDropped, err = addChangeOutputs(msgTx, tx, changeOutputs,
+			inputAmount, targetAmount, requiredFee, policy)
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	// The dust change is the remainder of the inputs after the fees of the
+	// transaction without change output. There is at least one output, since
+	// the change of a transaction without outputs is never dropped.
+	if changeDropped && tx.DustChangePolicy == ToFirstOutput {
+		dustChange := inputAmount - targetAmount - requiredFee(msgTx.TxOut)
+		msgTx.TxOut[0].Value += dustChange
+		targetAmount += dustChange
+
+		// The dust change may bring the first output above the maximum
+		// output value, so that it is checked again.
+		if err := checkOutputValues(msgTx.TxOut[:1], tx.MaxOutputValue, policy); err != nil {
+			return nil, err
 		}
-		return &retval, nil
 	}
 
-	// Add change output to TxOut arrays
-	msgTx.TxOut = append(msgTx.TxOut, changeTxOut)
+	// The rate of an absolute fee is only known once the outputs are final.
+	if tx.AbsoluteFee != 0 && tx.MaxFeeSatPerKb > 0 {
+		virtualSize := int64(estimateVirtualSize(msgTx.TxOut, utxoScripts))
+		if feeRate := tx.AbsoluteFee * 1000 / virtualSize; feeRate > tx.MaxFeeSatPerKb {
+			return nil, errors.Wrapf(ErrFeeRateTooHigh,
+				"absolute fee %d satoshis over %d vbytes is a fee rate of %d sat/kB, "+
+					"which exceeds the maximum of %d sat/kB",
+				tx.AbsoluteFee, virtualSize, feeRate, tx.MaxFeeSatPerKb)
+		}
+	}
 
-	// Randomize change output position
-	txauthor.RandomizeOutputPosition(msgTx.TxOut, len(msgTx.TxOut)-1)
+	switch tx.Ordering {
+	case AsProvided:
+	case Bip69:
+		txsort.InPlaceSort(msgTx)
+	default:
+		return nil, errors.Wrapf(ErrUnknownOrdering, "ordering %d", tx.Ordering)
+	}
 
 	// Add LockTime
 	msgTx.LockTime = tx.LockTime
 
+	lockTimeUnenforced := hasUnenforcedLockTime(msgTx)
+	if lockTimeUnenforced && tx.StrictLockTime {
+		return nil, errors.Wrapf(ErrUnenforcedLockTime, "lock time %d", tx.LockTime)
+	}
+
 	// Encode MsgTx to RawTx
 	rawTx, err := encodeMsgTx(msgTx)
+	if err != nil {
+		return nil, err
+	}
+
+	totalFees := inputAmount - targetAmount - changeAmount
+	feeRateSatPerVByte, feeRateSatPerKb := feeRates(
+		totalFees, estimateVirtualSize(msgTx.TxOut, utxoScripts))
 
 	return &RawTxWithChangeFees{
-		RawTx:     *rawTx,
-		Change:    changeAmount,
-		TotalFees: inputAmount - targetAmount - changeAmount,
-	}, err
-	// encodeMsgTx(msgTx), changeAmount,
+		RawTx:              *rawTx,
+		Change:             changeAmount,
+		TotalFees:          totalFees,
+		FeeRateSatPerVByte: feeRateSatPerVByte,
+		FeeRateSatPerKb:    feeRateSatPerKb,
+		ChangeDropped:      changeDropped,
+		LockTimeUnenforced: lockTimeUnenforced,
+	}, nil
 }
 
-func (s *Service) GenerateDerSignatures(msgTx *wire.MsgTx, utxos []Utxo, privKey string) ([]DerSignature, error) {
-	// Validation
-	if len(msgTx.TxIn) != len(utxos) {
-		return nil, errors.New("inputs length != utxos length")
+// resolveOutputScript returns the script of an output of a transaction to
+// create: the script paying to its address, or its raw script, which must
+// be standard unless allowNonStandard is set.
+func resolveOutputScript(
+	output Output, allowNonStandard bool, chainParams chaincfg.ChainParams,
+) ([]byte, error) {
+	if len(output.Script) > 0 {
+		if output.Address != "" {
+			return nil, errors.Errorf(
+				"output has both address %s and script %x", output.Address,
+				output.Script)
+		}
+
+		if err := checkOutputScript(output.Script, allowNonStandard); err != nil {
+			return nil, err
+		}
+
+		return output.Script, nil
+	}
+
+	// Decode address from string
+	address, err := decodeAddress(output.Address, chainParams)
+
+	if err != nil && isForeignBase58Address(output.Address, chainParams) {
+		return nil, errors.Wrapf(ErrNetworkMismatch,
+			"output address %s is not for network %s", output.Address,
+			chainParams.Name)
 	}
 
-	// Get extended key from private key
-	extendedKey, err := hdkeychain.NewKeyFromString(privKey)
 	if err != nil {
-		return nil, errors.Wrapf(err,
-			"failed to get extended key from private key %s",
-			privKey,
-		)
+		return nil, errors.Wrap(&ErrInvalidAddress{Address: output.Address, Err: err},
+			"invalid output address")
 	}
 
-	// Build sig hash type and sig hashes
-	sigHashType := txscript.SigHashAll
-	sigHashes := txscript.NewTxSigHashes(msgTx)
+	// Segwit addresses of other networks are decoded successfully, as
+	// long as their human-readable part is known.
+	if !address.IsForNet(chainParams) {
+		return nil, errors.Wrapf(ErrNetworkMismatch,
+			"output address %s is not for network %s", output.Address,
+			chainParams.Name)
+	}
 
-	derSignatures := make([]DerSignature, len(msgTx.TxIn))
+	// Create a 'pay to' script that pays to the address depending on the address type.
+	outputScript, err := txscript.PayToAddrScript(address)
+	if err != nil {
+		return nil, errors.Wrapf(err,
+			"failed to build 'pay to' script from address %v",
+			address,
+		)
+	}
 
-	// Generate a valid der signature for each input
-	for idx, input := range msgTx.TxIn {
-		// Get the utxo assuming inputs and utxos are in the same order
-		utxo := utxos[idx]
+	return outputScript, nil
+}
 
-		script := utxo.Script
+// checkOutputScript returns an error if a raw output script cannot be
+// parsed. Unless allowNonStandard is set, it also returns an error wrapping
+// ErrNonStandardScript if the script is not of a standard type, i.e. does
+// not pay to an address (P2PKH, P2SH, P2WPKH, P2WSH or P2TR), and is not an
+// OP_RETURN script. Bare public key and bare multisig scripts are rejected
+// too, as they have no address, and are seldom relayed.
+func checkOutputScript(script []byte, allowNonStandard bool) error {
+	if _, err := txscript.DisasmString(script); err != nil {
+		return errors.Wrapf(err, "failed to parse output script %x", script)
+	}
 
-		amount := utxo.Value
+	if allowNonStandard {
+		return nil
+	}
 
-		derivation := utxo.Derivation
+	switch class := txscript.GetScriptClass(script); class {
+	case txscript.PubKeyHashTy, txscript.ScriptHashTy,
+		txscript.WitnessV0PubKeyHashTy, txscript.WitnessV0ScriptHashTy,
+		txscript.WitnessV1TaprootTy, txscript.NullDataTy:
+		return nil
+	default:
+		return errors.Wrapf(ErrNonStandardScript,
+			"output script %x is of type %s", script, class)
+	}
+}
 
-		// Derive the extended key for given derivation path
-		for _, childIndex := range derivation {
-			extendedKey, err = extendedKey.Derive(childIndex)
-			if err != nil {
-				return nil, errors.Wrapf(err, "failed to derive extendedKey %s at index %d",
-					extendedKey, childIndex)
+// checkOutputValues rejects the outputs below the dust threshold of their
+// script, except OP_RETURN outputs, which carry no value, and the outputs
+// above maxOutputValue, if set.
+func checkOutputValues(txOuts []*wire.TxOut, maxOutputValue int64, policy relayPolicy) error {
+	for idx, txOut := range txOuts {
+		if txscript.GetScriptClass(txOut.PkScript) != txscript.NullDataTy {
+			threshold := dustThreshold(txOut.PkScript, policy.dustRelayFeeSatPerKb)
+			if txOut.Value < threshold {
+				return errors.Wrapf(ErrDustOutput,
+					"output %d of %d satoshis is below the dust threshold of %d satoshis",
+					idx, txOut.Value, threshold)
 			}
 		}
 
-		// Get the private key for given derivation path
-		ecPrivKey, err := extendedKey.ECPrivKey()
-		if err != nil {
-			return nil, err
+		if maxOutputValue > 0 && txOut.Value > maxOutputValue {
+			return errors.Wrapf(ErrOutputValueTooHigh,
+				"output %d of %d satoshis is above the maximum of %d satoshis",
+				idx, txOut.Value, maxOutputValue)
 		}
+	}
 
-		derSig, err := txscript.RawTxInWitnessSignature(msgTx, sigHashes, idx, amount, script, sigHashType, ecPrivKey)
+	return nil
+}
 
-		if err != nil {
-			return nil, errors.Wrapf(err,
-				"failed to generate der signature for input %v",
-				input,
-			)
+// hasUnenforcedLockTime reports whether a transaction has a non-zero lock
+// time, while all its inputs have the final sequence number 0xffffffff, in
+// which case the lock time is ignored by consensus.
+func hasUnenforcedLockTime(msgTx *wire.MsgTx) bool {
+	if msgTx.LockTime == 0 {
+		return false
+	}
+
+	for _, txIn := range msgTx.TxIn {
+		if txIn.Sequence != wire.MaxTxInSequenceNum {
+			return false
 		}
+	}
 
-		derSignatures[idx] = derSig
+	return true
+}
+
+// hasRelativeLockTime reports whether an input of a transaction has a
+// sequence number enabling a BIP0068 relative locktime, i.e. with the
+// disable flag unset.
+func hasRelativeLockTime(msgTx *wire.MsgTx) bool {
+	for _, txIn := range msgTx.TxIn {
+		if txIn.Sequence&wire.SequenceLockTimeDisabled == 0 {
+			return true
+		}
 	}
 
-	return derSignatures, nil
+	return false
 }
 
-func (s *Service) SignTransaction(msgTx *wire.MsgTx, chainParams chaincfg.ChainParams, signatures []SignatureMetadata) (*RawTx, error) {
-	// Validation
-	if len(msgTx.TxIn) != len(signatures) {
-		return nil, errors.New("inputs length != signatures length")
+// resolveChangeAddress returns the change address of the transaction: either its
+// ChangeAddress, or the address derived from ChangeAccountKey along
+// ChangeDerivation, encoded with ChangeEncoding.
+func (s *Service) resolveChangeAddress(tx *Tx, chainParams chaincfg.ChainParams) (string, error) {
+	switch {
+	case tx.ChangeAddress != "" && len(tx.ChangeDerivation) > 0:
+		return "", errors.Wrap(ErrInvalidChange,
+			"change address and change derivation are mutually exclusive")
+	case tx.ChangeAddress != "":
+		return tx.ChangeAddress, nil
+	case len(tx.ChangeDerivation) == 0:
+		return "", errors.Wrap(ErrInvalidChange,
+			"either a change address or a change derivation must be set")
 	}
 
-	for inputIdx, input := range msgTx.TxIn {
+	accountKey, err := hdkeychain.NewKeyFromString(tx.ChangeAccountKey)
+	if err != nil {
+		return "", errors.Wrap(err, "failed to decode change account key")
+	}
 
-		// Get the signature struct assuming inputs and signatures are in the same order
-		signature := signatures[inputIdx]
+	if err := checkExtendedKeyNetwork(accountKey, chainParams); err != nil {
+		return "", err
+	}
 
-		// Get the DER signature
-		derSig := signature.DerSig
+	derived, err := s.DeriveExtendedKey(
+		context.Background(), tx.ChangeAccountKey, tx.ChangeDerivation)
+	if err != nil {
+		return "", errors.Wrapf(err, "failed to derive change key %v",
+			tx.ChangeDerivation)
+	}
 
-		// Get input address public key
-		pubKey := signature.PubKey
+	address, err := s.EncodeAddress(
+		derived.PublicKey, tx.ChangeEncoding, true, chainParams)
+	if err != nil {
+		return "", errors.Wrapf(err, "failed to encode change address %v",
+			tx.ChangeDerivation)
+	}
 
-		// Get address type for the input
-		inputAddrEncoding := signature.AddrEncoding
+	return address, nil
+}
 
-		// Serialize input public key data
-		pubKeyData := pubKey.SerializeCompressed()
+// changeRatioTolerance is the tolerance on the sum of the ratios of split
+// change outputs, to allow for the rounding of floating-point ratios.
+const changeRatioTolerance = 1e-9
 
-		var sigScript []byte
+// changeOutput is an output receiving a share of the change, given by its
+// ratio.
+type changeOutput struct {
+	script []byte
+	ratio  float64
+}
 
-		// If we're spending p2wkh output nested within a p2sh output, then
-		// we'll need to attach a sigScript in addition to witness data.
-		// Otherwise sigScript is an empty byte array
-		if inputAddrEncoding == WrappedSegwit {
-			pubKeyHash := btcutil.Hash160(pubKeyData)
+// resolveChangeOutputs returns the outputs receiving the change of the
+// transaction: the outputs of SplitChange if set, or else a single output
+// paying to the change address of resolveChangeAddress.
+func (s *Service) resolveChangeOutputs(
+	tx *Tx, chainParams chaincfg.ChainParams,
+) ([]changeOutput, error) {
+	if len(tx.SplitChange) == 0 {
+		changeAddress, err := s.resolveChangeAddress(tx, chainParams)
+		if err != nil {
+			return nil, err
+		}
 
-			// Next, we'll generate a valid sigScript that will allow us to
-			// spend the p2sh output. The sigScript will contain only a
-			// single push of the p2wkh witness program corresponding to
-			// the matching public key of this address.
-			p2wkhAddr, err := btcutil.NewAddressWitnessPubKeyHash(
-				pubKeyHash, chainParams,
-			)
+		changeScript, err := changeAddressScript(changeAddress, chainParams)
+		if err != nil {
+			return nil, err
+		}
 
-			if err != nil {
-				return nil, err
-			}
+		return []changeOutput{{script: changeScript, ratio: 1}}, nil
+	}
 
-			redeemScript, err := txscript.PayToAddrScript(p2wkhAddr)
-			if err != nil {
-				return nil, err
-			}
+	if tx.ChangeAddress != "" || len(tx.ChangeDerivation) > 0 {
+		return nil, errors.Wrap(ErrInvalidChange,
+			"split change is mutually exclusive with change address and change derivation")
+	}
 
-			bldr := txscript.NewScriptBuilder()
-			bldr.AddData(redeemScript)
-			sigScript, err = bldr.Script()
+	changeOutputs := make([]changeOutput, len(tx.SplitChange))
 
-			if err != nil {
-				return nil, err
-			}
+	var ratioSum float64
+
+	for idx, split := range tx.SplitChange {
+		// Also rejects NaN ratios.
+		if !(split.Ratio > 0) {
+			return nil, errors.Wrapf(ErrInvalidChangeRatio,
+				"ratio %v of change output %d must be positive", split.Ratio, idx)
 		}
 
-		// Put signature script and witness data to the input
-		input.SignatureScript = sigScript
-		input.Witness = wire.TxWitness{derSig, pubKeyData}
+		changeScript, err := changeAddressScript(split.Address, chainParams)
+		if err != nil {
+			return nil, err
+		}
+
+		changeOutputs[idx] = changeOutput{script: changeScript, ratio: split.Ratio}
+		ratioSum += split.Ratio
 	}
 
-	// Encode signed MsgTx to RawTx
-	signedRawTx, err := encodeMsgTx(msgTx)
-	if err != nil {
-		return nil, err
+	if math.Abs(ratioSum-1) > changeRatioTolerance {
+		return nil, errors.Wrapf(ErrInvalidChangeRatio,
+			"ratios of change outputs sum to %v, expected 1", ratioSum)
 	}
 
-	return signedRawTx, nil
+	return changeOutputs, nil
 }
 
-// Encode MsgTx to RawTx
-func encodeMsgTx(msgTx *wire.MsgTx) (*RawTx, error) {
-	var buf bytes.Buffer
-	if err := msgTx.Serialize(&buf); err != nil {
-		return nil, errors.Wrap(err, "failed to encode transaction in hex")
+// changeAddressScript returns the script paying to a change address, which
+// must be for the network of the chain parameters.
+func changeAddressScript(changeAddress string, chainParams chaincfg.ChainParams) ([]byte, error) {
+	// Decode change address from string
+	decodedChangeAddress, err := decodeAddress(changeAddress, chainParams)
+	if err != nil && isForeignBase58Address(changeAddress, chainParams) {
+		return nil, errors.Wrapf(ErrNetworkMismatch,
+			"change address %s is not for network %s", changeAddress,
+			chainParams.Name)
 	}
 
-	rawTx := &RawTx{
-		Hex:         hex.EncodeToString(buf.Bytes()),
-		Hash:        msgTx.TxHash().String(),
-		WitnessHash: msgTx.WitnessHash().String(),
+	if err != nil {
+		return nil, errors.Wrap(&ErrInvalidAddress{Address: changeAddress, Err: err},
+			"invalid change address")
 	}
 
-	return rawTx, nil
-}
-
-// Deserialize MsgTx from RawTx
-func (s *Service) DeserializeMsgTx(rawTx *RawTx) (*wire.MsgTx, error) {
-	// Instantiate a MsgTx
-	msgTx := wire.NewMsgTx(wire.TxVersion)
+	if !decodedChangeAddress.IsForNet(chainParams) {
+		return nil, errors.Wrapf(ErrNetworkMismatch,
+			"change address %s is not for network %s", changeAddress,
+			chainParams.Name)
+	}
 
-	// Get bytes from hex string
-	hexBytes, err := hex.DecodeString(rawTx.Hex)
+	// Compute change script
+	changeScript, err := txscript.PayToAddrScript(decodedChangeAddress)
 	if err != nil {
 		return nil, errors.Wrapf(err,
-			"failed to derialize raw tx %v",
-			rawTx,
+			"failed to build 'pay to' script from change address %v",
+			changeAddress,
 		)
 	}
-	reader := bytes.NewReader(hexBytes)
-
-	// Derialize into MsgTx
-	msgTx.Deserialize(reader)
 
-	return msgTx, nil
+	return changeScript, nil
 }
 
-func getMaxRequiredFee(outputs []*wire.TxOut, utxoScripts [][]byte, feeSatPerKb int64) int64 {
-	// We count the types of utxos to spend, which we'll use to estimate
-	// the vsize of the transaction.
-	var nested, p2wpkh, p2pkh int
-	for _, script := range utxoScripts {
-		switch {
-		// If this is a p2sh output, we assume this is a
-		// nested P2WKH.
-		case txscript.IsPayToScriptHash(script):
-			nested++
-		case txscript.IsPayToWitnessPubKeyHash(script):
-			p2wpkh++
-		default:
-			p2pkh++
+// addChangeOutputs adds the outputs paying the change, split in proportion
+// to their ratios, each at a random position, and returns the total change
+// amount.
+//
+// Change outputs below the dust limit are dropped, and the change is split
+// again among the remaining ones, with the fees of the smaller transaction.
+// If all change outputs are dropped, the change is added to the fees,
+// provided that they are enough to pay for the transaction without change
+// output. In this case, changeDropped is true. If the transaction has no
+// other outputs, ErrInsufficientFunds is returned instead.
+//
+// requiredFee returns the fees of the transaction paying to the given
+// outputs.
+func addChangeOutputs(
+	msgTx *wire.MsgTx,
+	tx *Tx,
+	changeOutputs []changeOutput,
+	inputAmount int64,
+	targetAmount int64,
+	requiredFee func(outputs []*wire.TxOut) int64,
+	policy relayPolicy,
+) (changeAmount int64, changeDropped bool, err error) {
+	dustLimit := func(changeScript []byte) int64 {
+		if tx.DustLimit != 0 {
+			return tx.DustLimit
 		}
+
+		return dustThreshold(changeScript, policy.dustRelayFeeSatPerKb)
 	}
 
-	maxSignedSize := txsizes.EstimateVirtualSize(p2pkh, p2wpkh, nested, outputs, true)
-	maxRequiredFee := txrules.FeeForSerializeSize(btcutil.Amount(feeSatPerKb), maxSignedSize)
+	// The first change output is the one paying the change if the others
+	// are dropped.
+	firstChange := changeOutputs[0]
 
-	return int64(maxRequiredFee)
+	for len(changeOutputs) > 0 {
+		// Estimate fee with change
+		changeTxOuts := make([]*wire.TxOut, len(changeOutputs))
+		for idx, change := range changeOutputs {
+			changeTxOuts[idx] = wire.NewTxOut(0, change.script)
+		}
+
+		txOutsWithEstimatedChange := append(
+			append([]*wire.TxOut{}, msgTx.TxOut...), changeTxOuts...)
+
+		maxRequiredFee := requiredFee(txOutsWithEstimatedChange)
+		changeAmount = inputAmount - targetAmount - maxRequiredFee
+
+		splitAmounts := splitChangeAmount(changeAmount, changeOutputs)
+
+		var aboveDust []changeOutput
+
+		for idx, change := range changeOutputs {
+			if splitAmounts[idx] >= dustLimit(change.script) {
+				aboveDust = append(aboveDust, change)
+			}
+		}
+
+		if len(aboveDust) < len(changeOutputs) {
+			changeOutputs = aboveDust
+			continue
+		}
+
+		// Add change outputs to TxOut arrays, and randomize their position
+		for idx, changeTxOut := range changeTxOuts {
+			changeTxOut.Value = splitAmounts[idx]
+			msgTx.TxOut = append(msgTx.TxOut, changeTxOut)
+			txauthor.RandomizeOutputPosition(msgTx.TxOut, len(msgTx.TxOut)-1)
+		}
+
+		return changeAmount, false, nil
+	}
+
+	// Without other outputs, the change cannot be dropped, and must reach
+	// the dust limit of a single change output.
+	if len(msgTx.TxOut) == 0 {
+		changeTxOut := wire.NewTxOut(0, firstChange.script)
+		missingAmount := dustLimit(firstChange.script) +
+			requiredFee([]*wire.TxOut{changeTxOut}) - (inputAmount - targetAmount)
+
+		return 0, false, &ErrInsufficientFunds{MissingAmount: missingAmount}
+	}
+
+	// If the change is dust, drop the change outputs, and add the change to
+	// the fees, provided that they are enough to pay for the transaction
+	// without change output.
+	maxRequiredFeeWithoutChange := requiredFee(msgTx.TxOut)
+
+	// Not enough utxos to pay fees
+	if inputAmount-targetAmount < maxRequiredFeeWithoutChange {
+		missingAmount := targetAmount + maxRequiredFeeWithoutChange - inputAmount
+
+		return 0, false, &ErrInsufficientFunds{MissingAmount: missingAmount}
+	}
+
+	return 0, true, nil
+}
+
+// splitChangeAmount splits a change amount in proportion to the ratios of
+// the change outputs, relative to their sum. The last output receives the
+// rounding remainder, so that the split amounts sum to the change amount.
+func splitChangeAmount(changeAmount int64, changeOutputs []changeOutput) []int64 {
+	var ratioSum float64
+	for _, change := range changeOutputs {
+		ratioSum += change.ratio
+	}
+
+	splitAmounts := make([]int64, len(changeOutputs))
+	remainder := changeAmount
+
+	for idx := 0; idx < len(changeOutputs)-1; idx++ {
+		splitAmounts[idx] = int64(float64(changeAmount) * changeOutputs[idx].ratio / ratioSum)
+		remainder -= splitAmounts[idx]
+	}
+
+	splitAmounts[len(changeOutputs)-1] = remainder
+
+	return splitAmounts
+}
+
+// setSendMaxOutputValue sets the value of the single output of the
+// transaction to the total amount of the inputs, minus the fees, and
+// returns it. No change output is added.
+//
+// If the resulting value is dust, ErrInsufficientFunds is returned with the
+// amount missing to reach the dust threshold.
+func setSendMaxOutputValue(
+	msgTx *wire.MsgTx,
+	tx *Tx,
+	inputAmount int64,
+	requiredFee func(outputs []*wire.TxOut) int64,
+	policy relayPolicy,
+) (int64, error) {
+	if len(msgTx.TxOut) != 1 {
+		return 0, errors.Wrapf(ErrInvalidSendMax, "got %d outputs", len(msgTx.TxOut))
+	}
+
+	txOut := msgTx.TxOut[0]
+
+	dustLimit := tx.DustLimit
+	if dustLimit == 0 {
+		dustLimit = dustThreshold(txOut.PkScript, policy.dustRelayFeeSatPerKb)
+	}
+
+	txOut.Value = inputAmount - requiredFee(msgTx.TxOut)
+	if txOut.Value < dustLimit {
+		return 0, &ErrInsufficientFunds{MissingAmount: dustLimit - txOut.Value}
+	}
+
+	return txOut.Value, nil
+}
+
+// GenerateDerSignatures signs each input of a transaction with the key
+// derived from an extended private key, at the derivation path of the utxo
+// it spends.
+//
+// The derivation path of every utxo is relative to privKey. Compatibility
+// note: earlier versions derived the path of each utxo from the key of the
+// previous utxo, so that only the first input of a transaction was signed
+// with the key of its path. Utxos whose paths relied on this chaining no
+// longer match their script, and are rejected with ErrPublicKeyMismatch
+// instead of being signed with another key.
+//
+// If grindLowR is set, the nonces of ECDSA signatures are ground until the
+// R values are lower than 2^255, like Bitcoin Core does, so that every DER
+// signature is at most 71 bytes long, including the signature hash type.
+func (s *Service) GenerateDerSignatures(
+	msgTx *wire.MsgTx, utxos []Utxo, privKey string, grindLowR bool,
+) ([]DerSignature, error) {
+	// Validation
+	if len(msgTx.TxIn) != len(utxos) {
+		return nil, errors.Wrap(ErrLengthMismatch, "inputs length != utxos length")
+	}
+
+	// Get extended key from private key
+	masterKey, err := hdkeychain.NewKeyFromString(privKey)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to get extended key from private key")
+	}
+
+	// Build sig hashes
+	sigHashes, err := newTxSigHashes(msgTx, utxos)
+	if err != nil {
+		return nil, err
+	}
+
+	derSignatures := make([]DerSignature, len(msgTx.TxIn))
+
+	// Generate a valid der signature for each input
+	for idx := range msgTx.TxIn {
+		// Get the utxo assuming inputs and utxos are in the same order
+		utxo := utxos[idx]
+
+		// Derive the extended key for given derivation path, always
+		// starting from the master key, and not from the key of the
+		// previous utxo.
+		extendedKey := masterKey
+		for _, childIndex := range utxo.Derivation {
+			extendedKey, err = extendedKey.Derive(childIndex)
+			if err != nil {
+				return nil, errors.Wrapf(err, "failed to derive extendedKey at index %d",
+					childIndex)
+			}
+		}
+
+		// Get the private key for given derivation path
+		ecPrivKey, err := extendedKey.ECPrivKey()
+		if err != nil {
+			return nil, err
+		}
+
+		// A wrong private key or derivation would otherwise produce a
+		// signature that is silently invalid.
+		if err := checkSigningKey(utxo, ecPrivKey.PubKey()); err != nil {
+			return nil, errors.Wrapf(err, "signing key does not match input %d's script", idx)
+		}
+
+		derSig, err := signInput(msgTx, sigHashes, idx, utxo, ecPrivKey, grindLowR)
+		if err != nil {
+			return nil, err
+		}
+
+		derSignatures[idx] = derSig
+	}
+
+	return derSignatures, nil
+}
+
+// GenerateDerSignaturesFromScalars signs each input of a transaction with a
+// raw 32-byte private scalar, as exported by some HSMs for a derived key.
+//
+// Keys are matched to inputs by position, in the same way as utxos. Each
+// scalar must be in the range [1, n-1], where n is the order of the
+// secp256k1 curve. If the ScalarKey also carries the expected public key of
+// the input, it is checked against the public key of the scalar before
+// signing. Like in GenerateDerSignatures, the public key of the scalar must
+// also match the script of the utxo, or ErrPublicKeyMismatch is returned.
+func (s *Service) GenerateDerSignaturesFromScalars(
+	msgTx *wire.MsgTx, utxos []Utxo, keys []ScalarKey,
+) ([]DerSignature, error) {
+	// Validation
+	if len(msgTx.TxIn) != len(utxos) {
+		return nil, errors.Wrap(ErrLengthMismatch, "inputs length != utxos length")
+	}
+
+	if len(msgTx.TxIn) != len(keys) {
+		return nil, errors.Wrap(ErrLengthMismatch, "inputs length != keys length")
+	}
+
+	// Build sig hashes
+	sigHashes, err := newTxSigHashes(msgTx, utxos)
+	if err != nil {
+		return nil, err
+	}
+
+	derSignatures := make([]DerSignature, len(msgTx.TxIn))
+
+	for idx := range msgTx.TxIn {
+		ecPrivKey, err := parseScalarKey(keys[idx])
+		if err != nil {
+			return nil, errors.Wrapf(err, "invalid private key for input %d", idx)
+		}
+
+		// A scalar of another key would otherwise produce a signature that
+		// is silently invalid.
+		if err := checkSigningKey(utxos[idx], ecPrivKey.PubKey()); err != nil {
+			return nil, errors.Wrapf(err, "signing key does not match input %d's script", idx)
+		}
+
+		derSig, err := signInput(msgTx, sigHashes, idx, utxos[idx], ecPrivKey, false)
+		if err != nil {
+			return nil, err
+		}
+
+		derSignatures[idx] = derSig
+	}
+
+	return derSignatures, nil
+}
+
+// parseScalarKey loads a raw private scalar into a btcec.PrivateKey, after
+// checking that it is a valid secp256k1 private key, and that it matches the
+// expected public key, if any.
+func parseScalarKey(key ScalarKey) (*btcec.PrivateKey, error) {
+	if len(key.PrivateKey) != btcec.PrivKeyBytesLen {
+		return nil, errors.Wrapf(ErrInvalidPrivateKey,
+			"private key has invalid length %d, expected %d",
+			len(key.PrivateKey), btcec.PrivKeyBytesLen)
+	}
+
+	scalar := new(big.Int).SetBytes(key.PrivateKey)
+	if scalar.Sign() == 0 || scalar.Cmp(btcec.S256().N) >= 0 {
+		return nil, errors.Wrap(ErrInvalidPrivateKey,
+			"private key is not in range [1, n-1]")
+	}
+
+	ecPrivKey, ecPubKey := btcec.PrivKeyFromBytes(key.PrivateKey)
+
+	if len(key.PublicKey) > 0 {
+		expectedPubKey, err := btcec.ParsePubKey(key.PublicKey)
+		if err != nil {
+			return nil, errors.Wrapf(err, "failed to parse public key %s",
+				hex.EncodeToString(key.PublicKey))
+		}
+
+		if !ecPubKey.IsEqual(expectedPubKey) {
+			return nil, errors.Wrapf(ErrPublicKeyMismatch,
+				"private key does not match public key %s",
+				hex.EncodeToString(key.PublicKey))
+		}
+	}
+
+	return ecPrivKey, nil
+}
+
+// newPrevOutFetcher returns the outputs spent by the inputs of a
+// transaction, which txscript needs to compute signature hashes and execute
+// scripts, since BIP0341 signature hashes commit to all of them. Utxos are
+// matched to inputs by position.
+func newPrevOutFetcher(msgTx *wire.MsgTx, utxos []Utxo) (*txscript.MultiPrevOutFetcher, error) {
+	if len(msgTx.TxIn) != len(utxos) {
+		return nil, errors.Wrap(ErrLengthMismatch, "inputs length != utxos length")
+	}
+
+	prevOuts := txscript.NewMultiPrevOutFetcher(nil)
+	for idx, txIn := range msgTx.TxIn {
+		prevOuts.AddPrevOut(txIn.PreviousOutPoint,
+			wire.NewTxOut(utxos[idx].Value, utxos[idx].Script))
+	}
+
+	return prevOuts, nil
+}
+
+// newTxSigHashes computes the hashes of a transaction that are shared by the
+// BIP0143 and BIP0341 signature hashes of all its inputs.
+func newTxSigHashes(msgTx *wire.MsgTx, utxos []Utxo) (*txscript.TxSigHashes, error) {
+	prevOuts, err := newPrevOutFetcher(msgTx, utxos)
+	if err != nil {
+		return nil, err
+	}
+
+	return txscript.NewTxSigHashes(msgTx, prevOuts), nil
+}
+
+// signInput produces the DER signature of the input at index idx, spending
+// the given utxo, using the SIGHASH_ALL signature hash type.
+//
+// The signature hash is computed with the legacy algorithm for P2PKH utxos,
+// and with the BIP0143 algorithm for segwit utxos otherwise, P2SH utxos being
+// nested P2WPKH.
+//
+// If the utxo is a P2TR output, a 64-byte BIP0340 signature of a key-path
+// spend is produced instead, or of a script-path spend if the utxo has a
+// tap leaf script, using the SIGHASH_DEFAULT signature hash type.
+//
+// If grindLowR is set, ECDSA signatures are produced with a low R value.
+func signInput(
+	msgTx *wire.MsgTx,
+	sigHashes *txscript.TxSigHashes,
+	idx int,
+	utxo Utxo,
+	privKey *btcec.PrivateKey,
+	grindLowR bool,
+) (DerSignature, error) {
+	if err := checkPreviousTx(msgTx.TxIn[idx], utxo); err != nil {
+		return nil, errors.Wrapf(err, "invalid previous tx for input %d", idx)
+	}
+
+	if txscript.IsPayToTaproot(utxo.Script) {
+		sig, err := signTaprootInput(msgTx, sigHashes, idx, utxo, privKey)
+		if err != nil {
+			return nil, errors.Wrapf(err,
+				"failed to generate schnorr signature for input %v",
+				msgTx.TxIn[idx],
+			)
+		}
+
+		return sig, nil
+	}
+
+	if txscript.GetScriptClass(utxo.Script) == txscript.PubKeyHashTy {
+		var (
+			derSig DerSignature
+			err    error
+		)
+
+		if grindLowR {
+			derSig, err = legacyLowRSignature(msgTx, idx, utxo.Script, privKey)
+		} else {
+			derSig, err = txscript.RawTxInSignature(
+				msgTx, idx, utxo.Script, txscript.SigHashAll, privKey)
+		}
+
+		if err != nil {
+			return nil, errors.Wrapf(err,
+				"failed to generate legacy der signature for input %v",
+				msgTx.TxIn[idx],
+			)
+		}
+
+		return derSig, nil
+	}
+
+	// A P2SH utxo is assumed to be a nested P2WPKH, signed against its
+	// redeemScript, i.e. the P2WPKH witness program of the signing key.
+	witnessProgram := utxo.Script
+	if txscript.IsPayToScriptHash(utxo.Script) {
+		var err error
+
+		witnessProgram, err = txscript.NewScriptBuilder().AddOp(txscript.OP_0).
+			AddData(btcutil.Hash160(privKey.PubKey().SerializeCompressed())).Script()
+		if err != nil {
+			return nil, errors.Wrapf(err,
+				"failed to build witness program for input %v",
+				msgTx.TxIn[idx],
+			)
+		}
+	}
+
+	var (
+		derSig DerSignature
+		err    error
+	)
+
+	if grindLowR {
+		derSig, err = witnessLowRSignature(
+			msgTx, sigHashes, idx, utxo.Value, witnessProgram, privKey)
+	} else {
+		derSig, err = txscript.RawTxInWitnessSignature(
+			msgTx, sigHashes, idx, utxo.Value, witnessProgram, txscript.SigHashAll, privKey)
+	}
+
+	if err != nil {
+		return nil, errors.Wrapf(err,
+			"failed to generate der signature for input %v",
+			msgTx.TxIn[idx],
+		)
+	}
+
+	return derSig, nil
+}
+
+// legacyLowRSignature returns the low R signature of the input at index idx,
+// computed with the legacy signature hash algorithm and SIGHASH_ALL.
+func legacyLowRSignature(
+	msgTx *wire.MsgTx, idx int, script []byte, privKey *btcec.PrivateKey,
+) (DerSignature, error) {
+	hash, err := txscript.CalcSignatureHash(script, txscript.SigHashAll, msgTx, idx)
+	if err != nil {
+		return nil, err
+	}
+
+	return lowRSignature(hash, txscript.SigHashAll, privKey), nil
+}
+
+// witnessLowRSignature returns the low R signature of the input at index
+// idx, computed with the BIP0143 signature hash algorithm and SIGHASH_ALL.
+func witnessLowRSignature(
+	msgTx *wire.MsgTx,
+	sigHashes *txscript.TxSigHashes,
+	idx int,
+	amount int64,
+	script []byte,
+	privKey *btcec.PrivateKey,
+) (DerSignature, error) {
+	hash, err := txscript.CalcWitnessSigHash(
+		script, sigHashes, txscript.SigHashAll, msgTx, idx, amount)
+	if err != nil {
+		return nil, err
+	}
+
+	return lowRSignature(hash, txscript.SigHashAll, privKey), nil
+}
+
+// checkSigningKey verifies that a utxo script pays to the given public key,
+// and returns ErrPublicKeyMismatch otherwise.
+//
+// Only single-key scripts are checked: P2PKH, P2SH assumed to be nested
+// P2WPKH, P2WPKH, and P2TR with a BIP0086 output key, or with a tap leaf
+// script pushing the x-only public key for script-path spends. Other
+// scripts, and missing scripts, are not checked.
+func checkSigningKey(utxo Utxo, pubKey *btcec.PublicKey) error {
+	script := utxo.Script
+	pubKeyHash := btcutil.Hash160(pubKey.SerializeCompressed())
+
+	var matches bool
+
+	switch {
+	case txscript.GetScriptClass(script) == txscript.PubKeyHashTy:
+		// OP_DUP OP_HASH160 <20-byte hash> OP_EQUALVERIFY OP_CHECKSIG
+		scriptHash := script[3:23]
+		matches = bytes.Equal(scriptHash, pubKeyHash) ||
+			bytes.Equal(scriptHash, btcutil.Hash160(pubKey.SerializeUncompressed()))
+	case txscript.IsPayToScriptHash(script):
+		// OP_HASH160 <20-byte hash of OP_0 <20-byte public key hash>> OP_EQUAL
+		redeemScript := append([]byte{txscript.OP_0, txscript.OP_DATA_20}, pubKeyHash...)
+		matches = bytes.Equal(script[2:22], btcutil.Hash160(redeemScript))
+	case txscript.IsPayToWitnessPubKeyHash(script):
+		// OP_0 <20-byte public key hash>
+		matches = bytes.Equal(script[2:], pubKeyHash)
+	case txscript.IsPayToTaproot(script) && len(utxo.TapLeafScript) > 0:
+		// e.g. <32-byte x-only public key> OP_CHECKSIG
+		matches = tapLeafHasKey(utxo.TapLeafScript, pubKey)
+	case txscript.IsPayToTaproot(script):
+		// OP_1 <32-byte x-only output key>
+		outputKey := txscript.ComputeTaprootKeyNoScript(pubKey)
+		matches = bytes.Equal(script[2:], schnorr.SerializePubKey(outputKey))
+	default:
+		return nil
+	}
+
+	if !matches {
+		return errors.Wrapf(ErrPublicKeyMismatch, "public key %x", pubKey.SerializeCompressed())
+	}
+
+	return nil
+}
+
+// checkPreviousTx verifies that the previous transaction of a utxo, if any,
+// is the one referenced by the input, and that the spent output matches the
+// script and the value of the utxo.
+func checkPreviousTx(txIn *wire.TxIn, utxo Utxo) error {
+	if len(utxo.PreviousTx) == 0 {
+		return nil
+	}
+
+	prevTx := wire.NewMsgTx(wire.TxVersion)
+	if err := prevTx.Deserialize(bytes.NewReader(utxo.PreviousTx)); err != nil {
+		return errors.Wrap(err, "failed to deserialize previous tx")
+	}
+
+	prevOut := txIn.PreviousOutPoint
+
+	if prevTxHash := prevTx.TxHash(); prevTxHash != prevOut.Hash {
+		return errors.Wrapf(ErrPreviousTxMismatch,
+			"previous tx hash %s does not match outpoint %s",
+			prevTxHash, prevOut)
+	}
+
+	if prevOut.Index >= uint32(len(prevTx.TxOut)) {
+		return errors.Wrapf(ErrPreviousTxMismatch,
+			"outpoint %s is out of range of the %d outputs of previous tx",
+			prevOut, len(prevTx.TxOut))
+	}
+
+	txOut := prevTx.TxOut[prevOut.Index]
+
+	if !bytes.Equal(txOut.PkScript, utxo.Script) {
+		return errors.Wrapf(ErrPreviousTxMismatch,
+			"output script %x of outpoint %s does not match utxo script %x",
+			txOut.PkScript, prevOut, utxo.Script)
+	}
+
+	if txOut.Value != utxo.Value {
+		return errors.Wrapf(ErrPreviousTxMismatch,
+			"output value %d of outpoint %s does not match utxo value %d",
+			txOut.Value, prevOut, utxo.Value)
+	}
+
+	return nil
+}
+
+func (s *Service) SignTransaction(msgTx *wire.MsgTx, chainParams chaincfg.ChainParams, signatures []SignatureMetadata) (*RawTx, error) {
+	// Validation
+	if len(msgTx.TxIn) != len(signatures) {
+		return nil, errors.Wrap(ErrLengthMismatch, "inputs length != signatures length")
+	}
+
+	for inputIdx, input := range msgTx.TxIn {
+
+		// Get the signature struct assuming inputs and signatures are in the same order
+		signature := signatures[inputIdx]
+
+		// Get the DER signature
+		derSig := signature.DerSig
+
+		// Get input address public key
+		pubKey := signature.PubKey
+
+		// Get address type for the input
+		inputAddrEncoding := signature.AddrEncoding
+
+		if len(signature.UtxoScript) > 0 {
+			scriptEncoding, err := addressEncodingFromScript(signature.UtxoScript)
+			if err != nil {
+				return nil, errors.Wrapf(err, "input %d", inputIdx)
+			}
+
+			if scriptEncoding != inputAddrEncoding {
+				return nil, errors.Wrapf(ErrAddressEncodingMismatch,
+					"input %d: declared %s, but utxo script %x is %s",
+					inputIdx, inputAddrEncoding, signature.UtxoScript,
+					scriptEncoding)
+			}
+		}
+
+		if signature.UncompressedPubKey && inputAddrEncoding != Legacy {
+			return nil, errors.Wrapf(ErrUncompressedPublicKey,
+				"input %d: %s input", inputIdx, inputAddrEncoding)
+		}
+
+		if signature.NormalizeLowS && inputAddrEncoding != Taproot && len(derSig) > 0 {
+			lowSSig, err := s.NormalizeSignatureLowS(derSig[:len(derSig)-1])
+			if err != nil {
+				return nil, errors.Wrapf(ErrNonCanonicalSignature,
+					"input %d: %v", inputIdx, err)
+			}
+
+			derSig = append(lowSSig, derSig[len(derSig)-1])
+		}
+
+		// Nodes reject transactions with non-canonical signatures, hence
+		// externally-produced signatures are checked before assembly.
+		if err := s.checkSignatureEncoding(derSig, inputAddrEncoding); err != nil {
+			return nil, errors.Wrapf(ErrNonCanonicalSignature,
+				"input %d: %v", inputIdx, err)
+		}
+
+		scriptPath := len(signature.TapLeafScript) > 0 || len(signature.ControlBlock) > 0
+		if scriptPath && inputAddrEncoding != Taproot {
+			return nil, errors.Errorf("input %d: tap leaf script and control block "+
+				"are only allowed for %s inputs", inputIdx, Taproot)
+		}
+
+		// Script-path spends of P2TR outputs reveal the tapscript leaf,
+		// after the data it consumes, and the control block proving that the
+		// output key commits to it.
+		if scriptPath {
+			if len(signature.TapLeafScript) == 0 {
+				return nil, errors.Errorf("input %d: control block without "+
+					"tap leaf script", inputIdx)
+			}
+
+			var outputKey []byte
+			if len(signature.UtxoScript) > 0 {
+				outputKey = signature.UtxoScript[2:]
+			}
+
+			if err := checkControlBlock(
+				signature.ControlBlock, signature.TapLeafScript, outputKey,
+			); err != nil {
+				return nil, errors.Wrapf(err, "input %d", inputIdx)
+			}
+
+			input.SignatureScript = nil
+			input.Witness = wire.TxWitness{
+				derSig, signature.TapLeafScript, signature.ControlBlock,
+			}
+			continue
+		}
+
+		// Key-path spends of P2TR outputs only need the Schnorr signature
+		// in the witness, since the output key is the witness program.
+		if inputAddrEncoding == Taproot {
+			input.SignatureScript = nil
+			input.Witness = wire.TxWitness{derSig}
+			continue
+		}
+
+		// Serialize input public key data
+		pubKeyData := pubKey.SerializeCompressed()
+		if signature.UncompressedPubKey {
+			pubKeyData = pubKey.SerializeUncompressed()
+		}
+
+		// Spending a P2PKH output only requires a sigScript, pushing the
+		// signature and the public key. There is no witness data.
+		if inputAddrEncoding == Legacy {
+			sigScript, err := txscript.NewScriptBuilder().
+				AddData(derSig).AddData(pubKeyData).Script()
+			if err != nil {
+				return nil, err
+			}
+
+			input.SignatureScript = sigScript
+			input.Witness = nil
+			continue
+		}
+
+		var sigScript []byte
+
+		// If we're spending p2wkh output nested within a p2sh output, then
+		// we'll need to attach a sigScript in addition to witness data.
+		// Otherwise sigScript is an empty byte array
+		if inputAddrEncoding == WrappedSegwit {
+			pubKeyHash := btcutil.Hash160(pubKeyData)
+
+			// Next, we'll generate a valid sigScript that will allow us to
+			// spend the p2sh output. The sigScript will contain only a
+			// single push of the p2wkh witness program corresponding to
+			// the matching public key of this address.
+			p2wkhAddr, err := btcutil.NewAddressWitnessPubKeyHash(
+				pubKeyHash, chainParams,
+			)
+
+			if err != nil {
+				return nil, err
+			}
+
+			redeemScript, err := txscript.PayToAddrScript(p2wkhAddr)
+			if err != nil {
+				return nil, err
+			}
+
+			bldr := txscript.NewScriptBuilder()
+			bldr.AddData(redeemScript)
+			sigScript, err = bldr.Script()
+
+			if err != nil {
+				return nil, err
+			}
+		}
+
+		// Put signature script and witness data to the input
+		input.SignatureScript = sigScript
+		input.Witness = wire.TxWitness{derSig, pubKeyData}
+	}
+
+	// Encode signed MsgTx to RawTx
+	signedRawTx, err := encodeMsgTx(msgTx)
+	if err != nil {
+		return nil, err
+	}
+
+	return signedRawTx, nil
+}
+
+// checkSignatureEncoding verifies that the signature of an input is
+// canonically encoded, as required by the standardness rules of nodes:
+//   * ECDSA signatures are strictly DER-encoded, with a low S value, and
+//     followed by a defined signature hash type.
+//   * Schnorr signatures of P2TR inputs are 64 bytes long, or 65 bytes long
+//     with an explicit, defined signature hash type other than
+//     SIGHASH_DEFAULT, as per BIP0341.
+func (s *Service) checkSignatureEncoding(sig DerSignature, encoding AddressEncoding) error {
+	if encoding == Taproot {
+		switch len(sig) {
+		case schnorr.SignatureSize:
+			return nil
+		case schnorr.SignatureSize + 1:
+			return checkSigHashType(sig[schnorr.SignatureSize])
+		default:
+			return errors.Errorf("invalid schnorr signature length %d", len(sig))
+		}
+	}
+
+	if len(sig) == 0 {
+		return errors.New("empty signature")
+	}
+
+	if err := checkSigHashType(sig[len(sig)-1]); err != nil {
+		return err
+	}
+
+	return s.ValidateDerSignature(sig[:len(sig)-1])
+}
+
+// checkSigHashType verifies that an explicit signature hash type is one of
+// SIGHASH_ALL, SIGHASH_NONE or SIGHASH_SINGLE, optionally combined with
+// SIGHASH_ANYONECANPAY.
+func checkSigHashType(b byte) error {
+	switch txscript.SigHashType(b) &^ txscript.SigHashAnyOneCanPay {
+	case txscript.SigHashAll, txscript.SigHashNone, txscript.SigHashSingle:
+		return nil
+	default:
+		return errors.Errorf("undefined signature hash type 0x%02x", b)
+	}
+}
+
+// ValidateDerSignature verifies that an ECDSA signature, without signature
+// hash type, is strictly DER-encoded as per BIP0066, with a low S value as
+// per BIP0062. Nodes reject transactions with other signatures as
+// non-standard.
+//
+// References:
+//   [BIP62]: BIP0062 - Dealing with malleability
+//   https://github.com/bitcoin/bips/blob/master/bip-0062.mediawiki#low-s-values-in-signatures
+//
+//   [BIP66]: BIP0066 - Strict DER signatures
+//   https://github.com/bitcoin/bips/blob/master/bip-0066.mediawiki
+func (s *Service) ValidateDerSignature(der []byte) error {
+	ecSig, err := parseDerSignature(der)
+	if err != nil {
+		return err
+	}
+
+	if sValue := ecSig.S(); sValue.IsOverHalfOrder() {
+		return errors.New("signature is not canonical due to unnecessarily high S value")
+	}
+
+	return nil
+}
+
+// NormalizeSignatureLowS returns the low S form of a strictly DER-encoded
+// ECDSA signature, without signature hash type, as produced by some HSMs.
+// A high S value is replaced by N - S, which is an equally valid signature
+// of the same hash, as required by the standardness rules of BIP0062.
+// Signatures with a low S value are returned unchanged.
+func (s *Service) NormalizeSignatureLowS(der []byte) ([]byte, error) {
+	ecSig, err := parseDerSignature(der)
+	if err != nil {
+		return nil, err
+	}
+
+	// ecdsa serializes signatures with the S value negated if high.
+	return ecSig.Serialize(), nil
+}
+
+// parseDerSignature parses an ECDSA signature, without signature hash type,
+// strictly DER-encoded as per BIP0066.
+func parseDerSignature(der []byte) (*ecdsa.Signature, error) {
+	// ecdsa.ParseDERSignature enforces the strict DER encoding rules of
+	// BIP0066, but ignores trailing bytes, and accepts high S values.
+	if len(der) < 2 || int(der[1])+2 != len(der) {
+		return nil, errors.New("malformed signature: bad length")
+	}
+
+	return ecdsa.ParseDERSignature(der)
+}
+
+// InputVerificationFailure describes why the script of a signed input
+// failed verification.
+type InputVerificationFailure struct {
+	InputIndex int
+	Reason     string
+}
+
+// VerificationError is returned when the scripts of one or more inputs of a
+// signed transaction fail verification.
+type VerificationError struct {
+	Failures []InputVerificationFailure
+}
+
+func (e *VerificationError) Error() string {
+	reasons := make([]string, len(e.Failures))
+	for idx, failure := range e.Failures {
+		reasons[idx] = fmt.Sprintf("input %d: %s", failure.InputIndex, failure.Reason)
+	}
+
+	return fmt.Sprintf("script verification failed for %d input(s): %s",
+		len(e.Failures), strings.Join(reasons, "; "))
+}
+
+// SignAndVerifyTransaction generates the DER signatures of all inputs,
+// assembles the signed transaction, and runs full script verification of
+// every input against the utxo it spends.
+//
+// The signed transaction is returned only if all inputs verify. Otherwise,
+// a *VerificationError listing the failing inputs is returned. msgTx is
+// never modified.
+//
+// privKey must be an extended private key of the network of the chain
+// parameters, or ErrNotPrivateExtendedKey or ErrNetworkMismatch is
+// returned. Utxos and signatures must be as many as the inputs, or
+// ErrLengthMismatch is returned.
+func (s *Service) SignAndVerifyTransaction(
+	msgTx *wire.MsgTx,
+	utxos []Utxo,
+	privKey string,
+	signatures []SignatureMetadata,
+	chainParams chaincfg.ChainParams,
+) (*RawTx, error) {
+	if len(msgTx.TxIn) != len(signatures) {
+		return nil, errors.Wrap(ErrLengthMismatch, "inputs length != signatures length")
+	}
+
+	masterKey, err := hdkeychain.NewKeyFromString(privKey)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to get extended key from private key")
+	}
+
+	if err := checkExtendedKeyNetwork(masterKey, chainParams); err != nil {
+		return nil, err
+	}
+
+	// Work on a copy, to never leak a partially signed transaction.
+	signedMsgTx := msgTx.Copy()
+
+	derSignatures, err := s.GenerateDerSignatures(signedMsgTx, utxos, privKey, false)
+	if err != nil {
+		return nil, err
+	}
+
+	signaturesWithDerSig := make([]SignatureMetadata, len(signatures))
+	for idx, signature := range signatures {
+		signature.DerSig = derSignatures[idx]
+		signature.UtxoScript = utxos[idx].Script
+		signaturesWithDerSig[idx] = signature
+	}
+
+	signedRawTx, err := s.SignTransaction(signedMsgTx, chainParams, signaturesWithDerSig)
+	if err != nil {
+		return nil, err
+	}
+
+	if failures := verifyInputs(signedMsgTx, utxos); len(failures) > 0 {
+		return nil, &VerificationError{Failures: failures}
+	}
+
+	return signedRawTx, nil
+}
+
+// verifyInputs executes the scripts of all inputs of a signed transaction,
+// and returns the failures, if any.
+func verifyInputs(msgTx *wire.MsgTx, utxos []Utxo) []InputVerificationFailure {
+	var failures []InputVerificationFailure
+
+	// The utxos have already been checked against the inputs.
+	prevOuts, _ := newPrevOutFetcher(msgTx, utxos)
+	sigHashes := txscript.NewTxSigHashes(msgTx, prevOuts)
+
+	for idx := range msgTx.TxIn {
+		engine, err := txscript.NewEngine(utxos[idx].Script, msgTx, idx,
+			txscript.StandardVerifyFlags, nil, sigHashes, utxos[idx].Value, prevOuts)
+		if err == nil {
+			err = engine.Execute()
+		}
+
+		if err != nil {
+			failures = append(failures, InputVerificationFailure{
+				InputIndex: idx,
+				Reason:     err.Error(),
+			})
+		}
+	}
+
+	return failures
+}
+
+// Encode MsgTx to RawTx
+//
+// Without witness data, btcd computes the witness hash as the txid, so that
+// WitnessHash equals Hash, and Hex equals StrippedHex.
+func encodeMsgTx(msgTx *wire.MsgTx) (*RawTx, error) {
+	var buf bytes.Buffer
+	if err := msgTx.Serialize(&buf); err != nil {
+		return nil, errors.Wrap(err, "failed to encode transaction in hex")
+	}
+
+	strippedHex, err := encodeMsgTxNoWitness(msgTx)
+	if err != nil {
+		return nil, err
+	}
+
+	rawTx := &RawTx{
+		Hex:         hex.EncodeToString(buf.Bytes()),
+		Hash:        msgTx.TxHash().String(),
+		WitnessHash: msgTx.WitnessHash().String(),
+		StrippedHex: strippedHex,
+	}
+
+	return rawTx, nil
+}
+
+// SerializeNoWitness serializes a transaction without its witness data,
+// i.e. in the legacy format preceding BIP0144, for legacy systems and to
+// compute the txid.
+//
+// The serialization is both the Hex and StrippedHex of the result, and the
+// txid both its Hash and WitnessHash.
+func (s *Service) SerializeNoWitness(msgTx *wire.MsgTx) (*RawTx, error) {
+	strippedHex, err := encodeMsgTxNoWitness(msgTx)
+	if err != nil {
+		return nil, err
+	}
+
+	txid := msgTx.TxHash().String()
+
+	return &RawTx{
+		Hex:         strippedHex,
+		Hash:        txid,
+		WitnessHash: txid,
+		StrippedHex: strippedHex,
+	}, nil
+}
+
+// encodeMsgTxNoWitness returns the hex of the serialized transaction,
+// without witness data.
+func encodeMsgTxNoWitness(msgTx *wire.MsgTx) (string, error) {
+	var buf bytes.Buffer
+	if err := msgTx.SerializeNoWitness(&buf); err != nil {
+		return "", errors.Wrap(err, "failed to encode stripped transaction in hex")
+	}
+
+	return hex.EncodeToString(buf.Bytes()), nil
+}
+
+// Deserialize MsgTx from RawTx
+func (s *Service) DeserializeMsgTx(rawTx *RawTx) (*wire.MsgTx, error) {
+	// Instantiate a MsgTx
+	msgTx := wire.NewMsgTx(wire.TxVersion)
+
+	// Get bytes from hex string
+	hexBytes, err := hex.DecodeString(rawTx.Hex)
+	if err != nil {
+		return nil, errors.Wrapf(err,
+			"failed to derialize raw tx %v",
+			rawTx,
+		)
+	}
+	reader := bytes.NewReader(hexBytes)
+
+	// Derialize into MsgTx
+	if err := msgTx.Deserialize(reader); err != nil {
+		return nil, errors.Wrapf(err,
+			"failed to deserialize raw tx %v",
+			rawTx,
+		)
+	}
+
+	return msgTx, nil
+}
+
+// DecodedRawTx is a transaction decoded from its serialized form, along
+// with the serialization format that was used.
+type DecodedRawTx struct {
+	MsgTx       *wire.MsgTx
+	Hash        string
+	WitnessHash string
+
+	// SegwitSerialized indicates whether the raw transaction was serialized
+	// with the BIP144 marker and flag bytes, i.e. with witness data.
+	//
+	// A legacy serialized transaction spending segwit outputs has had its
+	// witness data stripped, and cannot be broadcasted as is.
+	SegwitSerialized bool
+}
+
+// References:
+//   [BIP144]: BIP0144 - Segregated Witness (Peer Services)
+//   https://github.com/bitcoin/bips/blob/master/bip-0144.mediawiki
+
+// DecodeRawTransaction deserializes a hex-encoded raw transaction, and
+// reports whether it uses the segwit or the legacy serialization format.
+func (s *Service) DecodeRawTransaction(rawTxHex string) (*DecodedRawTx, error) {
+	rawTxBytes, err := hex.DecodeString(rawTxHex)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to decode raw tx hex %s", rawTxHex)
+	}
+
+	msgTx := wire.NewMsgTx(wire.TxVersion)
+	if err := msgTx.Deserialize(bytes.NewReader(rawTxBytes)); err != nil {
+		return nil, errors.Wrapf(err, "failed to deserialize raw tx %s", rawTxHex)
+	}
+
+	return &DecodedRawTx{
+		MsgTx:            msgTx,
+		Hash:             msgTx.TxHash().String(),
+		WitnessHash:      msgTx.WitnessHash().String(),
+		SegwitSerialized: isSegwitSerialized(rawTxBytes),
+	}, nil
+}
+
+// TxidFromHex returns the txid and the wtxid of a hex-encoded raw
+// transaction, without building its decoded structure. Both are the same
+// for a transaction without witness data.
+func (s *Service) TxidFromHex(rawTxHex string) (txid string, wtxid string, err error) {
+	msgTx, err := s.DeserializeMsgTx(&RawTx{Hex: rawTxHex})
+	if err != nil {
+		return "", "", err
+	}
+
+	return msgTx.TxHash().String(), msgTx.WitnessHash().String(), nil
+}
+
+// ReplaceOutputAddress replaces the script of the output at outputIndex of
+// an unsigned hex-encoded raw transaction by the script paying to
+// newAddress, keeping the value of the output, and returns the new
+// transaction.
+//
+// Transactions with a sigScript or witness data in any input are rejected,
+// since the signatures commit to the outputs, and would become invalid.
+func (s *Service) ReplaceOutputAddress(
+	rawHex string, outputIndex uint32, newAddress string, chainParams chaincfg.ChainParams,
+) (*RawTx, error) {
+	msgTx, err := s.DeserializeMsgTx(&RawTx{Hex: rawHex})
+	if err != nil {
+		return nil, err
+	}
+
+	for idx, txIn := range msgTx.TxIn {
+		if len(txIn.SignatureScript) > 0 || len(txIn.Witness) > 0 {
+			return nil, errors.Errorf("input %d is already signed", idx)
+		}
+	}
+
+	if int(outputIndex) >= len(msgTx.TxOut) {
+		return nil, errors.Errorf("output index %d out of range, transaction has %d outputs",
+			outputIndex, len(msgTx.TxOut))
+	}
+
+	address, err := decodeAddress(newAddress, chainParams)
+	if err != nil && isForeignBase58Address(newAddress, chainParams) {
+		return nil, errors.Wrapf(ErrNetworkMismatch,
+			"address %s is not for network %s", newAddress, chainParams.Name)
+	}
+
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to decode address %s", newAddress)
+	}
+
+	if !address.IsForNet(chainParams) {
+		return nil, errors.Wrapf(ErrNetworkMismatch,
+			"address %s is not for network %s", newAddress, chainParams.Name)
+	}
+
+	script, err := txscript.PayToAddrScript(address)
+	if err != nil {
+		return nil, errors.Wrapf(err,
+			"failed to build 'pay to' script from address %v", address)
+	}
+
+	msgTx.TxOut[outputIndex].PkScript = script
+
+	return encodeMsgTx(msgTx)
+}
+
+// DecodedTx is the structured content of a transaction, as returned by
+// DecodeTransaction.
+type DecodedTx struct {
+	Version  int32
+	LockTime uint32
+	Inputs   []DecodedTxInput
+	Outputs  []DecodedTxOutput
+
+	// TotalOutput is the total value of the outputs.
+	TotalOutput int64
+
+	// HasFee indicates that the previous output of every input was supplied
+	// to DecodeTransaction, in which case TotalInput and Fee are set. They
+	// are zero otherwise.
+	HasFee     bool
+	TotalInput int64
+	Fee        int64
+}
+
+// DecodedTxInput is an input of a DecodedTx, i.e. the outpoint it spends,
+// and its sequence number.
+//
+// Script and Value are the ones of the previous output spent by the input,
+// if supplied to DecodeTransaction, and are empty otherwise.
+type DecodedTxInput struct {
+	OutputHash  string
+	OutputIndex uint32
+	Sequence    uint32
+	Script      []byte
+	Value       int64
+}
+
+// DecodedTxOutput is an output of a DecodedTx.
+//
+// Addresses are the addresses the script pays to, encoded for the network
+// of the chain parameters. It is empty for non-standard scripts, and has
+// several addresses for bare multisig scripts.
+type DecodedTxOutput struct {
+	Value     int64
+	Script    []byte
+	Addresses []string
+}
+
+// DecodeTransaction deserializes a hex-encoded raw transaction, and returns
+// its inputs and outputs, along with the addresses paid by the outputs.
+//
+// The optional prevouts are the outputs spent by the inputs, matched by
+// outpoint with their OutputHash and OutputIndex, whose Script and Value are
+// echoed in the decoded inputs. If every input has a previous output, the
+// total input value and the fee of the transaction are computed. Prevouts
+// not spent by any input are rejected, as are prevouts worth less than the
+// outputs.
+func (s *Service) DecodeTransaction(
+	rawTxHex string, prevouts []Input, chainParams chaincfg.ChainParams,
+) (*DecodedTx, error) {
+	decodedRawTx, err := s.DecodeRawTransaction(rawTxHex)
+	if err != nil {
+		return nil, err
+	}
+
+	msgTx := decodedRawTx.MsgTx
+
+	prevoutsByOutPoint := make(map[wire.OutPoint]Input, len(prevouts))
+
+	for _, prevout := range prevouts {
+		hash, err := chainhash.NewHashFromStr(prevout.OutputHash)
+		if err != nil {
+			return nil, errors.Wrapf(err, "invalid prevout hash %s", prevout.OutputHash)
+		}
+
+		if prevout.Value < 0 {
+			return nil, errors.Errorf("prevout %s:%d has negative value %d",
+				prevout.OutputHash, prevout.OutputIndex, prevout.Value)
+		}
+
+		prevoutsByOutPoint[*wire.NewOutPoint(hash, prevout.OutputIndex)] = prevout
+	}
+
+	spentOutPoints := make(map[wire.OutPoint]bool, len(msgTx.TxIn))
+	for _, txIn := range msgTx.TxIn {
+		spentOutPoints[txIn.PreviousOutPoint] = true
+	}
+
+	for outPoint := range prevoutsByOutPoint {
+		if !spentOutPoints[outPoint] {
+			return nil, errors.Errorf("prevout %s is not spent by the transaction", outPoint)
+		}
+	}
+
+	decodedTx := &DecodedTx{
+		Version:  msgTx.Version,
+		LockTime: msgTx.LockTime,
+		Inputs:   make([]DecodedTxInput, len(msgTx.TxIn)),
+		Outputs:  make([]DecodedTxOutput, len(msgTx.TxOut)),
+		HasFee:   len(msgTx.TxIn) > 0,
+	}
+
+	for idx, txIn := range msgTx.TxIn {
+		decodedTx.Inputs[idx] = DecodedTxInput{
+			OutputHash:  txIn.PreviousOutPoint.Hash.String(),
+			OutputIndex: txIn.PreviousOutPoint.Index,
+			Sequence:    txIn.Sequence,
+		}
+
+		prevout, ok := prevoutsByOutPoint[txIn.PreviousOutPoint]
+		if !ok {
+			decodedTx.HasFee = false
+			continue
+		}
+
+		decodedTx.Inputs[idx].Script = prevout.Script
+		decodedTx.Inputs[idx].Value = prevout.Value
+		decodedTx.TotalInput += prevout.Value
+	}
+
+	for idx, txOut := range msgTx.TxOut {
+		addresses, err := scriptAddresses(txOut.PkScript, chainParams)
+		if err != nil {
+			return nil, errors.Wrapf(err, "failed to decode output %d", idx)
+		}
+
+		decodedTx.Outputs[idx] = DecodedTxOutput{
+			Value:     txOut.Value,
+			Script:    txOut.PkScript,
+			Addresses: addresses,
+		}
+
+		decodedTx.TotalOutput += txOut.Value
+	}
+
+	if !decodedTx.HasFee {
+		decodedTx.TotalInput = 0
+		return decodedTx, nil
+	}
+
+	if decodedTx.TotalInput < decodedTx.TotalOutput {
+		return nil, errors.Errorf("prevouts are worth %d, less than the %d of the outputs",
+			decodedTx.TotalInput, decodedTx.TotalOutput)
+	}
+
+	decodedTx.Fee = decodedTx.TotalInput - decodedTx.TotalOutput
+
+	return decodedTx, nil
+}
+
+// scriptAddresses returns the encoded addresses an output script pays to.
+func scriptAddresses(script []byte, chainParams chaincfg.ChainParams) ([]string, error) {
+	_, addresses, _, err := txscript.ExtractPkScriptAddrs(script, chainParams)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to extract addresses from script %x",
+			script)
+	}
+
+	encodedAddresses := make([]string, len(addresses))
+	for idx, address := range addresses {
+		encodedAddresses[idx] = address.EncodeAddress()
+	}
+
+	return encodedAddresses, nil
+}
+
+// isSegwitSerialized inspects the marker and flag bytes following the 4-byte
+// version of a serialized transaction.
+//
+// In the legacy format, the version is followed by the number of inputs,
+// which is never zero for a valid transaction. In the BIP144 format, it is
+// followed by the 0x00 marker, and the 0x01 flag.
+func isSegwitSerialized(rawTxBytes []byte) bool {
+	const (
+		witnessMarker = 0x00
+		witnessFlag   = 0x01
+	)
+
+	return len(rawTxBytes) > 6 &&
+		rawTxBytes[4] == witnessMarker && rawTxBytes[5] == witnessFlag
+}
+
+// maxSizePaddingVbytes is the maximum number of vbytes added to the
+// estimated virtual size of a transaction to overestimate its fee.
+const maxSizePaddingVbytes = 1000
+
+func getMaxRequiredFee(outputs []*wire.TxOut, utxoScripts [][]byte, feeSatPerKb int64) int64 {
+	maxSignedSize := estimateVirtualSize(outputs, utxoScripts)
+	maxRequiredFee := txrules.FeeForSerializeSize(btcutil.Amount(feeSatPerKb), maxSignedSize)
+
+	return int64(maxRequiredFee)
+}
+
+// Worst case sizes of the inputs spending P2TR outputs, in the key path.
+const (
+	// redeemP2TRInputSize is the size of a transaction input spending a
+	// P2TR output, without witness. It is calculated as:
+	//
+	//   - 32 bytes previous tx
+	//   - 4 bytes output index
+	//   - 1 byte encoding empty signature script
+	//   - 4 bytes sequence
+	redeemP2TRInputSize = 32 + 4 + 1 + 4
+
+	// redeemP2TRInputWitnessWeight is the weight of the witness of a P2TR
+	// key path spend, signed with the default BIP0341 signature hash type.
+	// It is calculated as:
+	//
+	//   - 1 wu compact int encoding value 1 (number of items)
+	//   - 1 wu compact int encoding value 64
+	//   - 64 wu Schnorr signature
+	redeemP2TRInputWitnessWeight = 1 + 1 + 64
+)
+
+// TxSize is the estimated size of a signed transaction, as returned by
+// EstimateTxSize.
+type TxSize struct {
+	// Size is the serialized size in bytes, including the witness data.
+	Size int
+
+	// Weight is the BIP0141 weight, i.e. 4 wu per non-witness byte, and 1 wu
+	// per witness byte.
+	Weight int
+
+	// VirtualSize is the weight divided by 4, rounded up, on which fees are
+	// computed.
+	VirtualSize int
+}
+
+// EstimateTxSize returns the worst case size of the signed transaction
+// spending utxos with the given scripts, and paying to the given output
+// scripts, as estimated by CreateTransaction to compute the fees.
+//
+// The witness bytes of segwit inputs are discounted in the virtual size, as
+// they weigh 1 wu instead of 4 wu.
+func (s *Service) EstimateTxSize(utxoScripts [][]byte, outputScripts [][]byte) TxSize {
+	outputs := make([]*wire.TxOut, len(outputScripts))
+	for idx, script := range outputScripts {
+		outputs[idx] = wire.NewTxOut(0, script)
+	}
+
+	return estimateTxSize(outputs, utxoScripts)
+}
+
+// estimateVirtualSize returns the worst case virtual size of the signed
+// transaction spending the given utxos, and paying to the given outputs.
+func estimateVirtualSize(outputs []*wire.TxOut, utxoScripts [][]byte) int {
+	return estimateTxSize(outputs, utxoScripts).VirtualSize
+}
+
+// estimateTxSize returns the worst case size of the signed transaction
+// spending the given utxos, and paying to the given outputs.
+//
+// The size of each input depends on the type of the script of the utxo it
+// spends:
+//   * P2PKH: 149 bytes, with a 108-byte signature script.
+//   * P2SH, assumed to be P2SH-P2WPKH: 64 bytes and a 109 wu witness,
+//     i.e. ~91 vbytes.
+//   * P2WPKH: 41 bytes and a 109 wu witness, i.e. ~68 vbytes.
+//   * P2TR: 41 bytes and a 66 wu witness, i.e. ~58 vbytes.
+// Utxos of unknown types are assumed to be P2PKH.
+//
+// Non-witness bytes weigh 4 wu, and witness bytes 1 wu. The virtual size is
+// the weight divided by 4, rounded up.
+func estimateTxSize(outputs []*wire.TxOut, utxoScripts [][]byte) TxSize {
+	var (
+		baseSize      int
+		witnessWeight int
+		hasWitness    bool
+	)
+
+	for _, script := range utxoScripts {
+		switch {
+		// If this is a p2sh output, we assume this is a
+		// nested P2WKH.
+		case txscript.IsPayToScriptHash(script):
+			baseSize += txsizes.RedeemNestedP2WPKHInputSize
+			witnessWeight += txsizes.RedeemP2WPKHInputWitnessWeight
+			hasWitness = true
+		case txscript.IsPayToWitnessPubKeyHash(script):
+			baseSize += txsizes.RedeemP2WPKHInputSize
+			witnessWeight += txsizes.RedeemP2WPKHInputWitnessWeight
+			hasWitness = true
+		case txscript.IsPayToTaproot(script):
+			baseSize += redeemP2TRInputSize
+			witnessWeight += redeemP2TRInputWitnessWeight
+			hasWitness = true
+		default:
+			baseSize += txsizes.RedeemP2PKHInputSize
+			// In a segwit transaction, the witness of a non-witness input
+			// is an empty stack, encoded as a zero item count.
+			witnessWeight++
+		}
+	}
+
+	// 8 additional bytes are for version and locktime
+	baseSize += 8 + wire.VarIntSerializeSize(uint64(len(utxoScripts))) +
+		wire.VarIntSerializeSize(uint64(len(outputs))) +
+		txsizes.SumOutputSerializeSizes(outputs)
+
+	size := baseSize
+	weight := baseSize * blockchain.WitnessScaleFactor
+
+	// The witnesses are preceded by the 2-byte marker and flag of BIP0144.
+	// Witness bytes weigh 1 wu, hence their weight is also their size.
+	if hasWitness {
+		size += 2 + witnessWeight
+		weight += 2 + witnessWeight
+	}
+
+	return TxSize{
+		Size:   size,
+		Weight: weight,
+		VirtualSize: (weight + blockchain.WitnessScaleFactor - 1) /
+			blockchain.WitnessScaleFactor,
+	}
+}
+
+// relayPolicy holds the fee rates, in sat/kB, used by the reference client
+// of a network to decide whether to relay a transaction.
+type relayPolicy struct {
+	dustRelayFeeSatPerKb int64
+	minRelayFeeSatPerKb  int64
+}
+
+// defaultRelayPolicy is the relay policy of Bitcoin Core.
+//
+// Ref: https://github.com/bitcoin/bitcoin/blob/v0.21.0/src/policy/policy.h#L50-L56
+var defaultRelayPolicy = relayPolicy{
+	dustRelayFeeSatPerKb: 3000,
+	minRelayFeeSatPerKb:  1000,
+}
+
+// relayPolicies maps the magic number of a network to its relay policy,
+// for networks which do not follow the one of Bitcoin Core.
+//
+// Bitcoin Cash nodes use a dust relay fee of 1000 sat/kB, but multiply it
+// by 3 when computing dust thresholds, which amounts to the same thresholds
+// as Bitcoin Core for non-witness outputs.
+//
+// Ref: https://github.com/litecoin-project/litecoin/blob/v0.18.1/src/policy/policy.h#L50
+var relayPolicies = map[wire.BitcoinNet]relayPolicy{
+	chaincfg.LitecoinMainNetParams.Net: {
+		dustRelayFeeSatPerKb: 30000,
+		minRelayFeeSatPerKb:  10000,
+	},
+	chaincfg.LitecoinTestNet4Params.Net: {
+		dustRelayFeeSatPerKb: 30000,
+		minRelayFeeSatPerKb:  10000,
+	},
+	chaincfg.LitecoinRegTestParams.Net: {
+		dustRelayFeeSatPerKb: 30000,
+		minRelayFeeSatPerKb:  10000,
+	},
+}
+
+// networkRelayPolicy returns the relay policy of the network of the given
+// chain parameters.
+func networkRelayPolicy(chainParams chaincfg.ChainParams) relayPolicy {
+	if policy, ok := relayPolicies[chainParams.Net]; ok {
+		return policy
+	}
+
+	return defaultRelayPolicy
+}
+
+// dustThreshold returns the minimum value of an output paying to the given
+// script, below which it is considered as dust at the given dust relay fee
+// rate, and the transaction is not relayed. With the default rate of
+// Bitcoin Core, this is 546 satoshis for P2PKH outputs, and 294 satoshis
+// for P2WPKH outputs.
+//
+// An output is dust if spending it costs more than a third of its value, at
+// the dust relay fee rate. Inputs spending witness programs get the witness
+// discount.
+//
+// Ref: https://github.com/bitcoin/bitcoin/blob/v0.21.0/src/policy/policy.cpp#L14-L50
+func dustThreshold(script []byte, dustRelayFeeSatPerKb int64) int64 {
+	size := int64(wire.NewTxOut(0, script).SerializeSize())
+
+	// Outpoint, script length, and sequence, followed by the signature and
+	// the public key, either in the sigScript or in the witness, where they
+	// are discounted by the witness scale factor of 4.
+	if txscript.IsWitnessProgram(script) {
+		size += 32 + 4 + 1 + (107 / 4) + 4
+	} else {
+		size += 32 + 4 + 1 + 107 + 4
+	}
+
+	return size * dustRelayFeeSatPerKb / 1000
+}
+
+// feeRates returns the fee rate realized by paying fee for a transaction of
+// the given virtual size, in sat/vbyte and in sat/kB.
+func feeRates(fee int64, virtualSize int) (float64, int64) {
+	if virtualSize <= 0 {
+		return 0, 0
+	}
+
+	return float64(fee) / float64(virtualSize), fee * 1000 / int64(virtualSize)
+}
+
+// ComputeCpfpFee returns the fee that a child transaction of the given
+// virtual size must pay, so that the package made of an unconfirmed parent
+// transaction and the child meets the target fee rate (child pays for
+// parent).
+//
+// The fee paid by the parent cannot be computed from its serialization
+// alone, and must be provided. If parentVsize is zero, the virtual size of
+// the parent is computed from parentHex, its hex-encoded serialization.
+//
+// The child fee is never lower than the fee of the child alone at the
+// target rate, in case the parent already pays more than the target rate.
+func (s *Service) ComputeCpfpFee(
+	parentHex string,
+	parentFee int64,
+	parentVsize int,
+	childVsize int,
+	targetRateSatPerKb int64,
+) (int64, error) {
+	if targetRateSatPerKb <= 0 {
+		return 0, errors.Errorf("target fee rate %d sat/kB must be positive",
+			targetRateSatPerKb)
+	}
+
+	if parentFee < 0 {
+		return 0, errors.Errorf("parent fee %d must not be negative", parentFee)
+	}
+
+	if childVsize <= 0 {
+		return 0, errors.Errorf("child virtual size %d must be positive", childVsize)
+	}
+
+	if parentVsize == 0 {
+		decodedRawTx, err := s.DecodeRawTransaction(parentHex)
+		if err != nil {
+			return 0, errors.Wrap(err, "failed to decode parent tx")
+		}
+
+		weight := blockchain.GetTransactionWeight(btcutil.NewTx(decodedRawTx.MsgTx))
+		parentVsize = int((weight + blockchain.WitnessScaleFactor - 1) /
+			blockchain.WitnessScaleFactor)
+	}
+
+	if parentVsize < 0 {
+		return 0, errors.Errorf("parent virtual size %d must be positive", parentVsize)
+	}
+
+	feeRate := btcutil.Amount(targetRateSatPerKb)
+	packageFee := int64(txrules.FeeForSerializeSize(feeRate, parentVsize+childVsize))
+	childFee := int64(txrules.FeeForSerializeSize(feeRate, childVsize))
+
+	if packageFee-parentFee > childFee {
+		return packageFee - parentFee, nil
+	}
+
+	return childFee, nil
 }
@@ -1,23 +1,37 @@
 package core
 
 import (
+	"bytes"
+	"context"
 	"encoding/hex"
+	"math"
+	"math/big"
+	"reflect"
+	"strings"
 	"testing"
 
-	"github.com/btcsuite/btcd/btcec"
+	"github.com/btcsuite/btcd/blockchain"
+	"github.com/btcsuite/btcd/btcec/v2"
+	"github.com/btcsuite/btcd/btcec/v2/ecdsa"
+	"github.com/btcsuite/btcd/btcec/v2/schnorr"
+	"github.com/btcsuite/btcd/btcutil"
+	"github.com/btcsuite/btcd/btcutil/hdkeychain"
+	"github.com/btcsuite/btcd/btcutil/txsort"
 	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/btcsuite/btcd/txscript"
 	"github.com/btcsuite/btcd/wire"
-	"github.com/btcsuite/btcutil"
+	"github.com/btcsuite/btcwallet/wallet/txsizes"
 	"github.com/ledgerhq/bitcoin-lib-grpc/pkg/chaincfg"
+	"github.com/pkg/errors"
 )
 
 func TestCreateTransaction(t *testing.T) {
 	tests := []struct {
-		name                    string
-		tx                      *Tx
-		chainParams             chaincfg.ChainParams
-		wantErr                 error
-		wantNotEnoughUtxoAmount *NotEnoughUtxo
+		name              string
+		tx                *Tx
+		chainParams       chaincfg.ChainParams
+		wantErr           error
+		wantMissingAmount int64
 	}{
 		{
 			name: "mainnet P2WPKH",
@@ -63,8 +77,37 @@ func TestCreateTransaction(t *testing.T) {
 				ChangeAddress: "1GgX4cGLiqF9p4Sd1XcPQhEAAhNDA4wLYS",
 				FeeSatPerKb:   1234,
 			},
-			chainParams:             chaincfg.BitcoinMainNetParams,
-			wantNotEnoughUtxoAmount: &NotEnoughUtxo{MissingAmount: 134},
+			chainParams: chaincfg.BitcoinMainNetParams,
+			// The inputs exactly cover the outputs, hence the missing amount
+			// is the fee of the transaction without change output:
+			// 1234 sat/kB * 193 bytes (one P2PKH input, one P2PKH output).
+			wantMissingAmount: 238,
+		},
+		{
+			name: "mainnet P2PKH with not enough utxo for the fees",
+			tx: &Tx{
+				LockTime: 0,
+				Inputs: []Input{
+					{
+						OutputHash:  "2f5dae23c2e18588c86cfc4e154f3b68bd8eb4265fe0b4b1341ad5aa40422f66",
+						OutputIndex: 0,
+						Script:      []byte("76a914e18c90d108c3509e952c1d79121f1776facf1c6788ac"),
+						Value:       100100,
+					},
+				},
+				Outputs: []Output{
+					{
+						Address: "1MZbRqZGpiSWGRLg8DUdVrDKHwNe1oesUZ",
+						Value:   100000,
+					},
+				},
+				ChangeAddress: "1GgX4cGLiqF9p4Sd1XcPQhEAAhNDA4wLYS",
+				FeeSatPerKb:   1234,
+			},
+			chainParams: chaincfg.BitcoinMainNetParams,
+			// The 100 satoshis left after the outputs only cover part of the
+			// 238 satoshis of fees.
+			wantMissingAmount: 138,
 		},
 	}
 
@@ -73,79 +116,70 @@ func TestCreateTransaction(t *testing.T) {
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
 			rawTx, err := s.CreateTransaction(tt.tx, tt.chainParams)
-			if err != nil && tt.wantErr == nil {
-				t.Fatalf("CreateTransaction() got error '%v'", err)
-			}
 
-			if rawTx.RawTx.NotEnoughUtxo != nil && tt.wantNotEnoughUtxoAmount == nil {
-				t.Fatalf("CreateTransaction() got NotEnoughUtxo '%v'", rawTx.RawTx.NotEnoughUtxo)
+			var insufficientFunds *ErrInsufficientFunds
+			if errors.As(err, &insufficientFunds) {
+				if insufficientFunds.MissingAmount != tt.wantMissingAmount {
+					t.Fatalf("CreateTransaction() got missing amount %d, want %d",
+						insufficientFunds.MissingAmount, tt.wantMissingAmount)
+				}
+
+				return
 			}
 
-			if rawTx.RawTx.NotEnoughUtxo == nil && tt.wantNotEnoughUtxoAmount != nil {
-				t.Fatalf("CreateTransaction() should have '%v'", tt.wantNotEnoughUtxoAmount)
+			if err != nil && tt.wantErr == nil {
+				t.Fatalf("CreateTransaction() got error '%v'", err)
 			}
 
-			if rawTx.RawTx.NotEnoughUtxo != nil && tt.wantNotEnoughUtxoAmount != nil && rawTx.RawTx.NotEnoughUtxo.MissingAmount != tt.wantNotEnoughUtxoAmount.MissingAmount {
-				t.Fatalf("CreateTransaction() got NotEnoughUtxo '%v'", rawTx.RawTx.NotEnoughUtxo)
+			if tt.wantMissingAmount != 0 {
+				t.Fatalf("CreateTransaction() got no error, want missing amount %d",
+					tt.wantMissingAmount)
 			}
 
-			if tt.wantNotEnoughUtxoAmount == nil {
-				if rawTx == nil {
-					t.Fatalf("CreateTransaction() got nil response")
-				}
+			if rawTx == nil {
+				t.Fatalf("CreateTransaction() got nil response")
+			}
 
-				if len(rawTx.RawTx.Hex) == 0 {
-					t.Fatalf("CreateTransaction() got empty raw hex")
-				}
+			if len(rawTx.RawTx.Hex) == 0 {
+				t.Fatalf("CreateTransaction() got empty raw hex")
 			}
 		})
 	}
 }
 
-func TestGenerateDerSignatures(t *testing.T) {
-	hashStrToHash := func(str string) *chainhash.Hash {
-		hash, err := chainhash.NewHashFromStr("864608ddfcb050c8a9a0c275687186ee2957e0853bee198aa464de798b7696db")
-		if err != nil {
-			panic(err)
-		}
-		return hash
+func TestCreateTransaction_FeeRates(t *testing.T) {
+	const feeSatPerKb = 10000
+
+	utxoScript, _ := hex.DecodeString("76a914e18c90d108c3509e952c1d79121f1776facf1c6788ac")
+
+	input := Input{
+		OutputHash:  "2f5dae23c2e18588c86cfc4e154f3b68bd8eb4265fe0b4b1341ad5aa40422f66",
+		OutputIndex: 0,
+		Script:      utxoScript,
+		Value:       110000,
 	}
-	hexStrToBytes := func(hexStr string) []byte {
-		script, err := hex.DecodeString(hexStr)
-		if err != nil {
-			panic(err)
-		}
-		return script
+
+	// virtualSize returns the size of a transaction spending P2PKH utxos,
+	// and paying to a P2PKH output and a P2PKH change output.
+	virtualSize := func(numInputs int) int64 {
+		return int64(8 + 1 + 1 + numInputs*txsizes.RedeemP2PKHInputSize +
+			2*txsizes.P2PKHOutputSize)
 	}
 
 	tests := []struct {
-		name    string
-		msgTx   *wire.MsgTx
-		utxos   []Utxo
-		privKey string
-		wantErr error
+		name            string
+		inputs          []Input
+		wantVirtualSize int64
 	}{
 		{
-			name: "generate DER signatures",
-			msgTx: &wire.MsgTx{
-				Version: 1,
-				TxIn: []*wire.TxIn{
-					wire.NewTxIn(
-						wire.NewOutPoint(hashStrToHash("864608ddfcb050c8a9a0c275687186ee2957e0853bee198aa464de798b7696db"), 0),
-						nil,
-						nil,
-					),
-				},
-				LockTime: 0x0,
-			},
-			utxos: []Utxo{
-				{
-					Script:     hexStrToBytes("001457f683080ee4491f1979950333e3240a0a9695d5"),
-					Value:      1000000,
-					Derivation: []uint32{84 + h, 0 + h, 0 + h, 0, 2},
-				},
-			},
-			privKey: "tprv8g5UXufoRYtBEU5g2ueXDG32joLBLEzsGnoTUBZayNm8cAFGS56CcJmGwuSNEBLguQ3ja5betvc6kas1BXPpVzwuh8MWKr2ijzXJWuoJBqL",
+			name:            "single input",
+			inputs:          []Input{input},
+			wantVirtualSize: virtualSize(1),
+		},
+		{
+			name:            "two inputs",
+			inputs:          []Input{input, input},
+			wantVirtualSize: virtualSize(2),
 		},
 	}
 
@@ -153,123 +187,4331 @@ func TestGenerateDerSignatures(t *testing.T) {
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			derSignatures, err := s.GenerateDerSignatures(tt.msgTx, tt.utxos, tt.privKey)
-			if err != nil && tt.wantErr == nil {
-				t.Fatalf("GenerateDerSignatures() got error '%v'", err)
+			rawTx, err := s.CreateTransaction(&Tx{
+				Inputs: tt.inputs,
+				Outputs: []Output{
+					{
+						Address: "1MZbRqZGpiSWGRLg8DUdVrDKHwNe1oesUZ",
+						Value:   100000,
+					},
+				},
+				ChangeAddress: "1GgX4cGLiqF9p4Sd1XcPQhEAAhNDA4wLYS",
+				FeeSatPerKb:   feeSatPerKb,
+			}, chaincfg.BitcoinMainNetParams)
+			if err != nil {
+				t.Fatalf("CreateTransaction() got error '%v'", err)
 			}
 
-			if tt.wantErr == nil {
-				if derSignatures == nil {
-					t.Fatal("GenerateDerSignatures() got nil response")
-				}
+			wantFees := feeSatPerKb * tt.wantVirtualSize / 1000
+			if rawTx.TotalFees != wantFees {
+				t.Fatalf("CreateTransaction() got fees %d, want %d",
+					rawTx.TotalFees, wantFees)
+			}
 
-				countDerSignatures := len(derSignatures)
-				countUtxos := len(tt.utxos)
+			wantFeeRateSatPerKb := wantFees * 1000 / tt.wantVirtualSize
+			if rawTx.FeeRateSatPerKb != wantFeeRateSatPerKb {
+				t.Fatalf("CreateTransaction() got fee rate %d sat/kB, want %d sat/kB",
+					rawTx.FeeRateSatPerKb, wantFeeRateSatPerKb)
+			}
 
-				if countDerSignatures != countUtxos {
-					t.Fatalf(
-						"GenerateDerSignatures has generated %d signatures instead of %d",
-						countDerSignatures,
-						countUtxos,
-					)
-				}
+			wantFeeRateSatPerVByte := float64(wantFees) / float64(tt.wantVirtualSize)
+			if rawTx.FeeRateSatPerVByte != wantFeeRateSatPerVByte {
+				t.Fatalf("CreateTransaction() got fee rate %f sat/vB, want %f sat/vB",
+					rawTx.FeeRateSatPerVByte, wantFeeRateSatPerVByte)
 			}
 		})
 	}
 }
 
-func TestSignTransaction(t *testing.T) {
-	// Helper to derive extended key and return the btcec public key.
-	// Use this in unit-tests to get input public key.
-	getPublicKey := func(extendedKey string, derivation []uint32, chainParams chaincfg.ChainParams) *btcec.PublicKey {
-		s := &Service{}
-
-		pubKeyMat, err := s.DeriveExtendedKey(extendedKey, derivation)
-		if err != nil {
-			panic(err)
-		}
-
-		addressPubKey, err := btcutil.NewAddressPubKey(pubKeyMat.PublicKey, chainParams)
-		if err != nil {
-			panic(err)
-		}
+func TestCreateTransaction_NetworkMismatch(t *testing.T) {
+	const (
+		mainnetAddress = "bc1qcr8te4kr609gcawutmrza0j4xv80jy8z306fyu"
+		testnetAddress = "tb1qw508d6qejxtdg4y5r3zarvary0c5xw7kxpjzsx"
 
-		return addressPubKey.PubKey()
-	}
+		// Litecoin addresses of the public key of mainnetAddress.
+		litecoinP2PKHAddress  = "LcoRfRoCWHwidgBwnQjpvee9eZSYkqKJ7c"
+		litecoinP2SHAddress   = "MP6dsSQqGMwgTE2XqW3w3ce2VRa6J27zqw"
+		litecoinP2WPKHAddress = "ltc1qcr8te4kr609gcawutmrza0j4xv80jy8z4nqduv"
+	)
 
 	tests := []struct {
-		name               string
-		msgTx              *wire.MsgTx
-		chainParams        chaincfg.ChainParams
-		utxos              []Utxo
-		privKey            string
-		signaturesMetadata []SignatureMetadata
-		wantErr            error
+		name          string
+		outputAddress string
+		changeAddress string
+		wantInErr     string
 	}{
 		{
-			name: "sign transaction",
-			msgTx: &wire.MsgTx{
-				Version: 1,
-				TxIn: []*wire.TxIn{
-					wire.NewTxIn(
-						wire.NewOutPoint(btcutil.NewTx(wire.NewMsgTx(1)).Hash(), 0),
-						nil,
-						nil,
-					),
+			name:          "testnet output address",
+			outputAddress: testnetAddress,
+			changeAddress: mainnetAddress,
+			wantInErr:     "output address " + testnetAddress,
+		},
+		{
+			name:          "testnet change address",
+			outputAddress: mainnetAddress,
+			changeAddress: testnetAddress,
+			wantInErr:     "change address " + testnetAddress,
+		},
+		{
+			name:          "litecoin P2PKH change address",
+			outputAddress: mainnetAddress,
+			changeAddress: litecoinP2PKHAddress,
+			wantInErr:     "change address " + litecoinP2PKHAddress,
+		},
+		{
+			name:          "litecoin P2WPKH change address",
+			outputAddress: mainnetAddress,
+			changeAddress: litecoinP2WPKHAddress,
+			wantInErr:     "change address " + litecoinP2WPKHAddress,
+		},
+		{
+			name:          "litecoin P2SH output address",
+			outputAddress: litecoinP2SHAddress,
+			changeAddress: mainnetAddress,
+			wantInErr:     "output address " + litecoinP2SHAddress,
+		},
+	}
+
+	s := &Service{}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := s.CreateTransaction(&Tx{
+				Inputs: []Input{
+					{
+						OutputHash:  "2f5dae23c2e18588c86cfc4e154f3b68bd8eb4265fe0b4b1341ad5aa40422f66",
+						OutputIndex: 0,
+						Value:       110000,
+					},
 				},
-				LockTime: 0x0,
-			},
-			chainParams: chaincfg.BitcoinMainNetParams,
-			utxos: []Utxo{
-				{
-					Script:     nil,
-					Value:      100000,
-					Derivation: []uint32{44 + h, 0 + h, 0 + h, 0, 0},
+				Outputs: []Output{
+					{
+						Address: tt.outputAddress,
+						Value:   100000,
+					},
 				},
+				ChangeAddress: tt.changeAddress,
+				FeeSatPerKb:   1000,
+			}, chaincfg.BitcoinMainNetParams)
+			if errors.Cause(err) != ErrNetworkMismatch {
+				t.Fatalf("CreateTransaction() got error '%v', want '%v'",
+					err, ErrNetworkMismatch)
+			}
+
+			if !strings.Contains(err.Error(), tt.wantInErr) {
+				t.Fatalf("CreateTransaction() got error '%v', want it to contain '%s'",
+					err, tt.wantInErr)
+			}
+		})
+	}
+}
+
+func TestCreateTransaction_MwebAddress(t *testing.T) {
+	const (
+		mwebAddress    = "ltcmweb1qqt5x3c4hw8fzyxmx6zme3qg2dlqs0jscyf4sj2hsemzp6ccqncnqgq4qjqpg3gy7gxwluwg84z7amj8f0qtf8yyzkhhz0tms0xh6qhmn5eaaz8wg"
+		litecoinChange = "ltc1q7qnj9xm8wp8ucmg64lk0h03as8k6ql6rk4wvsd"
+	)
+
+	s := &Service{}
+
+	_, err := s.CreateTransaction(&Tx{
+		Inputs: []Input{
+			{
+				OutputHash:  "2f5dae23c2e18588c86cfc4e154f3b68bd8eb4265fe0b4b1341ad5aa40422f66",
+				OutputIndex: 0,
+				Value:       110000,
 			},
-			privKey: "xprv9yv8fLFeRhD7NcKbjGS4GesBvy2PjvoRcwEKKaz7zJvM2cQ1eiCwhcHGQNEBwsXthHbPtZNQg5SBBEWS1QH941SKitBdaUT7VDTxzdS8vu7",
-			signaturesMetadata: []SignatureMetadata{
-				{
-					DerSig: nil,
-					PubKey: getPublicKey(
-						"xpub6Cc939fyHvfB9pPLWd3bSyyQFvgKbwhidca49jGCM5Hz5ypEPGf9JVXB4NBuUfPgoHnMjN6oNgdC9KRqM11RZtL8QLW6rFKziNwHDYhZ6Kx",
-						[]uint32{1, 1},
-						chaincfg.BitcoinMainNetParams,
-					),
-					AddrEncoding: Legacy,
-				},
+		},
+		Outputs: []Output{
+			{
+				Address: mwebAddress,
+				Value:   100000,
 			},
 		},
+		ChangeAddress: litecoinChange,
+		FeeSatPerKb:   1000,
+	}, chaincfg.LitecoinMainNetParams)
+	if errors.Cause(err) != ErrMwebAddress {
+		t.Fatalf("CreateTransaction() got error '%v', want '%v'", err, ErrMwebAddress)
+	}
+
+	var invalidAddress *ErrInvalidAddress
+	if !errors.As(err, &invalidAddress) || invalidAddress.Address != mwebAddress {
+		t.Fatalf("CreateTransaction() got error '%v', want invalid address %s", err, mwebAddress)
+	}
+}
+
+func TestCreateTransaction_DustChange(t *testing.T) {
+	const (
+		p2pkhChangeAddress  = "1GgX4cGLiqF9p4Sd1XcPQhEAAhNDA4wLYS"
+		p2wpkhChangeAddress = "bc1qcr8te4kr609gcawutmrza0j4xv80jy8z306fyu"
+		targetAmount        = 100000
+		feeSatPerKb         = 1000
+	)
+
+	outputScript, _ := hex.DecodeString("76a914e18c90d108c3509e952c1d79121f1776facf1c6788ac")
+
+	// fees returns the fees of a transaction spending a single utxo of
+	// unknown type, paying to a single output, and to the change address if
+	// not empty.
+	fees := func(changeAddress string) int64 {
+		txOuts := []*wire.TxOut{wire.NewTxOut(targetAmount, outputScript)}
+		if changeAddress != "" {
+			address, _ := btcutil.DecodeAddress(changeAddress, chaincfg.BitcoinMainNetParams)
+			changeScript, _ := txscript.PayToAddrScript(address)
+			txOuts = append(txOuts, wire.NewTxOut(0, changeScript))
+		}
+
+		return getMaxRequiredFee(txOuts, [][]byte{nil}, feeSatPerKb)
+	}
+
+	tests := []struct {
+		name                  string
+		inputAmount           int64
+		changeAddress         string
+		wantChange            int64
+		wantTotalFees         int64
+		wantChangeDropped     bool
+		wantInsufficientFunds bool
+	}{
+		{
+			name:          "P2PKH change at dust threshold",
+			inputAmount:   targetAmount + fees(p2pkhChangeAddress) + 546,
+			changeAddress: p2pkhChangeAddress,
+			wantChange:    546,
+			wantTotalFees: fees(p2pkhChangeAddress),
+		},
+		{
+			name:              "P2PKH change below dust threshold",
+			inputAmount:       targetAmount + fees(p2pkhChangeAddress) + 545,
+			changeAddress:     p2pkhChangeAddress,
+			wantTotalFees:     fees(p2pkhChangeAddress) + 545,
+			wantChangeDropped: true,
+		},
+		{
+			name:          "P2WPKH change at dust threshold",
+			inputAmount:   targetAmount + fees(p2wpkhChangeAddress) + 294,
+			changeAddress: p2wpkhChangeAddress,
+			wantChange:    294,
+			wantTotalFees: fees(p2wpkhChangeAddress),
+		},
+		{
+			name:              "P2WPKH change below dust threshold",
+			inputAmount:       targetAmount + fees(p2wpkhChangeAddress) + 293,
+			changeAddress:     p2wpkhChangeAddress,
+			wantTotalFees:     fees(p2wpkhChangeAddress) + 293,
+			wantChangeDropped: true,
+		},
+		{
+			name:              "fees only paid without change output",
+			inputAmount:       targetAmount + fees(""),
+			changeAddress:     p2wpkhChangeAddress,
+			wantTotalFees:     fees(""),
+			wantChangeDropped: true,
+		},
+		{
+			name:                  "not enough utxos without change output",
+			inputAmount:           targetAmount + fees("") - 1,
+			changeAddress:         p2wpkhChangeAddress,
+			wantInsufficientFunds: true,
+		},
 	}
 
 	s := &Service{}
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
+			got, err := s.CreateTransaction(&Tx{
+				Inputs: []Input{
+					{
+						OutputHash:  "2f5dae23c2e18588c86cfc4e154f3b68bd8eb4265fe0b4b1341ad5aa40422f66",
+						OutputIndex: 0,
+						Value:       tt.inputAmount,
+					},
+				},
+				Outputs: []Output{
+					{
+						Address: "1MZbRqZGpiSWGRLg8DUdVrDKHwNe1oesUZ",
+						Value:   targetAmount,
+					},
+				},
+				ChangeAddress: tt.changeAddress,
+				FeeSatPerKb:   feeSatPerKb,
+			}, chaincfg.BitcoinMainNetParams)
 
-			derSignatures, err := s.GenerateDerSignatures(tt.msgTx, tt.utxos, tt.privKey)
-			if err != nil && tt.wantErr == nil {
-				t.Fatalf("GenerateDerSignatures() got error '%v'", err)
+			var insufficientFunds *ErrInsufficientFunds
+			if errors.As(err, &insufficientFunds) != tt.wantInsufficientFunds {
+				t.Fatalf("CreateTransaction() got error '%v', want insufficient funds %v",
+					err, tt.wantInsufficientFunds)
 			}
 
-			// Put DER signatures
-			for idx := range tt.signaturesMetadata {
-				tt.signaturesMetadata[idx].DerSig = derSignatures[idx]
+			if tt.wantInsufficientFunds {
+				return
 			}
 
-			signedRawTx, err := s.SignTransaction(tt.msgTx, tt.chainParams, tt.signaturesMetadata)
-			if err != nil && tt.wantErr == nil {
-				t.Fatalf("SignTransaction() got error '%v'", err)
+			if err != nil {
+				t.Fatalf("CreateTransaction() got error '%v'", err)
 			}
 
-			if tt.wantErr == nil {
-				if signedRawTx == nil {
-					t.Fatal("SignTransaction() got nil response")
-				}
+			if got.ChangeDropped != tt.wantChangeDropped ||
+				got.Change != tt.wantChange || got.TotalFees != tt.wantTotalFees {
+				t.Fatalf("CreateTransaction() got change %d, fees %d, dropped %v, "+
+					"want change %d, fees %d, dropped %v", got.Change, got.TotalFees,
+					got.ChangeDropped, tt.wantChange, tt.wantTotalFees, tt.wantChangeDropped)
+			}
 
-				if len(signedRawTx.Hex) == 0 {
-					t.Fatal("SignTransaction() got empty raw hex")
-				}
+			msgTx, err := s.DeserializeMsgTx(&got.RawTx)
+			if err != nil {
+				t.Fatalf("DeserializeMsgTx() got error '%v'", err)
+			}
+
+			wantOutputs := 2
+			if tt.wantChangeDropped {
+				wantOutputs = 1
+			}
+
+			if len(msgTx.TxOut) != wantOutputs {
+				t.Fatalf("CreateTransaction() got %d outputs, want %d",
+					len(msgTx.TxOut), wantOutputs)
+			}
+		})
+	}
+}
+
+func TestCreateTransaction_DustChangePolicy(t *testing.T) {
+	const (
+		changeAddress = "1GgX4cGLiqF9p4Sd1XcPQhEAAhNDA4wLYS"
+		targetAmount  = 100000
+		feeSatPerKb   = 1000
+	)
+
+	outputScript, _ := hex.DecodeString("76a914e18c90d108c3509e952c1d79121f1776facf1c6788ac")
+
+	// fees returns the fees of a transaction spending a single utxo of
+	// unknown type, paying to a single output, and to the change address if
+	// set.
+	fees := func(withChange bool) int64 {
+		txOuts := []*wire.TxOut{wire.NewTxOut(targetAmount, outputScript)}
+		if withChange {
+			address, _ := btcutil.DecodeAddress(changeAddress, chaincfg.BitcoinMainNetParams)
+			changeScript, _ := txscript.PayToAddrScript(address)
+			txOuts = append(txOuts, wire.NewTxOut(0, changeScript))
+		}
+
+		return getMaxRequiredFee(txOuts, [][]byte{nil}, feeSatPerKb)
+	}
+
+	tests := []struct {
+		name              string
+		inputAmount       int64
+		policy            DustChangePolicy
+		sendMax           bool
+		maxOutputValue    int64
+		wantOutputValue   int64
+		wantChange        int64
+		wantTotalFees     int64
+		wantChangeDropped bool
+		wantErr           error
+	}{
+		{
+			name:              "dust change to fees",
+			inputAmount:       targetAmount + fees(true) + 545,
+			policy:            ToFee,
+			wantOutputValue:   targetAmount,
+			wantTotalFees:     fees(true) + 545,
+			wantChangeDropped: true,
+		},
+		{
+			name:              "dust change to first output",
+			inputAmount:       targetAmount + fees(true) + 545,
+			policy:            ToFirstOutput,
+			wantOutputValue:   targetAmount + fees(true) + 545 - fees(false),
+			wantTotalFees:     fees(false),
+			wantChangeDropped: true,
+		},
+		{
+			name:           "dust change to first output above maximum output value",
+			inputAmount:    targetAmount + fees(true) + 545,
+			policy:         ToFirstOutput,
+			maxOutputValue: targetAmount,
+			wantErr:        ErrOutputValueTooHigh,
+		},
+		{
+			name:            "change output unaffected by policy",
+			inputAmount:     targetAmount + fees(true) + 546,
+			policy:          ToFirstOutput,
+			wantOutputValue: targetAmount,
+			wantChange:      546,
+			wantTotalFees:   fees(true),
+		},
+		{
+			name:        "first output policy with send max",
+			inputAmount: targetAmount + fees(true) + 545,
+			policy:      ToFirstOutput,
+			sendMax:     true,
+			wantErr:     ErrInvalidDustChangePolicy,
+		},
+		{
+			name:        "unknown policy",
+			inputAmount: targetAmount + fees(true) + 545,
+			policy:      DustChangePolicy(2),
+			wantErr:     ErrInvalidDustChangePolicy,
+		},
+	}
+
+	s := &Service{}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := s.CreateTransaction(&Tx{
+				Inputs: []Input{
+					{
+						OutputHash:  "2f5dae23c2e18588c86cfc4e154f3b68bd8eb4265fe0b4b1341ad5aa40422f66",
+						OutputIndex: 0,
+						Value:       tt.inputAmount,
+					},
+				},
+				Outputs: []Output{
+					{
+						Address: "1MZbRqZGpiSWGRLg8DUdVrDKHwNe1oesUZ",
+						Value:   targetAmount,
+					},
+				},
+				ChangeAddress:    changeAddress,
+				FeeSatPerKb:      feeSatPerKb,
+				SendMax:          tt.sendMax,
+				MaxOutputValue:   tt.maxOutputValue,
+				DustChangePolicy: tt.policy,
+			}, chaincfg.BitcoinMainNetParams)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("CreateTransaction() got error '%v', want error '%v'", err, tt.wantErr)
+			}
+
+			if tt.wantErr != nil {
+				return
+			}
+
+			if got.ChangeDropped != tt.wantChangeDropped ||
+				got.Change != tt.wantChange || got.TotalFees != tt.wantTotalFees {
+				t.Fatalf("CreateTransaction() got change %d, fees %d, dropped %v, "+
+					"want change %d, fees %d, dropped %v", got.Change, got.TotalFees,
+					got.ChangeDropped, tt.wantChange, tt.wantTotalFees, tt.wantChangeDropped)
+			}
+
+			msgTx, err := s.DeserializeMsgTx(&got.RawTx)
+			if err != nil {
+				t.Fatalf("DeserializeMsgTx() got error '%v'", err)
+			}
+
+			var outputValue int64
+			for _, txOut := range msgTx.TxOut {
+				if bytes.Equal(txOut.PkScript, outputScript) {
+					outputValue = txOut.Value
+				}
+			}
+
+			if outputValue != tt.wantOutputValue {
+				t.Fatalf("CreateTransaction() got output value %d, want %d",
+					outputValue, tt.wantOutputValue)
+			}
+		})
+	}
+}
+
+func TestCreateTransaction_RelayPolicy(t *testing.T) {
+	const (
+		targetAmount = 100000
+		changeAmount = 1000
+		feeSatPerKb  = 10000
+	)
+
+	// Both networks use P2WPKH addresses, so that transactions have the
+	// same size, and pay the same fees.
+	p2wpkhScript, _ := hex.DecodeString("0014c0cebcd6c3d3ca8c75dc5ec62ebe55330ef910e2")
+	fees := getMaxRequiredFee([]*wire.TxOut{
+		wire.NewTxOut(targetAmount, p2wpkhScript),
+		wire.NewTxOut(changeAmount, p2wpkhScript),
+	}, [][]byte{nil}, feeSatPerKb)
+
+	tests := []struct {
+		name                string
+		address             string
+		feeSatPerKb         int64
+		dustLimit           int64
+		minRelayFeeSatPerKb int64
+		chainParams         chaincfg.ChainParams
+		wantChangeDropped   bool
+		wantErr             error
+	}{
+		{
+			name:        "bitcoin change above dust threshold",
+			address:     "bc1qcr8te4kr609gcawutmrza0j4xv80jy8z306fyu",
+			feeSatPerKb: feeSatPerKb,
+			chainParams: chaincfg.BitcoinMainNetParams,
+		},
+		{
+			name:              "litecoin change below dust threshold",
+			address:           "ltc1q7qnj9xm8wp8ucmg64lk0h03as8k6ql6rk4wvsd",
+			feeSatPerKb:       feeSatPerKb,
+			chainParams:       chaincfg.LitecoinMainNetParams,
+			wantChangeDropped: true,
+		},
+		{
+			name:              "bitcoin change below dust limit",
+			address:           "bc1qcr8te4kr609gcawutmrza0j4xv80jy8z306fyu",
+			feeSatPerKb:       feeSatPerKb,
+			dustLimit:         changeAmount + 1,
+			chainParams:       chaincfg.BitcoinMainNetParams,
+			wantChangeDropped: true,
+		},
+		{
+			name:        "litecoin change above dust limit",
+			address:     "ltc1q7qnj9xm8wp8ucmg64lk0h03as8k6ql6rk4wvsd",
+			feeSatPerKb: feeSatPerKb,
+			dustLimit:   changeAmount,
+			chainParams: chaincfg.LitecoinMainNetParams,
+		},
+		{
+			name:                "fee rate at minimum relay fee",
+			address:             "bc1qcr8te4kr609gcawutmrza0j4xv80jy8z306fyu",
+			feeSatPerKb:         feeSatPerKb,
+			minRelayFeeSatPerKb: feeSatPerKb,
+			chainParams:         chaincfg.BitcoinMainNetParams,
+		},
+		{
+			name:                "fee rate below minimum relay fee",
+			address:             "bc1qcr8te4kr609gcawutmrza0j4xv80jy8z306fyu",
+			feeSatPerKb:         1000,
+			minRelayFeeSatPerKb: feeSatPerKb,
+			chainParams:         chaincfg.BitcoinMainNetParams,
+			wantErr:             ErrFeeRateTooLow,
+		},
+		{
+			name:        "fee rate below litecoin minimum relay fee",
+			address:     "ltc1q7qnj9xm8wp8ucmg64lk0h03as8k6ql6rk4wvsd",
+			feeSatPerKb: 1000,
+			dustLimit:   changeAmount,
+			chainParams: chaincfg.LitecoinMainNetParams,
+			wantErr:     ErrFeeRateTooLow,
+		},
+	}
+
+	s := &Service{}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := s.CreateTransaction(&Tx{
+				Inputs: []Input{
+					{
+						OutputHash:  "2f5dae23c2e18588c86cfc4e154f3b68bd8eb4265fe0b4b1341ad5aa40422f66",
+						OutputIndex: 0,
+						Value:       targetAmount + fees + changeAmount,
+					},
+				},
+				Outputs: []Output{
+					{
+						Address: tt.address,
+						Value:   targetAmount,
+					},
+				},
+				ChangeAddress:       tt.address,
+				FeeSatPerKb:         tt.feeSatPerKb,
+				DustLimit:           tt.dustLimit,
+				MinRelayFeeSatPerKb: tt.minRelayFeeSatPerKb,
+			}, tt.chainParams)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("CreateTransaction() got error '%v', want '%v'", err, tt.wantErr)
+			}
+
+			if tt.wantErr != nil {
+				return
+			}
+
+			if got.ChangeDropped != tt.wantChangeDropped {
+				t.Fatalf("CreateTransaction() got ChangeDropped %v, want %v",
+					got.ChangeDropped, tt.wantChangeDropped)
+			}
+
+			wantChange := int64(changeAmount)
+			if tt.wantChangeDropped {
+				wantChange = 0
+			}
+
+			if got.Change != wantChange || got.TotalFees != fees+changeAmount-wantChange {
+				t.Fatalf("CreateTransaction() got change %d, fees %d, want change %d, fees %d",
+					got.Change, got.TotalFees, wantChange, fees+changeAmount-wantChange)
+			}
+		})
+	}
+}
+
+func TestCreateTransaction_AbsoluteFee(t *testing.T) {
+	const (
+		targetAmount = 100000
+		changeAmount = 5000
+		absoluteFee  = 1500
+	)
+
+	tests := []struct {
+		name                  string
+		inputAmount           int64
+		feeSatPerKb           int64
+		absoluteFee           int64
+		wantChange            int64
+		wantErr               bool
+		wantInsufficientFunds bool
+	}{
+		{
+			name:        "absolute fee",
+			inputAmount: targetAmount + absoluteFee + changeAmount,
+			absoluteFee: absoluteFee,
+			wantChange:  changeAmount,
+		},
+		{
+			name:        "fee rate",
+			inputAmount: targetAmount + absoluteFee + changeAmount,
+			feeSatPerKb: 1000,
+			// The fee of the transaction at 1 sat/vbyte, with one P2PKH
+			// input and two P2PKH outputs, is lower than the absolute fee.
+			wantChange: absoluteFee + changeAmount -
+				getMaxRequiredFee([]*wire.TxOut{
+					wire.NewTxOut(0, make([]byte, 25)),
+					wire.NewTxOut(0, make([]byte, 25)),
+				}, [][]byte{nil}, 1000),
+		},
+		{
+			name:                  "not enough utxos to pay absolute fee",
+			inputAmount:           targetAmount + absoluteFee - 1,
+			absoluteFee:           absoluteFee,
+			wantErr:               true,
+			wantInsufficientFunds: true,
+		},
+		{
+			name:        "both fee rate and absolute fee",
+			inputAmount: targetAmount + absoluteFee + changeAmount,
+			feeSatPerKb: 1000,
+			absoluteFee: absoluteFee,
+			wantErr:     true,
+		},
+		{
+			name:        "neither fee rate nor absolute fee",
+			inputAmount: targetAmount + absoluteFee + changeAmount,
+			wantErr:     true,
+		},
+	}
+
+	s := &Service{}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := s.CreateTransaction(&Tx{
+				Inputs: []Input{
+					{
+						OutputHash:  "2f5dae23c2e18588c86cfc4e154f3b68bd8eb4265fe0b4b1341ad5aa40422f66",
+						OutputIndex: 0,
+						Value:       tt.inputAmount,
+					},
+				},
+				Outputs: []Output{
+					{
+						Address: "1MZbRqZGpiSWGRLg8DUdVrDKHwNe1oesUZ",
+						Value:   targetAmount,
+					},
+				},
+				ChangeAddress: "1GgX4cGLiqF9p4Sd1XcPQhEAAhNDA4wLYS",
+				FeeSatPerKb:   tt.feeSatPerKb,
+				AbsoluteFee:   tt.absoluteFee,
+			}, chaincfg.BitcoinMainNetParams)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("CreateTransaction() got error '%v', want error %v",
+					err, tt.wantErr)
+			}
+
+			var insufficientFunds *ErrInsufficientFunds
+			if errors.As(err, &insufficientFunds) != tt.wantInsufficientFunds {
+				t.Fatalf("CreateTransaction() got error '%v', want insufficient funds %v",
+					err, tt.wantInsufficientFunds)
+			}
+
+			if tt.wantErr {
+				return
+			}
+
+			if got.Change != tt.wantChange || got.TotalFees != tt.inputAmount-targetAmount-tt.wantChange {
+				t.Fatalf("CreateTransaction() got change %d, fees %d, want change %d, fees %d",
+					got.Change, got.TotalFees, tt.wantChange,
+					tt.inputAmount-targetAmount-tt.wantChange)
+			}
+		})
+	}
+}
+
+func TestCreateTransaction_SendMax(t *testing.T) {
+	const feeSatPerKb = 1000
+
+	inputs := []Input{
+		{
+			OutputHash:  "2f5dae23c2e18588c86cfc4e154f3b68bd8eb4265fe0b4b1341ad5aa40422f66",
+			OutputIndex: 0,
+			Value:       60000,
+		},
+		{
+			OutputHash:  "2f5dae23c2e18588c86cfc4e154f3b68bd8eb4265fe0b4b1341ad5aa40422f66",
+			OutputIndex: 1,
+			Value:       40000,
+		},
+	}
+
+	output := Output{Address: "1MZbRqZGpiSWGRLg8DUdVrDKHwNe1oesUZ"}
+
+	outputScript, _ := hex.DecodeString("76a914e18c90d108c3509e952c1d79121f1776facf1c6788ac")
+	fees := getMaxRequiredFee(
+		[]*wire.TxOut{wire.NewTxOut(0, outputScript)}, [][]byte{nil, nil}, feeSatPerKb)
+	singleInputFees := getMaxRequiredFee(
+		[]*wire.TxOut{wire.NewTxOut(0, outputScript)}, [][]byte{nil}, feeSatPerKb)
+
+	tests := []struct {
+		name                  string
+		inputs                []Input
+		outputs               []Output
+		wantValue             int64
+		wantErr               bool
+		wantInsufficientFunds bool
+	}{
+		{
+			name:      "spend all inputs",
+			inputs:    inputs,
+			outputs:   []Output{output},
+			wantValue: 100000 - fees,
+		},
+		{
+			name:    "more than one output",
+			inputs:  inputs,
+			outputs: []Output{output, output},
+			wantErr: true,
+		},
+		{
+			name: "output value below dust threshold",
+			inputs: []Input{
+				{
+					OutputHash:  "2f5dae23c2e18588c86cfc4e154f3b68bd8eb4265fe0b4b1341ad5aa40422f66",
+					OutputIndex: 0,
+					Value:       singleInputFees + 545,
+				},
+			},
+			outputs:               []Output{output},
+			wantErr:               true,
+			wantInsufficientFunds: true,
+		},
+	}
+
+	s := &Service{}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := s.CreateTransaction(&Tx{
+				Inputs:      tt.inputs,
+				Outputs:     tt.outputs,
+				FeeSatPerKb: feeSatPerKb,
+				SendMax:     true,
+			}, chaincfg.BitcoinMainNetParams)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("CreateTransaction() got error '%v', want error %v",
+					err, tt.wantErr)
+			}
+
+			var insufficientFunds *ErrInsufficientFunds
+			if errors.As(err, &insufficientFunds) != tt.wantInsufficientFunds {
+				t.Fatalf("CreateTransaction() got error '%v', want insufficient funds %v",
+					err, tt.wantInsufficientFunds)
+			}
+
+			if tt.wantErr {
+				return
+			}
+
+			msgTx, err := s.DeserializeMsgTx(&got.RawTx)
+			if err != nil {
+				t.Fatalf("DeserializeMsgTx() got error '%v'", err)
+			}
+
+			if len(msgTx.TxOut) != 1 || msgTx.TxOut[0].Value != tt.wantValue {
+				t.Fatalf("CreateTransaction() got outputs %v, want a single output of %d",
+					msgTx.TxOut, tt.wantValue)
+			}
+
+			if got.Change != 0 || got.TotalFees != fees {
+				t.Fatalf("CreateTransaction() got change %d, fees %d, want change 0, fees %d",
+					got.Change, got.TotalFees, fees)
+			}
+		})
+	}
+}
+
+func TestCreateTransaction_NoOutputs(t *testing.T) {
+	const feeSatPerKb = 1000
+
+	inputs := []Input{
+		{
+			OutputHash:  "2f5dae23c2e18588c86cfc4e154f3b68bd8eb4265fe0b4b1341ad5aa40422f66",
+			OutputIndex: 0,
+			Value:       60000,
+		},
+		{
+			OutputHash:  "2f5dae23c2e18588c86cfc4e154f3b68bd8eb4265fe0b4b1341ad5aa40422f66",
+			OutputIndex: 1,
+			Value:       40000,
+		},
+	}
+
+	changeAddress := "1MZbRqZGpiSWGRLg8DUdVrDKHwNe1oesUZ"
+
+	changeScript, _ := hex.DecodeString("76a914e18c90d108c3509e952c1d79121f1776facf1c6788ac")
+	fees := getMaxRequiredFee(
+		[]*wire.TxOut{wire.NewTxOut(0, changeScript)}, [][]byte{nil, nil}, feeSatPerKb)
+	singleInputFees := getMaxRequiredFee(
+		[]*wire.TxOut{wire.NewTxOut(0, changeScript)}, [][]byte{nil}, feeSatPerKb)
+
+	tests := []struct {
+		name              string
+		inputs            []Input
+		changeAddress     string
+		sendMax           bool
+		wantChange        int64
+		wantErr           error
+		wantMissingAmount int64
+	}{
+		{
+			name:          "change address",
+			inputs:        inputs,
+			changeAddress: changeAddress,
+			wantChange:    100000 - fees,
+		},
+		{
+			name:          "change address with send max",
+			inputs:        inputs,
+			changeAddress: changeAddress,
+			sendMax:       true,
+			wantChange:    100000 - fees,
+		},
+		{
+			name:    "no change address",
+			inputs:  inputs,
+			wantErr: ErrNoOutputs,
+		},
+		{
+			// The P2PKH dust threshold is 546 satoshis.
+			name: "change below dust threshold",
+			inputs: []Input{
+				{
+					OutputHash:  "2f5dae23c2e18588c86cfc4e154f3b68bd8eb4265fe0b4b1341ad5aa40422f66",
+					OutputIndex: 0,
+					Value:       singleInputFees + 545,
+				},
+			},
+			changeAddress:     changeAddress,
+			wantMissingAmount: 1,
+		},
+	}
+
+	s := &Service{}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := s.CreateTransaction(&Tx{
+				Inputs:        tt.inputs,
+				ChangeAddress: tt.changeAddress,
+				FeeSatPerKb:   feeSatPerKb,
+				SendMax:       tt.sendMax,
+			}, chaincfg.BitcoinMainNetParams)
+
+			var insufficientFunds *ErrInsufficientFunds
+			if tt.wantMissingAmount != 0 {
+				if !errors.As(err, &insufficientFunds) ||
+					insufficientFunds.MissingAmount != tt.wantMissingAmount {
+					t.Fatalf("CreateTransaction() got error '%v', want missing amount %d",
+						err, tt.wantMissingAmount)
+				}
+
+				return
+			}
+
+			if errors.Cause(err) != tt.wantErr {
+				t.Fatalf("CreateTransaction() got error '%v', want '%v'", err, tt.wantErr)
+			}
+
+			if tt.wantErr != nil {
+				return
+			}
+
+			msgTx, err := s.DeserializeMsgTx(&got.RawTx)
+			if err != nil {
+				t.Fatalf("DeserializeMsgTx() got error '%v'", err)
+			}
+
+			if len(msgTx.TxOut) != 1 || msgTx.TxOut[0].Value != tt.wantChange ||
+				!bytes.Equal(msgTx.TxOut[0].PkScript, changeScript) {
+				t.Fatalf("CreateTransaction() got outputs %v, want a single change output of %d",
+					msgTx.TxOut, tt.wantChange)
+			}
+
+			if got.Change != tt.wantChange || got.TotalFees != fees || got.ChangeDropped {
+				t.Fatalf("CreateTransaction() got change %d, fees %d, dropped %v, want change %d, fees %d",
+					got.Change, got.TotalFees, got.ChangeDropped, tt.wantChange, fees)
+			}
+		})
+	}
+}
+
+func TestCreateTransaction_MaxFeeRate(t *testing.T) {
+	const maxFeeSatPerKb = 100000
+
+	tests := []struct {
+		name           string
+		feeSatPerKb    int64
+		absoluteFee    int64
+		maxFeeSatPerKb int64
+		wantErr        error
+	}{
+		{
+			name:           "at maximum fee rate",
+			feeSatPerKb:    maxFeeSatPerKb,
+			maxFeeSatPerKb: maxFeeSatPerKb,
+		},
+		{
+			name:           "above maximum fee rate",
+			feeSatPerKb:    maxFeeSatPerKb + 1,
+			maxFeeSatPerKb: maxFeeSatPerKb,
+			wantErr:        ErrFeeRateTooHigh,
+		},
+		{
+			name:           "mistyped fee rate",
+			feeSatPerKb:    maxFeeSatPerKb * 10,
+			maxFeeSatPerKb: maxFeeSatPerKb,
+			wantErr:        ErrFeeRateTooHigh,
+		},
+		{
+			name:        "no maximum fee rate",
+			feeSatPerKb: maxFeeSatPerKb * 10,
+		},
+		{
+			name:           "below minimum relay fee rate",
+			feeSatPerKb:    500,
+			maxFeeSatPerKb: maxFeeSatPerKb,
+			wantErr:        ErrFeeRateTooLow,
+		},
+		{
+			// The transaction is about 226 vbytes, i.e. a fee rate of about
+			// 44000 sat/kB.
+			name:           "absolute fee below maximum fee rate",
+			absoluteFee:    10000,
+			maxFeeSatPerKb: maxFeeSatPerKb,
+		},
+		{
+			name:           "mistyped absolute fee",
+			absoluteFee:    100000,
+			maxFeeSatPerKb: maxFeeSatPerKb,
+			wantErr:        ErrFeeRateTooHigh,
+		},
+		{
+			name:        "absolute fee without maximum fee rate",
+			absoluteFee: 100000,
+		},
+	}
+
+	s := &Service{}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := s.CreateTransaction(&Tx{
+				Inputs: []Input{
+					{
+						OutputHash:  "2f5dae23c2e18588c86cfc4e154f3b68bd8eb4265fe0b4b1341ad5aa40422f66",
+						OutputIndex: 0,
+						Value:       1000000,
+					},
+				},
+				Outputs: []Output{
+					{
+						Address: "1MZbRqZGpiSWGRLg8DUdVrDKHwNe1oesUZ",
+						Value:   100000,
+					},
+				},
+				ChangeAddress:  "1GgX4cGLiqF9p4Sd1XcPQhEAAhNDA4wLYS",
+				FeeSatPerKb:    tt.feeSatPerKb,
+				AbsoluteFee:    tt.absoluteFee,
+				MaxFeeSatPerKb: tt.maxFeeSatPerKb,
+			}, chaincfg.BitcoinMainNetParams)
+			if errors.Cause(err) != tt.wantErr {
+				t.Fatalf("CreateTransaction() got error '%v', want '%v'", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestCreateTransaction_SizePadding(t *testing.T) {
+	const feeSatPerKb = 12345
+
+	tests := []struct {
+		name              string
+		sizePaddingVbytes int
+		wantErr           bool
+	}{
+		{
+			name:              "no padding",
+			sizePaddingVbytes: 0,
+		},
+		{
+			name:              "padding",
+			sizePaddingVbytes: 50,
+		},
+		{
+			name:              "maximum padding",
+			sizePaddingVbytes: 1000,
+		},
+		{
+			name:              "negative padding",
+			sizePaddingVbytes: -1,
+			wantErr:           true,
+		},
+		{
+			name:              "padding above maximum",
+			sizePaddingVbytes: 1001,
+			wantErr:           true,
+		},
+	}
+
+	s := &Service{}
+
+	createTransaction := func(sizePaddingVbytes int) (*RawTxWithChangeFees, error) {
+		return s.CreateTransaction(&Tx{
+			Inputs: []Input{
+				{
+					OutputHash:  "2f5dae23c2e18588c86cfc4e154f3b68bd8eb4265fe0b4b1341ad5aa40422f66",
+					OutputIndex: 0,
+					Value:       1000000,
+				},
+			},
+			Outputs: []Output{
+				{
+					Address: "1MZbRqZGpiSWGRLg8DUdVrDKHwNe1oesUZ",
+					Value:   100000,
+				},
+			},
+			ChangeAddress:     "1GgX4cGLiqF9p4Sd1XcPQhEAAhNDA4wLYS",
+			FeeSatPerKb:       feeSatPerKb,
+			SizePaddingVbytes: sizePaddingVbytes,
+		}, chaincfg.BitcoinMainNetParams)
+	}
+
+	unpadded, err := createTransaction(0)
+	if err != nil {
+		t.Fatalf("CreateTransaction() unexpected error = %v", err)
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := createTransaction(tt.sizePaddingVbytes)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("CreateTransaction() got error '%v', want error %v",
+					err, tt.wantErr)
+			}
+
+			if err != nil {
+				return
+			}
+
+			wantFees := unpadded.TotalFees +
+				int64(tt.sizePaddingVbytes)*feeSatPerKb/1000
+			if got.TotalFees != wantFees {
+				t.Fatalf("CreateTransaction() got fees %d, want %d",
+					got.TotalFees, wantFees)
+			}
+
+			// The padding fee is paid by the change.
+			wantChange := unpadded.Change - (wantFees - unpadded.TotalFees)
+			if got.Change != wantChange {
+				t.Fatalf("CreateTransaction() got change %d, want %d",
+					got.Change, wantChange)
+			}
+		})
+	}
+}
+
+func TestCreateTransaction_OutputScript(t *testing.T) {
+	// BIP0084: Test Vectors (first receiving address, m/84'/0'/0'/0/0)
+	p2wpkhScript, _ := hex.DecodeString("0014c0cebcd6c3d3ca8c75dc5ec62ebe55330ef910e2")
+	barePublicKeyScript, _ := hex.DecodeString(
+		"210330d54fd0dd420a6e5f8d3624f5f3482cae350f79d5f0753bf5beef9c2d91af3cac")
+	opReturnScript, _ := hex.DecodeString("6a0b68656c6c6f20776f726c64")
+	// OP_PUSHDATA1 of 5 bytes, with only 2 bytes left.
+	malformedScript, _ := hex.DecodeString("4c05abcd")
+
+	tests := []struct {
+		name             string
+		output           Output
+		allowNonStandard bool
+		wantErr          bool
+		wantCause        error
+	}{
+		{
+			name:   "standard P2WPKH script",
+			output: Output{Script: p2wpkhScript, Value: 100000},
+		},
+		{
+			name:   "OP_RETURN script",
+			output: Output{Script: opReturnScript, Value: 0},
+		},
+		{
+			name:      "bare public key script",
+			output:    Output{Script: barePublicKeyScript, Value: 100000},
+			wantErr:   true,
+			wantCause: ErrNonStandardScript,
+		},
+		{
+			name:             "allowed bare public key script",
+			output:           Output{Script: barePublicKeyScript, Value: 100000},
+			allowNonStandard: true,
+		},
+		{
+			name:             "malformed script",
+			output:           Output{Script: malformedScript, Value: 100000},
+			allowNonStandard: true,
+			wantErr:          true,
+		},
+		{
+			name: "both address and script",
+			output: Output{
+				Address: "bc1qcr8te4kr609gcawutmrza0j4xv80jy8z306fyu",
+				Script:  p2wpkhScript,
+				Value:   100000,
+			},
+			wantErr: true,
+		},
+	}
+
+	s := &Service{}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := s.CreateTransaction(&Tx{
+				Inputs: []Input{
+					{
+						OutputHash:  "2f5dae23c2e18588c86cfc4e154f3b68bd8eb4265fe0b4b1341ad5aa40422f66",
+						OutputIndex: 0,
+						Value:       1000000,
+					},
+				},
+				Outputs:          []Output{tt.output},
+				ChangeAddress:    "1GgX4cGLiqF9p4Sd1XcPQhEAAhNDA4wLYS",
+				FeeSatPerKb:      1000,
+				AllowNonStandard: tt.allowNonStandard,
+			}, chaincfg.BitcoinMainNetParams)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("CreateTransaction() got error '%v', want error %v", err, tt.wantErr)
+			}
+
+			if tt.wantCause != nil && errors.Cause(err) != tt.wantCause {
+				t.Fatalf("CreateTransaction() got error '%v', want '%v'", err, tt.wantCause)
+			}
+
+			if err != nil {
+				return
+			}
+
+			decodedRawTx, err := s.DecodeRawTransaction(got.RawTx.Hex)
+			if err != nil {
+				t.Fatalf("DecodeRawTransaction() unexpected error = %v", err)
+			}
+
+			found := false
+			for _, txOut := range decodedRawTx.MsgTx.TxOut {
+				if bytes.Equal(txOut.PkScript, tt.output.Script) && txOut.Value == tt.output.Value {
+					found = true
+				}
+			}
+
+			if !found {
+				t.Fatalf("CreateTransaction() got no output with script %x", tt.output.Script)
+			}
+		})
+	}
+}
+
+func TestCreateTransaction_OutputValues(t *testing.T) {
+	inputs := []Input{
+		{
+			OutputHash:  "2f5dae23c2e18588c86cfc4e154f3b68bd8eb4265fe0b4b1341ad5aa40422f66",
+			OutputIndex: 0,
+			Value:       1000000,
+		},
+	}
+
+	// With the default dust relay fee of 3000 sat/kB, the dust threshold is
+	// 294 satoshis for P2WPKH outputs, and 546 satoshis for P2PKH outputs.
+	const (
+		p2wpkhAddress = "bc1qcr8te4kr609gcawutmrza0j4xv80jy8z306fyu"
+		p2pkhAddress  = "1MZbRqZGpiSWGRLg8DUdVrDKHwNe1oesUZ"
+	)
+
+	tests := []struct {
+		name           string
+		outputs        []Output
+		maxOutputValue int64
+		wantErr        error
+	}{
+		{
+			name:    "P2WPKH output at dust threshold",
+			outputs: []Output{{Address: p2wpkhAddress, Value: 294}},
+		},
+		{
+			name:    "P2WPKH output below dust threshold",
+			outputs: []Output{{Address: p2wpkhAddress, Value: 293}},
+			wantErr: ErrDustOutput,
+		},
+		{
+			name:    "P2PKH output at dust threshold",
+			outputs: []Output{{Address: p2pkhAddress, Value: 546}},
+		},
+		{
+			name: "P2PKH output below dust threshold",
+			outputs: []Output{
+				{Address: p2wpkhAddress, Value: 10000},
+				{Address: p2pkhAddress, Value: 545},
+			},
+			wantErr: ErrDustOutput,
+		},
+		{
+			name:           "output at maximum value",
+			outputs:        []Output{{Address: p2wpkhAddress, Value: 100000}},
+			maxOutputValue: 100000,
+		},
+		{
+			name:           "output above maximum value",
+			outputs:        []Output{{Address: p2wpkhAddress, Value: 100001}},
+			maxOutputValue: 100000,
+			wantErr:        ErrOutputValueTooHigh,
+		},
+	}
+
+	s := &Service{}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := s.CreateTransaction(&Tx{
+				Inputs:         inputs,
+				Outputs:        tt.outputs,
+				ChangeAddress:  p2wpkhAddress,
+				FeeSatPerKb:    1000,
+				MaxOutputValue: tt.maxOutputValue,
+			}, chaincfg.BitcoinMainNetParams)
+			if errors.Cause(err) != tt.wantErr {
+				t.Fatalf("CreateTransaction() got error '%v', want '%v'", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestCreateTransaction_ChangeDerivation(t *testing.T) {
+	// BIP0084: Test Vectors (account 0, m/84'/0'/0')
+	accountKey := "zpub6rFR7y4Q2AijBEqTUquhVz398htDFrtymD9xYYfG1m4wAcvPhXNfE3EfH1r1ADqtfSdVCToUG868RvUUkgDKf31mGDtKsAYz2oz2AGutZYs"
+
+	// Change address of account 0, at m/84'/0'/0'/1/3
+	wantChangeAddress := "bc1qv6vaedpeke2lxr3q0wek8dd7nzhut9w0eqkz9z"
+
+	tests := []struct {
+		name             string
+		changeAddress    string
+		changeDerivation []uint32
+		wantErr          bool
+	}{
+		{
+			name:             "derived change address",
+			changeDerivation: []uint32{InternalChain, 3},
+		},
+		{
+			name:    "no change address nor derivation",
+			wantErr: true,
+		},
+		{
+			name:             "both change address and derivation",
+			changeAddress:    wantChangeAddress,
+			changeDerivation: []uint32{InternalChain, 3},
+			wantErr:          true,
+		},
+		{
+			name:             "hardened change derivation",
+			changeDerivation: []uint32{InternalChain, hdkeychain.HardenedKeyStart},
+			wantErr:          true,
+		},
+	}
+
+	s := &Service{}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := s.CreateTransaction(&Tx{
+				Inputs: []Input{
+					{
+						OutputHash:  "2f5dae23c2e18588c86cfc4e154f3b68bd8eb4265fe0b4b1341ad5aa40422f66",
+						OutputIndex: 0,
+						Value:       110000,
+					},
+				},
+				Outputs: []Output{
+					{
+						Address: "1MZbRqZGpiSWGRLg8DUdVrDKHwNe1oesUZ",
+						Value:   100000,
+					},
+				},
+				ChangeAddress:    tt.changeAddress,
+				ChangeAccountKey: accountKey,
+				ChangeDerivation: tt.changeDerivation,
+				ChangeEncoding:   NativeSegwit,
+				FeeSatPerKb:      1000,
+			}, chaincfg.BitcoinMainNetParams)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("CreateTransaction() got error '%v', want error %v",
+					err, tt.wantErr)
+			}
+
+			if tt.wantErr {
+				return
+			}
+
+			decoded, err := s.DecodeTransaction(got.RawTx.Hex, nil, chaincfg.BitcoinMainNetParams)
+			if err != nil {
+				t.Fatalf("DecodeTransaction() got error '%v'", err)
+			}
+
+			var changeOutputs int
+
+			for _, output := range decoded.Outputs {
+				if len(output.Addresses) == 1 && output.Addresses[0] == wantChangeAddress {
+					changeOutputs++
+
+					if output.Value != got.Change {
+						t.Fatalf("CreateTransaction() got change output of %d, want %d",
+							output.Value, got.Change)
+					}
+				}
+			}
+
+			if changeOutputs != 1 {
+				t.Fatalf("CreateTransaction() got %d outputs to change address %s, want 1",
+					changeOutputs, wantChangeAddress)
+			}
+		})
+	}
+}
+
+func TestCreateTransaction_SplitChange(t *testing.T) {
+	// BIP0084: Test Vectors, at m/84'/0'/0'/0/0 and m/84'/0'/0'/1/0
+	firstChangeAddress := "bc1qcr8te4kr609gcawutmrza0j4xv80jy8z306fyu"
+	secondChangeAddress := "bc1q8c6fshw2dlwun7ekn9qwf37cu2rn755upcp6el"
+
+	tests := []struct {
+		name          string
+		changeAddress string
+		splitChange   []ChangeSplit
+		// wantSplit are the ratios of the change outputs expected in the
+		// transaction, by address.
+		wantSplit map[string]float64
+		wantErr   bool
+	}{
+		{
+			name: "50/50 split",
+			splitChange: []ChangeSplit{
+				{Address: firstChangeAddress, Ratio: 0.5},
+				{Address: secondChangeAddress, Ratio: 0.5},
+			},
+			wantSplit: map[string]float64{firstChangeAddress: 0.5, secondChangeAddress: 0.5},
+		},
+		{
+			name: "25/75 split",
+			splitChange: []ChangeSplit{
+				{Address: firstChangeAddress, Ratio: 0.25},
+				{Address: secondChangeAddress, Ratio: 0.75},
+			},
+			wantSplit: map[string]float64{firstChangeAddress: 0.25, secondChangeAddress: 0.75},
+		},
+		{
+			name: "dust piece dropped",
+			splitChange: []ChangeSplit{
+				{Address: firstChangeAddress, Ratio: 0.999},
+				{Address: secondChangeAddress, Ratio: 0.001},
+			},
+			wantSplit: map[string]float64{firstChangeAddress: 1},
+		},
+		{
+			name: "ratios not summing to 1",
+			splitChange: []ChangeSplit{
+				{Address: firstChangeAddress, Ratio: 0.5},
+				{Address: secondChangeAddress, Ratio: 0.4},
+			},
+			wantErr: true,
+		},
+		{
+			name: "negative ratio",
+			splitChange: []ChangeSplit{
+				{Address: firstChangeAddress, Ratio: 1.5},
+				{Address: secondChangeAddress, Ratio: -0.5},
+			},
+			wantErr: true,
+		},
+		{
+			name:          "both change address and split change",
+			changeAddress: firstChangeAddress,
+			splitChange: []ChangeSplit{
+				{Address: firstChangeAddress, Ratio: 0.5},
+				{Address: secondChangeAddress, Ratio: 0.5},
+			},
+			wantErr: true,
+		},
+		{
+			name: "change address of another network",
+			splitChange: []ChangeSplit{
+				{Address: firstChangeAddress, Ratio: 0.5},
+				{Address: "tb1qcr8te4kr609gcawutmrza0j4xv80jy8zmfp6l0", Ratio: 0.5},
+			},
+			wantErr: true,
+		},
+	}
+
+	s := &Service{}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			inputValue := int64(110000)
+			outputValue := int64(100000)
+
+			got, err := s.CreateTransaction(&Tx{
+				Inputs: []Input{
+					{
+						OutputHash:  "2f5dae23c2e18588c86cfc4e154f3b68bd8eb4265fe0b4b1341ad5aa40422f66",
+						OutputIndex: 0,
+						Value:       inputValue,
+					},
+				},
+				Outputs: []Output{
+					{
+						Address: "1MZbRqZGpiSWGRLg8DUdVrDKHwNe1oesUZ",
+						Value:   outputValue,
+					},
+				},
+				ChangeAddress: tt.changeAddress,
+				SplitChange:   tt.splitChange,
+				FeeSatPerKb:   1000,
+			}, chaincfg.BitcoinMainNetParams)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("CreateTransaction() got error '%v', want error %v",
+					err, tt.wantErr)
+			}
+
+			if tt.wantErr {
+				return
+			}
+
+			decoded, err := s.DecodeTransaction(got.RawTx.Hex, nil, chaincfg.BitcoinMainNetParams)
+			if err != nil {
+				t.Fatalf("DecodeTransaction() got error '%v'", err)
+			}
+
+			if len(decoded.Outputs) != 1+len(tt.wantSplit) {
+				t.Fatalf("CreateTransaction() got %d outputs, want %d",
+					len(decoded.Outputs), 1+len(tt.wantSplit))
+			}
+
+			var changeAmount int64
+
+			for _, output := range decoded.Outputs {
+				ratio, ok := tt.wantSplit[output.Addresses[0]]
+				if !ok {
+					continue
+				}
+
+				changeAmount += output.Value
+
+				// The rounding remainder goes to the last change output.
+				wantValue := float64(got.Change) * ratio
+				if math.Abs(float64(output.Value)-wantValue) > 1 {
+					t.Fatalf("CreateTransaction() got change output of %d to %s, want %v",
+						output.Value, output.Addresses[0], wantValue)
+				}
+			}
+
+			if changeAmount != got.Change {
+				t.Fatalf("CreateTransaction() got change outputs of %d, want %d",
+					changeAmount, got.Change)
+			}
+
+			if inputValue != outputValue+got.Change+got.TotalFees {
+				t.Fatalf("CreateTransaction() got output %d, change %d and fees %d, want a total of %d",
+					outputValue, got.Change, got.TotalFees, inputValue)
+			}
+
+			// The fees are paid at the fee rate, for the actual outputs.
+			decodedRawTx, err := s.DecodeRawTransaction(got.RawTx.Hex)
+			if err != nil {
+				t.Fatalf("DecodeRawTransaction() got error '%v'", err)
+			}
+
+			wantFees := getMaxRequiredFee(decodedRawTx.MsgTx.TxOut, [][]byte{nil}, 1000)
+			if got.TotalFees != wantFees {
+				t.Fatalf("CreateTransaction() got fees %d, want %d", got.TotalFees, wantFees)
+			}
+		})
+	}
+}
+
+func TestCreateTransaction_MixedInputsFee(t *testing.T) {
+	// BIP0032: Test Vector 1 (chain m)
+	privKey := "xprv9s21ZrQH143K3QTDL4LXw2F7HEK3wJUD2nW2nRk4stbPy6cq3jPPqjiChkVvvNKmPGJxWUtg6LnF5kejMRNNU3TGtRBeJgk33yuGBxrMPHi"
+
+	s := &Service{}
+
+	encodings := []AddressEncoding{Legacy, WrappedSegwit, NativeSegwit}
+
+	var (
+		inputs     []Input
+		utxos      []Utxo
+		signatures []SignatureMetadata
+	)
+
+	// Each input spends a utxo of another type, locked by the key at
+	// m/idx.
+	for idx, encoding := range encodings {
+		derivation := []uint32{uint32(idx)}
+
+		keyMaterial, err := s.DerivePrivateKey(privKey, derivation)
+		if err != nil {
+			t.Fatalf("DerivePrivateKey() got error '%v'", err)
+		}
+
+		pubKey, _ := btcec.ParsePubKey(keyMaterial.PublicKey)
+
+		address, err := s.EncodeAddress(
+			keyMaterial.PublicKey, encoding, true, chaincfg.BitcoinMainNetParams)
+		if err != nil {
+			t.Fatalf("EncodeAddress() got error '%v'", err)
+		}
+
+		script, err := s.AddressToScript(address, chaincfg.BitcoinMainNetParams)
+		if err != nil {
+			t.Fatalf("AddressToScript() got error '%v'", err)
+		}
+
+		inputs = append(inputs, Input{
+			OutputHash:  "2f5dae23c2e18588c86cfc4e154f3b68bd8eb4265fe0b4b1341ad5aa40422f66",
+			OutputIndex: uint32(idx),
+			Script:      script,
+			Value:       100000,
+		})
+		utxos = append(utxos, Utxo{Script: script, Value: 100000, Derivation: derivation})
+		signatures = append(signatures, SignatureMetadata{PubKey: pubKey, AddrEncoding: encoding})
+	}
+
+	// At 1 sat/vbyte, the fees are the estimated virtual size.
+	got, err := s.CreateTransaction(&Tx{
+		Inputs: inputs,
+		Outputs: []Output{
+			{
+				Address: "1MZbRqZGpiSWGRLg8DUdVrDKHwNe1oesUZ",
+				Value:   200000,
+			},
+		},
+		ChangeAddress: "bc1qcr8te4kr609gcawutmrza0j4xv80jy8z306fyu",
+		FeeSatPerKb:   1000,
+	}, chaincfg.BitcoinMainNetParams)
+	if err != nil {
+		t.Fatalf("CreateTransaction() got error '%v'", err)
+	}
+
+	msgTx, err := s.DeserializeMsgTx(&got.RawTx)
+	if err != nil {
+		t.Fatalf("DeserializeMsgTx() got error '%v'", err)
+	}
+
+	signedRawTx, err := s.SignAndVerifyTransaction(
+		msgTx, utxos, privKey, signatures, chaincfg.BitcoinMainNetParams)
+	if err != nil {
+		t.Fatalf("SignAndVerifyTransaction() got error '%v'", err)
+	}
+
+	signedMsgTx, err := s.DeserializeMsgTx(signedRawTx)
+	if err != nil {
+		t.Fatalf("DeserializeMsgTx() got error '%v'", err)
+	}
+
+	weight := blockchain.GetTransactionWeight(btcutil.NewTx(signedMsgTx))
+	virtualSize := (weight + blockchain.WitnessScaleFactor - 1) / blockchain.WitnessScaleFactor
+
+	// The estimate assumes 72-byte DER signatures, which can be one byte
+	// shorter, so it can exceed the signed size by up to one vbyte per
+	// input.
+	if got.TotalFees < virtualSize || got.TotalFees > virtualSize+int64(len(inputs)) {
+		t.Fatalf("CreateTransaction() got fees %d, want between %d and %d for a "+
+			"signed virtual size of %d", got.TotalFees, virtualSize,
+			virtualSize+int64(len(inputs)), virtualSize)
+	}
+}
+
+func TestCreateTransaction_Sequence(t *testing.T) {
+	const outputHash = "2f5dae23c2e18588c86cfc4e154f3b68bd8eb4265fe0b4b1341ad5aa40422f66"
+
+	// A relative locktime of 144 blocks, as per BIP0068, an opt-in for
+	// replacement as per BIP0125, and the default sequence number.
+	sequences := []uint32{144, wire.MaxTxInSequenceNum - 2, 0}
+
+	var inputs []Input
+	for idx, sequence := range sequences {
+		inputs = append(inputs, Input{
+			OutputHash:  outputHash,
+			OutputIndex: uint32(idx),
+			Value:       50000,
+			Sequence:    sequence,
+		})
+	}
+
+	s := &Service{}
+
+	got, err := s.CreateTransaction(&Tx{
+		Inputs: inputs,
+		Outputs: []Output{
+			{
+				Address: "1MZbRqZGpiSWGRLg8DUdVrDKHwNe1oesUZ",
+				Value:   100000,
+			},
+		},
+		ChangeAddress: "1GgX4cGLiqF9p4Sd1XcPQhEAAhNDA4wLYS",
+		FeeSatPerKb:   1000,
+	}, chaincfg.BitcoinMainNetParams)
+	if err != nil {
+		t.Fatalf("CreateTransaction() got error '%v'", err)
+	}
+
+	decoded, err := s.DecodeTransaction(got.RawTx.Hex, nil, chaincfg.BitcoinMainNetParams)
+	if err != nil {
+		t.Fatalf("DecodeTransaction() got error '%v'", err)
+	}
+
+	wantInputs := []DecodedTxInput{
+		{OutputHash: outputHash, OutputIndex: 0, Sequence: 144},
+		{OutputHash: outputHash, OutputIndex: 1, Sequence: wire.MaxTxInSequenceNum - 2},
+		{OutputHash: outputHash, OutputIndex: 2, Sequence: wire.MaxTxInSequenceNum},
+	}
+
+	if !reflect.DeepEqual(decoded.Inputs, wantInputs) {
+		t.Fatalf("CreateTransaction() got inputs '%v', want '%v'",
+			decoded.Inputs, wantInputs)
+	}
+
+	// The relative locktime of the first input requires a version 2
+	// transaction.
+	if decoded.Version != 2 {
+		t.Fatalf("CreateTransaction() got version %d, want 2", decoded.Version)
+	}
+}
+
+func TestCreateTransaction_Ordering(t *testing.T) {
+	const (
+		firstHash  = "0e53ec5dfb2cb8a71fec32dc9a634a35b7e24799295ddd5278217822e0b31f57"
+		secondHash = "2f5dae23c2e18588c86cfc4e154f3b68bd8eb4265fe0b4b1341ad5aa40422f66"
+	)
+
+	inputs := []Input{
+		{OutputHash: secondHash, OutputIndex: 1, Value: 50000},
+		{OutputHash: firstHash, OutputIndex: 3, Value: 50000},
+		{OutputHash: secondHash, OutputIndex: 0, Value: 50000},
+		{OutputHash: firstHash, OutputIndex: 2, Value: 50000},
+	}
+
+	outputs := []Output{
+		{Address: "1MZbRqZGpiSWGRLg8DUdVrDKHwNe1oesUZ", Value: 100000},
+		{Address: "bc1qcr8te4kr609gcawutmrza0j4xv80jy8z306fyu", Value: 40000},
+		{Address: "1GgX4cGLiqF9p4Sd1XcPQhEAAhNDA4wLYS", Value: 40000},
+	}
+
+	tests := []struct {
+		name       string
+		ordering   Ordering
+		wantInputs []DecodedTxInput
+		wantErr    bool
+	}{
+		{
+			name:     "as provided",
+			ordering: AsProvided,
+			wantInputs: []DecodedTxInput{
+				{OutputHash: secondHash, OutputIndex: 1, Sequence: wire.MaxTxInSequenceNum},
+				{OutputHash: firstHash, OutputIndex: 3, Sequence: wire.MaxTxInSequenceNum},
+				{OutputHash: secondHash, OutputIndex: 0, Sequence: wire.MaxTxInSequenceNum},
+				{OutputHash: firstHash, OutputIndex: 2, Sequence: wire.MaxTxInSequenceNum},
+			},
+		},
+		{
+			name:     "BIP69",
+			ordering: Bip69,
+			wantInputs: []DecodedTxInput{
+				{OutputHash: firstHash, OutputIndex: 2, Sequence: wire.MaxTxInSequenceNum},
+				{OutputHash: firstHash, OutputIndex: 3, Sequence: wire.MaxTxInSequenceNum},
+				{OutputHash: secondHash, OutputIndex: 0, Sequence: wire.MaxTxInSequenceNum},
+				{OutputHash: secondHash, OutputIndex: 1, Sequence: wire.MaxTxInSequenceNum},
+			},
+		},
+		{
+			name:     "unknown ordering",
+			ordering: 9999,
+			wantErr:  true,
+		},
+	}
+
+	s := &Service{}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := s.CreateTransaction(&Tx{
+				Inputs:        inputs,
+				Outputs:       outputs,
+				ChangeAddress: "bc1q8c6fshw2dlwun7ekn9qwf37cu2rn755upcp6el",
+				FeeSatPerKb:   1000,
+				Ordering:      tt.ordering,
+			}, chaincfg.BitcoinMainNetParams)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("CreateTransaction() got error '%v', want error %v",
+					err, tt.wantErr)
+			}
+
+			if tt.wantErr {
+				return
+			}
+
+			decodedRawTx, err := s.DecodeRawTransaction(got.RawTx.Hex)
+			if err != nil {
+				t.Fatalf("DecodeRawTransaction() got error '%v'", err)
+			}
+
+			decoded, err := s.DecodeTransaction(got.RawTx.Hex, nil, chaincfg.BitcoinMainNetParams)
+			if err != nil {
+				t.Fatalf("DecodeTransaction() got error '%v'", err)
+			}
+
+			if !reflect.DeepEqual(decoded.Inputs, tt.wantInputs) {
+				t.Fatalf("CreateTransaction() got inputs '%v', want '%v'",
+					decoded.Inputs, tt.wantInputs)
+			}
+
+			if tt.ordering != Bip69 {
+				return
+			}
+
+			if !txsort.IsSorted(decodedRawTx.MsgTx) {
+				t.Fatalf("CreateTransaction() got transaction %s not sorted as per BIP69",
+					got.RawTx.Hex)
+			}
+
+			// Outputs are sorted by value, then by script: the change output
+			// first, and the outputs of 40000 paying to a P2WPKH script
+			// (0x00...) before a P2PKH script (0x76...).
+			wantAddresses := []string{
+				"bc1q8c6fshw2dlwun7ekn9qwf37cu2rn755upcp6el",
+				"bc1qcr8te4kr609gcawutmrza0j4xv80jy8z306fyu",
+				"1GgX4cGLiqF9p4Sd1XcPQhEAAhNDA4wLYS",
+				"1MZbRqZGpiSWGRLg8DUdVrDKHwNe1oesUZ",
+			}
+
+			for idx, output := range decoded.Outputs {
+				if output.Addresses[0] != wantAddresses[idx] {
+					t.Fatalf("CreateTransaction() got output %d to %s, want %s",
+						idx, output.Addresses[0], wantAddresses[idx])
+				}
+			}
+		})
+	}
+}
+
+func TestCreateTransaction_LockTime(t *testing.T) {
+	tests := []struct {
+		name                   string
+		lockTime               uint32
+		sequence               uint32
+		strictLockTime         bool
+		wantLockTimeUnenforced bool
+		wantErr                error
+	}{
+		{
+			name: "no lock time",
+		},
+		{
+			name:     "lock time enforced by a non-final sequence",
+			lockTime: 700000,
+			sequence: wire.MaxTxInSequenceNum - 1,
+		},
+		{
+			name:                   "lock time with final sequences",
+			lockTime:               700000,
+			wantLockTimeUnenforced: true,
+		},
+		{
+			name:           "strict lock time with final sequences",
+			lockTime:       700000,
+			strictLockTime: true,
+			wantErr:        ErrUnenforcedLockTime,
+		},
+	}
+
+	s := &Service{}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := s.CreateTransaction(&Tx{
+				Inputs: []Input{
+					{
+						OutputHash:  "2f5dae23c2e18588c86cfc4e154f3b68bd8eb4265fe0b4b1341ad5aa40422f66",
+						OutputIndex: 0,
+						Value:       110000,
+						Sequence:    tt.sequence,
+					},
+				},
+				Outputs: []Output{
+					{
+						Address: "1MZbRqZGpiSWGRLg8DUdVrDKHwNe1oesUZ",
+						Value:   100000,
+					},
+				},
+				ChangeAddress:  "1GgX4cGLiqF9p4Sd1XcPQhEAAhNDA4wLYS",
+				FeeSatPerKb:    1000,
+				LockTime:       tt.lockTime,
+				StrictLockTime: tt.strictLockTime,
+			}, chaincfg.BitcoinMainNetParams)
+			if errors.Cause(err) != tt.wantErr {
+				t.Fatalf("CreateTransaction() got error '%v', want '%v'", err, tt.wantErr)
+			}
+
+			if tt.wantErr != nil {
+				return
+			}
+
+			if got.LockTimeUnenforced != tt.wantLockTimeUnenforced {
+				t.Fatalf("CreateTransaction() got lock time unenforced %v, want %v",
+					got.LockTimeUnenforced, tt.wantLockTimeUnenforced)
+			}
+		})
+	}
+}
+
+func TestGenerateDerSignatures(t *testing.T) {
+	hashStrToHash := func(str string) *chainhash.Hash {
+		hash, err := chainhash.NewHashFromStr("864608ddfcb050c8a9a0c275687186ee2957e0853bee198aa464de798b7696db")
+		if err != nil {
+			panic(err)
+		}
+		return hash
+	}
+	hexStrToBytes := func(hexStr string) []byte {
+		script, err := hex.DecodeString(hexStr)
+		if err != nil {
+			panic(err)
+		}
+		return script
+	}
+
+	tests := []struct {
+		name    string
+		msgTx   *wire.MsgTx
+		utxos   []Utxo
+		privKey string
+		wantErr error
+	}{
+		{
+			name: "generate DER signatures",
+			msgTx: &wire.MsgTx{
+				Version: 1,
+				TxIn: []*wire.TxIn{
+					wire.NewTxIn(
+						wire.NewOutPoint(hashStrToHash("864608ddfcb050c8a9a0c275687186ee2957e0853bee198aa464de798b7696db"), 0),
+						nil,
+						nil,
+					),
+				},
+				LockTime: 0x0,
+			},
+			utxos: []Utxo{
+				{
+					Script:     hexStrToBytes("0014ff131505f8f4868ef63eb3e71aa37bcbccd7ea57"),
+					Value:      1000000,
+					Derivation: []uint32{84 + h, 0 + h, 0 + h, 0, 2},
+				},
+			},
+			privKey: "tprv8g5UXufoRYtBEU5g2ueXDG32joLBLEzsGnoTUBZayNm8cAFGS56CcJmGwuSNEBLguQ3ja5betvc6kas1BXPpVzwuh8MWKr2ijzXJWuoJBqL",
+		},
+		{
+			name: "wrong derivation index",
+			msgTx: &wire.MsgTx{
+				Version: 1,
+				TxIn: []*wire.TxIn{
+					wire.NewTxIn(
+						wire.NewOutPoint(hashStrToHash("864608ddfcb050c8a9a0c275687186ee2957e0853bee198aa464de798b7696db"), 0),
+						nil,
+						nil,
+					),
+				},
+				LockTime: 0x0,
+			},
+			utxos: []Utxo{
+				{
+					Script:     hexStrToBytes("0014ff131505f8f4868ef63eb3e71aa37bcbccd7ea57"),
+					Value:      1000000,
+					Derivation: []uint32{84 + h, 0 + h, 0 + h, 0, 3},
+				},
+			},
+			privKey: "tprv8g5UXufoRYtBEU5g2ueXDG32joLBLEzsGnoTUBZayNm8cAFGS56CcJmGwuSNEBLguQ3ja5betvc6kas1BXPpVzwuh8MWKr2ijzXJWuoJBqL",
+			wantErr: ErrPublicKeyMismatch,
+		},
+	}
+
+	s := &Service{}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			derSignatures, err := s.GenerateDerSignatures(tt.msgTx, tt.utxos, tt.privKey, false)
+			if errors.Cause(err) != tt.wantErr {
+				t.Fatalf("GenerateDerSignatures() got error '%v', want '%v'", err, tt.wantErr)
+			}
+
+			if tt.wantErr != nil && !strings.Contains(err.Error(), "signing key does not match input 0's script") {
+				t.Fatalf("GenerateDerSignatures() got error '%v', want the mismatching input", err)
+			}
+
+			if tt.wantErr == nil {
+				if derSignatures == nil {
+					t.Fatal("GenerateDerSignatures() got nil response")
+				}
+
+				countDerSignatures := len(derSignatures)
+				countUtxos := len(tt.utxos)
+
+				if countDerSignatures != countUtxos {
+					t.Fatalf(
+						"GenerateDerSignatures has generated %d signatures instead of %d",
+						countDerSignatures,
+						countUtxos,
+					)
+				}
+			}
+		})
+	}
+}
+
+func TestGenerateDerSignatures_DerivationFromMasterKey(t *testing.T) {
+	// BIP0032: Test Vector 1 (chain m)
+	privKey := "xprv9s21ZrQH143K3QTDL4LXw2F7HEK3wJUD2nW2nRk4stbPy6cq3jPPqjiChkVvvNKmPGJxWUtg6LnF5kejMRNNU3TGtRBeJgk33yuGBxrMPHi"
+
+	// Helper to derive the public key and the P2WPKH script of the key at
+	// a derivation path of the master key.
+	getInputKey := func(derivation []uint32) (*btcec.PublicKey, []byte) {
+		xKey, err := hdkeychain.NewKeyFromString(privKey)
+		if err != nil {
+			t.Fatalf("NewKeyFromString() got error '%v'", err)
+		}
+
+		for _, childIndex := range derivation {
+			xKey, err = xKey.Derive(childIndex)
+			if err != nil {
+				t.Fatalf("Derive() got error '%v'", err)
+			}
+		}
+
+		pubKey, err := xKey.ECPubKey()
+		if err != nil {
+			t.Fatalf("ECPubKey() got error '%v'", err)
+		}
+
+		address, _ := btcutil.NewAddressWitnessPubKeyHash(
+			btcutil.Hash160(pubKey.SerializeCompressed()), chaincfg.BitcoinMainNetParams)
+		script, _ := txscript.PayToAddrScript(address)
+
+		return pubKey, script
+	}
+
+	newMsgTx := func(inputs int, outputScript []byte) *wire.MsgTx {
+		msgTx := wire.NewMsgTx(wire.TxVersion)
+		for idx := 0; idx < inputs; idx++ {
+			msgTx.AddTxIn(wire.NewTxIn(
+				wire.NewOutPoint(btcutil.NewTx(wire.NewMsgTx(1)).Hash(), uint32(idx)),
+				nil,
+				nil,
+			))
+		}
+		msgTx.AddTxOut(wire.NewTxOut(150000, outputScript))
+
+		return msgTx
+	}
+
+	pubKey0, script0 := getInputKey([]uint32{0})
+	pubKey1, script1 := getInputKey([]uint32{1})
+	pubKey01, script01 := getInputKey([]uint32{0, 1})
+
+	tests := []struct {
+		name    string
+		utxos   []Utxo
+		pubKeys []*btcec.PublicKey
+		wantErr error
+	}{
+		{
+			// Unchanged: the path of the first utxo is always derived from
+			// the master key.
+			name: "single input",
+			utxos: []Utxo{
+				{Script: script01, Value: 100000, Derivation: []uint32{0, 1}},
+			},
+			pubKeys: []*btcec.PublicKey{pubKey01},
+		},
+		{
+			// The second input is signed with the key at m/1, and not with
+			// the key at m/0/1, chained from the key of the first input.
+			name: "paths relative to the master key",
+			utxos: []Utxo{
+				{Script: script0, Value: 100000, Derivation: []uint32{0}},
+				{Script: script1, Value: 100000, Derivation: []uint32{1}},
+			},
+			pubKeys: []*btcec.PublicKey{pubKey0, pubKey1},
+		},
+		{
+			// Formerly, the second input was signed with the key at m/0/1,
+			// chained from the key of the first input.
+			name: "paths chained from the previous utxo",
+			utxos: []Utxo{
+				{Script: script0, Value: 100000, Derivation: []uint32{0}},
+				{Script: script01, Value: 100000, Derivation: []uint32{1}},
+			},
+			wantErr: ErrPublicKeyMismatch,
+		},
+	}
+
+	s := &Service{}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			msgTx := newMsgTx(len(tt.utxos), script0)
+
+			derSignatures, err := s.GenerateDerSignatures(msgTx, tt.utxos, privKey, false)
+			if errors.Cause(err) != tt.wantErr {
+				t.Fatalf("GenerateDerSignatures() got error '%v', want '%v'", err, tt.wantErr)
+			}
+
+			if tt.wantErr != nil {
+				return
+			}
+
+			signatures := make([]SignatureMetadata, len(derSignatures))
+			for idx, derSignature := range derSignatures {
+				signatures[idx] = SignatureMetadata{
+					DerSig:       derSignature,
+					PubKey:       tt.pubKeys[idx],
+					AddrEncoding: NativeSegwit,
+				}
+			}
+
+			if _, err := s.SignTransaction(msgTx, chaincfg.BitcoinMainNetParams, signatures); err != nil {
+				t.Fatalf("SignTransaction() got error '%v'", err)
+			}
+
+			for idx, utxo := range tt.utxos {
+				prevOuts := txscript.NewCannedPrevOutputFetcher(utxo.Script, utxo.Value)
+				vm, err := txscript.NewEngine(utxo.Script, msgTx, idx,
+					txscript.StandardVerifyFlags, nil, txscript.NewTxSigHashes(msgTx, prevOuts),
+					utxo.Value, prevOuts)
+				if err != nil {
+					t.Fatalf("NewEngine() got error '%v'", err)
+				}
+
+				if err := vm.Execute(); err != nil {
+					t.Fatalf("Execute() got error '%v' for input %d", err, idx)
+				}
+			}
+		})
+	}
+}
+
+func TestSignTransaction(t *testing.T) {
+	// Helper to derive extended key and return the btcec public key.
+	// Use this in unit-tests to get input public key.
+	getPublicKey := func(extendedKey string, derivation []uint32, chainParams chaincfg.ChainParams) *btcec.PublicKey {
+		s := &Service{}
+
+		pubKeyMat, err := s.DeriveExtendedKey(context.Background(), extendedKey, derivation)
+		if err != nil {
+			panic(err)
+		}
+
+		addressPubKey, err := btcutil.NewAddressPubKey(pubKeyMat.PublicKey, chainParams)
+		if err != nil {
+			panic(err)
+		}
+
+		return addressPubKey.PubKey()
+	}
+
+	tests := []struct {
+		name               string
+		msgTx              *wire.MsgTx
+		chainParams        chaincfg.ChainParams
+		utxos              []Utxo
+		privKey            string
+		signaturesMetadata []SignatureMetadata
+		wantErr            error
+	}{
+		{
+			name: "sign transaction",
+			msgTx: &wire.MsgTx{
+				Version: 1,
+				TxIn: []*wire.TxIn{
+					wire.NewTxIn(
+						wire.NewOutPoint(btcutil.NewTx(wire.NewMsgTx(1)).Hash(), 0),
+						nil,
+						nil,
+					),
+				},
+				LockTime: 0x0,
+			},
+			chainParams: chaincfg.BitcoinMainNetParams,
+			utxos: []Utxo{
+				{
+					Script:     nil,
+					Value:      100000,
+					Derivation: []uint32{44 + h, 0 + h, 0 + h, 0, 0},
+				},
+			},
+			privKey: "xprv9yv8fLFeRhD7NcKbjGS4GesBvy2PjvoRcwEKKaz7zJvM2cQ1eiCwhcHGQNEBwsXthHbPtZNQg5SBBEWS1QH941SKitBdaUT7VDTxzdS8vu7",
+			signaturesMetadata: []SignatureMetadata{
+				{
+					DerSig: nil,
+					PubKey: getPublicKey(
+						"xpub6Cc939fyHvfB9pPLWd3bSyyQFvgKbwhidca49jGCM5Hz5ypEPGf9JVXB4NBuUfPgoHnMjN6oNgdC9KRqM11RZtL8QLW6rFKziNwHDYhZ6Kx",
+						[]uint32{1, 1},
+						chaincfg.BitcoinMainNetParams,
+					),
+					AddrEncoding: Legacy,
+				},
+			},
+		},
+	}
+
+	s := &Service{}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+
+			derSignatures, err := s.GenerateDerSignatures(tt.msgTx, tt.utxos, tt.privKey, false)
+			if err != nil && tt.wantErr == nil {
+				t.Fatalf("GenerateDerSignatures() got error '%v'", err)
+			}
+
+			// Put DER signatures
+			for idx := range tt.signaturesMetadata {
+				tt.signaturesMetadata[idx].DerSig = derSignatures[idx]
+			}
+
+			signedRawTx, err := s.SignTransaction(tt.msgTx, tt.chainParams, tt.signaturesMetadata)
+			if err != nil && tt.wantErr == nil {
+				t.Fatalf("SignTransaction() got error '%v'", err)
+			}
+
+			if tt.wantErr == nil {
+				if signedRawTx == nil {
+					t.Fatal("SignTransaction() got nil response")
+				}
+
+				if len(signedRawTx.Hex) == 0 {
+					t.Fatal("SignTransaction() got empty raw hex")
+				}
+			}
+		})
+	}
+}
+
+func TestGenerateDerSignaturesFromScalars(t *testing.T) {
+	const privKey = "tprv8g5UXufoRYtBEU5g2ueXDG32joLBLEzsGnoTUBZayNm8cAFGS56CcJmGwuSNEBLguQ3ja5betvc6kas1BXPpVzwuh8MWKr2ijzXJWuoJBqL"
+
+	derivation := []uint32{84 + h, 0 + h, 0 + h, 0, 2}
+
+	// Helper to derive the raw private scalar and the compressed public key
+	// of an extended private key at the given derivation.
+	getScalarKey := func(extendedKey string, derivation []uint32) ScalarKey {
+		xKey, err := hdkeychain.NewKeyFromString(extendedKey)
+		if err != nil {
+			panic(err)
+		}
+
+		for _, childIndex := range derivation {
+			xKey, err = xKey.Derive(childIndex)
+			if err != nil {
+				panic(err)
+			}
+		}
+
+		ecPrivKey, err := xKey.ECPrivKey()
+		if err != nil {
+			panic(err)
+		}
+
+		return ScalarKey{
+			PrivateKey: ecPrivKey.Serialize(),
+			PublicKey:  ecPrivKey.PubKey().SerializeCompressed(),
+		}
+	}
+
+	newMsgTx := func() *wire.MsgTx {
+		hash, err := chainhash.NewHashFromStr("864608ddfcb050c8a9a0c275687186ee2957e0853bee198aa464de798b7696db")
+		if err != nil {
+			panic(err)
+		}
+
+		return &wire.MsgTx{
+			Version:  1,
+			TxIn:     []*wire.TxIn{wire.NewTxIn(wire.NewOutPoint(hash, 0), nil, nil)},
+			LockTime: 0x0,
+		}
+	}
+
+	script, err := hex.DecodeString("0014ff131505f8f4868ef63eb3e71aa37bcbccd7ea57")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	utxos := []Utxo{
+		{
+			Script:     script,
+			Value:      1000000,
+			Derivation: derivation,
+		},
+	}
+
+	validKey := getScalarKey(privKey, derivation)
+	otherKey := getScalarKey(privKey, []uint32{84 + h, 0 + h, 0 + h, 0, 3})
+
+	curveOrder := btcec.S256().N.Bytes()
+
+	tests := []struct {
+		name    string
+		key     ScalarKey
+		wantErr error
+	}{
+		{
+			name: "scalar with matching public key",
+			key:  validKey,
+		},
+		{
+			name: "scalar without public key",
+			key:  ScalarKey{PrivateKey: validKey.PrivateKey},
+		},
+		{
+			name:    "scalar with mismatching public key",
+			key:     ScalarKey{PrivateKey: validKey.PrivateKey, PublicKey: otherKey.PublicKey},
+			wantErr: ErrPublicKeyMismatch,
+		},
+		{
+			name:    "scalar of another key than the one of the script",
+			key:     otherKey,
+			wantErr: ErrPublicKeyMismatch,
+		},
+		{
+			name:    "scalar of another key without public key",
+			key:     ScalarKey{PrivateKey: otherKey.PrivateKey},
+			wantErr: ErrPublicKeyMismatch,
+		},
+		{
+			name:    "zero scalar",
+			key:     ScalarKey{PrivateKey: make([]byte, 32)},
+			wantErr: ErrInvalidPrivateKey,
+		},
+		{
+			name:    "scalar equal to curve order",
+			key:     ScalarKey{PrivateKey: curveOrder},
+			wantErr: ErrInvalidPrivateKey,
+		},
+		{
+			name:    "scalar with invalid length",
+			key:     ScalarKey{PrivateKey: validKey.PrivateKey[1:]},
+			wantErr: ErrInvalidPrivateKey,
+		},
+	}
+
+	s := &Service{}
+
+	// Signatures are deterministic (RFC6979), so signing with the raw scalar
+	// must produce the same signature as signing with the extended key.
+	want, err := s.GenerateDerSignatures(newMsgTx(), utxos, privKey, false)
+	if err != nil {
+		t.Fatalf("GenerateDerSignatures() got error '%v'", err)
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := s.GenerateDerSignaturesFromScalars(newMsgTx(), utxos, []ScalarKey{tt.key})
+			if tt.wantErr != nil {
+				if errors.Cause(err) != tt.wantErr {
+					t.Fatalf("GenerateDerSignaturesFromScalars() got error '%v', want '%v'",
+						err, tt.wantErr)
+				}
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("GenerateDerSignaturesFromScalars() got error '%v'", err)
+			}
+
+			if !reflect.DeepEqual(got, want) {
+				t.Fatalf("GenerateDerSignaturesFromScalars() got %x, want %x", got, want)
+			}
+		})
+	}
+}
+
+func TestDecodeRawTransaction(t *testing.T) {
+	msgTx := wire.NewMsgTx(wire.TxVersion)
+	msgTx.AddTxIn(wire.NewTxIn(
+		wire.NewOutPoint(btcutil.NewTx(wire.NewMsgTx(1)).Hash(), 0),
+		nil,
+		wire.TxWitness{
+			{0x30, 0x44, 0x02, 0x20},
+			{0x02, 0x79, 0xbe, 0x66},
+		},
+	))
+	msgTx.AddTxOut(wire.NewTxOut(100000, []byte{0x00, 0x14}))
+
+	var segwitBuf, legacyBuf bytes.Buffer
+	if err := msgTx.Serialize(&segwitBuf); err != nil {
+		t.Fatalf("Serialize() got error '%v'", err)
+	}
+	if err := msgTx.SerializeNoWitness(&legacyBuf); err != nil {
+		t.Fatalf("SerializeNoWitness() got error '%v'", err)
+	}
+
+	tests := []struct {
+		name                 string
+		rawTxHex             string
+		wantSegwitSerialized bool
+		wantHasWitness       bool
+		wantErr              bool
+	}{
+		{
+			name:                 "segwit serialization",
+			rawTxHex:             hex.EncodeToString(segwitBuf.Bytes()),
+			wantSegwitSerialized: true,
+			wantHasWitness:       true,
+		},
+		{
+			name:                 "legacy serialization with stripped witness",
+			rawTxHex:             hex.EncodeToString(legacyBuf.Bytes()),
+			wantSegwitSerialized: false,
+			wantHasWitness:       false,
+		},
+		{
+			name:     "invalid hex",
+			rawTxHex: "0100000z",
+			wantErr:  true,
+		},
+		{
+			name:     "truncated transaction",
+			rawTxHex: hex.EncodeToString(segwitBuf.Bytes()[:10]),
+			wantErr:  true,
+		},
+	}
+
+	s := &Service{}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := s.DecodeRawTransaction(tt.rawTxHex)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("DecodeRawTransaction() error = %v, wantErr %v", err, tt.wantErr)
+			}
+
+			if tt.wantErr {
+				return
+			}
+
+			if got.SegwitSerialized != tt.wantSegwitSerialized {
+				t.Fatalf("DecodeRawTransaction() got SegwitSerialized = %v, want %v",
+					got.SegwitSerialized, tt.wantSegwitSerialized)
+			}
+
+			if got.MsgTx.HasWitness() != tt.wantHasWitness {
+				t.Fatalf("DecodeRawTransaction() got HasWitness() = %v, want %v",
+					got.MsgTx.HasWitness(), tt.wantHasWitness)
+			}
+
+			// The txid does not commit to witness data, and must not depend
+			// on the serialization format.
+			if got.Hash != msgTx.TxHash().String() {
+				t.Fatalf("DecodeRawTransaction() got Hash = %v, want %v",
+					got.Hash, msgTx.TxHash().String())
+			}
+		})
+	}
+}
+
+func TestTxidFromHex(t *testing.T) {
+	tests := []struct {
+		name      string
+		rawTxHex  string
+		wantTxid  string
+		wantWtxid string
+		wantErr   bool
+	}{
+		{
+			// Mainnet transaction of block 170, without witness data.
+			name:      "legacy transaction",
+			rawTxHex:  "0100000001c997a5e56e104102fa209c6a852dd90660a20b2d9c352423edce25857fcd3704000000004847304402204e45e16932b8af514961a1d3a1a25fdf3f4f7732e9d624c6c61548ab5fb8cd410220181522ec8eca07de4860a4acdd12909d831cc56cbbac4622082221a8768d1d0901ffffffff0200ca9a3b00000000434104ae1a62fe09c5f51b13905f07f06b99a2f7159b2225f374cd378d71302fa28414e7aab37397f554a7df5f142c21c1b7303b8a0626f1baded5c72a704f7e6cd84cac00286bee0000000043410411db93e1dcdb8a016b49840f8c53bc1eb68a382e97b1482ecad7b148a6909a5cb2e0eaddfb84ccf9744464f82e160bfa9b8b64f9d4c03f999b8643f656b412a3ac00000000",
+			wantTxid:  "f4184fc596403b9d638783cf57adfe4c75c605f6356fbc91338530e9831e9e16",
+			wantWtxid: "f4184fc596403b9d638783cf57adfe4c75c605f6356fbc91338530e9831e9e16",
+		},
+		{
+			// https://github.com/bitcoin/bips/blob/master/bip-0143.mediawiki#native-p2wpkh
+			name:      "segwit transaction",
+			rawTxHex:  "01000000000102fff7f7881a8099afa6940d42d1e7f6362bec38171ea3edf433541db4e4ad969f00000000494830450221008b9d1dc26ba6a9cb62127b02742fa9d754cd3bebf337f7a55d114c8e5cdd30be022040529b194ba3f9281a99f2b1c0a19c0489bc22ede944ccf4ecbab4cc618ef3ed01eeffffffef51e1b804cc89d182d279655c3aa89e815b1b309fe287d9b2b55d57b90ec68a0100000000ffffffff02202cb206000000001976a9148280b37df378db99f66f85c95a783a76ac7a6d5988ac9093510d000000001976a9143bde42dbee7e4dbe6a21b2d50ce2f0167faa815988ac000247304402203609e17b84f6a7d30c80bfa610b5b4542f32a8a0d5447a12fb1366d7f01cc44a0220573a954c4518331561406f90300e8f3358f51928d43c212a8caed02de67eebee0121025476c2e83188368da1ff3e292e7acafcdb3566bb0ad253f62fc70f07aeee635711000000",
+			wantTxid:  "e8151a2af31c368a35053ddd4bdb285a8595c769a3ad83e0fa02314a602d4609",
+			wantWtxid: "c36c38370907df2324d9ce9d149d191192f338b37665a82e78e76a12c909b762",
+		},
+		{
+			name:     "invalid hex",
+			rawTxHex: "zz",
+			wantErr:  true,
+		},
+		{
+			name:     "truncated transaction",
+			rawTxHex: "0100000001",
+			wantErr:  true,
+		},
+	}
+
+	s := &Service{}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			txid, wtxid, err := s.TxidFromHex(tt.rawTxHex)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("TxidFromHex() got error '%v', want error %v", err, tt.wantErr)
+			}
+
+			if txid != tt.wantTxid {
+				t.Fatalf("TxidFromHex() got txid %s, want %s", txid, tt.wantTxid)
+			}
+
+			if wtxid != tt.wantWtxid {
+				t.Fatalf("TxidFromHex() got wtxid %s, want %s", wtxid, tt.wantWtxid)
+			}
+		})
+	}
+}
+
+func TestReplaceOutputAddress(t *testing.T) {
+	const newAddress = "bc1qw508d6qejxtdg4y5r3zarvary0c5xw7kv8f3t4"
+
+	s := &Service{}
+
+	unsignedTx, err := s.CreateTransaction(&Tx{
+		Inputs: []Input{
+			{
+				OutputHash:  "2f5dae23c2e18588c86cfc4e154f3b68bd8eb4265fe0b4b1341ad5aa40422f66",
+				OutputIndex: 0,
+				Value:       100000,
+			},
+		},
+		Outputs: []Output{
+			{Address: "1MZbRqZGpiSWGRLg8DUdVrDKHwNe1oesUZ", Value: 50000},
+			{Address: "3CWFddi6m4ndiGyKqzYvsFYagqDLPVMTzC", Value: 40000},
+		},
+		ChangeAddress: "1GgX4cGLiqF9p4Sd1XcPQhEAAhNDA4wLYS",
+		FeeSatPerKb:   1000,
+	}, chaincfg.BitcoinMainNetParams)
+	if err != nil {
+		t.Fatalf("CreateTransaction() got error '%v'", err)
+	}
+
+	// Mainnet transaction of block 170, with a signed input.
+	signedTxHex := "0100000001c997a5e56e104102fa209c6a852dd90660a20b2d9c352423edce25857fcd3704000000004847304402204e45e16932b8af514961a1d3a1a25fdf3f4f7732e9d624c6c61548ab5fb8cd410220181522ec8eca07de4860a4acdd12909d831cc56cbbac4622082221a8768d1d0901ffffffff0200ca9a3b00000000434104ae1a62fe09c5f51b13905f07f06b99a2f7159b2225f374cd378d71302fa28414e7aab37397f554a7df5f142c21c1b7303b8a0626f1baded5c72a704f7e6cd84cac00286bee0000000043410411db93e1dcdb8a016b49840f8c53bc1eb68a382e97b1482ecad7b148a6909a5cb2e0eaddfb84ccf9744464f82e160bfa9b8b64f9d4c03f999b8643f656b412a3ac00000000"
+
+	tests := []struct {
+		name        string
+		rawTxHex    string
+		outputIndex uint32
+		address     string
+		chainParams chaincfg.ChainParams
+		wantErr     error
+	}{
+		{
+			name:        "replace second output",
+			rawTxHex:    unsignedTx.RawTx.Hex,
+			outputIndex: 1,
+			address:     newAddress,
+			chainParams: chaincfg.BitcoinMainNetParams,
+		},
+		{
+			name:        "signed transaction",
+			rawTxHex:    signedTxHex,
+			outputIndex: 0,
+			address:     newAddress,
+			chainParams: chaincfg.BitcoinMainNetParams,
+			wantErr:     errors.New("input 0 is already signed"),
+		},
+		{
+			name:        "output index out of range",
+			rawTxHex:    unsignedTx.RawTx.Hex,
+			outputIndex: 3,
+			address:     newAddress,
+			chainParams: chaincfg.BitcoinMainNetParams,
+			wantErr:     errors.New("output index 3 out of range, transaction has 3 outputs"),
+		},
+		{
+			name:        "address of another network",
+			rawTxHex:    unsignedTx.RawTx.Hex,
+			outputIndex: 0,
+			address:     "tb1qw508d6qejxtdg4y5r3zarvary0c5xw7kxpjzsx",
+			chainParams: chaincfg.BitcoinMainNetParams,
+			wantErr:     ErrNetworkMismatch,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := s.ReplaceOutputAddress(tt.rawTxHex, tt.outputIndex, tt.address, tt.chainParams)
+			if tt.wantErr != nil {
+				if err == nil || errors.Cause(err).Error() != tt.wantErr.Error() {
+					t.Fatalf("ReplaceOutputAddress() got error '%v', want '%v'", err, tt.wantErr)
+				}
+
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("ReplaceOutputAddress() got error '%v'", err)
+			}
+
+			original, err := s.DeserializeMsgTx(&RawTx{Hex: tt.rawTxHex})
+			if err != nil {
+				t.Fatalf("DeserializeMsgTx() got error '%v'", err)
+			}
+
+			replaced, err := s.DeserializeMsgTx(got)
+			if err != nil {
+				t.Fatalf("DeserializeMsgTx() got error '%v'", err)
+			}
+
+			if got.Hash != replaced.TxHash().String() || got.Hash == original.TxHash().String() {
+				t.Fatalf("ReplaceOutputAddress() got hash %s", got.Hash)
+			}
+
+			for idx, txOut := range replaced.TxOut {
+				if txOut.Value != original.TxOut[idx].Value {
+					t.Fatalf("ReplaceOutputAddress() got value %d for output %d, want %d",
+						txOut.Value, idx, original.TxOut[idx].Value)
+				}
+
+				address, err := s.ScriptToAddress(txOut.PkScript, tt.chainParams)
+				if err != nil {
+					t.Fatalf("ScriptToAddress() got error '%v'", err)
+				}
+
+				wantAddress, _ := s.ScriptToAddress(original.TxOut[idx].PkScript, tt.chainParams)
+				if idx == int(tt.outputIndex) {
+					wantAddress = tt.address
+				}
+
+				if address != wantAddress {
+					t.Fatalf("ReplaceOutputAddress() got address %s for output %d, want %s",
+						address, idx, wantAddress)
+				}
+			}
+		})
+	}
+}
+
+func TestEstimateTxSize(t *testing.T) {
+	decodeHex := func(hexStr string) []byte {
+		b, err := hex.DecodeString(hexStr)
+		if err != nil {
+			panic(err)
+		}
+		return b
+	}
+
+	p2pkh := decodeHex("76a914e18c90d108c3509e952c1d79121f1776facf1c6788ac")
+	p2wpkh := decodeHex("0014751e76e8199196d454941c45d1b3a323f1433bd6")
+	p2tr := decodeHex("5120147c9c57132f6e7ecddba9800bb0c4449251c92a1e60371ee77557b6620f3ea3")
+
+	tests := []struct {
+		name          string
+		utxoScripts   [][]byte
+		outputScripts [][]byte
+		want          TxSize
+	}{
+		{
+			// 82 bytes of non-witness data, and a 111-byte witness with
+			// the marker and flag.
+			name:          "P2WPKH 1-input 1-output",
+			utxoScripts:   [][]byte{p2wpkh},
+			outputScripts: [][]byte{p2wpkh},
+			want:          TxSize{Size: 193, Weight: 439, VirtualSize: 110},
+		},
+		{
+			name:          "P2WPKH 1-input 2-output",
+			utxoScripts:   [][]byte{p2wpkh},
+			outputScripts: [][]byte{p2wpkh, p2wpkh},
+			want:          TxSize{Size: 224, Weight: 563, VirtualSize: 141},
+		},
+		{
+			// Without witness data, the virtual size is the size.
+			name:          "P2PKH 1-input 2-output",
+			utxoScripts:   [][]byte{p2pkh},
+			outputScripts: [][]byte{p2pkh, p2pkh},
+			want:          TxSize{Size: 227, Weight: 908, VirtualSize: 227},
+		},
+		{
+			name:          "P2TR 1-input 1-output",
+			utxoScripts:   [][]byte{p2tr},
+			outputScripts: [][]byte{p2tr},
+			want:          TxSize{Size: 162, Weight: 444, VirtualSize: 111},
+		},
+		{
+			// The P2PKH input has an empty witness, i.e. a zero item count.
+			name:          "P2PKH and P2WPKH inputs",
+			utxoScripts:   [][]byte{p2pkh, p2wpkh},
+			outputScripts: [][]byte{p2wpkh},
+			want:          TxSize{Size: 343, Weight: 1036, VirtualSize: 259},
+		},
+	}
+
+	s := &Service{}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := s.EstimateTxSize(tt.utxoScripts, tt.outputScripts)
+			if got != tt.want {
+				t.Fatalf("EstimateTxSize() got %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSerializeNoWitness(t *testing.T) {
+	msgTx := wire.NewMsgTx(wire.TxVersion)
+	msgTx.AddTxIn(wire.NewTxIn(
+		wire.NewOutPoint(btcutil.NewTx(wire.NewMsgTx(1)).Hash(), 0),
+		nil,
+		wire.TxWitness{
+			{0x30, 0x44, 0x02, 0x20},
+			{0x02, 0x79, 0xbe, 0x66},
+		},
+	))
+	msgTx.AddTxOut(wire.NewTxOut(100000, []byte{0x00, 0x14}))
+
+	s := &Service{}
+
+	got, err := s.SerializeNoWitness(msgTx)
+	if err != nil {
+		t.Fatalf("SerializeNoWitness() got error '%v'", err)
+	}
+
+	full, err := encodeMsgTx(msgTx)
+	if err != nil {
+		t.Fatalf("encodeMsgTx() got error '%v'", err)
+	}
+
+	if got.Hex == full.Hex {
+		t.Fatalf("SerializeNoWitness() got the serialization with witness %s", got.Hex)
+	}
+
+	if got.Hex != full.StrippedHex {
+		t.Fatalf("SerializeNoWitness() got hex %s, want %s", got.Hex, full.StrippedHex)
+	}
+
+	// With witness data, the wtxid commits to it, unlike the txid.
+	if full.WitnessHash == full.Hash {
+		t.Fatalf("encodeMsgTx() got witness hash %s, want it to differ from txid",
+			full.WitnessHash)
+	}
+
+	if got.Hash != full.Hash || got.WitnessHash != full.Hash {
+		t.Fatalf("SerializeNoWitness() got hashes %s and %s, want txid %s",
+			got.Hash, got.WitnessHash, full.Hash)
+	}
+
+	// The stripped serialization lacks the marker, flag and witness data.
+	decoded, err := s.DecodeRawTransaction(got.Hex)
+	if err != nil {
+		t.Fatalf("DecodeRawTransaction() got error '%v'", err)
+	}
+
+	if decoded.SegwitSerialized || decoded.MsgTx.HasWitness() {
+		t.Fatalf("SerializeNoWitness() got a serialization with witness data")
+	}
+
+	if decoded.Hash != full.Hash {
+		t.Fatalf("DecodeRawTransaction() got txid %s, want %s", decoded.Hash, full.Hash)
+	}
+}
+
+func TestSignAndVerifyTransaction(t *testing.T) {
+	// BIP0032: Test Vector 1 (chain m)
+	privKey := "xprv9s21ZrQH143K3QTDL4LXw2F7HEK3wJUD2nW2nRk4stbPy6cq3jPPqjiChkVvvNKmPGJxWUtg6LnF5kejMRNNU3TGtRBeJgk33yuGBxrMPHi"
+
+	s := &Service{}
+
+	// Helper to derive the public key of an input, and the P2WPKH script
+	// locking the utxo it spends.
+	getInputKey := func(derivation []uint32) (*btcec.PublicKey, []byte) {
+		keyMaterial, err := s.DerivePrivateKey(privKey, derivation)
+		if err != nil {
+			panic(err)
+		}
+
+		pubKey, err := btcec.ParsePubKey(keyMaterial.PublicKey)
+		if err != nil {
+			panic(err)
+		}
+
+		address, err := btcutil.NewAddressWitnessPubKeyHash(
+			btcutil.Hash160(keyMaterial.PublicKey), chaincfg.BitcoinMainNetParams)
+		if err != nil {
+			panic(err)
+		}
+
+		script, err := txscript.PayToAddrScript(address)
+		if err != nil {
+			panic(err)
+		}
+
+		return pubKey, script
+	}
+
+	pubKey0, script0 := getInputKey([]uint32{0})
+	pubKey1, script1 := getInputKey([]uint32{1})
+
+	newMsgTx := func() *wire.MsgTx {
+		msgTx := wire.NewMsgTx(wire.TxVersion)
+		for idx := uint32(0); idx < 2; idx++ {
+			msgTx.AddTxIn(wire.NewTxIn(
+				wire.NewOutPoint(btcutil.NewTx(wire.NewMsgTx(1)).Hash(), idx),
+				nil,
+				nil,
+			))
+		}
+		msgTx.AddTxOut(wire.NewTxOut(150000, script0))
+		return msgTx
+	}
+
+	utxos := []Utxo{
+		{Script: script0, Value: 100000, Derivation: []uint32{0}},
+		{Script: script1, Value: 60000, Derivation: []uint32{1}},
+	}
+
+	tests := []struct {
+		name          string
+		signatures    []SignatureMetadata
+		wantFailedIdx []int
+	}{
+		{
+			name: "all inputs verify",
+			signatures: []SignatureMetadata{
+				{PubKey: pubKey0, AddrEncoding: NativeSegwit},
+				{PubKey: pubKey1, AddrEncoding: NativeSegwit},
+			},
+		},
+		{
+			name: "second input has the wrong public key",
+			signatures: []SignatureMetadata{
+				{PubKey: pubKey0, AddrEncoding: NativeSegwit},
+				{PubKey: pubKey0, AddrEncoding: NativeSegwit},
+			},
+			wantFailedIdx: []int{1},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			msgTx := newMsgTx()
+
+			got, err := s.SignAndVerifyTransaction(
+				msgTx, utxos, privKey, tt.signatures, chaincfg.BitcoinMainNetParams)
+
+			for _, txIn := range msgTx.TxIn {
+				if len(txIn.Witness) != 0 || len(txIn.SignatureScript) != 0 {
+					t.Fatal("SignAndVerifyTransaction() modified the input transaction")
+				}
+			}
+
+			if len(tt.wantFailedIdx) == 0 {
+				if err != nil {
+					t.Fatalf("SignAndVerifyTransaction() got error '%v'", err)
+				}
+
+				if got == nil || len(got.Hex) == 0 {
+					t.Fatal("SignAndVerifyTransaction() got empty raw tx")
+				}
+
+				return
+			}
+
+			if got != nil {
+				t.Fatalf("SignAndVerifyTransaction() got raw tx %v, want nil", got)
+			}
+
+			verificationErr, ok := errors.Cause(err).(*VerificationError)
+			if !ok {
+				t.Fatalf("SignAndVerifyTransaction() got error '%v', want *VerificationError", err)
+			}
+
+			var gotFailedIdx []int
+			for _, failure := range verificationErr.Failures {
+				gotFailedIdx = append(gotFailedIdx, failure.InputIndex)
+			}
+
+			if !reflect.DeepEqual(gotFailedIdx, tt.wantFailedIdx) {
+				t.Fatalf("SignAndVerifyTransaction() got failed inputs %v, want %v",
+					gotFailedIdx, tt.wantFailedIdx)
+			}
+		})
+	}
+}
+
+func TestDeserializeMsgTx(t *testing.T) {
+	msgTx := wire.NewMsgTx(wire.TxVersion)
+	msgTx.AddTxIn(wire.NewTxIn(
+		wire.NewOutPoint(btcutil.NewTx(wire.NewMsgTx(1)).Hash(), 0),
+		nil,
+		nil,
+	))
+	msgTx.AddTxOut(wire.NewTxOut(100000, []byte{0x00, 0x14}))
+
+	var buf bytes.Buffer
+	if err := msgTx.Serialize(&buf); err != nil {
+		t.Fatalf("Serialize() got error '%v'", err)
+	}
+
+	rawTxHex := hex.EncodeToString(buf.Bytes())
+
+	tests := []struct {
+		name      string
+		rawTxHex  string
+		wantErr   bool
+		wantInErr string
+	}{
+		{
+			name:     "valid raw tx",
+			rawTxHex: rawTxHex,
+		},
+		{
+			name:      "truncated raw tx",
+			rawTxHex:  rawTxHex[:len(rawTxHex)-10],
+			wantErr:   true,
+			wantInErr: "failed to deserialize raw tx",
+		},
+		{
+			name:      "empty raw tx",
+			rawTxHex:  "",
+			wantErr:   true,
+			wantInErr: "failed to deserialize raw tx",
+		},
+	}
+
+	s := &Service{}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := s.DeserializeMsgTx(&RawTx{Hex: tt.rawTxHex})
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("DeserializeMsgTx() got error '%v', want error %v",
+					err, tt.wantErr)
+			}
+
+			if tt.wantErr {
+				if got != nil || !strings.Contains(err.Error(), tt.wantInErr) {
+					t.Fatalf("DeserializeMsgTx() got '%v', error '%v', want nil tx and "+
+						"error containing '%s'", got, err, tt.wantInErr)
+				}
+
+				return
+			}
+
+			if got.TxHash() != msgTx.TxHash() {
+				t.Fatalf("DeserializeMsgTx() got tx %s, want %s",
+					got.TxHash(), msgTx.TxHash())
+			}
+		})
+	}
+}
+
+func TestDecodeTransaction(t *testing.T) {
+	// Mainnet transaction f4184fc596403b9d638783cf57adfe4c75c605f6356fbc91338530e9831e9e16,
+	// from block 170, paying to two P2PK outputs.
+	rawTxHex := "0100000001c997a5e56e104102fa209c6a852dd90660a20b2d9c352423edce25857fcd3704000000004847304402204e45e16932b8af514961a1d3a1a25fdf3f4f7732e9d624c6c61548ab5fb8cd410220181522ec8eca07de4860a4acdd12909d831cc56cbbac4622082221a8768d1d0901ffffffff0200ca9a3b00000000434104ae1a62fe09c5f51b13905f07f06b99a2f7159b2225f374cd378d71302fa28414e7aab37397f554a7df5f142c21c1b7303b8a0626f1baded5c72a704f7e6cd84cac00286bee0000000043410411db93e1dcdb8a016b49840f8c53bc1eb68a382e97b1482ecad7b148a6909a5cb2e0eaddfb84ccf9744464f82e160bfa9b8b64f9d4c03f999b8643f656b412a3ac00000000"
+
+	s := &Service{}
+
+	got, err := s.DecodeTransaction(rawTxHex, nil, chaincfg.BitcoinMainNetParams)
+	if err != nil {
+		t.Fatalf("DecodeTransaction() got error '%v'", err)
+	}
+
+	if got.Version != 1 || got.LockTime != 0 {
+		t.Fatalf("DecodeTransaction() got version %d, lock time %d, want 1, 0",
+			got.Version, got.LockTime)
+	}
+
+	wantInputs := []DecodedTxInput{
+		{
+			OutputHash:  "0437cd7f8525ceed2324359c2d0ba26006d92d856a9c20fa0241106ee5a597c9",
+			OutputIndex: 0,
+			Sequence:    wire.MaxTxInSequenceNum,
+		},
+	}
+
+	if !reflect.DeepEqual(got.Inputs, wantInputs) {
+		t.Fatalf("DecodeTransaction() got inputs '%v', want '%v'",
+			got.Inputs, wantInputs)
+	}
+
+	wantOutputs := []struct {
+		value     int64
+		addresses []string
+	}{
+		{value: 1000000000, addresses: []string{"1Q2TWHE3GMdB6BZKafqwxXtWAWgFt5Jvm3"}},
+		{value: 4000000000, addresses: []string{"12cbQLTFMXRnSzktFkuoG3eHoMeFtpTu3S"}},
+	}
+
+	if len(got.Outputs) != len(wantOutputs) {
+		t.Fatalf("DecodeTransaction() got %d outputs, want %d",
+			len(got.Outputs), len(wantOutputs))
+	}
+
+	for idx, output := range got.Outputs {
+		if output.Value != wantOutputs[idx].value ||
+			!reflect.DeepEqual(output.Addresses, wantOutputs[idx].addresses) {
+			t.Fatalf("DecodeTransaction() got output %d '%v', want '%v'",
+				idx, output, wantOutputs[idx])
+		}
+	}
+
+	if _, err := s.DecodeTransaction(rawTxHex[:100], nil, chaincfg.BitcoinMainNetParams); err == nil {
+		t.Fatalf("DecodeTransaction() got no error for truncated raw tx")
+	}
+}
+
+func TestDecodeTransaction_Prevouts(t *testing.T) {
+	const outputHash = "2f5dae23c2e18588c86cfc4e154f3b68bd8eb4265fe0b4b1341ad5aa40422f66"
+
+	p2wpkhScript, _ := hex.DecodeString("0014c0cebcd6c3d3ca8c75dc5ec62ebe55330ef910e2")
+
+	inputs := []Input{
+		{OutputHash: outputHash, OutputIndex: 0, Script: p2wpkhScript, Value: 60000},
+		{OutputHash: outputHash, OutputIndex: 1, Script: p2wpkhScript, Value: 70000},
+	}
+
+	s := &Service{}
+
+	got, err := s.CreateTransaction(&Tx{
+		Inputs: inputs,
+		Outputs: []Output{
+			{
+				Address: "1MZbRqZGpiSWGRLg8DUdVrDKHwNe1oesUZ",
+				Value:   100000,
+			},
+		},
+		ChangeAddress: "1GgX4cGLiqF9p4Sd1XcPQhEAAhNDA4wLYS",
+		FeeSatPerKb:   1000,
+	}, chaincfg.BitcoinMainNetParams)
+	if err != nil {
+		t.Fatalf("CreateTransaction() got error '%v'", err)
+	}
+
+	tests := []struct {
+		name           string
+		prevouts       []Input
+		wantHasFee     bool
+		wantTotalInput int64
+		wantFee        int64
+		wantErr        bool
+	}{
+		{
+			name: "no prevouts",
+		},
+		{
+			name:     "prevout of one input",
+			prevouts: inputs[1:],
+		},
+		{
+			name:           "prevouts of all inputs",
+			prevouts:       []Input{inputs[1], inputs[0]},
+			wantHasFee:     true,
+			wantTotalInput: 130000,
+			wantFee:        got.TotalFees,
+		},
+		{
+			name: "prevout not spent",
+			prevouts: append([]Input{
+				{OutputHash: outputHash, OutputIndex: 2, Value: 10000},
+			}, inputs...),
+			wantErr: true,
+		},
+		{
+			name: "prevouts worth less than the outputs",
+			prevouts: []Input{
+				inputs[0],
+				{OutputHash: outputHash, OutputIndex: 1, Value: 1000},
+			},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			decoded, err := s.DecodeTransaction(got.RawTx.Hex, tt.prevouts, chaincfg.BitcoinMainNetParams)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("DecodeTransaction() got error '%v', want error %v", err, tt.wantErr)
+			}
+
+			if tt.wantErr {
+				return
+			}
+
+			if decoded.HasFee != tt.wantHasFee || decoded.TotalInput != tt.wantTotalInput ||
+				decoded.Fee != tt.wantFee {
+				t.Fatalf("DecodeTransaction() got has fee %v, total input %d, fee %d, "+
+					"want %v, %d, %d", decoded.HasFee, decoded.TotalInput, decoded.Fee,
+					tt.wantHasFee, tt.wantTotalInput, tt.wantFee)
+			}
+
+			if wantTotalOutput := 100000 + got.Change; decoded.TotalOutput != wantTotalOutput {
+				t.Fatalf("DecodeTransaction() got total output %d, want %d",
+					decoded.TotalOutput, wantTotalOutput)
+			}
+
+			// The prevouts are echoed in the inputs spending them.
+			for _, input := range decoded.Inputs {
+				var want DecodedTxInput
+
+				for _, prevout := range tt.prevouts {
+					if prevout.OutputHash == input.OutputHash && prevout.OutputIndex == input.OutputIndex {
+						want = DecodedTxInput{Script: prevout.Script, Value: prevout.Value}
+					}
+				}
+
+				if !bytes.Equal(input.Script, want.Script) || input.Value != want.Value {
+					t.Fatalf("DecodeTransaction() got input %s:%d with script %x and value %d, "+
+						"want %x and %d", input.OutputHash, input.OutputIndex, input.Script,
+						input.Value, want.Script, want.Value)
+				}
+			}
+		})
+	}
+}
+
+func TestComputeCpfpFee(t *testing.T) {
+	// Mainnet transaction f4184fc596403b9d638783cf57adfe4c75c605f6356fbc91338530e9831e9e16,
+	// from block 170: 275 vbytes, without fees.
+	block170TxHex := "0100000001c997a5e56e104102fa209c6a852dd90660a20b2d9c352423edce25857fcd3704000000004847304402204e45e16932b8af514961a1d3a1a25fdf3f4f7732e9d624c6c61548ab5fb8cd410220181522ec8eca07de4860a4acdd12909d831cc56cbbac4622082221a8768d1d0901ffffffff0200ca9a3b00000000434104ae1a62fe09c5f51b13905f07f06b99a2f7159b2225f374cd378d71302fa28414e7aab37397f554a7df5f142c21c1b7303b8a0626f1baded5c72a704f7e6cd84cac00286bee0000000043410411db93e1dcdb8a016b49840f8c53bc1eb68a382e97b1482ecad7b148a6909a5cb2e0eaddfb84ccf9744464f82e160bfa9b8b64f9d4c03f999b8643f656b412a3ac00000000"
+
+	tests := []struct {
+		name               string
+		parentHex          string
+		parentFee          int64
+		parentVsize        int
+		childVsize         int
+		targetRateSatPerKb int64
+		want               int64
+		wantErr            bool
+	}{
+		{
+			name:               "parent below target rate",
+			parentFee:          200,
+			parentVsize:        200,
+			childVsize:         150,
+			targetRateSatPerKb: 10000,
+			want:               3300,
+		},
+		{
+			name:               "parent at target rate",
+			parentFee:          2000,
+			parentVsize:        200,
+			childVsize:         150,
+			targetRateSatPerKb: 10000,
+			want:               1500,
+		},
+		{
+			name:               "parent above target rate",
+			parentFee:          5000,
+			parentVsize:        200,
+			childVsize:         100,
+			targetRateSatPerKb: 5000,
+			want:               500,
+		},
+		{
+			name:               "parent size from raw tx",
+			parentHex:          block170TxHex,
+			childVsize:         141,
+			targetRateSatPerKb: 10000,
+			want:               4160,
+		},
+		{
+			name:               "invalid parent raw tx",
+			parentHex:          "0100",
+			childVsize:         141,
+			targetRateSatPerKb: 10000,
+			wantErr:            true,
+		},
+		{
+			name:               "zero target rate",
+			parentVsize:        200,
+			childVsize:         141,
+			targetRateSatPerKb: 0,
+			wantErr:            true,
+		},
+		{
+			name:               "negative parent fee",
+			parentFee:          -1,
+			parentVsize:        200,
+			childVsize:         141,
+			targetRateSatPerKb: 10000,
+			wantErr:            true,
+		},
+		{
+			name:               "zero child size",
+			parentVsize:        200,
+			targetRateSatPerKb: 10000,
+			wantErr:            true,
+		},
+	}
+
+	s := &Service{}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := s.ComputeCpfpFee(
+				tt.parentHex, tt.parentFee, tt.parentVsize, tt.childVsize, tt.targetRateSatPerKb)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ComputeCpfpFee() got error '%v', want error %v", err, tt.wantErr)
+			}
+
+			if got != tt.want {
+				t.Fatalf("ComputeCpfpFee() got %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSignAndVerifyTransaction_Taproot(t *testing.T) {
+	// BIP0032: Test Vector 1 (chain m)
+	privKey := "xprv9s21ZrQH143K3QTDL4LXw2F7HEK3wJUD2nW2nRk4stbPy6cq3jPPqjiChkVvvNKmPGJxWUtg6LnF5kejMRNNU3TGtRBeJgk33yuGBxrMPHi"
+
+	s := &Service{}
+
+	// Helper to derive the public key of an input, and the P2TR script
+	// locking the utxo it spends, from its Taproot address.
+	getInputKey := func(derivation []uint32) (*btcec.PublicKey, []byte) {
+		keyMaterial, err := s.DerivePrivateKey(privKey, derivation)
+		if err != nil {
+			panic(err)
+		}
+
+		pubKey, err := btcec.ParsePubKey(keyMaterial.PublicKey)
+		if err != nil {
+			panic(err)
+		}
+
+		address, err := addressFromPublicKey(pubKey, Taproot, chaincfg.BitcoinMainNetParams)
+		if err != nil {
+			panic(err)
+		}
+
+		encodedAddress, err := s.EncodeAddress(
+			keyMaterial.PublicKey, Taproot, true, chaincfg.BitcoinMainNetParams)
+		if err != nil || encodedAddress != address.EncodeAddress() {
+			panic("unexpected taproot address")
+		}
+
+		script, err := txscript.NewScriptBuilder().
+			AddOp(txscript.OP_1).AddData(address.ScriptAddress()).Script()
+		if err != nil {
+			panic(err)
+		}
+
+		return pubKey, script
+	}
+
+	pubKey0, script0 := getInputKey([]uint32{0})
+	pubKey1, script1 := getInputKey([]uint32{1})
+
+	msgTx := wire.NewMsgTx(wire.TxVersion)
+	for idx := uint32(0); idx < 2; idx++ {
+		msgTx.AddTxIn(wire.NewTxIn(
+			wire.NewOutPoint(btcutil.NewTx(wire.NewMsgTx(1)).Hash(), idx),
+			nil,
+			nil,
+		))
+	}
+	msgTx.AddTxOut(wire.NewTxOut(150000, script0))
+
+	tests := []struct {
+		name    string
+		utxos   []Utxo
+		wantErr error
+	}{
+		{
+			name: "key-path spends",
+			utxos: []Utxo{
+				{Script: script0, Value: 100000, Derivation: []uint32{0}},
+				{Script: script1, Value: 60000, Derivation: []uint32{1}},
+			},
+		},
+		{
+			name: "private key does not match the output key",
+			utxos: []Utxo{
+				{Script: script0, Value: 100000, Derivation: []uint32{0}},
+				{Script: script1, Value: 60000, Derivation: []uint32{0}},
+			},
+			wantErr: ErrPublicKeyMismatch,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			signatures := []SignatureMetadata{
+				{PubKey: pubKey0, AddrEncoding: Taproot},
+				{PubKey: pubKey1, AddrEncoding: Taproot},
+			}
+
+			got, err := s.SignAndVerifyTransaction(
+				msgTx, tt.utxos, privKey, signatures, chaincfg.BitcoinMainNetParams)
+			if tt.wantErr != nil {
+				if errors.Cause(err) != tt.wantErr {
+					t.Fatalf("SignAndVerifyTransaction() got error '%v', want '%v'",
+						err, tt.wantErr)
+				}
+
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("SignAndVerifyTransaction() got error '%v'", err)
+			}
+
+			decodedTx, err := s.DecodeRawTransaction(got.Hex)
+			if err != nil {
+				t.Fatalf("DecodeRawTransaction() got error '%v'", err)
+			}
+
+			for idx, txIn := range decodedTx.MsgTx.TxIn {
+				if len(txIn.SignatureScript) != 0 {
+					t.Fatalf("input %d got non-empty signature script", idx)
+				}
+
+				if len(txIn.Witness) != 1 || len(txIn.Witness[0]) != 64 {
+					t.Fatalf("input %d got witness %x, want a single 64-byte signature",
+						idx, txIn.Witness)
+				}
+			}
+		})
+	}
+}
+
+func TestGenerateDerSignatures_PreviousTx(t *testing.T) {
+	// BIP0032: Test Vector 1 (chain m)
+	privKey := "xprv9s21ZrQH143K3QTDL4LXw2F7HEK3wJUD2nW2nRk4stbPy6cq3jPPqjiChkVvvNKmPGJxWUtg6LnF5kejMRNNU3TGtRBeJgk33yuGBxrMPHi"
+
+	s := &Service{}
+
+	keyMaterial, err := s.DerivePrivateKey(privKey, []uint32{0})
+	if err != nil {
+		t.Fatalf("DerivePrivateKey() got error '%v'", err)
+	}
+
+	address, err := btcutil.NewAddressPubKeyHash(
+		btcutil.Hash160(keyMaterial.PublicKey), chaincfg.BitcoinMainNetParams)
+	if err != nil {
+		t.Fatalf("NewAddressPubKeyHash() got error '%v'", err)
+	}
+
+	script, err := txscript.PayToAddrScript(address)
+	if err != nil {
+		t.Fatalf("PayToAddrScript() got error '%v'", err)
+	}
+
+	// Previous transaction paying to the P2PKH script in its second output.
+	prevTx := wire.NewMsgTx(wire.TxVersion)
+	prevTx.AddTxIn(wire.NewTxIn(
+		wire.NewOutPoint(btcutil.NewTx(wire.NewMsgTx(1)).Hash(), 0),
+		nil,
+		nil,
+	))
+	prevTx.AddTxOut(wire.NewTxOut(50000, script))
+	prevTx.AddTxOut(wire.NewTxOut(100000, script))
+
+	var buf bytes.Buffer
+	if err := prevTx.Serialize(&buf); err != nil {
+		t.Fatalf("Serialize() got error '%v'", err)
+	}
+
+	prevTxHash := prevTx.TxHash()
+
+	tests := []struct {
+		name     string
+		outPoint *wire.OutPoint
+		utxo     Utxo
+		wantErr  error
+	}{
+		{
+			name:     "matching previous tx",
+			outPoint: wire.NewOutPoint(&prevTxHash, 1),
+			utxo:     Utxo{Script: script, Value: 100000, PreviousTx: buf.Bytes()},
+		},
+		{
+			name:     "no previous tx",
+			outPoint: wire.NewOutPoint(&prevTxHash, 1),
+			utxo:     Utxo{Script: script, Value: 100000},
+		},
+		{
+			name:     "previous tx hash mismatch",
+			outPoint: wire.NewOutPoint(btcutil.NewTx(wire.NewMsgTx(1)).Hash(), 1),
+			utxo:     Utxo{Script: script, Value: 100000, PreviousTx: buf.Bytes()},
+			wantErr:  ErrPreviousTxMismatch,
+		},
+		{
+			name:     "output index out of range",
+			outPoint: wire.NewOutPoint(&prevTxHash, 2),
+			utxo:     Utxo{Script: script, Value: 100000, PreviousTx: buf.Bytes()},
+			wantErr:  ErrPreviousTxMismatch,
+		},
+		{
+			name:     "forged value",
+			outPoint: wire.NewOutPoint(&prevTxHash, 0),
+			utxo:     Utxo{Script: script, Value: 100000, PreviousTx: buf.Bytes()},
+			wantErr:  ErrPreviousTxMismatch,
+		},
+		{
+			name:     "forged script",
+			outPoint: wire.NewOutPoint(&prevTxHash, 1),
+			utxo:     Utxo{Script: script[:len(script)-1], Value: 100000, PreviousTx: buf.Bytes()},
+			wantErr:  ErrPreviousTxMismatch,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			msgTx := wire.NewMsgTx(wire.TxVersion)
+			msgTx.AddTxIn(wire.NewTxIn(tt.outPoint, nil, nil))
+			msgTx.AddTxOut(wire.NewTxOut(90000, script))
+
+			tt.utxo.Derivation = []uint32{0}
+
+			derSignatures, err := s.GenerateDerSignatures(msgTx, []Utxo{tt.utxo}, privKey, false)
+			if tt.wantErr != nil {
+				if errors.Cause(err) != tt.wantErr {
+					t.Fatalf("GenerateDerSignatures() got error '%v', want '%v'",
+						err, tt.wantErr)
+				}
+
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("GenerateDerSignatures() got error '%v'", err)
+			}
+
+			if len(derSignatures) != 1 {
+				t.Fatalf("GenerateDerSignatures() got %d signatures, want 1",
+					len(derSignatures))
+			}
+		})
+	}
+}
+
+func TestGenerateDerSignatures_GrindLowR(t *testing.T) {
+	// BIP0032: Test Vector 1 (chain m)
+	privKey := "xprv9s21ZrQH143K3QTDL4LXw2F7HEK3wJUD2nW2nRk4stbPy6cq3jPPqjiChkVvvNKmPGJxWUtg6LnF5kejMRNNU3TGtRBeJgk33yuGBxrMPHi"
+
+	s := &Service{}
+
+	keyMaterial, err := s.DerivePrivateKey(privKey, []uint32{0})
+	if err != nil {
+		t.Fatalf("DerivePrivateKey() got error '%v'", err)
+	}
+
+	pubKey, err := btcec.ParsePubKey(keyMaterial.PublicKey)
+	if err != nil {
+		t.Fatalf("ParsePubKey() got error '%v'", err)
+	}
+
+	p2pkhAddress, _ := btcutil.NewAddressPubKeyHash(
+		btcutil.Hash160(keyMaterial.PublicKey), chaincfg.BitcoinMainNetParams)
+	p2pkhScript, _ := txscript.PayToAddrScript(p2pkhAddress)
+
+	p2wpkhAddress, _ := btcutil.NewAddressWitnessPubKeyHash(
+		btcutil.Hash160(keyMaterial.PublicKey), chaincfg.BitcoinMainNetParams)
+	p2wpkhScript, _ := txscript.PayToAddrScript(p2wpkhAddress)
+
+	utxos := []Utxo{
+		{Script: p2pkhScript, Value: 100000, Derivation: []uint32{0}},
+		{Script: p2wpkhScript, Value: 100000, Derivation: []uint32{0}},
+	}
+
+	highR := 0
+
+	for iteration := 0; iteration < 100; iteration++ {
+		// Every iteration signs a distinct transaction.
+		msgTx := wire.NewMsgTx(wire.TxVersion)
+		for idx := range utxos {
+			msgTx.AddTxIn(wire.NewTxIn(
+				wire.NewOutPoint(btcutil.NewTx(wire.NewMsgTx(1)).Hash(), uint32(idx)),
+				nil,
+				nil,
+			))
+		}
+		msgTx.AddTxOut(wire.NewTxOut(int64(150000+iteration), p2wpkhScript))
+
+		derSignatures, err := s.GenerateDerSignatures(msgTx, utxos, privKey, false)
+		if err != nil {
+			t.Fatalf("GenerateDerSignatures() got error '%v'", err)
+		}
+
+		lowRSignatures, err := s.GenerateDerSignatures(msgTx, utxos, privKey, true)
+		if err != nil {
+			t.Fatalf("GenerateDerSignatures() got error '%v'", err)
+		}
+
+		for idx, lowRSignature := range lowRSignatures {
+			if len(lowRSignature) > 71 {
+				t.Fatalf("GenerateDerSignatures() got %d-byte signature %x for input %d, want at most 71 bytes",
+					len(lowRSignature), lowRSignature, idx)
+			}
+
+			// The first nonce is the RFC6979 nonce used by btcec, so that
+			// signatures which already have a low R value are unchanged.
+			if len(derSignatures[idx]) <= 71 && !bytes.Equal(lowRSignature, derSignatures[idx]) {
+				t.Fatalf("GenerateDerSignatures() got signature %x for input %d, want %x",
+					lowRSignature, idx, derSignatures[idx])
+			}
+
+			if len(derSignatures[idx]) > 71 {
+				highR++
+			}
+		}
+
+		_, err = s.SignTransaction(msgTx, chaincfg.BitcoinMainNetParams, []SignatureMetadata{
+			{DerSig: lowRSignatures[0], PubKey: pubKey, AddrEncoding: Legacy},
+			{DerSig: lowRSignatures[1], PubKey: pubKey, AddrEncoding: NativeSegwit},
+		})
+		if err != nil {
+			t.Fatalf("SignTransaction() got error '%v'", err)
+		}
+
+		if failures := verifyInputs(msgTx, utxos); len(failures) > 0 {
+			t.Fatalf("verifyInputs() got failures %v", failures)
+		}
+	}
+
+	// About half of the signatures have a high R value without grinding.
+	if highR == 0 {
+		t.Fatalf("GenerateDerSignatures() got no high R signature without grinding")
+	}
+}
+
+func TestSignTransaction_LegacyP2PKH(t *testing.T) {
+	// BIP0032: Test Vector 1 (chain m)
+	privKey := "xprv9s21ZrQH143K3QTDL4LXw2F7HEK3wJUD2nW2nRk4stbPy6cq3jPPqjiChkVvvNKmPGJxWUtg6LnF5kejMRNNU3TGtRBeJgk33yuGBxrMPHi"
+
+	s := &Service{}
+
+	keyMaterial, err := s.DerivePrivateKey(privKey, []uint32{0})
+	if err != nil {
+		t.Fatalf("DerivePrivateKey() got error '%v'", err)
+	}
+
+	pubKey, err := btcec.ParsePubKey(keyMaterial.PublicKey)
+	if err != nil {
+		t.Fatalf("ParsePubKey() got error '%v'", err)
+	}
+
+	address, err := btcutil.NewAddressPubKeyHash(
+		btcutil.Hash160(keyMaterial.PublicKey), chaincfg.BitcoinMainNetParams)
+	if err != nil {
+		t.Fatalf("NewAddressPubKeyHash() got error '%v'", err)
+	}
+
+	script, err := txscript.PayToAddrScript(address)
+	if err != nil {
+		t.Fatalf("PayToAddrScript() got error '%v'", err)
+	}
+
+	msgTx := wire.NewMsgTx(wire.TxVersion)
+	msgTx.AddTxIn(wire.NewTxIn(
+		wire.NewOutPoint(btcutil.NewTx(wire.NewMsgTx(1)).Hash(), 0),
+		nil,
+		nil,
+	))
+	msgTx.AddTxOut(wire.NewTxOut(90000, script))
+
+	utxo := Utxo{Script: script, Value: 100000, Derivation: []uint32{0}}
+
+	derSignatures, err := s.GenerateDerSignatures(msgTx, []Utxo{utxo}, privKey, false)
+	if err != nil {
+		t.Fatalf("GenerateDerSignatures() got error '%v'", err)
+	}
+
+	rawTx, err := s.SignTransaction(msgTx, chaincfg.BitcoinMainNetParams, []SignatureMetadata{
+		{DerSig: derSignatures[0], PubKey: pubKey, AddrEncoding: Legacy},
+	})
+	if err != nil {
+		t.Fatalf("SignTransaction() got error '%v'", err)
+	}
+
+	if len(msgTx.TxIn[0].Witness) != 0 {
+		t.Fatalf("SignTransaction() got witness %x, want none", msgTx.TxIn[0].Witness)
+	}
+
+	// Without witness data, the wtxid is the txid, and the transaction is
+	// serialized in the legacy format.
+	if rawTx.WitnessHash != rawTx.Hash || rawTx.Hash != msgTx.TxHash().String() {
+		t.Fatalf("SignTransaction() got hash %s and witness hash %s, want txid %s",
+			rawTx.Hash, rawTx.WitnessHash, msgTx.TxHash())
+	}
+
+	if rawTx.Hex != rawTx.StrippedHex {
+		t.Fatalf("SignTransaction() got hex %s, want stripped hex %s",
+			rawTx.Hex, rawTx.StrippedHex)
+	}
+
+	decoded, err := s.DecodeRawTransaction(rawTx.Hex)
+	if err != nil {
+		t.Fatalf("DecodeRawTransaction() got error '%v'", err)
+	}
+
+	if decoded.SegwitSerialized || decoded.WitnessHash != rawTx.Hash {
+		t.Fatalf("DecodeRawTransaction() got witness hash %s, want txid %s",
+			decoded.WitnessHash, rawTx.Hash)
+	}
+
+	// Verify the input without any of the segwit script flags.
+	preSegwitFlags := txscript.ScriptBip16 |
+		txscript.ScriptVerifyDERSignatures |
+		txscript.ScriptVerifyStrictEncoding |
+		txscript.ScriptVerifyLowS |
+		txscript.ScriptVerifyCheckLockTimeVerify
+
+	engine, err := txscript.NewEngine(script, msgTx, 0, preSegwitFlags, nil, nil, utxo.Value,
+		txscript.NewCannedPrevOutputFetcher(script, utxo.Value))
+	if err != nil {
+		t.Fatalf("NewEngine() got error '%v'", err)
+	}
+
+	if err := engine.Execute(); err != nil {
+		t.Fatalf("Execute() got error '%v'", err)
+	}
+}
+
+func TestSignTransaction_UncompressedP2PKH(t *testing.T) {
+	// BIP0032: Test Vector 1 (chain m)
+	privKey := "xprv9s21ZrQH143K3QTDL4LXw2F7HEK3wJUD2nW2nRk4stbPy6cq3jPPqjiChkVvvNKmPGJxWUtg6LnF5kejMRNNU3TGtRBeJgk33yuGBxrMPHi"
+
+	s := &Service{}
+
+	keyMaterial, err := s.DerivePrivateKey(privKey, []uint32{0})
+	if err != nil {
+		t.Fatalf("DerivePrivateKey() got error '%v'", err)
+	}
+
+	pubKey, err := btcec.ParsePubKey(keyMaterial.PublicKey)
+	if err != nil {
+		t.Fatalf("ParsePubKey() got error '%v'", err)
+	}
+
+	// The utxo pays to the hash of the uncompressed public key.
+	address, err := btcutil.NewAddressPubKeyHash(
+		btcutil.Hash160(pubKey.SerializeUncompressed()), chaincfg.BitcoinMainNetParams)
+	if err != nil {
+		t.Fatalf("NewAddressPubKeyHash() got error '%v'", err)
+	}
+
+	script, err := txscript.PayToAddrScript(address)
+	if err != nil {
+		t.Fatalf("PayToAddrScript() got error '%v'", err)
+	}
+
+	msgTx := wire.NewMsgTx(wire.TxVersion)
+	msgTx.AddTxIn(wire.NewTxIn(
+		wire.NewOutPoint(btcutil.NewTx(wire.NewMsgTx(1)).Hash(), 0),
+		nil,
+		nil,
+	))
+	msgTx.AddTxOut(wire.NewTxOut(90000, script))
+
+	utxo := Utxo{Script: script, Value: 100000, Derivation: []uint32{0}}
+
+	derSignatures, err := s.GenerateDerSignatures(msgTx, []Utxo{utxo}, privKey, false)
+	if err != nil {
+		t.Fatalf("GenerateDerSignatures() got error '%v'", err)
+	}
+
+	// Uncompressed public keys are only allowed in P2PKH inputs.
+	_, err = s.SignTransaction(msgTx, chaincfg.BitcoinMainNetParams, []SignatureMetadata{
+		{DerSig: derSignatures[0], PubKey: pubKey, AddrEncoding: NativeSegwit, UncompressedPubKey: true},
+	})
+	if errors.Cause(err) != ErrUncompressedPublicKey {
+		t.Fatalf("SignTransaction() got error '%v', want '%v'", err, ErrUncompressedPublicKey)
+	}
+
+	_, err = s.SignTransaction(msgTx, chaincfg.BitcoinMainNetParams, []SignatureMetadata{
+		{DerSig: derSignatures[0], PubKey: pubKey, AddrEncoding: Legacy, UncompressedPubKey: true},
+	})
+	if err != nil {
+		t.Fatalf("SignTransaction() got error '%v'", err)
+	}
+
+	pushes, err := txscript.PushedData(msgTx.TxIn[0].SignatureScript)
+	if err != nil {
+		t.Fatalf("PushedData() got error '%v'", err)
+	}
+
+	if len(pushes) != 2 || !bytes.Equal(pushes[1], pubKey.SerializeUncompressed()) {
+		t.Fatalf("SignTransaction() got sigScript %x, want the uncompressed public key %x",
+			msgTx.TxIn[0].SignatureScript, pubKey.SerializeUncompressed())
+	}
+
+	engine, err := txscript.NewEngine(script, msgTx, 0, txscript.StandardVerifyFlags, nil, nil, utxo.Value,
+		txscript.NewCannedPrevOutputFetcher(script, utxo.Value))
+	if err != nil {
+		t.Fatalf("NewEngine() got error '%v'", err)
+	}
+
+	if err := engine.Execute(); err != nil {
+		t.Fatalf("Execute() got error '%v'", err)
+	}
+}
+
+func TestSignTransaction_TaprootScriptPath(t *testing.T) {
+	decodeHex := func(hexStr string) []byte {
+		b, err := hex.DecodeString(hexStr)
+		if err != nil {
+			panic(err)
+		}
+		return b
+	}
+
+	// Single leaf script tree of the BIP0341 wallet test vectors, with the
+	// leaf <key> OP_CHECKSIG:
+	// https://github.com/bitcoin/bips/blob/master/bip-0341/wallet-test-vectors.json
+	tapLeafScript := decodeHex("20d85a959b0290bf19bb89ed43c916be835475d013da4b362117393e25a48229b8ac")
+	controlBlock := decodeHex("c1187791b6f712a8ea41c8ecdd0ee77fab3e85263b37e1ec18a3651926b3a6cf27")
+	utxoScript := decodeHex("5120147c9c57132f6e7ecddba9800bb0c4449251c92a1e60371ee77557b6620f3ea3")
+
+	// The signature is not verified by SignTransaction, only its length.
+	schnorrSig := bytes.Repeat([]byte{0x01}, schnorr.SignatureSize)
+
+	wrongParity := append([]byte{0xc0}, controlBlock[1:]...)
+	otherLeaf := append(append([]byte{}, tapLeafScript[:len(tapLeafScript)-1]...), txscript.OP_CHECKSIGVERIFY)
+
+	tests := []struct {
+		name          string
+		tapLeafScript []byte
+		controlBlock  []byte
+		utxoScript    []byte
+		wantErr       error
+	}{
+		{
+			name:          "committed tap leaf",
+			tapLeafScript: tapLeafScript,
+			controlBlock:  controlBlock,
+			utxoScript:    utxoScript,
+		},
+		{
+			name:          "without utxo script",
+			tapLeafScript: tapLeafScript,
+			controlBlock:  controlBlock,
+		},
+		{
+			name:          "wrong output key parity",
+			tapLeafScript: tapLeafScript,
+			controlBlock:  wrongParity,
+			utxoScript:    utxoScript,
+			wantErr:       ErrInvalidControlBlock,
+		},
+		{
+			name:          "uncommitted tap leaf",
+			tapLeafScript: otherLeaf,
+			controlBlock:  controlBlock,
+			utxoScript:    utxoScript,
+			wantErr:       ErrInvalidControlBlock,
+		},
+		{
+			name:          "truncated control block",
+			tapLeafScript: tapLeafScript,
+			controlBlock:  controlBlock[:len(controlBlock)-1],
+			wantErr:       ErrInvalidControlBlock,
+		},
+		{
+			name:          "unsupported leaf version",
+			tapLeafScript: tapLeafScript,
+			controlBlock:  append([]byte{0xc3}, controlBlock[1:]...),
+			wantErr:       ErrInvalidControlBlock,
+		},
+	}
+
+	s := &Service{}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			msgTx := wire.NewMsgTx(wire.TxVersion)
+			msgTx.AddTxIn(wire.NewTxIn(
+				wire.NewOutPoint(btcutil.NewTx(wire.NewMsgTx(1)).Hash(), 0),
+				nil,
+				nil,
+			))
+			msgTx.AddTxOut(wire.NewTxOut(90000, utxoScript))
+
+			_, err := s.SignTransaction(msgTx, chaincfg.BitcoinMainNetParams, []SignatureMetadata{
+				{
+					DerSig:        schnorrSig,
+					AddrEncoding:  Taproot,
+					UtxoScript:    tt.utxoScript,
+					TapLeafScript: tt.tapLeafScript,
+					ControlBlock:  tt.controlBlock,
+				},
+			})
+			if errors.Cause(err) != tt.wantErr {
+				t.Fatalf("SignTransaction() got error '%v', want '%v'", err, tt.wantErr)
+			}
+
+			if tt.wantErr != nil {
+				return
+			}
+
+			wantWitness := wire.TxWitness{schnorrSig, tt.tapLeafScript, tt.controlBlock}
+			if !reflect.DeepEqual(msgTx.TxIn[0].Witness, wantWitness) {
+				t.Fatalf("SignTransaction() got witness %x, want %x",
+					msgTx.TxIn[0].Witness, wantWitness)
+			}
+
+			if len(msgTx.TxIn[0].SignatureScript) != 0 {
+				t.Fatalf("SignTransaction() got sigScript %x, want none",
+					msgTx.TxIn[0].SignatureScript)
+			}
+		})
+	}
+}
+
+func TestGenerateDerSignatures_TaprootScriptPath(t *testing.T) {
+	// BIP0032: Test Vector 1 (chain m)
+	privKey := "xprv9s21ZrQH143K3QTDL4LXw2F7HEK3wJUD2nW2nRk4stbPy6cq3jPPqjiChkVvvNKmPGJxWUtg6LnF5kejMRNNU3TGtRBeJgk33yuGBxrMPHi"
+
+	s := &Service{}
+
+	keyMaterial, err := s.DerivePrivateKey(privKey, []uint32{0})
+	if err != nil {
+		t.Fatalf("DerivePrivateKey() got error '%v'", err)
+	}
+
+	pubKey, err := btcec.ParsePubKey(keyMaterial.PublicKey)
+	if err != nil {
+		t.Fatalf("ParsePubKey() got error '%v'", err)
+	}
+
+	// Single leaf <key> OP_CHECKSIG, committed to by the BIP0341 NUMS point,
+	// so that the output can only be spent using the script path.
+	tapLeafScript, _ := txscript.NewScriptBuilder().
+		AddData(schnorr.SerializePubKey(pubKey)).AddOp(txscript.OP_CHECKSIG).Script()
+	nums, _ := hex.DecodeString("50929b74c1a04954b78b4b6035e97a5e078a5a0f28ec96d547bfee9ace803ac0")
+
+	address, err := s.EncodeTaprootScriptAddress(
+		nums, [][]byte{tapLeafScript}, chaincfg.BitcoinMainNetParams)
+	if err != nil {
+		t.Fatalf("EncodeTaprootScriptAddress() got error '%v'", err)
+	}
+
+	utxoScript := append([]byte{txscript.OP_1, txscript.OP_DATA_32}, address.OutputKey...)
+
+	msgTx := wire.NewMsgTx(wire.TxVersion)
+	msgTx.AddTxIn(wire.NewTxIn(
+		wire.NewOutPoint(btcutil.NewTx(wire.NewMsgTx(1)).Hash(), 0),
+		nil,
+		nil,
+	))
+	msgTx.AddTxOut(wire.NewTxOut(90000, utxoScript))
+
+	utxos := []Utxo{
+		{Script: utxoScript, Value: 100000, Derivation: []uint32{0}, TapLeafScript: tapLeafScript},
+	}
+
+	derSignatures, err := s.GenerateDerSignatures(msgTx, utxos, privKey, false)
+	if err != nil {
+		t.Fatalf("GenerateDerSignatures() got error '%v'", err)
+	}
+
+	_, err = s.SignTransaction(msgTx, chaincfg.BitcoinMainNetParams, []SignatureMetadata{
+		{
+			DerSig:        derSignatures[0],
+			AddrEncoding:  Taproot,
+			UtxoScript:    utxoScript,
+			TapLeafScript: tapLeafScript,
+			ControlBlock:  address.ControlBlocks[0],
+		},
+	})
+	if err != nil {
+		t.Fatalf("SignTransaction() got error '%v'", err)
+	}
+
+	if failures := verifyInputs(msgTx, utxos); len(failures) > 0 {
+		t.Fatalf("verifyInputs() unexpected failures: %+v", failures)
+	}
+
+	// The signature hash prepared for hardware wallets is the one signed.
+	inputs, err := s.PrepareForHardwareSigning(msgTx, utxos, chaincfg.BitcoinMainNetParams)
+	if err != nil {
+		t.Fatalf("PrepareForHardwareSigning() got error '%v'", err)
+	}
+
+	schnorrSig, err := schnorr.ParseSignature(derSignatures[0])
+	if err != nil {
+		t.Fatalf("ParseSignature() got error '%v'", err)
+	}
+
+	if !schnorrSig.Verify(inputs[0].SigHash, pubKey) {
+		t.Fatalf("PrepareForHardwareSigning() got sighash %x, not signed by GenerateDerSignatures",
+			inputs[0].SigHash)
+	}
+
+	// The key at m/1 is not pushed by the tap leaf script.
+	utxos[0].Derivation = []uint32{1}
+
+	_, err = s.GenerateDerSignatures(msgTx, utxos, privKey, false)
+	if errors.Cause(err) != ErrPublicKeyMismatch {
+		t.Fatalf("GenerateDerSignatures() got error '%v', want '%v'", err, ErrPublicKeyMismatch)
+	}
+}
+
+func TestSignTransaction_NonCanonicalSignatures(t *testing.T) {
+	// BIP0032: Test Vector 1 (chain m)
+	privKey := "xprv9s21ZrQH143K3QTDL4LXw2F7HEK3wJUD2nW2nRk4stbPy6cq3jPPqjiChkVvvNKmPGJxWUtg6LnF5kejMRNNU3TGtRBeJgk33yuGBxrMPHi"
+
+	s := &Service{}
+
+	keyMaterial, err := s.DerivePrivateKey(privKey, []uint32{0})
+	if err != nil {
+		t.Fatalf("DerivePrivateKey() got error '%v'", err)
+	}
+
+	pubKey, err := btcec.ParsePubKey(keyMaterial.PublicKey)
+	if err != nil {
+		t.Fatalf("ParsePubKey() got error '%v'", err)
+	}
+
+	newMsgTx := func() *wire.MsgTx {
+		msgTx := wire.NewMsgTx(wire.TxVersion)
+		for idx := uint32(0); idx < 2; idx++ {
+			msgTx.AddTxIn(wire.NewTxIn(
+				wire.NewOutPoint(btcutil.NewTx(wire.NewMsgTx(1)).Hash(), idx),
+				nil,
+				nil,
+			))
+		}
+		return msgTx
+	}
+
+	privateKey, _ := btcec.PrivKeyFromBytes(keyMaterial.PrivateKey)
+
+	ecSig := ecdsa.Sign(privateKey, chainhash.DoubleHashB([]byte("message")))
+
+	// Serialize the signature in strict DER, without normalizing S, unlike
+	// ecdsa.Signature.Serialize.
+	serializeDER := func(r, s *big.Int) []byte {
+		encodeInt := func(v *big.Int) []byte {
+			b := v.Bytes()
+			if b[0]&0x80 != 0 {
+				b = append([]byte{0x00}, b...)
+			}
+			return append([]byte{0x02, byte(len(b))}, b...)
+		}
+
+		body := append(encodeInt(r), encodeInt(s)...)
+		return append([]byte{0x30, byte(len(body))}, body...)
+	}
+
+	r, highS := ecSig.R(), ecSig.S()
+	highS.Negate()
+
+	validSig := append(ecSig.Serialize(), byte(txscript.SigHashAll))
+	highSSig := append(serializeDER(scalarToInt(r), scalarToInt(highS)),
+		byte(txscript.SigHashAll))
+
+	tests := []struct {
+		name     string
+		derSig   DerSignature
+		encoding AddressEncoding
+		wantErr  bool
+	}{
+		{
+			name:     "canonical signature",
+			derSig:   validSig,
+			encoding: NativeSegwit,
+		},
+		{
+			name:     "high S value",
+			derSig:   highSSig,
+			encoding: NativeSegwit,
+			wantErr:  true,
+		},
+		{
+			name:     "truncated DER",
+			derSig:   validSig[:len(validSig)-5],
+			encoding: NativeSegwit,
+			wantErr:  true,
+		},
+		{
+			name:     "trailing garbage",
+			derSig:   append(append([]byte{}, validSig[:len(validSig)-1]...), 0x00, byte(txscript.SigHashAll)),
+			encoding: Legacy,
+			wantErr:  true,
+		},
+		{
+			name:     "undefined hash type",
+			derSig:   append(append([]byte{}, validSig[:len(validSig)-1]...), 0x04),
+			encoding: WrappedSegwit,
+			wantErr:  true,
+		},
+		{
+			name:     "empty signature",
+			derSig:   nil,
+			encoding: NativeSegwit,
+			wantErr:  true,
+		},
+		{
+			name:     "schnorr signature with invalid length",
+			derSig:   make([]byte, 63),
+			encoding: Taproot,
+			wantErr:  true,
+		},
+		{
+			name:     "schnorr signature with explicit hash type",
+			derSig:   append(make([]byte, schnorr.SignatureSize), byte(txscript.SigHashAll)),
+			encoding: Taproot,
+		},
+		{
+			name:     "schnorr signature with anyonecanpay hash type",
+			derSig:   append(make([]byte, schnorr.SignatureSize), 0x83),
+			encoding: Taproot,
+		},
+		{
+			name:     "schnorr signature with default hash type",
+			derSig:   append(make([]byte, schnorr.SignatureSize), 0x00),
+			encoding: Taproot,
+			wantErr:  true,
+		},
+		{
+			name:     "schnorr signature with undefined hash type",
+			derSig:   append(make([]byte, schnorr.SignatureSize), 0x04),
+			encoding: Taproot,
+			wantErr:  true,
+		},
+		{
+			name:     "schnorr signature with anyonecanpay only",
+			derSig:   append(make([]byte, schnorr.SignatureSize), 0x80),
+			encoding: Taproot,
+			wantErr:  true,
+		},
+		{
+			name:     "schnorr signature with invalid hash type",
+			derSig:   append(make([]byte, schnorr.SignatureSize), 0xff),
+			encoding: Taproot,
+			wantErr:  true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// The offending signature is always at input 1.
+			_, err := s.SignTransaction(newMsgTx(), chaincfg.BitcoinMainNetParams, []SignatureMetadata{
+				{DerSig: validSig, PubKey: pubKey, AddrEncoding: NativeSegwit},
+				{DerSig: tt.derSig, PubKey: pubKey, AddrEncoding: tt.encoding},
+			})
+
+			if !tt.wantErr {
+				if err != nil {
+					t.Fatalf("SignTransaction() got error '%v'", err)
+				}
+
+				return
+			}
+
+			if errors.Cause(err) != ErrNonCanonicalSignature {
+				t.Fatalf("SignTransaction() got error '%v', want '%v'",
+					err, ErrNonCanonicalSignature)
+			}
+
+			if !strings.HasPrefix(err.Error(), "input 1: ") {
+				t.Fatalf("SignTransaction() got error '%v', want input 1", err)
+			}
+		})
+	}
+}
+
+// scalarToInt converts a scalar modulo the order of secp256k1 to an integer.
+func scalarToInt(v btcec.ModNScalar) *big.Int {
+	b := v.Bytes()
+	return new(big.Int).SetBytes(b[:])
+}
+
+func TestValidateDerSignature(t *testing.T) {
+	privateKey, _ := btcec.PrivKeyFromBytes(bytes.Repeat([]byte{0x01}, 32))
+
+	ecSig := ecdsa.Sign(privateKey, chainhash.DoubleHashB([]byte("message")))
+
+	// Serialize the signature in strict DER with the high S value, which
+	// ecdsa.Signature.Serialize would normalize.
+	encodeInt := func(v *big.Int) []byte {
+		b := v.Bytes()
+		if b[0]&0x80 != 0 {
+			b = append([]byte{0x00}, b...)
+		}
+		return append([]byte{0x02, byte(len(b))}, b...)
+	}
+
+	r, highS := ecSig.R(), ecSig.S()
+	highS.Negate()
+
+	highSBody := append(encodeInt(scalarToInt(r)), encodeInt(scalarToInt(highS))...)
+	highSSig := append([]byte{0x30, byte(len(highSBody))}, highSBody...)
+
+	validSig := ecSig.Serialize()
+
+	// Negative R value, i.e. without the leading 0x00 of a DER integer with
+	// the highest bit set.
+	negativeR := []byte{0x30, 0x06, 0x02, 0x01, 0x80, 0x02, 0x01, 0x01}
+
+	tests := []struct {
+		name    string
+		der     []byte
+		wantErr bool
+	}{
+		{
+			name: "low S signature",
+			der:  validSig,
+		},
+		{
+			name:    "high S signature",
+			der:     highSSig,
+			wantErr: true,
+		},
+		{
+			name:    "truncated DER",
+			der:     validSig[:len(validSig)-5],
+			wantErr: true,
+		},
+		{
+			name:    "trailing bytes",
+			der:     append(append([]byte{}, validSig...), 0x00),
+			wantErr: true,
+		},
+		{
+			name:    "negative R value",
+			der:     negativeR,
+			wantErr: true,
+		},
+		{
+			name:    "empty signature",
+			der:     nil,
+			wantErr: true,
+		},
+	}
+
+	s := &Service{}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := s.ValidateDerSignature(tt.der); (err != nil) != tt.wantErr {
+				t.Fatalf("ValidateDerSignature() got error '%v', want error %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestNormalizeSignatureLowS(t *testing.T) {
+	// Signature of SHA256("bitcoin-lib-grpc") by the private key 1, with its
+	// low S value, and with the high S value N - S.
+	hash, _ := hex.DecodeString("1f9472771aeb891948049b86ba6fe0cff988529bf1f139ed15bc1d371ecb54b9")
+	lowSSig, _ := hex.DecodeString("3045022100ef5624c101d8357fee50fff9807602c961741123d15d404475bf9f246eadab08" +
+		"02203500cf9c61881cbcac99a0948db20ccaf270a0de43b0923408fe425cbf899c02")
+	highSSig, _ := hex.DecodeString("3046022100ef5624c101d8357fee50fff9807602c961741123d15d404475bf9f246eadab08" +
+		"022100caff30639e77e34353665f6b724df333c83e3c086b980e07b6d41c3010aca53f")
+
+	_, publicKey := btcec.PrivKeyFromBytes([]byte{0x01})
+
+	tests := []struct {
+		name    string
+		der     []byte
+		want    []byte
+		wantErr bool
+	}{
+		{
+			name: "high S signature",
+			der:  highSSig,
+			want: lowSSig,
+		},
+		{
+			name: "low S signature",
+			der:  lowSSig,
+			want: lowSSig,
+		},
+		{
+			name:    "trailing bytes",
+			der:     append(append([]byte{}, highSSig...), 0x00),
+			wantErr: true,
+		},
+		{
+			name:    "empty signature",
+			der:     nil,
+			wantErr: true,
+		},
+	}
+
+	s := &Service{}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := s.NormalizeSignatureLowS(tt.der)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("NormalizeSignatureLowS() got error '%v', want error %v", err, tt.wantErr)
+			}
+
+			if !bytes.Equal(got, tt.want) {
+				t.Fatalf("NormalizeSignatureLowS() got %x, want %x", got, tt.want)
+			}
+
+			if tt.wantErr {
+				return
+			}
+
+			if err := s.ValidateDerSignature(got); err != nil {
+				t.Fatalf("ValidateDerSignature() got error '%v'", err)
+			}
+
+			ecSig, err := ecdsa.ParseDERSignature(got)
+			if err != nil {
+				t.Fatalf("ParseDERSignature() got error '%v'", err)
+			}
+
+			if !ecSig.Verify(hash, publicKey) {
+				t.Fatalf("NormalizeSignatureLowS() got signature %x not verifying", got)
+			}
+		})
+	}
+}
+
+func TestSignTransaction_NormalizeLowS(t *testing.T) {
+	// BIP0032: Test Vector 1 (chain m)
+	privKey := "xprv9s21ZrQH143K3QTDL4LXw2F7HEK3wJUD2nW2nRk4stbPy6cq3jPPqjiChkVvvNKmPGJxWUtg6LnF5kejMRNNU3TGtRBeJgk33yuGBxrMPHi"
+
+	s := &Service{}
+
+	keyMaterial, err := s.DerivePrivateKey(privKey, []uint32{0})
+	if err != nil {
+		t.Fatalf("DerivePrivateKey() got error '%v'", err)
+	}
+
+	pubKey, err := btcec.ParsePubKey(keyMaterial.PublicKey)
+	if err != nil {
+		t.Fatalf("ParsePubKey() got error '%v'", err)
+	}
+
+	address, err := addressFromPublicKey(pubKey, NativeSegwit, chaincfg.BitcoinMainNetParams)
+	if err != nil {
+		t.Fatalf("addressFromPublicKey() got error '%v'", err)
+	}
+
+	script, err := txscript.PayToAddrScript(address)
+	if err != nil {
+		t.Fatalf("PayToAddrScript() got error '%v'", err)
+	}
+
+	msgTx := wire.NewMsgTx(wire.TxVersion)
+	msgTx.AddTxIn(wire.NewTxIn(
+		wire.NewOutPoint(btcutil.NewTx(wire.NewMsgTx(1)).Hash(), 0),
+		nil,
+		nil,
+	))
+	msgTx.AddTxOut(wire.NewTxOut(90000, script))
+
+	utxo := Utxo{Script: script, Value: 100000, Derivation: []uint32{0}}
+
+	derSignatures, err := s.GenerateDerSignatures(msgTx, []Utxo{utxo}, privKey, false)
+	if err != nil {
+		t.Fatalf("GenerateDerSignatures() got error '%v'", err)
+	}
+
+	// Replace the S value of the signature by N - S, as returned by some
+	// HSMs, keeping the signature hash type.
+	derSig := derSignatures[0]
+
+	ecSig, err := ecdsa.ParseDERSignature(derSig[:len(derSig)-1])
+	if err != nil {
+		t.Fatalf("ParseDERSignature() got error '%v'", err)
+	}
+
+	encodeInt := func(v *big.Int) []byte {
+		b := v.Bytes()
+		if b[0]&0x80 != 0 {
+			b = append([]byte{0x00}, b...)
+		}
+		return append([]byte{0x02, byte(len(b))}, b...)
+	}
+
+	r, highS := ecSig.R(), ecSig.S()
+	highS.Negate()
+
+	highSBody := append(encodeInt(scalarToInt(r)), encodeInt(scalarToInt(highS))...)
+	highSSig := append([]byte{0x30, byte(len(highSBody))}, highSBody...)
+	highSSig = append(highSSig, derSig[len(derSig)-1])
+
+	_, err = s.SignTransaction(msgTx, chaincfg.BitcoinMainNetParams, []SignatureMetadata{
+		{DerSig: highSSig, PubKey: pubKey, AddrEncoding: NativeSegwit},
+	})
+	if errors.Cause(err) != ErrNonCanonicalSignature {
+		t.Fatalf("SignTransaction() got error '%v', want '%v'", err, ErrNonCanonicalSignature)
+	}
+
+	_, err = s.SignTransaction(msgTx, chaincfg.BitcoinMainNetParams, []SignatureMetadata{
+		{DerSig: highSSig, PubKey: pubKey, AddrEncoding: NativeSegwit, NormalizeLowS: true},
+	})
+	if err != nil {
+		t.Fatalf("SignTransaction() got error '%v'", err)
+	}
+
+	if witnessSig := msgTx.TxIn[0].Witness[0]; !bytes.Equal(witnessSig, derSig) {
+		t.Fatalf("SignTransaction() got witness signature %x, want %x", witnessSig, derSig)
+	}
+
+	prevOuts := txscript.NewCannedPrevOutputFetcher(script, utxo.Value)
+	sigHashes := txscript.NewTxSigHashes(msgTx, prevOuts)
+
+	engine, err := txscript.NewEngine(script, msgTx, 0, txscript.StandardVerifyFlags, nil, sigHashes, utxo.Value,
+		prevOuts)
+	if err != nil {
+		t.Fatalf("NewEngine() got error '%v'", err)
+	}
+
+	if err := engine.Execute(); err != nil {
+		t.Fatalf("Execute() got error '%v'", err)
+	}
+}
+
+func TestSignTransaction_AddressEncodingMismatch(t *testing.T) {
+	// BIP0032: Test Vector 1 (chain m)
+	privKey := "xprv9s21ZrQH143K3QTDL4LXw2F7HEK3wJUD2nW2nRk4stbPy6cq3jPPqjiChkVvvNKmPGJxWUtg6LnF5kejMRNNU3TGtRBeJgk33yuGBxrMPHi"
+
+	s := &Service{}
+
+	keyMaterial, err := s.DerivePrivateKey(privKey, []uint32{0})
+	if err != nil {
+		t.Fatalf("DerivePrivateKey() got error '%v'", err)
+	}
+
+	pubKey, err := btcec.ParsePubKey(keyMaterial.PublicKey)
+	if err != nil {
+		t.Fatalf("ParsePubKey() got error '%v'", err)
+	}
+
+	// Helper to build the output script of the address of the public key.
+	getScript := func(encoding AddressEncoding) []byte {
+		address, err := addressFromPublicKey(pubKey, encoding, chaincfg.BitcoinMainNetParams)
+		if err != nil {
+			panic(err)
+		}
+
+		script, err := txscript.PayToAddrScript(address)
+		if err != nil {
+			panic(err)
+		}
+
+		return script
+	}
+
+	privateKey, _ := btcec.PrivKeyFromBytes(keyMaterial.PrivateKey)
+
+	ecSig := ecdsa.Sign(privateKey, chainhash.DoubleHashB([]byte("message")))
+
+	derSig := append(ecSig.Serialize(), byte(txscript.SigHashAll))
+
+	tests := []struct {
+		name       string
+		utxoScript []byte
+		encoding   AddressEncoding
+		wantErr    error
+	}{
+		{
+			name:       "P2PKH",
+			utxoScript: getScript(Legacy),
+			encoding:   Legacy,
+		},
+		{
+			name:       "P2PKH declared as P2WPKH",
+			utxoScript: getScript(Legacy),
+			encoding:   NativeSegwit,
+			wantErr:    ErrAddressEncodingMismatch,
+		},
+		{
+			name:       "P2SH-P2WPKH",
+			utxoScript: getScript(WrappedSegwit),
+			encoding:   WrappedSegwit,
+		},
+		{
+			name:       "P2SH-P2WPKH declared as P2WPKH",
+			utxoScript: getScript(WrappedSegwit),
+			encoding:   NativeSegwit,
+			wantErr:    ErrAddressEncodingMismatch,
+		},
+		{
+			name:       "P2WPKH",
+			utxoScript: getScript(NativeSegwit),
+			encoding:   NativeSegwit,
+		},
+		{
+			name:       "P2WPKH declared as P2SH-P2WPKH",
+			utxoScript: getScript(NativeSegwit),
+			encoding:   WrappedSegwit,
+			wantErr:    ErrAddressEncodingMismatch,
+		},
+		{
+			name:       "P2WPKH declared as P2PKH",
+			utxoScript: getScript(NativeSegwit),
+			encoding:   Legacy,
+			wantErr:    ErrAddressEncodingMismatch,
+		},
+		{
+			name:       "unsupported script",
+			utxoScript: []byte{txscript.OP_RETURN},
+			encoding:   Legacy,
+			wantErr:    ErrUnknownAddressType,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			msgTx := wire.NewMsgTx(wire.TxVersion)
+			msgTx.AddTxIn(wire.NewTxIn(
+				wire.NewOutPoint(btcutil.NewTx(wire.NewMsgTx(1)).Hash(), 0),
+				nil,
+				nil,
+			))
+
+			_, err := s.SignTransaction(msgTx, chaincfg.BitcoinMainNetParams, []SignatureMetadata{
+				{
+					DerSig:       derSig,
+					PubKey:       pubKey,
+					AddrEncoding: tt.encoding,
+					UtxoScript:   tt.utxoScript,
+				},
+			})
+			if errors.Cause(err) != tt.wantErr {
+				t.Fatalf("SignTransaction() got error '%v', want '%v'", err, tt.wantErr)
 			}
 		})
 	}
@@ -0,0 +1,96 @@
+package core
+
+import (
+	"github.com/btcsuite/btcd/btcutil"
+	"github.com/ledgerhq/bitcoin-lib-grpc/pkg/chaincfg"
+	"github.com/pkg/errors"
+)
+
+// ImportedKey contains the key material and the standard addresses of a
+// private key imported from the Wallet Import Format (WIF).
+type ImportedKey struct {
+	// PrivateKey is the 32-byte raw private key.
+	PrivateKey []byte
+
+	// PublicKey is the serialized public key, compressed or uncompressed
+	// according to the compression flag of the WIF.
+	PublicKey []byte
+
+	// Compressed indicates whether the WIF is for a compressed public key.
+	Compressed bool
+
+	// LegacyAddress is the P2PKH address of PublicKey.
+	LegacyAddress string
+
+	// NativeSegwitAddress is the P2WPKH address of PublicKey. It is empty
+	// for uncompressed public keys, which cannot be used in segwit outputs.
+	NativeSegwitAddress string
+}
+
+// References:
+//   [Bitcoin Wiki]: Wallet import format
+//   https://en.bitcoin.it/wiki/Wallet_import_format
+
+// ImportWIF decodes a private key in Wallet Import Format, and returns its
+// public key and the corresponding addresses.
+//
+// The WIF must be encoded for the network of the given chain parameters.
+func (s *Service) ImportWIF(wif string, chainParams chaincfg.ChainParams) (*ImportedKey, error) {
+	decodedWIF, err := btcutil.DecodeWIF(wif)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to decode WIF")
+	}
+
+	if !decodedWIF.IsForNet(chainParams) {
+		return nil, errors.Wrapf(ErrNetworkMismatch,
+			"WIF is not for network %s", chainParams.Name)
+	}
+
+	publicKey := decodedWIF.SerializePubKey()
+
+	legacyAddress, err := btcutil.NewAddressPubKeyHash(
+		btcutil.Hash160(publicKey), chainParams)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to encode P2PKH address")
+	}
+
+	key := &ImportedKey{
+		PrivateKey:    decodedWIF.PrivKey.Serialize(),
+		PublicKey:     publicKey,
+		Compressed:    decodedWIF.CompressPubKey,
+		LegacyAddress: legacyAddress.EncodeAddress(),
+	}
+
+	if decodedWIF.CompressPubKey {
+		nativeSegwitAddress, err := btcutil.NewAddressWitnessPubKeyHash(
+			btcutil.Hash160(publicKey), chainParams)
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to encode P2WPKH address")
+		}
+
+		key.NativeSegwitAddress = nativeSegwitAddress.EncodeAddress()
+	}
+
+	return key, nil
+}
+
+// ExportWIF encodes a 32-byte raw private key in Wallet Import Format, for
+// the network of the given chain parameters.
+//
+// The compressed flag indicates whether the public key of privKey must be
+// serialized in compressed form, when deriving addresses from the WIF.
+func (s *Service) ExportWIF(
+	privKey []byte, compressed bool, chainParams chaincfg.ChainParams,
+) (string, error) {
+	ecPrivKey, err := parseScalarKey(ScalarKey{PrivateKey: privKey})
+	if err != nil {
+		return "", err
+	}
+
+	wif, err := btcutil.NewWIF(ecPrivKey, chainParams, compressed)
+	if err != nil {
+		return "", errors.Wrap(err, "failed to encode WIF")
+	}
+
+	return wif.String(), nil
+}
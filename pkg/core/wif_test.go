@@ -0,0 +1,206 @@
+package core
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/ledgerhq/bitcoin-lib-grpc/pkg/chaincfg"
+	"github.com/pkg/errors"
+)
+
+// wifPrivateKey is the secp256k1 private key 1, whose public key is the
+// generator point G.
+var wifPrivateKey = []byte{
+	0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00,
+	0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00,
+	0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00,
+	0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x01,
+}
+
+var wifCompressedPublicKey = []byte{
+	0x02, 0x79, 0xbe, 0x66, 0x7e, 0xf9, 0xdc, 0xbb,
+	0xac, 0x55, 0xa0, 0x62, 0x95, 0xce, 0x87, 0x0b,
+	0x07, 0x02, 0x9b, 0xfc, 0xdb, 0x2d, 0xce, 0x28,
+	0xd9, 0x59, 0xf2, 0x81, 0x5b, 0x16, 0xf8, 0x17,
+	0x98,
+}
+
+var wifUncompressedPublicKey = []byte{
+	0x04, 0x79, 0xbe, 0x66, 0x7e, 0xf9, 0xdc, 0xbb,
+	0xac, 0x55, 0xa0, 0x62, 0x95, 0xce, 0x87, 0x0b,
+	0x07, 0x02, 0x9b, 0xfc, 0xdb, 0x2d, 0xce, 0x28,
+	0xd9, 0x59, 0xf2, 0x81, 0x5b, 0x16, 0xf8, 0x17,
+	0x98, 0x48, 0x3a, 0xda, 0x77, 0x26, 0xa3, 0xc4,
+	0x65, 0x5d, 0xa4, 0xfb, 0xfc, 0x0e, 0x11, 0x08,
+	0xa8, 0xfd, 0x17, 0xb4, 0x48, 0xa6, 0x85, 0x54,
+	0x19, 0x9c, 0x47, 0xd0, 0x8f, 0xfb, 0x10, 0xd4,
+	0xb8,
+}
+
+func TestImportWIF(t *testing.T) {
+	tests := []struct {
+		name        string
+		wif         string
+		chainParams chaincfg.ChainParams
+		want        *ImportedKey
+		wantErr     error
+	}{
+		{
+			name:        "mainnet compressed",
+			wif:         "KwDiBf89QgGbjEhKnhXJuH7LrciVrZi3qYjgd9M7rFU73sVHnoWn",
+			chainParams: chaincfg.BitcoinMainNetParams,
+			want: &ImportedKey{
+				PrivateKey:          wifPrivateKey,
+				PublicKey:           wifCompressedPublicKey,
+				Compressed:          true,
+				LegacyAddress:       "1BgGZ9tcN4rm9KBzDn7KprQz87SZ26SAMH",
+				NativeSegwitAddress: "bc1qw508d6qejxtdg4y5r3zarvary0c5xw7kv8f3t4",
+			},
+		},
+		{
+			name:        "mainnet uncompressed",
+			wif:         "5HpHagT65TZzG1PH3CSu63k8DbpvD8s5ip4nEB3kEsreAnchuDf",
+			chainParams: chaincfg.BitcoinMainNetParams,
+			want: &ImportedKey{
+				PrivateKey:    wifPrivateKey,
+				PublicKey:     wifUncompressedPublicKey,
+				Compressed:    false,
+				LegacyAddress: "1EHNa6Q4Jz2uvNExL497mE43ikXhwF6kZm",
+			},
+		},
+		{
+			name:        "testnet3 compressed",
+			wif:         "cMahea7zqjxrtgAbB7LSGbcQUr1uX1ojuat9jZodMN87JcbXMTcA",
+			chainParams: chaincfg.BitcoinTestNet3Params,
+			want: &ImportedKey{
+				PrivateKey:          wifPrivateKey,
+				PublicKey:           wifCompressedPublicKey,
+				Compressed:          true,
+				LegacyAddress:       "mrCDrCybB6J1vRfbwM5hemdJz73FwDBC8r",
+				NativeSegwitAddress: "tb1qw508d6qejxtdg4y5r3zarvary0c5xw7kxpjzsx",
+			},
+		},
+		{
+			name:        "testnet3 uncompressed",
+			wif:         "91avARGdfge8E4tZfYLoxeJ5sGBdNJQH4kvjJoQFacbgwmaKkrx",
+			chainParams: chaincfg.BitcoinTestNet3Params,
+			want: &ImportedKey{
+				PrivateKey:    wifPrivateKey,
+				PublicKey:     wifUncompressedPublicKey,
+				Compressed:    false,
+				LegacyAddress: "mtoKs9V381UAhUia3d7Vb9GNak8Qvmcsme",
+			},
+		},
+		{
+			name:        "mainnet WIF on testnet3",
+			wif:         "KwDiBf89QgGbjEhKnhXJuH7LrciVrZi3qYjgd9M7rFU73sVHnoWn",
+			chainParams: chaincfg.BitcoinTestNet3Params,
+			wantErr:     ErrNetworkMismatch,
+		},
+		{
+			name:        "testnet3 WIF on mainnet",
+			wif:         "cMahea7zqjxrtgAbB7LSGbcQUr1uX1ojuat9jZodMN87JcbXMTcA",
+			chainParams: chaincfg.BitcoinMainNetParams,
+			wantErr:     ErrNetworkMismatch,
+		},
+	}
+
+	s := &Service{}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := s.ImportWIF(tt.wif, tt.chainParams)
+			if err != nil && errors.Cause(err) != tt.wantErr {
+				t.Fatalf("ImportWIF() unexpected error = %v", err)
+			}
+
+			if err == nil && tt.wantErr != nil {
+				t.Fatalf("ImportWIF() got no error, want %v", tt.wantErr)
+			}
+
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Fatalf("ImportWIF() got = %v, want %v", got, tt.want)
+			}
+		})
+	}
+
+	t.Run("invalid checksum", func(t *testing.T) {
+		if _, err := s.ImportWIF(
+			"KwDiBf89QgGbjEhKnhXJuH7LrciVrZi3qYjgd9M7rFU73sVHnoWo",
+			chaincfg.BitcoinMainNetParams,
+		); err == nil {
+			t.Fatalf("ImportWIF() got no error for invalid checksum")
+		}
+	})
+}
+
+func TestExportWIF(t *testing.T) {
+	tests := []struct {
+		name        string
+		privKey     []byte
+		compressed  bool
+		chainParams chaincfg.ChainParams
+		want        string
+		wantErr     error
+	}{
+		{
+			name:        "mainnet compressed",
+			privKey:     wifPrivateKey,
+			compressed:  true,
+			chainParams: chaincfg.BitcoinMainNetParams,
+			want:        "KwDiBf89QgGbjEhKnhXJuH7LrciVrZi3qYjgd9M7rFU73sVHnoWn",
+		},
+		{
+			name:        "mainnet uncompressed",
+			privKey:     wifPrivateKey,
+			compressed:  false,
+			chainParams: chaincfg.BitcoinMainNetParams,
+			want:        "5HpHagT65TZzG1PH3CSu63k8DbpvD8s5ip4nEB3kEsreAnchuDf",
+		},
+		{
+			name:        "testnet3 compressed",
+			privKey:     wifPrivateKey,
+			compressed:  true,
+			chainParams: chaincfg.BitcoinTestNet3Params,
+			want:        "cMahea7zqjxrtgAbB7LSGbcQUr1uX1ojuat9jZodMN87JcbXMTcA",
+		},
+		{
+			name:        "testnet3 uncompressed",
+			privKey:     wifPrivateKey,
+			compressed:  false,
+			chainParams: chaincfg.BitcoinTestNet3Params,
+			want:        "91avARGdfge8E4tZfYLoxeJ5sGBdNJQH4kvjJoQFacbgwmaKkrx",
+		},
+		{
+			name:        "invalid length",
+			privKey:     wifPrivateKey[1:],
+			chainParams: chaincfg.BitcoinMainNetParams,
+			wantErr:     ErrInvalidPrivateKey,
+		},
+		{
+			name:        "zero scalar",
+			privKey:     make([]byte, 32),
+			chainParams: chaincfg.BitcoinMainNetParams,
+			wantErr:     ErrInvalidPrivateKey,
+		},
+	}
+
+	s := &Service{}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := s.ExportWIF(tt.privKey, tt.compressed, tt.chainParams)
+			if err != nil && errors.Cause(err) != tt.wantErr {
+				t.Fatalf("ExportWIF() unexpected error = %v", err)
+			}
+
+			if err == nil && tt.wantErr != nil {
+				t.Fatalf("ExportWIF() got no error, want %v", tt.wantErr)
+			}
+
+			if got != tt.want {
+				t.Fatalf("ExportWIF() got = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}